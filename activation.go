@@ -1,6 +1,11 @@
 package deep
 
-import "math"
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+)
 
 // Mode denotes inference mode
 type Mode int
@@ -16,8 +21,16 @@ const (
 	ModeBinary Mode = 3
 	// ModeMultiLabel is for multilabel classification, applies sigmoid output layer
 	ModeMultiLabel Mode = 4
+	// ModePositiveRegression is regression of strictly positive values,
+	// applies softplus output layer
+	ModePositiveRegression Mode = 5
 )
 
+// known reports whether m is one of the modes above
+func (m Mode) known() bool {
+	return m >= ModeDefault && m <= ModePositiveRegression
+}
+
 // OutputActivation returns activation corresponding to prediction mode
 func OutputActivation(c Mode) ActivationType {
 	switch c {
@@ -27,12 +40,31 @@ func OutputActivation(c Mode) ActivationType {
 		return ActivationLinear
 	case ModeBinary, ModeMultiLabel:
 		return ActivationSigmoid
+	case ModePositiveRegression:
+		return ActivationSoftplus
 	}
 	return ActivationNone
 }
 
-// GetActivation returns the concrete activation given an ActivationType
+// GetActivation returns the concrete activation given an ActivationType,
+// with default parameters
 func GetActivation(act ActivationType) Differentiable {
+	return ActivationParams{}.Activation(act)
+}
+
+// ActivationParams holds the parameters of parameterized activations,
+// where zero values take the defaults
+type ActivationParams struct {
+	// LeakySlope is the negative slope of ActivationLeakyReLU, default 0.01
+	LeakySlope float64
+	// ELUAlpha is the negative saturation of ActivationELU, default 1
+	ELUAlpha float64
+	// SwishBeta scales the input to the sigmoid of ActivationSwish, default 1
+	SwishBeta float64
+}
+
+// Activation returns the concrete activation given an ActivationType
+func (p ActivationParams) Activation(act ActivationType) Differentiable {
 	switch act {
 	case ActivationSigmoid:
 		return Sigmoid{}
@@ -44,10 +76,40 @@ func GetActivation(act ActivationType) Differentiable {
 		return Linear{}
 	case ActivationSoftmax:
 		return Linear{}
+	case ActivationExp:
+		return Exp{}
+	case ActivationLeakyReLU:
+		return LeakyReLU{Slope: fdefault(p.LeakySlope, 0.01)}
+	case ActivationELU:
+		return ELU{Alpha: fdefault(p.ELUAlpha, 1)}
+	case ActivationSELU:
+		return SELU{}
+	case ActivationGELU:
+		return GELU{}
+	case ActivationSwish:
+		return Swish{Beta: fdefault(p.SwishBeta, 1)}
+	case ActivationSoftplus:
+		return Softplus{}
+	case ActivationPReLU:
+		return PReLU{Alpha: 0.25}
+	case ActivationHardSigmoid:
+		return HardSigmoid{}
+	case ActivationHardTanh:
+		return HardTanh{}
+	}
+	if a, ok := activations.get(act); ok {
+		return a
 	}
 	return Linear{}
 }
 
+func fdefault(v, d float64) float64 {
+	if v == 0 {
+		return d
+	}
+	return v
+}
+
 // ActivationType is represents a neuron activation function
 type ActivationType int
 
@@ -64,8 +126,219 @@ const (
 	ActivationLinear ActivationType = 4
 	// ActivationSoftmax is a softmax activation (per layer)
 	ActivationSoftmax ActivationType = 5
+	// ActivationExp is an exponential activation, for strictly positive outputs
+	ActivationExp ActivationType = 6
+	// ActivationLeakyReLU is a rectified linear unit with a small slope for
+	// negative inputs
+	ActivationLeakyReLU ActivationType = 7
+	// ActivationELU is exponential linear unit activation
+	ActivationELU ActivationType = 8
+	// ActivationSELU is scaled exponential linear unit activation, for
+	// self-normalizing networks initialized by WeightLeCun
+	ActivationSELU ActivationType = 9
+	// ActivationGELU is gaussian error linear unit activation
+	ActivationGELU ActivationType = 10
+	// ActivationSwish is swish activation, or SiLU for beta = 1
+	ActivationSwish ActivationType = 11
+	// ActivationSoftplus is softplus activation, for strictly positive outputs
+	ActivationSoftplus ActivationType = 12
+	// ActivationPReLU is a rectified linear unit with a negative slope
+	// learned per layer
+	ActivationPReLU ActivationType = 13
+	// ActivationHardSigmoid is a piecewise linear sigmoid activation
+	ActivationHardSigmoid ActivationType = 14
+	// ActivationHardTanh is a piecewise linear hyperbolic activation
+	ActivationHardTanh ActivationType = 15
 )
 
+func (a ActivationType) String() string {
+	switch a {
+	case ActivationNone:
+		return "None"
+	case ActivationSigmoid:
+		return "Sigmoid"
+	case ActivationTanh:
+		return "Tanh"
+	case ActivationReLU:
+		return "ReLU"
+	case ActivationLinear:
+		return "Linear"
+	case ActivationSoftmax:
+		return "Softmax"
+	case ActivationExp:
+		return "Exp"
+	case ActivationLeakyReLU:
+		return "LeakyReLU"
+	case ActivationELU:
+		return "ELU"
+	case ActivationSELU:
+		return "SELU"
+	case ActivationGELU:
+		return "GELU"
+	case ActivationSwish:
+		return "Swish"
+	case ActivationSoftplus:
+		return "Softplus"
+	case ActivationPReLU:
+		return "PReLU"
+	case ActivationHardSigmoid:
+		return "HardSigmoid"
+	case ActivationHardTanh:
+		return "HardTanh"
+	}
+	if a, ok := activations.get(a); ok {
+		return a.name
+	}
+	return "N/A"
+}
+
+// known reports whether a is a builtin or registered activation
+func (a ActivationType) known() bool {
+	_, registered := activations.get(a)
+	return (a >= ActivationNone && a <= ActivationHardTanh) || registered
+}
+
+// MarshalJSON encodes registered activations by name, as their
+// ActivationType depends on the order of registration
+func (a ActivationType) MarshalJSON() ([]byte, error) {
+	if a, ok := activations.get(a); ok {
+		return json.Marshal(a.name)
+	}
+	return json.Marshal(int(a))
+}
+
+// UnmarshalJSON decodes an ActivationType, where registered activations
+// must have been registered prior to decoding
+func (a *ActivationType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var id int
+		if err := json.Unmarshal(data, &id); err != nil {
+			return err
+		}
+		*a = ActivationType(id)
+		return nil
+	}
+	act, ok := activations.lookup(name)
+	if !ok {
+		return fmt.Errorf("deep: activation %q is not registered", name)
+	}
+	*a = act
+	return nil
+}
+
+// RegisterActivation registers a custom activation f under name, where df
+// is the derivative of f with respect to its input, returning an
+// ActivationType usable with Config.Activation and GetActivation.
+// Registering a name again replaces its functions and returns the same
+// ActivationType. Networks persisted with a registered activation can only
+// be restored once it has been registered again.
+func RegisterActivation(name string, f, df func(float64) float64) ActivationType {
+	return activations.register(name, f, df)
+}
+
+// firstRegisteredActivation is the first ActivationType allocated by
+// RegisterActivation
+const firstRegisteredActivation ActivationType = 1000
+
+// registered is an activation added by RegisterActivation
+type registered struct {
+	name  string
+	f, df func(float64) float64
+}
+
+// F is f(x)
+func (a registered) F(x float64) float64 { return a.f(x) }
+
+// Df is df(x) at the x for which f(x) = y, found by bisection assuming f
+// increasing. Networks differentiate registered activations by DfInput.
+func (a registered) Df(y float64) float64 {
+	return a.df(inverse(a.f, y, math.Inf(-1)))
+}
+
+// DfInput is df(x)
+func (a registered) DfInput(x float64) float64 { return a.df(x) }
+
+type activationRegistry struct {
+	sync.RWMutex
+	activations []registered
+}
+
+var activations activationRegistry
+
+func (r *activationRegistry) register(name string, f, df func(float64) float64) ActivationType {
+	r.Lock()
+	defer r.Unlock()
+	for i, a := range r.activations {
+		if a.name == name {
+			r.activations[i] = registered{name, f, df}
+			return firstRegisteredActivation + ActivationType(i)
+		}
+	}
+	r.activations = append(r.activations, registered{name, f, df})
+	return firstRegisteredActivation + ActivationType(len(r.activations)-1)
+}
+
+func (r *activationRegistry) get(a ActivationType) (registered, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	i := int(a - firstRegisteredActivation)
+	if i >= 0 && i < len(r.activations) {
+		return r.activations[i], true
+	}
+	return registered{}, false
+}
+
+func (r *activationRegistry) lookup(name string) (ActivationType, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	for i, a := range r.activations {
+		if a.name == name {
+			return firstRegisteredActivation + ActivationType(i), true
+		}
+	}
+	return ActivationNone, false
+}
+
+// inverse returns the x >= from for which f(x) = y, by bisection, for f
+// increasing from from, which may be -Inf. It returns from for y below the
+// least value of f.
+func inverse(f func(float64) float64, y, from float64) float64 {
+	if math.IsNaN(y) {
+		return y
+	}
+	lo, hi := from, 1.0
+	if math.IsInf(from, -1) {
+		for lo = -1; f(lo) > y && !math.IsInf(lo, -1); lo *= 2 {
+		}
+	} else if f(from) >= y {
+		return from
+	}
+	if hi <= lo {
+		hi = lo + 1
+	}
+	for f(hi) < y && !math.IsInf(hi, 1) {
+		hi *= 2
+	}
+	if math.IsInf(lo, -1) {
+		return lo
+	}
+	if math.IsInf(hi, 1) {
+		return hi
+	}
+	for {
+		mid := lo + (hi-lo)/2
+		if mid <= lo || mid >= hi {
+			return mid
+		}
+		if f(mid) < y {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+}
+
 // Differentiable is an activation function and its first order derivative,
 // where the latter is expressed as a function of the former for efficiency
 type Differentiable interface {
@@ -73,6 +346,13 @@ type Differentiable interface {
 	Df(float64) float64
 }
 
+// InputDifferentiable is satisfied by activations whose derivative cannot be
+// expressed as a function of their output, and is instead given their input
+type InputDifferentiable interface {
+	Differentiable
+	DfInput(x float64) float64
+}
+
 // Sigmoid is a logistic activator in the special case of a = 1
 type Sigmoid struct{}
 
@@ -87,6 +367,21 @@ func Logistic(x, a float64) float64 {
 	return 1 / (1 + math.Exp(-a*x))
 }
 
+// HardSigmoid is a piecewise linear approximation of Sigmoid, for cheap
+// inference
+type HardSigmoid struct{}
+
+// F is clip(0.2x+0.5, 0, 1)
+func (a HardSigmoid) F(x float64) float64 { return clamp(0.2*x+0.5, 0, 1) }
+
+// Df is HardSigmoid'(y), where y = HardSigmoid(x)
+func (a HardSigmoid) Df(y float64) float64 {
+	if y > 0 && y < 1 {
+		return 0.2
+	}
+	return 0
+}
+
 // Tanh is a hyperbolic activator
 type Tanh struct{}
 
@@ -96,6 +391,20 @@ func (a Tanh) F(x float64) float64 { return (1 - math.Exp(-2*x)) / (1 + math.Exp
 // Df is Tanh'(y), where y = Tanh(x)
 func (a Tanh) Df(y float64) float64 { return 1 - math.Pow(y, 2) }
 
+// HardTanh is a piecewise linear approximation of Tanh, for cheap inference
+type HardTanh struct{}
+
+// F is clip(x, -1, 1)
+func (a HardTanh) F(x float64) float64 { return clamp(x, -1, 1) }
+
+// Df is HardTanh'(y), where y = HardTanh(x)
+func (a HardTanh) Df(y float64) float64 {
+	if y > -1 && y < 1 {
+		return 1
+	}
+	return 0
+}
+
 // ReLU is a rectified linear unit activator
 type ReLU struct{}
 
@@ -110,6 +419,185 @@ func (a ReLU) Df(y float64) float64 {
 	return 0
 }
 
+// LeakyReLU is a rectified linear unit activator with slope Slope for
+// negative inputs
+type LeakyReLU struct {
+	Slope float64
+}
+
+// F is LeakyReLU(x)
+func (a LeakyReLU) F(x float64) float64 {
+	if x > 0 {
+		return x
+	}
+	return a.Slope * x
+}
+
+// Df is LeakyReLU'(y), where y = LeakyReLU(x), for a nonnegative Slope.
+// Networks differentiate LeakyReLU by DfInput.
+func (a LeakyReLU) Df(y float64) float64 {
+	if y > 0 {
+		return 1
+	}
+	return a.Slope
+}
+
+// DfInput is LeakyReLU'(x), also for a negative Slope
+func (a LeakyReLU) DfInput(x float64) float64 {
+	if x > 0 {
+		return 1
+	}
+	return a.Slope
+}
+
+// PReLU is a rectified linear unit activator with a learned slope Alpha for
+// negative inputs
+type PReLU struct {
+	Alpha float64
+}
+
+// F is PReLU(x)
+func (a PReLU) F(x float64) float64 {
+	if x > 0 {
+		return x
+	}
+	return a.Alpha * x
+}
+
+// Df is PReLU'(y), where y = PReLU(x), for a nonnegative Alpha. Networks
+// differentiate PReLU by DfInput, as the learned Alpha may turn negative.
+func (a PReLU) Df(y float64) float64 {
+	if y > 0 {
+		return 1
+	}
+	return a.Alpha
+}
+
+// DfInput is PReLU'(x)
+func (a PReLU) DfInput(x float64) float64 {
+	if x > 0 {
+		return 1
+	}
+	return a.Alpha
+}
+
+// DfAlpha is the derivative of PReLU(x) with respect to Alpha
+func (a PReLU) DfAlpha(x float64) float64 { return math.Min(x, 0) }
+
+// ELU is an exponential linear unit activator, saturating at -Alpha
+type ELU struct {
+	Alpha float64
+}
+
+// F is ELU(x)
+func (a ELU) F(x float64) float64 {
+	if x > 0 {
+		return x
+	}
+	return a.Alpha * math.Expm1(x)
+}
+
+// Df is ELU'(y), where y = ELU(x), which for x <= 0 is y + Alpha
+func (a ELU) Df(y float64) float64 {
+	if y > 0 {
+		return 1
+	}
+	return y + a.Alpha
+}
+
+// SELU constants of self-normalizing networks
+const (
+	seluAlpha  = 1.6732632423543772
+	seluLambda = 1.0507009873554805
+)
+
+// SELU is a scaled exponential linear unit activator
+type SELU struct{}
+
+// F is SELU(x)
+func (a SELU) F(x float64) float64 {
+	if x > 0 {
+		return seluLambda * x
+	}
+	return seluLambda * seluAlpha * math.Expm1(x)
+}
+
+// Df is SELU'(y), where y = SELU(x), which for x <= 0 is y + λα
+func (a SELU) Df(y float64) float64 {
+	if y > 0 {
+		return seluLambda
+	}
+	return y + seluLambda*seluAlpha
+}
+
+// GELU is a gaussian error linear unit activator, by its tanh approximation
+type GELU struct{}
+
+var geluC = math.Sqrt(2 / math.Pi)
+
+// F is GELU(x)
+func (a GELU) F(x float64) float64 {
+	return 0.5 * x * (1 + math.Tanh(geluC*(x+0.044715*x*x*x)))
+}
+
+// geluMin is the input at which GELU is least
+const geluMin = -0.7524614220710162
+
+// Df is GELU'(x) at the x >= geluMin for which GELU(x) = y, found by
+// bisection, as GELU is not invertible below its minimum. Networks
+// differentiate GELU by DfInput.
+func (a GELU) Df(y float64) float64 {
+	return a.DfInput(inverse(a.F, y, geluMin))
+}
+
+// DfInput is GELU'(x)
+func (a GELU) DfInput(x float64) float64 {
+	t := math.Tanh(geluC * (x + 0.044715*x*x*x))
+	return 0.5*(1+t) + 0.5*x*(1-t*t)*geluC*(1+3*0.044715*x*x)
+}
+
+// Swish is a self-gated activator, x*sigmoid(Beta*x)
+type Swish struct {
+	Beta float64
+}
+
+// F is Swish(x)
+func (a Swish) F(x float64) float64 { return x * Logistic(x, a.Beta) }
+
+// swishMin is the product of Beta and the input at which Swish is least
+const swishMin = -1.278464542761074
+
+// Df is Swish'(x) at the x >= swishMin/Beta for which Swish(x) = y, found
+// by bisection, as Swish is not invertible below its minimum. Networks
+// differentiate Swish by DfInput.
+func (a Swish) Df(y float64) float64 {
+	from := math.Inf(-1)
+	if a.Beta > 0 {
+		from = swishMin / a.Beta
+	}
+	return a.DfInput(inverse(a.F, y, from))
+}
+
+// DfInput is Swish'(x)
+func (a Swish) DfInput(x float64) float64 {
+	s := Logistic(x, a.Beta)
+	return s + a.Beta*x*s*(1-s)
+}
+
+// Softplus is a smooth rectifier, log(1+exp(x))
+type Softplus struct{}
+
+// F is Softplus(x), computed without overflow for large x
+func (a Softplus) F(x float64) float64 {
+	if x > 0 {
+		return x + math.Log1p(math.Exp(-x))
+	}
+	return math.Log1p(math.Exp(x))
+}
+
+// Df is Softplus'(y) = sigmoid(x), where y = Softplus(x)
+func (a Softplus) Df(y float64) float64 { return -math.Expm1(-y) }
+
 // Linear is a linear activator
 type Linear struct{}
 
@@ -118,3 +606,12 @@ func (a Linear) F(x float64) float64 { return x }
 
 // Df is constant
 func (a Linear) Df(x float64) float64 { return 1 }
+
+// Exp is an exponential activator
+type Exp struct{}
+
+// F is exp(x)
+func (a Exp) F(x float64) float64 { return math.Exp(x) }
+
+// Df is Exp'(y), where y = Exp(x)
+func (a Exp) Df(y float64) float64 { return y }
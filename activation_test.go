@@ -0,0 +1,397 @@
+package deep
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LeakyReLU(t *testing.T) {
+	a := GetActivation(ActivationLeakyReLU)
+	assert.Equal(t, LeakyReLU{Slope: 0.01}, a)
+
+	assert.Equal(t, 2.0, a.F(2))
+	assert.Equal(t, 1.0, a.Df(a.F(2)))
+	assert.InDelta(t, -0.02, a.F(-2), 1e-12)
+	assert.Equal(t, 0.01, a.Df(a.F(-2)))
+
+	a = ActivationParams{LeakySlope: 0.2}.Activation(ActivationLeakyReLU)
+	assert.InDelta(t, -0.4, a.F(-2), 1e-12)
+	assert.Equal(t, 0.2, a.Df(a.F(-2)))
+	assert.Equal(t, "LeakyReLU", ActivationLeakyReLU.String())
+
+	// a negative slope maps negative inputs to positive outputs
+	negative := LeakyReLU{Slope: -0.1}
+	assert.Equal(t, 1.0, negative.DfInput(2))
+	assert.Equal(t, -0.1, negative.DfInput(-2))
+}
+
+func Test_LeakyReLUPersist(t *testing.T) {
+	rand.Seed(0)
+
+	n := NewNeural(&Config{
+		Inputs:           1,
+		Layout:           []int{3, 1},
+		Activation:       ActivationLeakyReLU,
+		ActivationParams: ActivationParams{LeakySlope: 0.3},
+		Mode:             ModeRegression,
+		Weight:           NewNormal(1, 0),
+		Bias:             true,
+	})
+	neuron := n.Layers[0].Neurons[0]
+	assert.Equal(t, 0.3, neuron.DActivate(neuron.Activate(-1)))
+
+	dump, err := n.Marshal()
+	assert.Nil(t, err)
+	new, err := Unmarshal(dump)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 0.3, new.Config.ActivationParams.LeakySlope)
+	neuron = new.Layers[0].Neurons[0]
+	assert.Equal(t, 0.3, neuron.DActivate(neuron.Activate(-1)))
+	for _, x := range []float64{-2, -0.5, 1} {
+		assert.Equal(t, n.Predict([]float64{x}), new.Predict([]float64{x}))
+	}
+}
+
+func Test_ELU(t *testing.T) {
+	a := GetActivation(ActivationELU)
+	assert.Equal(t, ELU{Alpha: 1}, a)
+	assert.Equal(t, "ELU", ActivationELU.String())
+
+	// continuous at 0, and for alpha = 1 so is the derivative
+	assert.InDelta(t, a.F(1e-9), a.F(-1e-9), 1e-8)
+	assert.InDelta(t, a.Df(a.F(1e-9)), a.Df(a.F(-1e-9)), 1e-8)
+
+	assert.Equal(t, 2.0, a.F(2))
+	assert.Equal(t, 1.0, a.Df(a.F(2)))
+	assert.InDelta(t, math.Exp(-2)-1, a.F(-2), 1e-12)
+	assert.InDelta(t, math.Exp(-2), a.Df(a.F(-2)), 1e-12)
+
+	a = ActivationParams{ELUAlpha: 0.5}.Activation(ActivationELU)
+	assert.Equal(t, -0.5, a.F(-1000))
+	assert.Equal(t, 0.0, a.Df(a.F(-1000)))
+	assert.InDelta(t, 0.5*math.Exp(-1), a.Df(a.F(-1)), 1e-12)
+}
+
+func Test_ELUPersist(t *testing.T) {
+	rand.Seed(0)
+
+	n := NewNeural(&Config{
+		Inputs:           1,
+		Layout:           []int{3, 1},
+		Activation:       ActivationELU,
+		ActivationParams: ActivationParams{ELUAlpha: 0.5},
+		Mode:             ModeRegression,
+		Weight:           NewNormal(1, 0),
+		Bias:             true,
+	})
+
+	new := FromDump(n.Dump())
+	assert.Equal(t, 0.5, new.Config.ActivationParams.ELUAlpha)
+	neuron := new.Layers[0].Neurons[0]
+	assert.Equal(t, -0.5, neuron.Activate(-1000))
+	for _, x := range []float64{-2, -0.5, 1} {
+		assert.Equal(t, n.Predict([]float64{x}), new.Predict([]float64{x}))
+	}
+}
+
+func Test_SELU(t *testing.T) {
+	a := GetActivation(ActivationSELU)
+	assert.Equal(t, "SELU", ActivationSELU.String())
+
+	assert.InDelta(t, 1.0507*2, a.F(2), 1e-4)
+	assert.InDelta(t, 1.0507, a.Df(a.F(2)), 1e-4)
+	assert.InDelta(t, 1.0507*1.6733*(math.Exp(-1)-1), a.F(-1), 1e-4)
+	assert.InDelta(t, 1.0507*1.6733*math.Exp(-1), a.Df(a.F(-1)), 1e-4)
+	assert.InDelta(t, -1.0507*1.6733, a.F(-1000), 1e-4)
+}
+
+func Test_SELUSelfNormalizing(t *testing.T) {
+	rand.Seed(0)
+
+	n := NewNeural(&Config{
+		Inputs:     100,
+		Layout:     []int{100, 100, 100, 100, 100},
+		Activation: ActivationSELU,
+		Weight:     WeightLeCun,
+	})
+	assert.Equal(t, ActivationSELU, n.Layers[4].Neurons[0].A)
+
+	sums := make([][]float64, len(n.Layers))
+	input := make([]float64, 100)
+	for i := 0; i < 100; i++ {
+		for j := range input {
+			input[j] = rand.NormFloat64()
+		}
+		n.Forward(input)
+		for l, layer := range n.Layers {
+			for _, neuron := range layer.Neurons {
+				var sum float64
+				for _, s := range neuron.In {
+					sum += s.Out
+				}
+				sums[l] = append(sums[l], sum)
+			}
+		}
+	}
+	for _, s := range sums {
+		assert.InDelta(t, 0, Mean(s), 0.2)
+		assert.InDelta(t, 1, Variance(s), 0.2)
+	}
+}
+
+func Test_GELU(t *testing.T) {
+	a := GetActivation(ActivationGELU).(InputDifferentiable)
+	assert.Equal(t, "GELU", ActivationGELU.String())
+
+	assert.Equal(t, 0.0, a.F(0))
+	assert.InDelta(t, 0.8412, a.F(1), 1e-4)
+	assert.InDelta(t, -0.1588, a.F(-1), 1e-4)
+
+	const h = 1e-6
+	for _, x := range []float64{-4, -1.5, -0.3, 0, 0.2, 1, 2.5, 6} {
+		numeric := (a.F(x+h) - a.F(x-h)) / (2 * h)
+		assert.InDelta(t, numeric, a.DfInput(x), 1e-6)
+	}
+	// the output is inverted on the branch through the origin
+	for _, x := range []float64{-0.7, -0.3, 0, 0.2, 1, 2.5, 6} {
+		assert.InDelta(t, a.DfInput(x), a.Df(a.F(x)), 1e-6, "%v", x)
+	}
+	assert.Equal(t, a.DfInput(geluMin), a.Df(-1))
+}
+
+func Test_NeuronDerivative(t *testing.T) {
+	rand.Seed(0)
+
+	n := NewNeural(&Config{
+		Inputs:     2,
+		Layout:     []int{3, 1},
+		Activation: ActivationGELU,
+		Mode:       ModeRegression,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+	})
+	n.Forward([]float64{0.5, -1})
+
+	gelu := GELU{}
+	for _, neuron := range n.Layers[0].Neurons {
+		assert.Equal(t, gelu.F(neuron.Sum), neuron.Value)
+		assert.Equal(t, gelu.DfInput(neuron.Sum), neuron.Derivative())
+	}
+	out := n.Layers[1].Neurons[0]
+	assert.Equal(t, 1.0, out.Derivative())
+
+	new := FromDump(n.Dump())
+	assert.Equal(t, ActivationGELU, new.Layers[0].Neurons[0].A)
+	assert.Equal(t, n.Predict([]float64{0.5, -1}), new.Predict([]float64{0.5, -1}))
+}
+
+func Test_Swish(t *testing.T) {
+	a := GetActivation(ActivationSwish).(InputDifferentiable)
+	assert.Equal(t, Swish{Beta: 1}, a)
+	assert.Equal(t, "Swish", ActivationSwish.String())
+	assert.Equal(t, 0.0, a.F(0))
+	assert.InDelta(t, 1/(1+math.Exp(-1)), a.F(1), 1e-12)
+
+	const h = 1e-6
+	for _, beta := range []float64{0.5, 1, 2} {
+		a = ActivationParams{SwishBeta: beta}.Activation(ActivationSwish).(InputDifferentiable)
+		for _, x := range []float64{-5, -1, -0.2, 0, 0.4, 1.5, 4} {
+			numeric := (a.F(x+h) - a.F(x-h)) / (2 * h)
+			assert.InDelta(t, numeric, a.DfInput(x), 1e-6)
+			if x*beta >= swishMin {
+				assert.InDelta(t, a.DfInput(x), a.Df(a.F(x)), 1e-6, "%v at %v", beta, x)
+			}
+		}
+	}
+
+	n := NewNeural(&Config{
+		Inputs:           1,
+		Layout:           []int{2, 1},
+		Activation:       ActivationSwish,
+		ActivationParams: ActivationParams{SwishBeta: 2},
+		Mode:             ModeRegression,
+	})
+	new := FromDump(n.Dump())
+	assert.Equal(t, 2.0, new.Config.ActivationParams.SwishBeta)
+	assert.Equal(t, n.Predict([]float64{-0.7}), new.Predict([]float64{-0.7}))
+}
+
+func Test_Softplus(t *testing.T) {
+	a := GetActivation(ActivationSoftplus)
+	assert.Equal(t, "Softplus", ActivationSoftplus.String())
+	assert.Equal(t, ActivationSoftplus, OutputActivation(ModePositiveRegression))
+
+	assert.InDelta(t, math.Ln2, a.F(0), 1e-12)
+	assert.InDelta(t, 0.5, a.Df(a.F(0)), 1e-12)
+	for _, x := range []float64{-3, -0.5, 0.5, 3} {
+		assert.InDelta(t, math.Log(1+math.Exp(x)), a.F(x), 1e-12)
+		assert.InDelta(t, Logistic(x, 1), a.Df(a.F(x)), 1e-9)
+	}
+
+	// asymptotically x for large x, and exp(x) for very negative x
+	assert.Equal(t, 1000.0, a.F(1000))
+	assert.Equal(t, 1.0, a.Df(a.F(1000)))
+	assert.InEpsilon(t, math.Exp(-30), a.F(-30), 1e-9)
+	assert.InEpsilon(t, math.Exp(-30), a.Df(a.F(-30)), 1e-9)
+	assert.Equal(t, 0.0, a.F(-1000))
+	assert.Equal(t, 0.0, a.Df(a.F(-1000)))
+}
+
+func Test_PReLU(t *testing.T) {
+	a := PReLU{Alpha: 0.25}
+	assert.Equal(t, a, GetActivation(ActivationPReLU))
+	assert.Equal(t, "PReLU", ActivationPReLU.String())
+	assert.Equal(t, 2.0, a.F(2))
+	assert.Equal(t, -0.5, a.F(-2))
+	assert.Equal(t, 0.25, a.Df(a.F(-2)))
+	assert.Equal(t, 0.0, a.DfAlpha(2))
+	assert.Equal(t, -2.0, a.DfAlpha(-2))
+
+	n := NewNeural(&Config{
+		Inputs:     1,
+		Layout:     []int{3, 1},
+		Activation: ActivationPReLU,
+		Mode:       ModeRegression,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+	})
+	assert.Equal(t, 0.25, n.Layers[0].Alpha)
+	n.Layers[0].Alpha = 0.6
+	neuron := n.Layers[0].Neurons[0]
+	assert.Equal(t, -0.6, neuron.Activate(-1))
+
+	dump, err := n.Marshal()
+	assert.Nil(t, err)
+	new, err := Unmarshal(dump)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.6, new.Layers[0].Alpha)
+	assert.Equal(t, -0.6, new.Layers[0].Neurons[0].Activate(-1))
+	assert.Equal(t, n.Predict([]float64{-1}), new.Predict([]float64{-1}))
+
+	// a learned negative slope maps negative sums to positive values
+	n.Layers[0].Alpha = -0.5
+	for _, x := range []float64{-1, 1} {
+		n.Forward([]float64{x})
+		for _, neuron := range n.Layers[0].Neurons {
+			expected := 1.0
+			if neuron.Sum <= 0 {
+				expected = -0.5
+			}
+			assert.Equal(t, expected, neuron.Derivative(), "%v", neuron.Sum)
+		}
+	}
+	assert.Equal(t, -0.5, PReLU{Alpha: -0.5}.DfInput(-2))
+}
+
+func Test_RegisterActivation(t *testing.T) {
+	sin := RegisterActivation("sin", math.Sin, math.Cos)
+
+	assert.Equal(t, "sin", sin.String())
+	a := GetActivation(sin).(InputDifferentiable)
+	assert.Equal(t, math.Sin(0.3), a.F(0.3))
+	assert.Equal(t, math.Cos(0.3), a.DfInput(0.3))
+	assert.Equal(t, sin, RegisterActivation("sin", math.Sin, math.Cos))
+
+	n := NewNeural(&Config{Inputs: 1, Layout: []int{2, 1}, Activation: sin, Mode: ModeRegression})
+	n.Forward([]float64{0.5})
+	neuron := n.Layers[0].Neurons[0]
+	assert.Equal(t, math.Cos(neuron.Sum), neuron.Derivative())
+
+	// the output of an increasing activation is inverted
+	atan := GetActivation(RegisterActivation("atan", math.Atan, func(x float64) float64 { return 1 / (1 + x*x) }))
+	for _, x := range []float64{-3, -0.4, 0, 0.7, 10} {
+		assert.InDelta(t, 1/(1+x*x), atan.Df(math.Atan(x)), 1e-9, "%v", x)
+	}
+	assert.InDelta(t, math.Cos(0.3), a.Df(math.Sin(0.3)), 1e-9)
+
+	var unmarshaled ActivationType
+	assert.Nil(t, unmarshaled.UnmarshalJSON([]byte(`"sin"`)))
+	assert.Equal(t, sin, unmarshaled)
+	assert.Nil(t, unmarshaled.UnmarshalJSON([]byte(`2`)))
+	assert.Equal(t, ActivationTanh, unmarshaled)
+	assert.Error(t, unmarshaled.UnmarshalJSON([]byte(`"unregistered"`)))
+}
+
+func Test_RegisterActivationConcurrent(t *testing.T) {
+	types := make([]ActivationType, 16)
+	var wg sync.WaitGroup
+	for i := range types {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			types[i] = RegisterActivation(fmt.Sprintf("concurrent-%d", i), math.Sin, math.Cos)
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[ActivationType]bool)
+	for i, a := range types {
+		assert.False(t, seen[a])
+		seen[a] = true
+		assert.Equal(t, fmt.Sprintf("concurrent-%d", i), a.String())
+	}
+}
+
+func Test_HardSigmoid(t *testing.T) {
+	a := GetActivation(ActivationHardSigmoid)
+	assert.Equal(t, "HardSigmoid", ActivationHardSigmoid.String())
+
+	assert.Equal(t, 0.5, a.F(0))
+	assert.InDelta(t, 0.7, a.F(1), 1e-12)
+	assert.InDelta(t, 0.2, a.Df(a.F(1)), 1e-12)
+	for _, x := range []float64{-2.5, -10} {
+		assert.Equal(t, 0.0, a.F(x))
+		assert.Equal(t, 0.0, a.Df(a.F(x)))
+	}
+	for _, x := range []float64{2.5, 10} {
+		assert.Equal(t, 1.0, a.F(x))
+		assert.Equal(t, 0.0, a.Df(a.F(x)))
+	}
+}
+
+func Test_HardTanh(t *testing.T) {
+	a := GetActivation(ActivationHardTanh)
+	assert.Equal(t, "HardTanh", ActivationHardTanh.String())
+
+	assert.Equal(t, 0.5, a.F(0.5))
+	assert.Equal(t, 1.0, a.Df(a.F(0.5)))
+	for _, x := range []float64{-1, -10} {
+		assert.Equal(t, -1.0, a.F(x))
+		assert.Equal(t, 0.0, a.Df(a.F(x)))
+	}
+	for _, x := range []float64{1, 10} {
+		assert.Equal(t, 1.0, a.F(x))
+		assert.Equal(t, 0.0, a.Df(a.F(x)))
+	}
+}
+
+func Benchmark_Forward(b *testing.B) {
+	for _, act := range []ActivationType{
+		ActivationSigmoid, ActivationHardSigmoid, ActivationTanh, ActivationHardTanh,
+	} {
+		b.Run(act.String(), func(b *testing.B) {
+			rand.Seed(0)
+			n := NewNeural(&Config{
+				Inputs:     32,
+				Layout:     []int{64, 64, 8},
+				Activation: act,
+				Weight:     NewNormal(0.5, 0),
+				Bias:       true,
+			})
+			input := make([]float64, 32)
+			for i := range input {
+				input[i] = rand.NormFloat64()
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				n.Forward(input)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package deep
+
+import "fmt"
+
+// ActorCritic is a network with a shared trunk and two heads over its
+// output layer: an actor with a softmax over actions, trained by LossActor,
+// and a linear critic, trained by LossCritic
+type ActorCritic struct {
+	*Neural
+}
+
+// NewActorCritic returns an actor-critic network with the hidden layers of
+// the layout of c as its trunk, followed by an output layer of the
+// actorOutputs of the actor and the criticOutputs of the critic. The
+// per-layer options of c, if any, cover the trunk. Mode, Loss and Heads of
+// c are replaced by the heads. It panics if c is invalid.
+func NewActorCritic(c *Config, actorOutputs, criticOutputs int) *ActorCritic {
+	if actorOutputs < 1 || criticOutputs < 1 {
+		panic(fmt.Sprintf("deep: invalid config: %d actor and %d critic outputs", actorOutputs, criticOutputs))
+	}
+	config := *c
+	config.Layout = append(append([]int(nil), c.Layout...), actorOutputs+criticOutputs)
+	if len(c.Activations) > 0 {
+		config.Activations = append(append([]ActivationType(nil), c.Activations...), ActivationNone)
+	}
+	if len(c.Dropout) > 0 {
+		config.Dropout = append(append([]float64(nil), c.Dropout...), 0)
+	}
+	config.BatchNorm = extendLayers(c.BatchNorm)
+	config.LayerNorm = extendLayers(c.LayerNorm)
+	config.Recurrent = extendLayers(c.Recurrent)
+	config.Mode, config.Loss = ModeDefault, LossNone
+	config.Heads = []Head{
+		{From: 0, To: actorOutputs, Mode: ModeMultiClass, Loss: LossActor},
+		{From: actorOutputs, To: actorOutputs + criticOutputs, Mode: ModeRegression, Loss: LossCritic},
+	}
+	return &ActorCritic{Neural: NewNeural(&config)}
+}
+
+// extendLayers appends the output layer to options of the trunk, if any
+func extendLayers(options []bool) []bool {
+	if len(options) == 0 {
+		return options
+	}
+	return append(append([]bool(nil), options...), false)
+}
+
+// AsActorCritic returns n, e.g. as unmarshaled, as an actor-critic network
+func AsActorCritic(n *Neural) (*ActorCritic, error) {
+	heads := n.Config.Heads
+	if len(heads) != 2 || heads[0].Loss != LossActor || heads[1].Loss != LossCritic {
+		return nil, fmt.Errorf("network is not an actor-critic")
+	}
+	return &ActorCritic{Neural: n}, nil
+}
+
+// Actions returns the number of outputs of the actor
+func (a *ActorCritic) Actions() int {
+	return a.Config.Heads[0].To
+}
+
+// SetLossWeights weights the losses of the actor and critic in the
+// combined loss, which trains the trunk by their weighted sum
+func (a *ActorCritic) SetLossWeights(actor, critic float64) {
+	a.Config.Heads[0].Weight = actor
+	a.Config.Heads[1].Weight = critic
+}
+
+// Predict returns the policy of the actor and the values of the critic
+func (a *ActorCritic) Predict(input []float64) (policy, values []float64) {
+	out := a.Neural.Predict(input)
+	return out[:a.Actions()], out[a.Actions():]
+}
+
+// Target returns the ideal of an example where action was taken with the
+// TD error tdError, the return less the value of the critic, which trains
+// the actor towards actions of positive error and the critic towards the
+// return
+func (a *ActorCritic) Target(action int, tdError float64) []float64 {
+	ideal := make([]float64, len(a.Layers[len(a.Layers)-1].Neurons))
+	ideal[action] = tdError
+	for i := a.Actions(); i < len(ideal); i++ {
+		// the gradient of the squared error is -2*tdError
+		ideal[i] = -tdError
+	}
+	return ideal
+}
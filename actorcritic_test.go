@@ -0,0 +1,57 @@
+package deep
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ActorCritic(t *testing.T) {
+	rand.Seed(0)
+	c := &Config{
+		Inputs:     3,
+		Layout:     []int{4, 4},
+		Activation: ActivationReLU,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+		Dropout:    []float64{0.1, 0},
+	}
+	ac := NewActorCritic(c, 3, 1)
+	// the trunk config is left as is
+	assert.Equal(t, []int{4, 4}, c.Layout)
+	assert.Equal(t, []int{4, 4, 4}, ac.Config.Layout)
+	assert.Equal(t, []float64{0.1, 0, 0}, ac.Config.Dropout)
+	assert.Equal(t, 3, ac.Actions())
+
+	input := []float64{0.5, -1, 2}
+	policy, values := ac.Predict(input)
+	assert.Len(t, policy, 3)
+	assert.Len(t, values, 1)
+	var sum float64
+	for _, p := range policy {
+		sum += p
+	}
+	assert.InDelta(t, 1, sum, 1e-12)
+	out := ac.Neural.Predict(input)
+	assert.Equal(t, out[:3], policy)
+	assert.Equal(t, out[3:], values)
+
+	assert.Equal(t, []float64{0, 0.5, 0, -0.5}, ac.Target(1, 0.5))
+
+	ac.SetLossWeights(1, 0.5)
+	dump, err := ac.Marshal()
+	assert.Nil(t, err)
+	n, err := Unmarshal(dump)
+	assert.Nil(t, err)
+	restored, err := AsActorCritic(n)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.5, restored.Config.Heads[1].Weight)
+	p, v := restored.Predict(input)
+	assert.Equal(t, policy, p)
+	assert.Equal(t, values, v)
+
+	_, err = AsActorCritic(NewNeural(&Config{Inputs: 1, Layout: []int{2}}))
+	assert.Error(t, err)
+	assert.Panics(t, func() { NewActorCritic(&Config{Inputs: 1, Layout: []int{2}}, 0, 1) })
+}
@@ -0,0 +1,171 @@
+package deep
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// binaryMagic begins the binary format of a network
+const binaryMagic = "GDNN"
+
+// binaryVersion is the version of the binary format written
+const binaryVersion = 1
+
+// weightChunk is the number of weights written or read at a time
+const weightChunk = 512
+
+// MarshalBinary marshals n to a compact binary format: a header holding the
+// magic "GDNN", a version byte and the length of the JSON of the dump of n
+// without its weights, that JSON, and then the number of weights and the
+// weights themselves as little-endian IEEE 754 doubles, in the order of
+// Weights. Weights round-trip exactly, and Load rejects those not finite.
+func (n *Neural) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	b.Grow(len(binaryMagic) + 1 + 4 + 8 + 8*n.synapses())
+	if err := n.Save(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// UnmarshalBinary restores n from the binary format of MarshalBinary
+func (n *Neural) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	restored, err := Load(r)
+	if err != nil {
+		return err
+	}
+	if r.Len() > 0 {
+		return fmt.Errorf("%d bytes after the network", r.Len())
+	}
+	*n = *restored
+	return nil
+}
+
+// Save writes n to w in the binary format of MarshalBinary, streaming its
+// weights in small chunks rather than encoding them in memory first
+func (n *Neural) Save(w io.Writer) error {
+	header, err := json.Marshal(n.dumpParameters())
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 0, 8*weightChunk)
+	b = append(b, binaryMagic...)
+	b = append(b, binaryVersion)
+	b = appendUint32(b, uint32(len(header)))
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	b = appendUint64(b[:0], uint64(n.synapses()))
+	for _, l := range n.Layers {
+		for _, neuron := range l.Neurons {
+			for _, s := range neuron.In {
+				if len(b) == cap(b) {
+					if _, err := w.Write(b); err != nil {
+						return err
+					}
+					b = b[:0]
+				}
+				b = appendUint64(b, math.Float64bits(s.Weight))
+			}
+		}
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Load reads a network written by Save or MarshalBinary from r, reading
+// no further than its end, and validates it as Dump.Validate does
+func Load(r io.Reader) (*Neural, error) {
+	prefix := make([]byte, len(binaryMagic)+1+4)
+	if _, err := io.ReadFull(r, prefix[:len(binaryMagic)]); err != nil || string(prefix[:len(binaryMagic)]) != binaryMagic {
+		return nil, errors.New("not a binary network")
+	}
+	if _, err := io.ReadFull(r, prefix[len(binaryMagic):]); err != nil {
+		return nil, errors.New("truncated network header")
+	}
+	if version := prefix[len(binaryMagic)]; version != binaryVersion {
+		return nil, fmt.Errorf("unsupported binary network version %d", version)
+	}
+	header := make([]byte, binary.LittleEndian.Uint32(prefix[len(binaryMagic)+1:]))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.New("truncated network header")
+	}
+	var dump Dump
+	if err := json.Unmarshal(header, &dump); err != nil {
+		return nil, err
+	}
+	if err := dump.Migrate(); err != nil {
+		return nil, err
+	}
+	if _, err := dump.validateParameters(); err != nil {
+		return nil, fmt.Errorf("invalid network: %w", err)
+	}
+
+	// the weights are all read, so they need not be drawn
+	dump.Config.defaults()
+	n := newNeural(dump.Config, WeightInitializer(func() float64 { return 0 }))
+	b := make([]byte, 8*weightChunk)
+	if _, err := io.ReadFull(r, b[:8]); err != nil {
+		return nil, errors.New("truncated network header")
+	}
+	if weights, expected := binary.LittleEndian.Uint64(b), uint64(n.synapses()); weights != expected {
+		return nil, fmt.Errorf("%d weights for a network of %d", weights, expected)
+	}
+	var next []byte
+	remaining := n.synapses()
+	for i, l := range n.Layers {
+		for j, neuron := range l.Neurons {
+			for k, s := range neuron.In {
+				if len(next) == 0 {
+					chunk := weightChunk
+					if remaining < chunk {
+						chunk = remaining
+					}
+					remaining -= chunk
+					next = b[:8*chunk]
+					if _, err := io.ReadFull(r, next); err != nil {
+						return nil, fmt.Errorf("truncated network weights: %v", err)
+					}
+				}
+				s.Weight = math.Float64frombits(binary.LittleEndian.Uint64(next))
+				next = next[8:]
+				if err := checkWeight(i, j, k, s.Weight); err != nil {
+					return nil, fmt.Errorf("invalid network: %w", err)
+				}
+			}
+		}
+	}
+	n.applyDump(&dump)
+	return n, nil
+}
+
+// synapses returns the number of synapses of the layers of n
+func (n *Neural) synapses() (num int) {
+	for _, l := range n.Layers {
+		for _, neuron := range l.Neurons {
+			num += len(neuron.In)
+		}
+	}
+	return num
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
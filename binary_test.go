@@ -0,0 +1,251 @@
+package deep
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MarshalBinary(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{
+		Inputs:     2,
+		Layout:     []int{4, 3, 2},
+		Activation: ActivationPReLU,
+		Mode:       ModeMultiClass,
+		Weight:     NewNormal(1, 0),
+		BatchNorm:  []bool{true, false, false},
+		LayerNorm:  []bool{false, true, false},
+		Bias:       true,
+	})
+	n.Layers[0].Alpha = 0.3
+	n.Layers[1].Norm.Gamma[1] = 0.25
+	n.Layers[0].Neurons[1].In[0].Weight = -math.MaxFloat64
+	n.Layers[0].Neurons[1].In[1].Weight = math.SmallestNonzeroFloat64
+	n.Prune(0.1)
+
+	b, err := n.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, "GDNN", string(b[:4]))
+	assert.Equal(t, byte(1), b[4])
+
+	var restored Neural
+	assert.NoError(t, restored.UnmarshalBinary(b))
+	assert.Equal(t, n.Weights(), restored.Weights())
+	assert.Equal(t, n.Alphas(), restored.Alphas())
+	assert.Equal(t, n.Norms(), restored.Norms())
+	assert.Equal(t, n.pruned(), restored.pruned())
+	assert.Equal(t, n.String(), restored.String())
+	n.Layers[0].Neurons[1].In[0].Weight = -1
+	restored.Layers[0].Neurons[1].In[0].Weight = -1
+	assert.Equal(t, n.Predict([]float64{0.5, -1}), restored.Predict([]float64{0.5, -1}))
+
+	// the format is checked
+	assert.Error(t, restored.UnmarshalBinary(b[:len(b)-1]))
+	assert.Error(t, restored.UnmarshalBinary(b[:10]))
+	assert.Error(t, restored.UnmarshalBinary([]byte("{}")))
+	future := append([]byte{}, b...)
+	future[4] = 2
+	assert.Error(t, restored.UnmarshalBinary(future))
+}
+
+// binaryNetwork returns the binary format of a network of header and
+// weights
+func binaryNetwork(t *testing.T, header *Dump, weights ...float64) []byte {
+	js, err := json.Marshal(header)
+	assert.NoError(t, err)
+	b := append([]byte(binaryMagic), binaryVersion)
+	b = appendUint32(b, uint32(len(js)))
+	b = append(b, js...)
+	b = appendUint64(b, uint64(len(weights)))
+	for _, w := range weights {
+		b = appendUint64(b, math.Float64bits(w))
+	}
+	return b
+}
+
+func Test_LoadValidates(t *testing.T) {
+	config := func() *Config {
+		return &Config{Inputs: 1, Layout: []int{2, 1}, Activation: ActivationTanh, Mode: ModeRegression}
+	}
+	weights := []float64{1, 2, 3, 4}
+	var n Neural
+	assert.NoError(t, n.UnmarshalBinary(binaryNetwork(t, &Dump{Version: DumpVersion, Config: config()}, weights...)))
+
+	unknown := config()
+	unknown.Activation = 100
+	for name, c := range map[string]struct {
+		header  *Dump
+		weights []float64
+	}{
+		"nan weight": {&Dump{Version: DumpVersion, Config: config()}, []float64{1, math.NaN(), 3, 4}},
+		"inf weight": {&Dump{Version: DumpVersion, Config: config()}, []float64{1, 2, 3, math.Inf(1)}},
+		"activation": {&Dump{Version: DumpVersion, Config: unknown}, weights},
+		"pruned":     {&Dump{Version: DumpVersion, Config: config(), Pruned: [][3]int{{5, 5, 5}}}, weights},
+		"alphas":     {&Dump{Version: DumpVersion, Config: config(), Alphas: []float64{0.1}}, weights},
+		"norms":      {&Dump{Version: DumpVersion, Config: config(), Norms: []*Norm{nil, {}}}, weights},
+		"conv":       {&Dump{Version: DumpVersion, Config: config(), Conv: &Convolution{}}, weights},
+	} {
+		err := n.UnmarshalBinary(binaryNetwork(t, c.header, c.weights...))
+		assert.Error(t, err, name)
+		if err != nil {
+			assert.Contains(t, err.Error(), "invalid network", name)
+		}
+	}
+}
+
+func Test_MarshalBinaryConv(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{
+		Inputs:     8,
+		Conv:       &Conv1D{Kernel: 3, Filters: 2, Stride: 1},
+		Layout:     []int{2},
+		Activation: ActivationReLU,
+		Mode:       ModeRegression,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+	})
+	b, err := n.MarshalBinary()
+	assert.NoError(t, err)
+	var restored Neural
+	assert.NoError(t, restored.UnmarshalBinary(b))
+	assert.Equal(t, n.Convolution(), restored.Convolution())
+	input := []float64{1, 2, 3, 4, 5, 6, 7, 8}
+	assert.Equal(t, n.Predict(input), restored.Predict(input))
+}
+
+func largeNetwork() *Neural {
+	rand.Seed(0)
+	return NewNeural(&Config{
+		Inputs:     64,
+		Layout:     []int{512, 512, 512, 10},
+		Activation: ActivationReLU,
+		Mode:       ModeMultiClass,
+		Weight:     WeightHe,
+		Bias:       true,
+	})
+}
+
+func Test_MarshalBinarySize(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+	n := largeNetwork()
+	js, err := n.Marshal()
+	assert.NoError(t, err)
+	b, err := n.MarshalBinary()
+	assert.NoError(t, err)
+	// the header and count of weights, and 8 bytes a weight
+	header, err := json.Marshal(n.dumpParameters())
+	assert.NoError(t, err)
+	assert.Equal(t, len(binaryMagic)+1+4+len(header)+8+8*n.synapses(), len(b))
+	assert.True(t, len(b)*2 < len(js), "%d vs %d bytes", len(b), len(js))
+
+	var restored Neural
+	assert.NoError(t, restored.UnmarshalBinary(b))
+	assert.Equal(t, n.Weights(), restored.Weights())
+}
+
+// the speed of the binary format against JSON is measured by the
+// benchmarks, rather than asserted
+func Benchmark_MarshalBinary(b *testing.B) {
+	n := largeNetwork()
+	for i := 0; i < b.N; i++ {
+		n.MarshalBinary()
+	}
+}
+
+func Benchmark_MarshalJSON(b *testing.B) {
+	n := largeNetwork()
+	for i := 0; i < b.N; i++ {
+		n.Marshal()
+	}
+}
+
+func Benchmark_UnmarshalBinary(b *testing.B) {
+	data, _ := largeNetwork().MarshalBinary()
+	for i := 0; i < b.N; i++ {
+		var n Neural
+		n.UnmarshalBinary(data)
+	}
+}
+
+func Benchmark_UnmarshalJSON(b *testing.B) {
+	data, _ := largeNetwork().Marshal()
+	for i := 0; i < b.N; i++ {
+		Unmarshal(data)
+	}
+}
+
+// writeRecorder records the size of the largest write
+type writeRecorder struct {
+	io.Writer
+	largest, total int
+}
+
+func (w *writeRecorder) Write(p []byte) (int, error) {
+	if len(p) > w.largest {
+		w.largest = len(p)
+	}
+	w.total += len(p)
+	return w.Writer.Write(p)
+}
+
+func fileNetwork() *Neural {
+	rand.Seed(0)
+	return NewNeural(&Config{
+		Inputs:     16,
+		Layout:     []int{64, 32, 4},
+		Activation: ActivationTanh,
+		Mode:       ModeMultiClass,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+		BatchNorm:  []bool{true, false, false},
+	})
+}
+
+func Test_SaveLoad(t *testing.T) {
+	n := fileNetwork()
+
+	// the network is read while it is written, in small pieces
+	r, w := io.Pipe()
+	recorder := &writeRecorder{Writer: w}
+	go func() {
+		w.CloseWithError(n.Save(recorder))
+	}()
+	restored, err := Load(r)
+	assert.NoError(t, err)
+	assert.Equal(t, n.Weights(), restored.Weights())
+	assert.Equal(t, n.Norms(), restored.Norms())
+	assert.True(t, recorder.largest*4 < recorder.total, "%d of %d bytes", recorder.largest, recorder.total)
+
+	// nothing after the network is read
+	b, err := n.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, recorder.total, len(b))
+	stream := io.MultiReader(&bytesReader{b}, &bytesReader{b})
+	for i := 0; i < 2; i++ {
+		restored, err = Load(stream)
+		assert.NoError(t, err)
+		assert.Equal(t, n.Weights(), restored.Weights())
+	}
+	_, err = Load(stream)
+	assert.Error(t, err)
+}
+
+// bytesReader reads b, a byte at a time
+type bytesReader struct {
+	b []byte
+}
+
+func (r *bytesReader) Read(p []byte) (int, error) {
+	if len(r.b) == 0 {
+		return 0, io.EOF
+	}
+	p[0], r.b = r.b[0], r.b[1:]
+	return 1, nil
+}
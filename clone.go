@@ -0,0 +1,46 @@
+package deep
+
+import "reflect"
+
+// Clone returns a deep copy of n, of the same config, weights, PReLU slopes,
+// normalizations, convolution, pruned synapses, frozen layers and recurrent
+// state, that shares no mutable state with n. The initializer of the config
+// is shared, and the clone drops out by the global source until SetRand.
+func (n *Neural) Clone() *Neural {
+	clone := newNeural(n.Config.Clone(), WeightInitializer(func() float64 { return 0 }))
+	for i, l := range n.Layers {
+		c := clone.Layers[i]
+		for j, neuron := range l.Neurons {
+			in := c.Neurons[j].In
+			for k, s := range neuron.In {
+				in[k].Weight, in[k].Pruned = s.Weight, s.Pruned
+			}
+		}
+		c.Alpha, c.Frozen = l.Alpha, l.Frozen
+		copy(c.state, l.state)
+	}
+	clone.ApplyNorms(n.Norms())
+	clone.ApplyConvolution(n.Conv)
+	clone.training = n.training
+	return clone
+}
+
+// Clone returns a copy of c with slices and a convolution of its own, e.g.
+// for a network of its own, see NewNeural, which sets the defaults of its
+// config
+func (c *Config) Clone() *Config {
+	clone := *c
+	v := reflect.ValueOf(&clone).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if f := v.Field(i); f.Kind() == reflect.Slice && !f.IsNil() {
+			s := reflect.MakeSlice(f.Type(), f.Len(), f.Len())
+			reflect.Copy(s, f)
+			f.Set(s)
+		}
+	}
+	if c.Conv != nil {
+		conv := *c.Conv
+		clone.Conv = &conv
+	}
+	return &clone
+}
@@ -0,0 +1,96 @@
+package deep
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func cloneNetwork() *Neural {
+	rand.Seed(0)
+	n := NewNeural(&Config{
+		Inputs:      6,
+		Layout:      []int{4, 4, 3},
+		Activations: []ActivationType{ActivationPReLU, ActivationTanh, ActivationNone},
+		BatchNorm:   []bool{true, false, false},
+		Dropout:     []float64{0.2, 0, 0},
+		Skips:       []Skip{{From: 0, To: 1}},
+		Conv:        &Conv1D{Kernel: 2, Stride: 2, Filters: 2},
+		Mode:        ModeMultiClass,
+		Bias:        true,
+	})
+	n.Layers[0].Alpha = 0.1
+	for j := range n.Layers[0].Norm.Mean {
+		n.Layers[0].Norm.Mean[j], n.Layers[0].Norm.Gamma[j] = rand.NormFloat64(), rand.Float64()+0.5
+	}
+	n.Prune(0.05)
+	n.FreezeLayer(1)
+	return n
+}
+
+func Test_Clone(t *testing.T) {
+	n := cloneNetwork()
+	original, err := n.Marshal()
+	assert.NoError(t, err)
+
+	clone := n.Clone()
+	assert.Equal(t, n.Fingerprint(), clone.Fingerprint())
+	cloned, err := clone.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, string(original), string(cloned))
+	assert.True(t, clone.Layers[1].Frozen)
+	input := []float64{1, -2, 0.5, 3, -1, 0}
+	assert.Equal(t, n.Predict(input), clone.Predict(input))
+
+	// mutating every part of the clone leaves n untouched
+	clone.Config.Layout[0] = 5
+	clone.Config.Activations[1] = ActivationReLU
+	clone.Config.Conv.Filters = 3
+	clone.Config.Skips[0].To = 0
+	clone.Config.ActivationParams.LeakySlope = 0.5
+	clone.Layers[0].Neurons[0].In[0].Weight = 42
+	clone.Layers[0].Neurons[0].In[0].Pruned = !clone.Layers[0].Neurons[0].In[0].Pruned
+	clone.Layers[0].Alpha = 0.9
+	clone.Layers[0].Norm.Gamma[0], clone.Layers[0].Norm.Mean[1] = 7, 7
+	clone.Conv.Kernels[0][0], clone.Conv.Biases[1] = 7, 7
+	clone.UnfreezeLayer(1)
+	clone.SetTraining(true)
+	clone.Forward(input)
+
+	after, err := n.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, string(original), string(after))
+	assert.True(t, n.Layers[1].Frozen)
+	assert.False(t, n.Training())
+	assert.Equal(t, 0.1, n.Layers[0].Alpha)
+}
+
+func Test_CloneRecurrent(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{Inputs: 2, Layout: []int{3, 1}, Recurrent: []bool{true, false}, Mode: ModeRegression, Bias: true})
+	n.Predict([]float64{1, -1})
+
+	// the clone carries on from the state of n, but of its own
+	clone := n.Clone()
+	assert.Equal(t, n.Predict([]float64{0.5, 2}), clone.Predict([]float64{0.5, 2}))
+	clone.ResetState()
+	assert.NotEqual(t, n.Predict([]float64{0.5, 2}), clone.Predict([]float64{0.5, 2}))
+}
+
+func Benchmark_Clone(b *testing.B) {
+	n := largeNetwork()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n.Clone()
+	}
+}
+
+func Benchmark_CloneJSON(b *testing.B) {
+	n := largeNetwork()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dump, _ := n.Marshal()
+		Unmarshal(dump)
+	}
+}
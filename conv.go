@@ -0,0 +1,178 @@
+package deep
+
+import "fmt"
+
+// Conv1D configures a 1D convolution of the inputs by a bank of filters,
+// whose outputs, filter by filter, are the inputs of the first layer
+type Conv1D struct {
+	// Kernel is the size of each filter
+	Kernel int
+	// Stride is the step between the positions of the filters, zero is 1
+	Stride int
+	// Filters is the number of filters
+	Filters int
+	// Activation of the filtered outputs, ActivationNone is the activation
+	// of the network
+	Activation ActivationType
+}
+
+func (c Conv1D) stride() int {
+	if c.Stride == 0 {
+		return 1
+	}
+	return c.Stride
+}
+
+// positions returns the number of positions of each filter over inputs
+func (c Conv1D) positions(inputs int) int {
+	return (inputs-c.Kernel)/c.stride() + 1
+}
+
+// Outputs returns the number of outputs of the convolution of inputs
+func (c Conv1D) Outputs(inputs int) int {
+	return c.Filters * c.positions(inputs)
+}
+
+func (c Conv1D) validate(inputs int) error {
+	if c.Kernel < 1 || c.Kernel > inputs {
+		return fmt.Errorf("invalid kernel size %d for %d inputs", c.Kernel, inputs)
+	}
+	if c.Stride < 0 || c.Filters < 1 {
+		return fmt.Errorf("invalid stride %d, filters %d", c.Stride, c.Filters)
+	}
+	switch c.Activation {
+	case ActivationPReLU, ActivationSoftmax:
+		return fmt.Errorf("unsupported convolution activation %s", c.Activation)
+	}
+	return nil
+}
+
+// Convolution is the convolutional input stage of a network
+type Convolution struct {
+	// Kernels are the weights of each filter
+	Kernels [][]float64
+	// Biases of each filter, nil without bias
+	Biases []float64
+
+	config     Conv1D
+	activation Differentiable
+	// input, sums and values of the outputs at the last forward pass
+	input, sums, values []float64
+}
+
+func newConvolution(c *Config, weight Initializer) *Convolution {
+	conv := &Convolution{
+		Kernels:    make([][]float64, c.Conv.Filters),
+		config:     *c.Conv,
+		activation: c.ActivationParams.Activation(c.convActivation()),
+		sums:       make([]float64, c.Conv.Outputs(c.Inputs)),
+		values:     make([]float64, c.Conv.Outputs(c.Inputs)),
+	}
+	kernel := weight.Layer(c.Conv.Kernel, c.Conv.Filters)
+	for f := range conv.Kernels {
+		conv.Kernels[f] = make([]float64, c.Conv.Kernel)
+		for k := range conv.Kernels[f] {
+			conv.Kernels[f][k] = kernel()
+		}
+	}
+	if c.Bias {
+		bias := biasInitializer(weight)
+		conv.Biases = make([]float64, c.Conv.Filters)
+		for f := range conv.Biases {
+			conv.Biases[f] = bias()
+		}
+	}
+	return conv
+}
+
+// convActivation is the activation of the convolution of c
+func (c *Config) convActivation() ActivationType {
+	if c.Conv.Activation != ActivationNone {
+		return c.Conv.Activation
+	}
+	return c.Activation
+}
+
+// forward convolves input and returns the outputs
+func (c *Convolution) forward(input []float64) []float64 {
+	c.input = input
+	c.filter(input, c.sums, c.values)
+	return c.values
+}
+
+// filter computes the sums and values of the outputs of input
+func (c *Convolution) filter(input, sums, values []float64) {
+	positions := len(values) / len(c.Kernels)
+	for f, kernel := range c.Kernels {
+		for p := 0; p < positions; p++ {
+			var sum float64
+			if c.Biases != nil {
+				sum = c.Biases[f]
+			}
+			window := input[p*c.config.stride():]
+			for k, w := range kernel {
+				sum += w * window[k]
+			}
+			sums[f*positions+p] = sum
+			values[f*positions+p] = c.activation.F(sum)
+		}
+	}
+}
+
+// Backward adds the gradients of the kernels and biases to kernels and
+// biases, given the gradients of the outputs at the last forward pass
+func (c *Convolution) Backward(outputs []float64, kernels [][]float64, biases []float64) {
+	positions := len(c.values) / len(c.Kernels)
+	d, input := c.activation.(InputDifferentiable)
+	for f, kernel := range kernels {
+		for p := 0; p < positions; p++ {
+			q := f*positions + p
+			delta := outputs[q]
+			if input {
+				delta *= d.DfInput(c.sums[q])
+			} else {
+				delta *= c.activation.Df(c.values[q])
+			}
+			window := c.input[p*c.config.stride():]
+			for k := range kernel {
+				kernel[k] += delta * window[k]
+			}
+			if biases != nil {
+				biases[f] += delta
+			}
+		}
+	}
+}
+
+// copy returns a copy of the kernels and biases of c
+func (c *Convolution) copy() *Convolution {
+	k := &Convolution{
+		Kernels: make([][]float64, len(c.Kernels)),
+		Biases:  append([]float64(nil), c.Biases...),
+	}
+	for f, kernel := range c.Kernels {
+		k.Kernels[f] = append([]float64(nil), kernel...)
+	}
+	return k
+}
+
+// Convolution returns a copy of the kernels and biases of the convolution
+// of n, nil without
+func (n Neural) Convolution() *Convolution {
+	if n.Conv == nil {
+		return nil
+	}
+	return n.Conv.copy()
+}
+
+// ApplyConvolution sets the kernels and biases of the convolution of n to
+// those of c
+func (n *Neural) ApplyConvolution(c *Convolution) {
+	if n.Conv == nil || c == nil {
+		return
+	}
+	for f, kernel := range n.Conv.Kernels {
+		copy(kernel, c.Kernels[f])
+	}
+	copy(n.Conv.Biases, c.Biases)
+}
@@ -0,0 +1,41 @@
+package deep
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Conv(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{
+		Inputs:     6,
+		Layout:     []int{2, 1},
+		Activation: ActivationTanh,
+		Mode:       ModeRegression,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+		Conv:       &Conv1D{Kernel: 2, Stride: 2, Filters: 2, Activation: ActivationReLU},
+	})
+	assert.Equal(t, 6, n.Config.Conv.Outputs(6))
+	// 2 kernels of 2 and 2 biases, 2x(6+1) and 2 weights
+	assert.Equal(t, 6+14+2, n.NumWeights())
+	for _, neuron := range n.Layers[0].Neurons {
+		assert.Len(t, neuron.In, 7)
+	}
+
+	input := []float64{1, -2, 0.5, 3, -1, 0}
+	n.Forward(input)
+	for f, kernel := range n.Conv.Kernels {
+		for p := 0; p < 3; p++ {
+			sum := n.Conv.Biases[f] + kernel[0]*input[2*p] + kernel[1]*input[2*p+1]
+			assert.InDelta(t, math.Max(0, sum), n.Layers[0].Neurons[0].In[3*f+p].In, 1e-12)
+		}
+	}
+
+	for _, conv := range []*Conv1D{{Kernel: 7, Filters: 1}, {Kernel: 2}, {Kernel: 2, Filters: 1, Stride: -1}, {Kernel: 2, Filters: 1, Activation: ActivationPReLU}} {
+		assert.Panics(t, func() { NewNeural(&Config{Inputs: 6, Layout: []int{1}, Conv: conv}) })
+	}
+}
@@ -0,0 +1,162 @@
+package deep
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// weightsCSVHeader is the header of the rows written by WriteWeightsCSV
+var weightsCSVHeader = []string{"layer", "neuron", "input", "kind", "weight"}
+
+// activationsCSVHeader is the header of the rows written by
+// WriteActivationsCSV
+var activationsCSVHeader = []string{"layer", "neuron", "activation", "sum", "output"}
+
+// synapseKind is the kind of the kth input synapse of neuron j of l in
+// the rows of WriteWeightsCSV: a bias, a recurrent synapse or a weight
+func synapseKind(l *Layer, j, k int) string {
+	s := l.Neurons[j].In[k]
+	if s.IsBias {
+		return "bias"
+	}
+	if l.Recurrent != nil {
+		for _, r := range l.Recurrent[j] {
+			if r == s {
+				return "recurrent"
+			}
+		}
+	}
+	return "weight"
+}
+
+// neuronActivation is the activation of neuron j of l, where the neurons
+// of softmax layers and heads are linear and softmax is applied over them
+func neuronActivation(l *Layer, j int) ActivationType {
+	if l.A == ActivationSoftmax {
+		return ActivationSoftmax
+	}
+	for _, r := range l.softmax {
+		if j >= r[0] && j < r[1] {
+			return ActivationSoftmax
+		}
+	}
+	return l.Neurons[j].A
+}
+
+// WriteWeightsCSV writes a row of the layer, neuron, input index, kind and
+// weight of each synapse of n to w as CSV, by layer, neuron and input,
+// where the kind is "weight", "bias" or "recurrent". Inputs are indexed as
+// in Weights, and weights are written exactly, such that LoadWeightsCSV
+// restores them. Convolutions and other parameters are not written.
+func (n *Neural) WriteWeightsCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(weightsCSVHeader)
+	for i, l := range n.Layers {
+		for j, neuron := range l.Neurons {
+			for k, s := range neuron.In {
+				cw.Write([]string{
+					strconv.Itoa(i), strconv.Itoa(j), strconv.Itoa(k),
+					synapseKind(l, j, k), strconv.FormatFloat(s.Weight, 'g', -1, 64),
+				})
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// LoadWeightsCSV sets the weights of n to those of the rows read from r,
+// as written by WriteWeightsCSV in any order. Each synapse of n must have
+// exactly one row of its kind, else an error naming the line is returned
+// and no weight is set.
+func (n *Neural) LoadWeightsCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(weightsCSVHeader)
+	header, err := cr.Read()
+	if err != nil {
+		return err
+	}
+	for i, h := range weightsCSVHeader {
+		if header[i] != h {
+			return fmt.Errorf("line 1: header %q, expected %q", header, weightsCSVHeader)
+		}
+	}
+
+	weights := n.Weights()
+	set := make([][][]bool, len(weights))
+	for i := range weights {
+		set[i] = make([][]bool, len(weights[i]))
+		for j := range weights[i] {
+			set[i][j] = make([]bool, len(weights[i][j]))
+		}
+	}
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var index [3]int
+		for c := range index {
+			if index[c], err = strconv.Atoi(row[c]); err != nil {
+				return fmt.Errorf("line %d: invalid %s %q", line, weightsCSVHeader[c], row[c])
+			}
+		}
+		i, j, k := index[0], index[1], index[2]
+		switch {
+		case i < 0 || i >= len(n.Layers):
+			return fmt.Errorf("line %d: layer %d of a network of %d", line, i, len(n.Layers))
+		case j < 0 || j >= len(n.Layers[i].Neurons):
+			return fmt.Errorf("line %d: neuron %d of layer %d of %d neurons", line, j, i, len(n.Layers[i].Neurons))
+		case k < 0 || k >= len(weights[i][j]):
+			return fmt.Errorf("line %d: input %d of neuron %d of layer %d of %d inputs", line, k, j, i, len(weights[i][j]))
+		case set[i][j][k]:
+			return fmt.Errorf("line %d: input %d of neuron %d of layer %d set twice", line, k, j, i)
+		}
+		if kind := synapseKind(n.Layers[i], j, k); row[3] != kind {
+			return fmt.Errorf("line %d: %s for input %d of neuron %d of layer %d, expected %s", line, row[3], k, j, i, kind)
+		}
+		if weights[i][j][k], err = strconv.ParseFloat(row[4], 64); err != nil {
+			return fmt.Errorf("line %d: invalid weight %q", line, row[4])
+		}
+		set[i][j][k] = true
+	}
+	for i := range set {
+		for j := range set[i] {
+			for k, ok := range set[i][j] {
+				if !ok {
+					return fmt.Errorf("missing input %d of neuron %d of layer %d", k, j, i)
+				}
+			}
+		}
+	}
+	n.ApplyWeights(weights)
+	return nil
+}
+
+// WriteActivationsCSV computes a forward pass of input without dropout, like
+// Predict, and writes a row of the layer, neuron, activation, sum of
+// inputs and output of each neuron to w as CSV, by layer and neuron. The
+// sum is the input to the activation, after any normalization.
+func (n *Neural) WriteActivationsCSV(w io.Writer, input []float64) error {
+	sums, values, err := n.activations(input)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(activationsCSVHeader)
+	for i, l := range n.Layers {
+		for j := range l.Neurons {
+			cw.Write([]string{
+				strconv.Itoa(i), strconv.Itoa(j), neuronActivation(l, j).String(),
+				strconv.FormatFloat(sums[i][j], 'g', -1, 64), strconv.FormatFloat(values[i][j], 'g', -1, 64),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,107 @@
+package deep
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func csvNetwork() *Neural {
+	return NewNeural(&Config{
+		Inputs:    2,
+		Layout:    []int{3, 2},
+		Recurrent: []bool{true, false},
+		Mode:      ModeMultiClass,
+		Bias:      true,
+	})
+}
+
+func Test_WeightsCSV(t *testing.T) {
+	rand.Seed(0)
+	n := csvNetwork()
+	n.Layers[0].Neurons[1].In[0].Weight = math.Pi / 3
+
+	var b bytes.Buffer
+	assert.NoError(t, n.WriteWeightsCSV(&b))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Equal(t, "layer,neuron,input,kind,weight", lines[0])
+	assert.Len(t, lines, 1+n.NumWeights())
+	// the inputs, recurrent synapses and bias of the first neuron
+	for k, kind := range []string{"weight", "weight", "recurrent", "recurrent", "recurrent", "bias"} {
+		assert.True(t, strings.HasPrefix(lines[1+k], "0,0,"+strconv.Itoa(k)+","+kind+","), lines[1+k])
+	}
+	assert.Contains(t, lines, "0,1,0,weight,1.0471975511965979")
+
+	restored := csvNetwork()
+	assert.NoError(t, restored.LoadWeightsCSV(bytes.NewReader(b.Bytes())))
+	assert.Equal(t, n.Weights(), restored.Weights())
+
+	// rows may be in any order, as after sorting in a spreadsheet
+	rows := append([]string{lines[0]}, lines[1:]...)
+	for i, j := 1, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+	restored = csvNetwork()
+	assert.NoError(t, restored.LoadWeightsCSV(strings.NewReader(strings.Join(rows, "\n"))))
+	assert.Equal(t, n.Weights(), restored.Weights())
+}
+
+func Test_LoadWeightsCSVShapes(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{Inputs: 1, Layout: []int{1}, Mode: ModeBinary, Bias: true})
+	for weights, message := range map[string]string{
+		"layer,neuron,weight\n0,0,1\n":                                   "record on line 1: wrong number of fields",
+		"layer,neuron,index,kind,weight\n":                               `line 1: header ["layer" "neuron" "index" "kind" "weight"], expected ["layer" "neuron" "input" "kind" "weight"]`,
+		"layer,neuron,input,kind,weight\n0,0,0,weight,1\n":               "missing input 1 of neuron 0 of layer 0",
+		"layer,neuron,input,kind,weight\n0,0,x,weight,1\n":               `line 2: invalid input "x"`,
+		"layer,neuron,input,kind,weight\n1,0,0,weight,1\n":               "line 2: layer 1 of a network of 1",
+		"layer,neuron,input,kind,weight\n0,1,0,weight,1\n":               "line 2: neuron 1 of layer 0 of 1 neurons",
+		"layer,neuron,input,kind,weight\n0,0,2,weight,1\n":               "line 2: input 2 of neuron 0 of layer 0 of 2 inputs",
+		"layer,neuron,input,kind,weight\n0,0,0,weight,1\n0,0,0,weight,2": "line 3: input 0 of neuron 0 of layer 0 set twice",
+		"layer,neuron,input,kind,weight\n0,0,1,weight,1\n":               "line 2: weight for input 1 of neuron 0 of layer 0, expected bias",
+		"layer,neuron,input,kind,weight\n0,0,0,weight,one\n":             `line 2: invalid weight "one"`,
+	} {
+		before := n.Weights()
+		assert.EqualError(t, n.LoadWeightsCSV(strings.NewReader(weights)), message)
+		assert.Equal(t, before, n.Weights())
+	}
+}
+
+func Test_ActivationsCSV(t *testing.T) {
+	rand.Seed(0)
+	scaled := RegisterActivation("scaled, shifted", func(x float64) float64 { return 2*x + 1 }, func(y float64) float64 { return 2 })
+	n := NewNeural(&Config{
+		Inputs:      2,
+		Layout:      []int{3, 2},
+		Activations: []ActivationType{scaled, ActivationNone},
+		Mode:        ModeMultiClass,
+		Bias:        true,
+	})
+	input := []float64{0.5, -1}
+
+	var b bytes.Buffer
+	assert.NoError(t, n.WriteActivationsCSV(&b, input))
+	assert.True(t, strings.HasPrefix(b.String(), "layer,neuron,activation,sum,output\n0,0,\"scaled, shifted\","), b.String())
+
+	rows, err := csv.NewReader(&b).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1+3+2)
+	for _, row := range rows[1:4] {
+		sum, _ := strconv.ParseFloat(row[3], 64)
+		output, _ := strconv.ParseFloat(row[4], 64)
+		assert.Equal(t, 2*sum+1, output)
+	}
+	prediction := n.Predict(input)
+	for j, row := range rows[4:] {
+		assert.Equal(t, []string{"1", strconv.Itoa(j), "Softmax"}, row[:3])
+		assert.Equal(t, strconv.FormatFloat(prediction[j], 'g', -1, 64), row[4])
+	}
+
+	assert.Error(t, n.WriteActivationsCSV(&b, []float64{1}))
+}
@@ -0,0 +1,154 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/patrikeh/go-deep/training"
+)
+
+// Predictor predicts the outputs of an input, as a *deep.Neural or a
+// Calibrated network
+type Predictor interface {
+	Predict(input []float64) []float64
+}
+
+// CalibrationBin is the examples whose estimated probability falls in
+// [Low, High), or [Low, 1] for the last bin. An empty bin has a Count of
+// 0, and a MeanEstimate and Frequency of 0.
+type CalibrationBin struct {
+	Low, High float64
+	Count     int
+	// MeanEstimate is the mean estimated probability of the examples, and
+	// Frequency the fraction of them that are positive or correct
+	MeanEstimate, Frequency float64
+}
+
+// Empty reports whether the bin holds no examples
+func (b CalibrationBin) Empty() bool {
+	return b.Count == 0
+}
+
+// CalibrationReport is the calibration of the probabilities of a
+// classifier on examples, by the Brier score and a reliability table
+type CalibrationReport struct {
+	// Brier is the mean over examples of the squared error of the
+	// probabilities, summed over the outputs of a multi-class classifier
+	Brier float64
+	// Bins of equal width of the estimated probability of a single output,
+	// or of the highest output of several against whether it is the class
+	Bins []CalibrationBin
+	// ECE is the expected calibration error, the mean difference between
+	// the MeanEstimate and Frequency of a bin weighted by its Count
+	ECE float64
+}
+
+// Calibration returns the calibration of p on examples by bins, 10 if bins
+// is not positive. The probability of a single output is that of the
+// positive class, whose responses are 0.5 and above.
+func Calibration(p Predictor, examples training.Examples, bins int) CalibrationReport {
+	if bins <= 0 {
+		bins = 10
+	}
+	r := CalibrationReport{Bins: make([]CalibrationBin, bins)}
+	for i := range r.Bins {
+		r.Bins[i].Low, r.Bins[i].High = float64(i)/float64(bins), float64(i+1)/float64(bins)
+	}
+	if len(examples) == 0 {
+		r.Brier, r.ECE = math.NaN(), math.NaN()
+		return r
+	}
+	for _, e := range examples {
+		estimate := p.Predict(e.Input)
+		for j, v := range estimate {
+			r.Brier += (v - e.Response[j]) * (v - e.Response[j])
+		}
+		probability, correct := estimate[0], e.Response[0] >= 0.5
+		if len(estimate) > 1 {
+			c := deep.ArgMax(estimate)
+			probability, correct = estimate[c], c == deep.ArgMax(e.Response)
+		}
+		b := &r.Bins[min(int(probability*float64(bins)), bins-1)]
+		b.Count++
+		b.MeanEstimate += probability
+		if correct {
+			b.Frequency++
+		}
+	}
+	r.Brier /= float64(len(examples))
+	for i := range r.Bins {
+		b := &r.Bins[i]
+		if b.Empty() {
+			continue
+		}
+		b.MeanEstimate /= float64(b.Count)
+		b.Frequency /= float64(b.Count)
+		r.ECE += float64(b.Count) / float64(len(examples)) * math.Abs(b.MeanEstimate-b.Frequency)
+	}
+	return r
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Calibrated is a network whose sigmoid and softmax outputs are predicted
+// with their logits divided by Temperature
+type Calibrated struct {
+	Neural      *deep.Neural
+	Temperature float64
+}
+
+// Predict computes a prediction at the temperature, and panics if it is
+// not positive
+func (c Calibrated) Predict(input []float64) []float64 {
+	out, err := c.Neural.PredictWithTemperature(input, c.Temperature)
+	if err != nil {
+		panic(fmt.Sprintf("eval: %s", err))
+	}
+	return out
+}
+
+// FitTemperature returns n calibrated by the temperature, between 0.01 and
+// 100, of the lowest cross entropy of its probabilities on validation, as
+// in temperature scaling. It returns an error without examples.
+func FitTemperature(n *deep.Neural, validation training.Examples) (Calibrated, error) {
+	if len(validation) == 0 {
+		return Calibrated{}, errors.New("no validation examples")
+	}
+	loss := deep.Loss(deep.BinaryCrossEntropy{})
+	if n.Config.Mode == deep.ModeMultiClass {
+		loss = deep.CrossEntropy{}
+	}
+	nll := func(logT float64) float64 {
+		c := Calibrated{Neural: n, Temperature: math.Exp(logT)}
+		estimates, ideals := make([][]float64, len(validation)), make([][]float64, len(validation))
+		for i, e := range validation {
+			estimates[i], ideals[i] = c.Predict(e.Input), e.Response
+		}
+		return loss.F(estimates, ideals)
+	}
+
+	// golden section search over the log of the temperature
+	ratio := (math.Sqrt(5) - 1) / 2
+	a, b := math.Log(0.01), math.Log(100)
+	x1, x2 := b-ratio*(b-a), a+ratio*(b-a)
+	f1, f2 := nll(x1), nll(x2)
+	for b-a > 1e-6 {
+		if f1 < f2 {
+			b, x2, f2 = x2, x1, f1
+			x1 = b - ratio*(b-a)
+			f1 = nll(x1)
+		} else {
+			a, x1, f1 = x1, x2, f2
+			x2 = a + ratio*(b-a)
+			f2 = nll(x2)
+		}
+	}
+	return Calibrated{Neural: n, Temperature: math.Exp((a + b) / 2)}, nil
+}
@@ -0,0 +1,93 @@
+package eval
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/patrikeh/go-deep/training"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Calibration(t *testing.T) {
+	p := fixed{{0.05}, {0.15}, {0.15}, {0.95}, {1}}
+	examples := training.Examples{
+		{Input: []float64{0}, Response: []float64{0}},
+		{Input: []float64{1}, Response: []float64{0}},
+		{Input: []float64{2}, Response: []float64{1}},
+		{Input: []float64{3}, Response: []float64{1}},
+		{Input: []float64{4}, Response: []float64{1}},
+	}
+	r := Calibration(p, examples, 5)
+	assert.InDelta(t, (0.05*0.05+0.15*0.15+0.85*0.85+0.05*0.05)/5, r.Brier, 1e-12)
+	if assert.Len(t, r.Bins, 5) {
+		assert.Equal(t, 0.2, r.Bins[0].High)
+		assert.Equal(t, 3, r.Bins[0].Count)
+		assert.InDelta(t, 0.35/3, r.Bins[0].MeanEstimate, 1e-12)
+		assert.InDelta(t, 1./3, r.Bins[0].Frequency, 1e-12)
+		for _, b := range r.Bins[1:4] {
+			assert.True(t, b.Empty())
+			assert.Equal(t, 0.0, b.Frequency)
+		}
+		// 1 falls in the last bin
+		assert.Equal(t, 2, r.Bins[4].Count)
+		assert.InDelta(t, 0.975, r.Bins[4].MeanEstimate, 1e-12)
+		assert.Equal(t, 1.0, r.Bins[4].Frequency)
+	}
+	assert.InDelta(t, 3./5*(1./3-0.35/3)+2./5*0.025, r.ECE, 1e-12)
+
+	// the highest of several outputs, against the class
+	r = Calibration(fixed{{0.7, 0.3}, {0.6, 0.4}}, training.Examples{
+		{Input: []float64{0}, Response: []float64{1, 0}},
+		{Input: []float64{1}, Response: []float64{0, 1}},
+	}, 0)
+	assert.Len(t, r.Bins, 10)
+	assert.InDelta(t, (2*0.09+2*0.36)/2, r.Brier, 1e-12)
+	assert.Equal(t, 1, r.Bins[6].Count)
+	assert.Equal(t, 0.0, r.Bins[6].Frequency)
+	assert.Equal(t, 1.0, r.Bins[7].Frequency)
+
+	assert.True(t, math.IsNaN(Calibration(p, nil, 5).Brier))
+}
+
+// fixed predicts its rows by the first input of each
+type fixed [][]float64
+
+func (f fixed) Predict(input []float64) []float64 {
+	return f[int(input[0])]
+}
+
+func Test_FitTemperature(t *testing.T) {
+	// labels of probability sigmoid(x), estimated by sigmoid(3x)
+	r := rand.New(rand.NewSource(0))
+	examples := make(training.Examples, 5000)
+	for i := range examples {
+		x := 4*r.Float64() - 2
+		label := 0.0
+		if r.Float64() < deep.Logistic(x, 1) {
+			label = 1
+		}
+		examples[i] = training.Example{Input: []float64{x}, Response: []float64{label}}
+	}
+	n := deep.NewNeural(&deep.Config{Inputs: 1, Layout: []int{1}, Mode: deep.ModeBinary, Weight: deep.NewNormal(0, 3)})
+	validation, test := examples[:2500], examples[2500:]
+
+	c, err := FitTemperature(n, validation)
+	assert.NoError(t, err)
+	assert.InDelta(t, 3, c.Temperature, 0.4)
+
+	before, after := Calibration(n, test, 10), Calibration(c, test, 10)
+	assert.True(t, after.Brier < before.Brier-0.005, "%v vs %v", after.Brier, before.Brier)
+	assert.True(t, after.ECE < before.ECE/2, "%v vs %v", after.ECE, before.ECE)
+	assert.InDeltaSlice(t, n.Predict([]float64{1.5}), Calibrated{Neural: n, Temperature: 1}.Predict([]float64{1.5}), 1e-12)
+
+	// softmax outputs
+	m := deep.NewNeural(&deep.Config{Inputs: 2, Layout: []int{2}, Mode: deep.ModeMultiClass, Weight: deep.NewNormal(1, 0)})
+	out, _ := m.PredictWithTemperature([]float64{1, 2}, 2)
+	assert.InDeltaSlice(t, out, Calibrated{Neural: m, Temperature: 2}.Predict([]float64{1, 2}), 1e-12)
+
+	_, err = FitTemperature(n, nil)
+	assert.Error(t, err)
+	assert.Panics(t, func() { Calibrated{Neural: n}.Predict([]float64{1}) })
+}
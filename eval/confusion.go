@@ -0,0 +1,278 @@
+package eval
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"text/tabwriter"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/patrikeh/go-deep/training"
+)
+
+// Matrix is the confusion matrix of a classifier. Every class is also
+// counted against the rest, each output of a multi-label classifier as a
+// class of its own.
+//
+// Metrics of a class that are undefined, as the precision of a class that
+// is never estimated or the recall of one absent from the examples, are
+// NaN, and left out of macro averages.
+type Matrix struct {
+	// Counts[i][j] is the number of examples of class i estimated as class
+	// j, nil for multi-label classifiers
+	Counts [][]int
+	// TP, FP, FN and TN are the true and false positives and negatives of
+	// every class
+	TP, FP, FN, TN []int
+}
+
+// ConfusionMatrix returns the confusion matrix of n on examples at a
+// threshold of 0.5, see ConfusionMatrixAt
+func ConfusionMatrix(n *deep.Neural, examples training.Examples) Matrix {
+	return ConfusionMatrixAt(n, examples, 0.5)
+}
+
+// ConfusionMatrixAt returns the confusion matrix of n on examples. The class
+// of ModeMultiClass networks is the argmax of their outputs. The outputs of
+// ModeBinary and ModeMultiLabel networks are positive at threshold and
+// above, a single output being the classes 0 and 1 and several the labels
+// of a multi-label classifier. Other networks are classified by the argmax
+// of several outputs or by a single output thresholded. Responses are
+// positive at 0.5 and above whatever the threshold, as by Scores.
+func ConfusionMatrixAt(n *deep.Neural, examples training.Examples, threshold float64) Matrix {
+	estimates, ideals := predict(n, examples)
+	return confusion(n.Config.Mode, len(n.Layers[len(n.Layers)-1].Neurons), estimates, ideals, threshold)
+}
+
+// confusion returns the confusion matrix of estimates of outputs by mode
+func confusion(mode deep.Mode, outputs int, estimates, ideals [][]float64, threshold float64) Matrix {
+	thresholded := mode == deep.ModeBinary || mode == deep.ModeMultiLabel ||
+		mode != deep.ModeMultiClass && outputs == 1
+	if thresholded && outputs > 1 {
+		m := newMatrix(outputs)
+		for i, est := range estimates {
+			for j := range est {
+				m.count(j, est[j] >= threshold, ideals[i][j] >= 0.5)
+			}
+		}
+		return m
+	}
+
+	classes := outputs
+	if thresholded {
+		classes = 2
+	}
+	m := newMatrix(classes)
+	m.Counts = make([][]int, classes)
+	for i := range m.Counts {
+		m.Counts[i] = make([]int, classes)
+	}
+	class := func(v []float64, threshold float64) int {
+		if !thresholded {
+			return deep.ArgMax(v)
+		}
+		if v[0] >= threshold {
+			return 1
+		}
+		return 0
+	}
+	for i, est := range estimates {
+		actual, estimated := class(ideals[i], 0.5), class(est, threshold)
+		m.Counts[actual][estimated]++
+		for c := 0; c < classes; c++ {
+			m.count(c, estimated == c, actual == c)
+		}
+	}
+	return m
+}
+
+func newMatrix(classes int) Matrix {
+	return Matrix{
+		TP: make([]int, classes),
+		FP: make([]int, classes),
+		FN: make([]int, classes),
+		TN: make([]int, classes),
+	}
+}
+
+// count counts an estimate of class c against the actual class
+func (m Matrix) count(c int, estimated, actual bool) {
+	switch {
+	case estimated && actual:
+		m.TP[c]++
+	case estimated:
+		m.FP[c]++
+	case actual:
+		m.FN[c]++
+	default:
+		m.TN[c]++
+	}
+}
+
+// Classes returns the number of classes
+func (m Matrix) Classes() int {
+	return len(m.TP)
+}
+
+// Support returns the number of examples of class c
+func (m Matrix) Support(c int) int {
+	return m.TP[c] + m.FN[c]
+}
+
+// Precision returns the fraction of the estimates of class c that are
+// correct, NaN if it is never estimated
+func (m Matrix) Precision(c int) float64 {
+	return ratio(m.TP[c], m.TP[c]+m.FP[c])
+}
+
+// Recall returns the fraction of the examples of class c estimated as such,
+// NaN if it is absent
+func (m Matrix) Recall(c int) float64 {
+	return ratio(m.TP[c], m.TP[c]+m.FN[c])
+}
+
+// F1 returns the harmonic mean of the precision and recall of class c, NaN
+// if either is undefined
+func (m Matrix) F1(c int) float64 {
+	return f1(m.Precision(c), m.Recall(c))
+}
+
+// Accuracy returns the fraction of examples whose class is estimated, or of
+// labels of a multi-label classifier
+func (m Matrix) Accuracy() float64 {
+	var correct, total int
+	if m.Counts == nil {
+		for c := range m.TP {
+			correct += m.TP[c] + m.TN[c]
+			total += m.TP[c] + m.TN[c] + m.FP[c] + m.FN[c]
+		}
+		return ratio(correct, total)
+	}
+	for i, row := range m.Counts {
+		for j, count := range row {
+			if i == j {
+				correct += count
+			}
+			total += count
+		}
+	}
+	return ratio(correct, total)
+}
+
+// MacroPrecision returns the mean precision of the classes it is defined for
+func (m Matrix) MacroPrecision() float64 {
+	return m.macro(m.Precision)
+}
+
+// MacroRecall returns the mean recall of the classes present
+func (m Matrix) MacroRecall() float64 {
+	return m.macro(m.Recall)
+}
+
+// MacroF1 returns the mean F1 score of the classes it is defined for
+func (m Matrix) MacroF1() float64 {
+	return m.macro(m.F1)
+}
+
+func (m Matrix) macro(metric func(c int) float64) float64 {
+	var sum float64
+	var defined int
+	for c := range m.TP {
+		if v := metric(c); !math.IsNaN(v) {
+			sum += v
+			defined++
+		}
+	}
+	if defined == 0 {
+		return math.NaN()
+	}
+	return sum / float64(defined)
+}
+
+// MicroPrecision returns the precision of all classes counted together,
+// which for single-label classifiers is the accuracy
+func (m Matrix) MicroPrecision() float64 {
+	tp, fp, _ := m.totals()
+	return ratio(tp, tp+fp)
+}
+
+// MicroRecall returns the recall of all classes counted together
+func (m Matrix) MicroRecall() float64 {
+	tp, _, fn := m.totals()
+	return ratio(tp, tp+fn)
+}
+
+// MicroF1 returns the F1 score of all classes counted together
+func (m Matrix) MicroF1() float64 {
+	return f1(m.MicroPrecision(), m.MicroRecall())
+}
+
+func (m Matrix) totals() (tp, fp, fn int) {
+	for c := range m.TP {
+		tp, fp, fn = tp+m.TP[c], fp+m.FP[c], fn+m.FN[c]
+	}
+	return tp, fp, fn
+}
+
+// String returns a table of the matrix, or of the counts of every label of
+// a multi-label classifier, and of the metrics of every class
+func (m Matrix) String() string {
+	var b bytes.Buffer
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', tabwriter.AlignRight)
+	if m.Counts != nil {
+		fmt.Fprint(w, "actual\\estimated\t")
+		for c := range m.Counts {
+			fmt.Fprintf(w, "%d\t", c)
+		}
+	} else {
+		fmt.Fprint(w, "label\tTP\tFP\tFN\tTN\t")
+	}
+	fmt.Fprintln(w, "precision\trecall\tF1\tsupport\t")
+	for c := range m.TP {
+		fmt.Fprintf(w, "%d\t", c)
+		if m.Counts != nil {
+			for _, count := range m.Counts[c] {
+				fmt.Fprintf(w, "%d\t", count)
+			}
+		} else {
+			fmt.Fprintf(w, "%d\t%d\t%d\t%d\t", m.TP[c], m.FP[c], m.FN[c], m.TN[c])
+		}
+		fmt.Fprintf(w, "%.3f\t%.3f\t%.3f\t%d\t\n", m.Precision(c), m.Recall(c), m.F1(c), m.Support(c))
+	}
+	columns := len(m.Counts)
+	if m.Counts == nil {
+		columns = 4
+	}
+	for _, avg := range []struct {
+		name              string
+		precision, recall float64
+		f1                float64
+	}{
+		{"macro", m.MacroPrecision(), m.MacroRecall(), m.MacroF1()},
+		{"micro", m.MicroPrecision(), m.MicroRecall(), m.MicroF1()},
+	} {
+		fmt.Fprintf(w, "%s\t", avg.name)
+		for i := 0; i < columns; i++ {
+			fmt.Fprint(w, "\t")
+		}
+		fmt.Fprintf(w, "%.3f\t%.3f\t%.3f\t\t\n", avg.precision, avg.recall, avg.f1)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// ratio returns a/b, NaN if b is 0
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return math.NaN()
+	}
+	return float64(a) / float64(b)
+}
+
+// f1 returns the harmonic mean of precision and recall, 0 if both are 0
+func f1(precision, recall float64) float64 {
+	if precision+recall == 0 {
+		return 0
+	}
+	return 2 * precision * recall / (precision + recall)
+}
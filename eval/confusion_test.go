@@ -0,0 +1,112 @@
+package eval
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/patrikeh/go-deep/training"
+	"github.com/stretchr/testify/assert"
+)
+
+func oneHot(classes int, cc ...int) [][]float64 {
+	rows := make([][]float64, len(cc))
+	for i, c := range cc {
+		rows[i] = make([]float64, classes)
+		rows[i][c] = 1
+	}
+	return rows
+}
+
+func Test_ConfusionMatrix(t *testing.T) {
+	// class 3 is neither present nor estimated
+	m := confusion(deep.ModeMultiClass, 4, oneHot(4, 0, 0, 1, 1, 1, 2, 2), oneHot(4, 0, 0, 0, 1, 1, 1, 2), 0.5)
+	assert.Equal(t, [][]int{{2, 1, 0, 0}, {0, 2, 1, 0}, {0, 0, 1, 0}, {0, 0, 0, 0}}, m.Counts)
+	assert.Equal(t, []int{2, 2, 1, 0}, m.TP)
+	assert.Equal(t, []int{0, 1, 1, 0}, m.FP)
+	assert.Equal(t, []int{1, 1, 0, 0}, m.FN)
+	assert.Equal(t, []int{4, 3, 5, 7}, m.TN)
+	assert.Equal(t, 4, m.Classes())
+	assert.Equal(t, 3, m.Support(0))
+
+	for c, want := range [][3]float64{{1, 2. / 3, 0.8}, {2. / 3, 2. / 3, 2. / 3}, {0.5, 1, 2. / 3}} {
+		assert.InDelta(t, want[0], m.Precision(c), 1e-12)
+		assert.InDelta(t, want[1], m.Recall(c), 1e-12)
+		assert.InDelta(t, want[2], m.F1(c), 1e-12)
+	}
+	assert.True(t, math.IsNaN(m.Precision(3)))
+	assert.True(t, math.IsNaN(m.Recall(3)))
+	assert.True(t, math.IsNaN(m.F1(3)))
+
+	assert.InDelta(t, 13./18, m.MacroPrecision(), 1e-12)
+	assert.InDelta(t, 7./9, m.MacroRecall(), 1e-12)
+	assert.InDelta(t, 32./45, m.MacroF1(), 1e-12)
+	assert.InDelta(t, 5./7, m.Accuracy(), 1e-12)
+	assert.InDelta(t, 5./7, m.MicroPrecision(), 1e-12)
+	assert.InDelta(t, 5./7, m.MicroRecall(), 1e-12)
+	assert.InDelta(t, 5./7, m.MicroF1(), 1e-12)
+
+	lines := strings.Split(strings.TrimSpace(m.String()), "\n")
+	assert.Len(t, lines, 7)
+	assert.Equal(t, []string{"actual\\estimated", "0", "1", "2", "3", "precision", "recall", "F1", "support"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"0", "2", "1", "0", "0", "1.000", "0.667", "0.800", "3"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"3", "0", "0", "0", "0", "NaN", "NaN", "NaN", "0"}, strings.Fields(lines[4]))
+	assert.Equal(t, []string{"micro", "0.714", "0.714", "0.714"}, strings.Fields(lines[6]))
+}
+
+func Test_ConfusionMatrixBinary(t *testing.T) {
+	estimates := [][]float64{{0.2}, {0.4}, {0.6}, {0.1}}
+	ideals := [][]float64{{0}, {0}, {1}, {1}}
+	assert.Equal(t, [][]int{{2, 0}, {1, 1}}, confusion(deep.ModeBinary, 1, estimates, ideals, 0.5).Counts)
+
+	m := confusion(deep.ModeBinary, 1, estimates, ideals, 0.3)
+	assert.Equal(t, [][]int{{1, 1}, {1, 1}}, m.Counts)
+	assert.InDelta(t, 0.5, m.Precision(1), 1e-12)
+	assert.InDelta(t, 0.5, m.Recall(0), 1e-12)
+
+	// a single regression output is thresholded as well
+	assert.Equal(t, m, confusion(deep.ModeRegression, 1, estimates, ideals, 0.3))
+
+	// responses are positive at 0.5 whatever the threshold of the estimates
+	smoothed := [][]float64{{0.4}, {0.1}, {0.9}, {0.6}}
+	assert.Equal(t, m, confusion(deep.ModeBinary, 1, estimates, smoothed, 0.3))
+	assert.Equal(t, [][]int{{2, 0}, {2, 0}}, confusion(deep.ModeBinary, 1, estimates, smoothed, 0.7).Counts)
+}
+
+func Test_ConfusionMatrixMultiLabel(t *testing.T) {
+	estimates := [][]float64{{0.9, 0.1}, {0.8, 0.7}, {0.2, 0.6}}
+	ideals := [][]float64{{1, 0}, {0, 1}, {0, 1}}
+	m := confusion(deep.ModeMultiLabel, 2, estimates, ideals, 0.5)
+	assert.Nil(t, m.Counts)
+	assert.Equal(t, []int{1, 2}, m.TP)
+	assert.Equal(t, []int{1, 0}, m.FP)
+	assert.Equal(t, []int{0, 0}, m.FN)
+	assert.Equal(t, []int{1, 1}, m.TN)
+	assert.InDelta(t, 5./6, m.Accuracy(), 1e-12)
+	assert.InDelta(t, 0.75, m.MicroPrecision(), 1e-12)
+	assert.InDelta(t, 1, m.MicroRecall(), 1e-12)
+	assert.InDelta(t, 0.75, m.MacroPrecision(), 1e-12)
+
+	lines := strings.Split(strings.TrimSpace(m.String()), "\n")
+	assert.Len(t, lines, 5)
+	assert.Equal(t, []string{"0", "1", "1", "0", "1", "0.500", "1.000", "0.667", "1"}, strings.Fields(lines[1]))
+
+	// responses are positive at 0.5 whatever the threshold of the estimates
+	m = confusion(deep.ModeMultiLabel, 2, estimates, [][]float64{{0.6, 0.1}, {0.1, 0.6}, {0.1, 0.6}}, 0.65)
+	assert.Equal(t, []int{1, 1}, m.TP)
+	assert.Equal(t, []int{0, 1}, m.FN)
+}
+
+func Test_ConfusionMatrixNetwork(t *testing.T) {
+	// softmax of the inputs, which are classified as themselves
+	n := deep.NewNeural(&deep.Config{Inputs: 3, Layout: []int{3}, Mode: deep.ModeMultiClass, Weight: deep.NewNormal(0, 0)})
+	for j, neuron := range n.Layers[0].Neurons {
+		neuron.In[j].Weight = 1
+	}
+	var examples training.Examples
+	for i, in := range oneHot(3, 0, 1, 2, 2) {
+		examples = append(examples, training.Example{Input: in, Response: oneHot(3, []int{0, 1, 1, 2}[i])[0]})
+	}
+	assert.Equal(t, [][]int{{1, 0, 0}, {0, 1, 1}, {0, 0, 1}}, ConfusionMatrix(n, examples).Counts)
+}
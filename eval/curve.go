@@ -0,0 +1,134 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/patrikeh/go-deep/training"
+)
+
+// ROCPoint is the false and true positive rate of a classifier that
+// estimates the positive class at scores of Threshold and above
+type ROCPoint struct {
+	Threshold float64
+	FPR, TPR  float64
+}
+
+// PRPoint is the precision and recall of a classifier that estimates the
+// positive class at scores of Threshold and above
+type PRPoint struct {
+	Threshold         float64
+	Precision, Recall float64
+}
+
+// Scores returns the estimates of output of n on examples, and whether
+// each example is of the positive class by its response at 0.5 and above
+func Scores(n *deep.Neural, examples training.Examples, output int) (scores []float64, labels []bool) {
+	scores, labels = make([]float64, len(examples)), make([]bool, len(examples))
+	for i, e := range examples {
+		scores[i], labels[i] = n.Predict(e.Input)[output], e.Response[output] >= 0.5
+	}
+	return scores, labels
+}
+
+// ROC returns the ROC curve of scores of labels, from a threshold of +Inf
+// down through every distinct score, and the area under it by the
+// trapezoidal rule. Tied scores are a single point of the curve, such that
+// the area counts a positive tied with a negative as half ranked above it.
+// Labels of a single class have no curve, and return an error.
+func ROC(scores []float64, labels []bool) ([]ROCPoint, float64, error) {
+	counts, positives, negatives, err := sweep(scores, labels)
+	if err != nil {
+		return nil, 0, err
+	}
+	points := []ROCPoint{{Threshold: math.Inf(1)}}
+	var auc float64
+	for _, c := range counts {
+		last := points[len(points)-1]
+		p := ROCPoint{Threshold: c.threshold, FPR: float64(c.fp) / negatives, TPR: float64(c.tp) / positives}
+		auc += (p.FPR - last.FPR) * (p.TPR + last.TPR) / 2
+		points = append(points, p)
+	}
+	return points, auc, nil
+}
+
+// PRCurve returns the precision-recall curve of scores of labels, from the
+// highest distinct score down, and the average precision: the precision at
+// every threshold weighted by the increase in recall, as by scikit-learn.
+// Labels of a single class return an error.
+func PRCurve(scores []float64, labels []bool) ([]PRPoint, float64, error) {
+	counts, positives, _, err := sweep(scores, labels)
+	if err != nil {
+		return nil, 0, err
+	}
+	points := make([]PRPoint, len(counts))
+	var ap, recall float64
+	for i, c := range counts {
+		points[i] = PRPoint{
+			Threshold: c.threshold,
+			Precision: float64(c.tp) / float64(c.tp+c.fp),
+			Recall:    float64(c.tp) / positives,
+		}
+		ap += (points[i].Recall - recall) * points[i].Precision
+		recall = points[i].Recall
+	}
+	return points, ap, nil
+}
+
+// BestF1 returns the threshold of the distinct score of the highest F1
+// score of the positive class, the highest of any ties, and that F1 score
+func BestF1(scores []float64, labels []bool) (threshold, f1 float64, err error) {
+	points, _, err := PRCurve(scores, labels)
+	if err != nil {
+		return 0, 0, err
+	}
+	f1 = -1
+	for _, p := range points {
+		if s := 2 * p.Precision * p.Recall / (p.Precision + p.Recall); s > f1 {
+			threshold, f1 = p.Threshold, s
+		}
+	}
+	return threshold, f1, nil
+}
+
+// count is the true and false positives at a threshold
+type count struct {
+	threshold float64
+	tp, fp    int
+}
+
+// sweep returns the positives of scores at every distinct score, from the
+// highest down, and the number of positive and negative labels
+func sweep(scores []float64, labels []bool) ([]count, float64, float64, error) {
+	if len(scores) != len(labels) {
+		return nil, 0, 0, fmt.Errorf("%d scores for %d labels", len(scores), len(labels))
+	}
+	order := make([]int, len(scores))
+	for i := range order {
+		if math.IsNaN(scores[i]) {
+			return nil, 0, 0, errors.New("scores are NaN")
+		}
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+
+	var counts []count
+	var tp, fp int
+	for i, o := range order {
+		if labels[o] {
+			tp++
+		} else {
+			fp++
+		}
+		if i == len(order)-1 || scores[order[i+1]] != scores[o] {
+			counts = append(counts, count{threshold: scores[o], tp: tp, fp: fp})
+		}
+	}
+	if tp == 0 || fp == 0 {
+		return nil, 0, 0, errors.New("labels are all of one class")
+	}
+	return counts, float64(tp), float64(fp), nil
+}
@@ -0,0 +1,90 @@
+package eval
+
+import (
+	"math"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/patrikeh/go-deep/training"
+	"github.com/stretchr/testify/assert"
+)
+
+// scores with ties, whose values of scikit-learn's roc_auc_score and
+// average_precision_score are 27/35 and 893/1260
+var (
+	tiedScores = []float64{0.9, 0.8, 0.8, 0.7, 0.6, 0.55, 0.55, 0.5, 0.4, 0.3, 0.3, 0.1}
+	tiedLabels = []bool{true, true, false, true, false, true, false, false, true, false, false, false}
+)
+
+func Test_ROC(t *testing.T) {
+	points, auc, err := ROC(tiedScores, tiedLabels)
+	assert.NoError(t, err)
+	assert.InDelta(t, 27./35, auc, 1e-12)
+
+	want := [][2]float64{{0, 0}, {0, 0.2}, {1. / 7, 0.4}, {1. / 7, 0.6}, {2. / 7, 0.6}, {3. / 7, 0.8}, {4. / 7, 0.8}, {4. / 7, 1}, {6. / 7, 1}, {1, 1}}
+	if assert.Len(t, points, len(want)) {
+		assert.Equal(t, math.Inf(1), points[0].Threshold)
+		for i, p := range points {
+			assert.InDelta(t, want[i][0], p.FPR, 1e-12)
+			assert.InDelta(t, want[i][1], p.TPR, 1e-12)
+		}
+		assert.Equal(t, 0.8, points[2].Threshold)
+	}
+
+	// a perfect and a reversed ranking
+	_, auc, _ = ROC([]float64{0.1, 0.2, 0.8, 0.9}, []bool{false, false, true, true})
+	assert.Equal(t, 1.0, auc)
+	_, auc, _ = ROC([]float64{0.1, 0.2, 0.8, 0.9}, []bool{true, true, false, false})
+	assert.Equal(t, 0.0, auc)
+	// all tied is chance
+	_, auc, _ = ROC([]float64{0.5, 0.5, 0.5}, []bool{true, false, false})
+	assert.Equal(t, 0.5, auc)
+
+	_, _, err = ROC([]float64{0.1, 0.2}, []bool{true, true})
+	assert.Error(t, err)
+	_, _, err = ROC([]float64{0.1, 0.2}, []bool{false, false})
+	assert.Error(t, err)
+	_, _, err = ROC([]float64{0.1}, []bool{true, false})
+	assert.Error(t, err)
+	_, _, err = ROC(nil, nil)
+	assert.Error(t, err)
+}
+
+func Test_PRCurve(t *testing.T) {
+	points, ap, err := PRCurve(tiedScores, tiedLabels)
+	assert.NoError(t, err)
+	assert.InDelta(t, 893./1260, ap, 1e-12)
+	if assert.Len(t, points, 9) {
+		assert.Equal(t, PRPoint{Threshold: 0.9, Precision: 1, Recall: 0.2}, points[0])
+		assert.InDelta(t, 2./3, points[1].Precision, 1e-12)
+		assert.InDelta(t, 0.4, points[1].Recall, 1e-12)
+		assert.InDelta(t, 5./12, points[8].Precision, 1e-12)
+		assert.Equal(t, 1.0, points[8].Recall)
+	}
+
+	threshold, f1, err := BestF1(tiedScores, tiedLabels)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.4, threshold)
+	assert.InDelta(t, 5./7, f1, 1e-12)
+
+	_, _, err = PRCurve([]float64{0.1, 0.2}, []bool{false, false})
+	assert.Error(t, err)
+	_, _, err = BestF1([]float64{0.1, 0.2}, []bool{true, true})
+	assert.Error(t, err)
+}
+
+func Test_Scores(t *testing.T) {
+	// the identity of a single input
+	n := deep.NewNeural(&deep.Config{Inputs: 1, Layout: []int{1}, Mode: deep.ModeRegression, Weight: deep.NewNormal(0, 1)})
+	var examples training.Examples
+	for i, s := range tiedScores {
+		label := 0.0
+		if tiedLabels[i] {
+			label = 1
+		}
+		examples = append(examples, training.Example{Input: []float64{s}, Response: []float64{label}})
+	}
+	scores, labels := Scores(n, examples, 0)
+	assert.InDeltaSlice(t, tiedScores, scores, 1e-12)
+	assert.Equal(t, tiedLabels, labels)
+}
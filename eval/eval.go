@@ -0,0 +1,16 @@
+// Package eval evaluates trained networks on held-out examples
+package eval
+
+import (
+	deep "github.com/patrikeh/go-deep"
+	"github.com/patrikeh/go-deep/training"
+)
+
+// predict returns the estimates of n and the ideals of examples
+func predict(n *deep.Neural, examples training.Examples) (estimates, ideals [][]float64) {
+	estimates, ideals = make([][]float64, len(examples)), make([][]float64, len(examples))
+	for i, e := range examples {
+		estimates[i], ideals[i] = n.Predict(e.Input), e.Response
+	}
+	return estimates, ideals
+}
@@ -0,0 +1,104 @@
+package eval
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/patrikeh/go-deep/training"
+)
+
+// Importance is the degradation of a metric when the values of an input
+// are shuffled across examples, by its Mean and standard deviation over
+// the repeats
+type Importance struct {
+	Feature      int
+	Mean, Stddev float64
+}
+
+// ImportanceOption configures PermutationImportance
+type ImportanceOption func(*importanceOptions)
+
+type importanceOptions struct {
+	rand *rand.Rand
+}
+
+// WithSeed shuffles the inputs of PermutationImportance by a source seeded
+// by seed, rather than by the global source
+func WithSeed(seed int64) ImportanceOption {
+	return func(o *importanceOptions) {
+		o.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// PermutationImportance returns the importance of each input of n to metric
+// on examples, how much worse the metric of the examples with the input
+// shuffled across them is than that of the examples, repeats times, 1 if
+// repeats is not positive. Higher values of metric are better if
+// higherIsBetter is set, as of training.Accuracy, and lower otherwise, as
+// of training.RMSE. Importances are sorted by Mean, the highest first, then
+// by feature. The examples are left as they were.
+func PermutationImportance(n *deep.Neural, examples training.Examples, metric training.Metric, higherIsBetter bool, repeats int, opts ...ImportanceOption) []Importance {
+	if repeats <= 0 {
+		repeats = 1
+	}
+	var o importanceOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	shuffle := rand.Shuffle
+	if o.rand != nil {
+		shuffle = o.rand.Shuffle
+	}
+
+	// the degradation of the metric of the examples from the baseline
+	compute := func(examples training.Examples) float64 {
+		return metric.Compute(predict(n, examples))
+	}
+	baseline := compute(examples)
+	degradation := func(m float64) float64 {
+		if higherIsBetter {
+			return baseline - m
+		}
+		return m - baseline
+	}
+
+	// the examples with inputs of their own, of which one column at a time
+	// is shuffled and then restored
+	shuffled := make(training.Examples, len(examples))
+	for i, e := range examples {
+		shuffled[i] = e
+		shuffled[i].Input = append([]float64(nil), e.Input...)
+	}
+	column := make([]float64, len(examples))
+	importances := make([]Importance, n.Config.Inputs)
+	for j := range importances {
+		degradations := make([]float64, repeats)
+		for r := range degradations {
+			for i, e := range examples {
+				column[i] = e.Input[j]
+			}
+			shuffle(len(column), func(a, b int) { column[a], column[b] = column[b], column[a] })
+			for i := range shuffled {
+				shuffled[i].Input[j] = column[i]
+			}
+			degradations[r] = degradation(compute(shuffled))
+		}
+		for i, e := range examples {
+			shuffled[i].Input[j] = e.Input[j]
+		}
+		importances[j].Feature = j
+		for _, d := range degradations {
+			importances[j].Mean += d / float64(repeats)
+		}
+		for _, d := range degradations {
+			importances[j].Stddev += (d - importances[j].Mean) * (d - importances[j].Mean) / float64(repeats)
+		}
+		importances[j].Stddev = math.Sqrt(importances[j].Stddev)
+	}
+	sort.SliceStable(importances, func(a, b int) bool {
+		return importances[a].Mean > importances[b].Mean
+	})
+	return importances
+}
@@ -0,0 +1,78 @@
+package eval
+
+import (
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/patrikeh/go-deep/training"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PermutationImportance(t *testing.T) {
+	rand.Seed(0)
+	// only features 0 and 3 of 6 determine the response
+	var examples training.Examples
+	for i := 0; i < 200; i++ {
+		input := make([]float64, 6)
+		for j := range input {
+			input[j] = rand.Float64()*2 - 1
+		}
+		examples = append(examples, training.Example{Input: input, Response: []float64{input[0] - 2*input[3]}})
+	}
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     6,
+		Layout:     []int{8, 1},
+		Activation: deep.ActivationTanh,
+		Mode:       deep.ModeRegression,
+		Weight:     deep.NewNormal(0.5, 0),
+		Bias:       true,
+	})
+	training.NewBatchTrainer(training.NewAdam(0.02, 0, 0, 0), 0, 20, 1, training.WithSeed(1)).Train(n, examples, nil, 200)
+
+	inputs := make([][]float64, len(examples))
+	for i, e := range examples {
+		inputs[i] = append([]float64(nil), e.Input...)
+	}
+	importances := PermutationImportance(n, examples, training.RMSE{}, false, 5, WithSeed(1))
+	assert.Len(t, importances, 6)
+	assert.Equal(t, 3, importances[0].Feature)
+	assert.Equal(t, 0, importances[1].Feature)
+	for i, imp := range importances {
+		assert.True(t, i == 0 || imp.Mean <= importances[i-1].Mean, "%v", importances)
+		assert.True(t, imp.Stddev >= 0, "%v", imp)
+	}
+	assert.True(t, importances[1].Mean > 10*importances[2].Mean, "%v", importances)
+	for i, e := range examples {
+		assert.Equal(t, inputs[i], e.Input)
+	}
+
+	// the same shuffles by the same seed
+	assert.Equal(t, importances, PermutationImportance(n, examples, training.RMSE{}, false, 5, WithSeed(1)))
+	once := PermutationImportance(n, examples, training.RMSE{}, false, 0, WithSeed(1))
+	for _, imp := range once {
+		assert.Equal(t, 0.0, imp.Stddev)
+	}
+}
+
+func Test_PermutationImportanceAccuracy(t *testing.T) {
+	rand.Seed(0)
+	n := deep.NewNeural(&deep.Config{Inputs: 2, Layout: []int{2}, Mode: deep.ModeMultiClass, Weight: deep.NewNormal(1, 0), Bias: true})
+	// the class is 1 for a first input above 0.5, and the constant second
+	// input never matters
+	weights := n.Weights()
+	weights[0] = [][]float64{{0, 0, 0.5}, {1, 0, 0}}
+	n.ApplyWeights(weights)
+	var examples training.Examples
+	for i := 0; i < 100; i++ {
+		x := float64(i%2) + 0.1*rand.Float64()
+		examples = append(examples, training.Example{Input: []float64{x, 0}, Response: oneHot(2, i%2)[0]})
+	}
+	accuracy := training.Accuracy{Mode: deep.ModeMultiClass}
+	assert.Equal(t, 1.0, accuracy.Compute(predict(n, examples)))
+
+	importances := PermutationImportance(n, examples, accuracy, true, 10, WithSeed(2))
+	assert.Equal(t, 0, importances[0].Feature)
+	assert.True(t, importances[0].Mean > 0.3, "%v", importances)
+	assert.Equal(t, Importance{Feature: 1}, importances[1])
+}
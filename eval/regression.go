@@ -0,0 +1,87 @@
+package eval
+
+import (
+	"bytes"
+	"fmt"
+	"text/tabwriter"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/patrikeh/go-deep/training"
+)
+
+// RegressionStats are the metrics of regression by training.R2, MAE, RMSE
+// and MAPE. Skipped is the number of ideals of 0 left out of MAPE.
+type RegressionStats struct {
+	R2, MAE, RMSE, MAPE float64
+	Skipped             int
+}
+
+// RegressionReport are the metrics of a regression network on examples,
+// of every output and of all outputs together, where R2 is averaged over
+// outputs
+type RegressionReport struct {
+	Outputs []RegressionStats
+	Overall RegressionStats
+}
+
+// Regression returns the report of n on examples
+func Regression(n *deep.Neural, examples training.Examples) RegressionReport {
+	estimates, ideals := predict(n, examples)
+	return regression(estimates, ideals)
+}
+
+// regression returns the report of estimates
+func regression(estimates, ideals [][]float64) RegressionReport {
+	var r RegressionReport
+	if len(ideals) == 0 {
+		return r
+	}
+	for j := range ideals[0] {
+		est, ideal := column(estimates, j), column(ideals, j)
+		r.Outputs = append(r.Outputs, regressionStats(est, ideal))
+	}
+	r.Overall = regressionStats(estimates, ideals)
+	return r
+}
+
+func regressionStats(estimates, ideals [][]float64) RegressionStats {
+	s := RegressionStats{
+		R2:   training.R2{}.Compute(estimates, ideals),
+		MAE:  training.MAE{}.Compute(estimates, ideals),
+		RMSE: training.RMSE{}.Compute(estimates, ideals),
+		MAPE: training.MAPE{}.Compute(estimates, ideals),
+	}
+	for _, ideal := range ideals {
+		for _, v := range ideal {
+			if v == 0 {
+				s.Skipped++
+			}
+		}
+	}
+	return s
+}
+
+// column returns output j of every row as a row of its own
+func column(rows [][]float64, j int) [][]float64 {
+	c := make([][]float64, len(rows))
+	for i, row := range rows {
+		c[i] = row[j : j+1]
+	}
+	return c
+}
+
+// String returns a table of the metrics of every output and of all
+func (r RegressionReport) String() string {
+	var b bytes.Buffer
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "output\tR2\tMAE\tRMSE\tMAPE\tskipped\t")
+	row := func(name string, s RegressionStats) {
+		fmt.Fprintf(w, "%s\t%.4f\t%.4f\t%.4f\t%.4f\t%d\t\n", name, s.R2, s.MAE, s.RMSE, s.MAPE, s.Skipped)
+	}
+	for j, s := range r.Outputs {
+		row(fmt.Sprint(j), s)
+	}
+	row("all", r.Overall)
+	w.Flush()
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/patrikeh/go-deep/training"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Regression(t *testing.T) {
+	ideals := [][]float64{{1, 0}, {2, 2}, {3, 4}, {4, -2}}
+	estimates := [][]float64{{1.5, 0.5}, {2, 1}, {2, 4}, {5, -1}}
+	r := regression(estimates, ideals)
+
+	want := []RegressionStats{
+		// residuals of .5, 0, -1 and 1 about a mean of 2.5
+		{R2: 1 - 2.25/5, MAE: 0.625, RMSE: 0.75, MAPE: (0.5 + 1./3 + 0.25) / 4},
+		// residuals of .5, -1, 0 and 1 about a mean of 1, and an ideal of 0
+		{R2: 1 - 2.25/20, MAE: 0.625, RMSE: 0.75, MAPE: (0.5 + 0.5) / 3, Skipped: 1},
+	}
+	overall := RegressionStats{R2: (0.55 + 0.8875) / 2, MAE: 0.625, RMSE: 0.75, MAPE: (0.5 + 1./3 + 0.25 + 0.5 + 0.5) / 7, Skipped: 1}
+	if assert.Len(t, r.Outputs, 2) {
+		for j, s := range append(want, overall) {
+			got := r.Overall
+			if j < 2 {
+				got = r.Outputs[j]
+			}
+			assert.InDelta(t, s.R2, got.R2, 1e-12, "output %d", j)
+			assert.InDelta(t, s.MAE, got.MAE, 1e-12, "output %d", j)
+			assert.InDelta(t, s.RMSE, got.RMSE, 1e-12, "output %d", j)
+			assert.InDelta(t, s.MAPE, got.MAPE, 1e-12, "output %d", j)
+			assert.Equal(t, s.Skipped, got.Skipped, "output %d", j)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(r.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, []string{"output", "R2", "MAE", "RMSE", "MAPE", "skipped"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"1", "0.8875", "0.6250", "0.7500", "0.3333", "1"}, strings.Fields(lines[2]))
+	assert.Equal(t, "all", strings.Fields(lines[3])[0])
+
+	assert.Empty(t, regression(nil, nil).Outputs)
+}
+
+func Test_RegressionNetwork(t *testing.T) {
+	// the identity of two inputs
+	n := deep.NewNeural(&deep.Config{Inputs: 2, Layout: []int{2}, Mode: deep.ModeRegression, Weight: deep.NewNormal(0, 0)})
+	for j, neuron := range n.Layers[0].Neurons {
+		neuron.In[j].Weight = 1
+	}
+	var examples training.Examples
+	for _, e := range [][]float64{{1, 2}, {3, 5}, {-1, 0}} {
+		examples = append(examples, training.Example{Input: e, Response: []float64{e[0] + 1, e[1]}})
+	}
+	r := Regression(n, examples)
+	assert.Equal(t, 1.0, r.Outputs[0].MAE)
+	assert.Equal(t, 0.0, r.Outputs[1].RMSE)
+	assert.Equal(t, 1.0, r.Outputs[1].R2)
+	assert.Equal(t, 2, r.Overall.Skipped)
+}
@@ -0,0 +1,36 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/patrikeh/go-deep/training"
+)
+
+// TopKAccuracy returns the fraction of examples whose class, the argmax of
+// the response, is among the k classes of the highest outputs of n, NaN
+// without examples. It returns the error of an invalid k.
+func TopKAccuracy(n *deep.Neural, examples training.Examples, k int) (float64, error) {
+	if k <= 0 {
+		return 0, fmt.Errorf("invalid k %d, must be positive", k)
+	}
+	if len(examples) == 0 {
+		return math.NaN(), nil
+	}
+	var correct int
+	for _, e := range examples {
+		top, err := n.PredictTopK(e.Input, k)
+		if err != nil {
+			return 0, err
+		}
+		class := deep.ArgMax(e.Response)
+		for _, p := range top {
+			if p.Class == class {
+				correct++
+				break
+			}
+		}
+	}
+	return float64(correct) / float64(len(examples)), nil
+}
@@ -0,0 +1,45 @@
+package eval
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/patrikeh/go-deep/training"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TopKAccuracy(t *testing.T) {
+	rand.Seed(0)
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     2,
+		Layout:     []int{4, 5},
+		Activation: deep.ActivationTanh,
+		Mode:       deep.ModeMultiClass,
+		Weight:     deep.NewNormal(1, 0),
+		Bias:       true,
+	})
+	var examples training.Examples
+	for i := 0; i < 50; i++ {
+		examples = append(examples, training.Example{
+			Input:    []float64{rand.Float64(), rand.Float64()},
+			Response: oneHot(5, i%5)[0],
+		})
+	}
+
+	// top-1 is the accuracy of the argmax
+	top1, err := TopKAccuracy(n, examples, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, ConfusionMatrix(n, examples).Accuracy(), top1)
+	top3, _ := TopKAccuracy(n, examples, 3)
+	assert.True(t, top3 >= top1)
+	all, _ := TopKAccuracy(n, examples, 6)
+	assert.Equal(t, 1.0, all)
+
+	empty, err := TopKAccuracy(n, nil, 2)
+	assert.NoError(t, err)
+	assert.True(t, math.IsNaN(empty))
+	_, err = TopKAccuracy(n, examples, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,109 @@
+package deep
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileOption configures SaveFile
+type FileOption func(*fileOptions)
+
+type fileOptions struct {
+	gzip bool
+}
+
+// WithGzip compresses the file by gzip, as do paths ending in .gz
+func WithGzip() FileOption {
+	return func(o *fileOptions) {
+		o.gzip = true
+	}
+}
+
+// SaveFile writes n to path by Save, through a temporary file next to it
+// that is renamed to path once written, so that path never holds part of
+// a network
+func (n *Neural) SaveFile(path string, opts ...FileOption) error {
+	o := fileOptions{gzip: strings.HasSuffix(path, ".gz")}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return writeFile(path, o.gzip, n.Save)
+}
+
+// writeFile writes path atomically by write, compressed if gzipped, of the
+// mode of the file it replaces or else 0644
+func writeFile(path string, gzipped bool, write func(io.Writer) error) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	// keep the mode of the file replaced, or that of a file created anew
+	// rather than the private one of a temporary file
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := f.Chmod(mode); err != nil {
+		return fail(err)
+	}
+	buffered := bufio.NewWriter(f)
+	w := io.Writer(buffered)
+	var z *gzip.Writer
+	if gzipped {
+		z = gzip.NewWriter(buffered)
+		w = z
+	}
+	if err := write(w); err != nil {
+		return fail(err)
+	}
+	if z != nil {
+		if err := z.Close(); err != nil {
+			return fail(err)
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := f.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// LoadFile reads a network written by SaveFile from path, decompressing
+// it if it is gzipped
+func LoadFile(path string) (*Neural, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	if magic, err := r.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		z, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer z.Close()
+		return Load(z)
+	}
+	return Load(r)
+}
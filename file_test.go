@@ -0,0 +1,83 @@
+package deep
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SaveFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "networks")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	n := fileNetwork()
+
+	for _, c := range []struct {
+		name    string
+		opts    []FileOption
+		gzipped bool
+	}{
+		{"net.bin", nil, false},
+		{"net.bin.gz", nil, true},
+		{"compressed.bin", []FileOption{WithGzip()}, true},
+	} {
+		path := filepath.Join(dir, c.name)
+		assert.NoError(t, n.SaveFile(path, c.opts...))
+		b, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, c.gzipped, b[0] == 0x1f && b[1] == 0x8b, c.name)
+
+		restored, err := LoadFile(path)
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, n.Weights(), restored.Weights(), c.name)
+	}
+	_, err = LoadFile(filepath.Join(dir, "missing.bin"))
+	assert.Error(t, err)
+
+	// a new file is of mode 0644, and a replaced one keeps its mode
+	path := filepath.Join(dir, "net.bin")
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	assert.NoError(t, os.Chmod(path, 0640))
+	assert.NoError(t, n.SaveFile(path))
+	info, err = os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+}
+
+func Test_SaveFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "networks")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "net.bin")
+	n := fileNetwork()
+	assert.NoError(t, n.SaveFile(path))
+	saved, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+
+	for _, gzipped := range []bool{false, true} {
+		// a write that fails halfway leaves the saved network as it was
+		err = writeFile(path, gzipped, func(w io.Writer) error {
+			b, err := n.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			w.Write(b[:len(b)/2])
+			return errors.New("disk full")
+		})
+		assert.EqualError(t, err, "disk full")
+
+		files, err := ioutil.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Len(t, files, 1)
+		b, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, saved, b)
+	}
+}
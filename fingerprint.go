@@ -0,0 +1,141 @@
+package deep
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math"
+	"reflect"
+)
+
+// Fingerprint returns the hex SHA-256 of a canonical encoding of the config
+// and learned parameters of n, so that networks of the same config and
+// parameters, and only those, have the same fingerprint on any platform.
+// The config is encoded field by field in declaration order, by name and
+// leaving out zero fields, so that fields added later do not change the
+// fingerprints of networks that leave them unset; initializers and seeds
+// are left out. Parameters follow in the order of Weights, then the PReLU
+// slopes, normalizations, convolution and pruned synapses, with floats
+// encoded by their IEEE 754 bits.
+func (n *Neural) Fingerprint() string {
+	h := sha256.New()
+	f := fingerprint{h}
+	f.value(reflect.ValueOf(*n.Config))
+
+	f.string("weights")
+	for _, l := range n.Layers {
+		f.int(int64(len(l.Neurons)))
+		for _, neuron := range l.Neurons {
+			f.int(int64(len(neuron.In)))
+			for _, s := range neuron.In {
+				f.float(s.Weight)
+			}
+		}
+	}
+	f.string("alphas")
+	for _, l := range n.Layers {
+		f.float(l.Alpha)
+	}
+	f.string("norms")
+	for _, l := range n.Layers {
+		if l.Norm == nil {
+			f.int(0)
+			continue
+		}
+		f.int(1)
+		f.value(reflect.ValueOf(*l.Norm))
+	}
+	if n.Conv != nil {
+		f.string("conv")
+		f.value(reflect.ValueOf(n.Conv.Kernels))
+		f.value(reflect.ValueOf(n.Conv.Biases))
+	}
+	f.string("pruned")
+	f.value(reflect.ValueOf(n.pruned()))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fingerprint encodes values canonically to a hash
+type fingerprint struct {
+	h hash.Hash
+}
+
+func (f fingerprint) int(v int64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(v))
+	f.h.Write(b[:])
+}
+
+func (f fingerprint) float(v float64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+	f.h.Write(b[:])
+}
+
+func (f fingerprint) string(s string) {
+	f.int(int64(len(s)))
+	f.h.Write([]byte(s))
+}
+
+// value encodes v by its kind, activations and losses by name since those
+// registered are numbered in order of registration
+func (f fingerprint) value(v reflect.Value) {
+	switch x := v.Interface().(type) {
+	case ActivationType:
+		f.string(x.String())
+		return
+	case LossType:
+		f.string(x.String())
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			f.int(1)
+		} else {
+			f.int(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f.int(v.Int())
+	case reflect.Float32, reflect.Float64:
+		f.float(v.Float())
+	case reflect.String:
+		f.string(v.String())
+	case reflect.Slice, reflect.Array:
+		f.int(int64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			f.value(v.Index(i))
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			f.int(0)
+			return
+		}
+		f.int(1)
+		f.value(v.Elem())
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" || isZero(v.Field(i)) || (t == reflect.TypeOf(Config{}) && (field.Name == "Weight" || field.Name == "Seed")) {
+				continue
+			}
+			f.string(field.Name)
+			f.value(v.Field(i))
+		}
+		f.string("")
+	default:
+		panic(fmt.Sprintf("deep: cannot fingerprint %s", v.Type()))
+	}
+}
+
+// isZero reports whether v is the zero value of its type, or an empty
+// slice
+func isZero(v reflect.Value) bool {
+	if v.Kind() == reflect.Slice {
+		return v.Len() == 0
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
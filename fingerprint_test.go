@@ -0,0 +1,68 @@
+package deep
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fingerprintNetwork() *Neural {
+	return NewNeural(&Config{
+		Inputs:     3,
+		Layout:     []int{4, 2},
+		Activation: ActivationPReLU,
+		Mode:       ModeMultiClass,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+		Seed:       42,
+		BatchNorm:  []bool{true, false},
+	})
+}
+
+func Test_Fingerprint(t *testing.T) {
+	n := fingerprintNetwork()
+	fingerprint := n.Fingerprint()
+	assert.Len(t, fingerprint, 64)
+	assert.Equal(t, fingerprint, n.Fingerprint())
+	assert.Equal(t, fingerprint, fingerprintNetwork().Fingerprint())
+
+	// clones by either format have the same fingerprint
+	dump, err := n.Marshal()
+	assert.NoError(t, err)
+	clone, err := Unmarshal(dump)
+	assert.NoError(t, err)
+	assert.Equal(t, fingerprint, clone.Fingerprint())
+	b, err := n.MarshalBinary()
+	assert.NoError(t, err)
+	var restored Neural
+	assert.NoError(t, restored.UnmarshalBinary(b))
+	assert.Equal(t, fingerprint, restored.Fingerprint())
+
+	// pinned, as it must not change across platforms and versions
+	assert.Equal(t, "ea4899c0002b298cae098c2a3e8189ca1de5bcf3729378ecd7b6bf62a4d1dfc0", fingerprint)
+}
+
+func Test_FingerprintChanges(t *testing.T) {
+	fingerprint := fingerprintNetwork().Fingerprint()
+	for name, change := range map[string]func(n *Neural){
+		"weight bit": func(n *Neural) {
+			w := &n.Layers[1].Neurons[0].In[2].Weight
+			*w = math.Float64frombits(math.Float64bits(*w) ^ 1)
+		},
+		"alpha": func(n *Neural) { n.Layers[0].Alpha = 0.3 },
+		"norm":  func(n *Neural) { n.Layers[0].Norm.Mean[1] = 0.5 },
+		"l2":    func(n *Neural) { n.Config.L2 = 1e-4 },
+		"loss":  func(n *Neural) { n.Config.Loss = LossMeanSquared },
+		"prune": func(n *Neural) { n.Prune(0.5) },
+	} {
+		n := fingerprintNetwork()
+		change(n)
+		assert.NotEqual(t, fingerprint, n.Fingerprint(), name)
+	}
+
+	// initializers and seeds leave it unchanged
+	n := fingerprintNetwork()
+	n.Config.Weight, n.Config.Seed = WeightHe, 7
+	assert.Equal(t, fingerprint, n.Fingerprint())
+}
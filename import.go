@@ -0,0 +1,355 @@
+package deep
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// WeightFormat is a format of the weights read by ImportWeights
+type WeightFormat int
+
+const (
+	// WeightsNPZ is a NumPy .npz archive holding, for each layer i, an
+	// array kernel_i of shape (in, out), an array bias_i of shape (out,)
+	// unless the layer has no biases, and optionally a string activation_i
+	// naming its Keras activation. Those of a Keras model of Dense layers
+	// are written by:
+	//
+	//	weights = {}
+	//	for i, layer in enumerate(model.layers):
+	//	    weights[f"kernel_{i}"], weights[f"bias_{i}"] = layer.get_weights()
+	//	    weights[f"activation_{i}"] = layer.activation.__name__
+	//	np.savez("weights.npz", **weights)
+	WeightsNPZ WeightFormat = 1
+	// WeightsJSON is a JSON object of the same arrays by layer:
+	// {"layers": [{"kernel": [[...], ...], "bias": [...], "activation": "relu"}, ...]}
+	WeightsJSON WeightFormat = 2
+)
+
+// kerasActivations are the activations of the names of Keras activations
+var kerasActivations = map[string]ActivationType{
+	"sigmoid":      ActivationSigmoid,
+	"tanh":         ActivationTanh,
+	"relu":         ActivationReLU,
+	"linear":       ActivationLinear,
+	"softmax":      ActivationSoftmax,
+	"exponential":  ActivationExp,
+	"leaky_relu":   ActivationLeakyReLU,
+	"elu":          ActivationELU,
+	"selu":         ActivationSELU,
+	"gelu":         ActivationGELU,
+	"swish":        ActivationSwish,
+	"silu":         ActivationSwish,
+	"softplus":     ActivationSoftplus,
+	"hard_sigmoid": ActivationHardSigmoid,
+}
+
+// importedLayer are the weights of a layer read by ImportWeights, with the
+// kernel in row-major order
+type importedLayer struct {
+	Kernel     [][]float64
+	Bias       []float64
+	Activation string
+
+	kernel     []float64
+	kernelDims []int
+	biasDims   []int
+}
+
+// ImportWeights sets the weights of net to those of each layer read from r
+// in format, such as those of a Keras model of Dense layers. Kernels are
+// in the conventional (in, out) orientation. The shapes must match those
+// of the layers of net exactly, else an error naming the layer is returned
+// and no weight is set; activations that differ from those of net are
+// logged. Networks of convolutions, normalizations or recurrent layers
+// cannot be imported.
+func ImportWeights(net *Neural, r io.Reader, format WeightFormat) error {
+	var layers []importedLayer
+	var err error
+	switch format {
+	case WeightsNPZ:
+		layers, err = readNPZ(r)
+	case WeightsJSON:
+		layers, err = readWeightsJSON(r)
+	default:
+		return fmt.Errorf("unknown weight format %d", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case net.Conv != nil:
+		return fmt.Errorf("cannot import the weights of convolutions")
+	case net.Recurrent():
+		return fmt.Errorf("cannot import the weights of recurrent layers")
+	case net.Normalized():
+		return fmt.Errorf("cannot import the weights of normalizations")
+	case len(layers) != len(net.Layers):
+		return fmt.Errorf("%d layers of weights for a network of %d", len(layers), len(net.Layers))
+	}
+	for i, l := range net.Layers {
+		fanIn, biased := fanIn(l)
+		imported := layers[i]
+		if want := []int{fanIn, len(l.Neurons)}; !sameDims(imported.kernelDims, want) {
+			return fmt.Errorf("layer %d: kernel of shape %s, expected %s", i, dims(imported.kernelDims), dims(want))
+		}
+		switch want := []int{len(l.Neurons)}; {
+		case biased && imported.biasDims == nil:
+			return fmt.Errorf("layer %d: missing bias of shape %s", i, dims(want))
+		case !biased && imported.biasDims != nil:
+			return fmt.Errorf("layer %d: bias of shape %s for a layer without biases", i, dims(imported.biasDims))
+		case biased && !sameDims(imported.biasDims, want):
+			return fmt.Errorf("layer %d: bias of shape %s, expected %s", i, dims(imported.biasDims), dims(want))
+		}
+		if imported.Activation != "" {
+			a, ok := kerasActivations[imported.Activation]
+			if !ok || a != l.A {
+				log.Printf("deep: layer %d: imported activation %s, the network has %s", i, imported.Activation, l.A)
+			}
+		}
+	}
+
+	for i, l := range net.Layers {
+		fanIn, biased := fanIn(l)
+		for j, neuron := range l.Neurons {
+			for k := 0; k < fanIn; k++ {
+				neuron.In[k].Weight = layers[i].kernel[k*len(l.Neurons)+j]
+			}
+			if biased {
+				neuron.In[fanIn].Weight = layers[i].Bias[j]
+			}
+		}
+	}
+	return nil
+}
+
+// fanIn returns the number of inputs of each neuron of l other than its
+// bias, and whether it has one
+func fanIn(l *Layer) (int, bool) {
+	in := l.Neurons[0].In
+	if len(in) > 0 && in[len(in)-1].IsBias {
+		return len(in) - 1, true
+	}
+	return len(in), false
+}
+
+func sameDims(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// dims formats a shape as NumPy does
+func dims(shape []int) string {
+	s := make([]string, len(shape))
+	for i, d := range shape {
+		s[i] = strconv.Itoa(d)
+	}
+	if len(s) == 1 {
+		return "(" + s[0] + ",)"
+	}
+	return "(" + strings.Join(s, ", ") + ")"
+}
+
+// readWeightsJSON reads layers in WeightsJSON
+func readWeightsJSON(r io.Reader) ([]importedLayer, error) {
+	var weights struct {
+		Layers []importedLayer
+	}
+	if err := json.NewDecoder(r).Decode(&weights); err != nil {
+		return nil, err
+	}
+	for i := range weights.Layers {
+		l := &weights.Layers[i]
+		l.kernelDims = []int{len(l.Kernel), 0}
+		for j, row := range l.Kernel {
+			if j > 0 && len(row) != l.kernelDims[1] {
+				return nil, fmt.Errorf("layer %d: kernel rows of %d and %d weights", i, l.kernelDims[1], len(row))
+			}
+			l.kernelDims[1] = len(row)
+			l.kernel = append(l.kernel, row...)
+		}
+		if l.Bias != nil {
+			l.biasDims = []int{len(l.Bias)}
+		}
+	}
+	return weights.Layers, nil
+}
+
+// readNPZ reads layers in WeightsNPZ
+func readNPZ(r io.Reader) ([]importedLayer, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	arrays := map[string]npyArray{}
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		a, err := readNPY(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		arrays[strings.TrimSuffix(f.Name, ".npy")] = a
+	}
+
+	var layers []importedLayer
+	for i := 0; ; i++ {
+		kernel, ok := arrays[fmt.Sprintf("kernel_%d", i)]
+		if !ok {
+			break
+		}
+		if len(kernel.shape) != 2 || kernel.values == nil {
+			return nil, fmt.Errorf("layer %d: kernel of shape %s", i, dims(kernel.shape))
+		}
+		l := importedLayer{kernel: kernel.values, kernelDims: kernel.shape}
+		if bias, ok := arrays[fmt.Sprintf("bias_%d", i)]; ok {
+			l.Bias, l.biasDims = bias.values, bias.shape
+		}
+		if activation, ok := arrays[fmt.Sprintf("activation_%d", i)]; ok {
+			l.Activation = activation.text
+		}
+		layers = append(layers, l)
+	}
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("no kernel_0 array")
+	}
+	return layers, nil
+}
+
+// npyArray is an array of a .npy file, of floats in row-major order or a
+// string
+type npyArray struct {
+	shape  []int
+	values []float64
+	text   string
+}
+
+var (
+	npyDescr   = regexp.MustCompile(`'descr':\s*'([<>|=])([fU])(\d+)'`)
+	npyFortran = regexp.MustCompile(`'fortran_order':\s*(True|False)`)
+	npyShape   = regexp.MustCompile(`'shape':\s*\(([\d,\s]*)\)`)
+)
+
+// readNPY reads an array of little-endian floats or a unicode string in the
+// .npy format
+func readNPY(r io.Reader) (npyArray, error) {
+	var a npyArray
+	prefix := make([]byte, 8)
+	if _, err := io.ReadFull(r, prefix); err != nil || string(prefix[:6]) != "\x93NUMPY" {
+		return a, fmt.Errorf("not a .npy array")
+	}
+	var size int
+	switch prefix[6] {
+	case 1:
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return a, err
+		}
+		size = int(binary.LittleEndian.Uint16(b))
+	case 2, 3:
+		b := make([]byte, 4)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return a, err
+		}
+		size = int(binary.LittleEndian.Uint32(b))
+	default:
+		return a, fmt.Errorf("unsupported .npy version %d", prefix[6])
+	}
+	header := make([]byte, size)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return a, err
+	}
+
+	descr, fortran, shape := npyDescr.FindSubmatch(header), npyFortran.FindSubmatch(header), npyShape.FindSubmatch(header)
+	if descr == nil || fortran == nil || shape == nil {
+		return a, fmt.Errorf("unsupported .npy header %q", header)
+	}
+	count := 1
+	for _, d := range strings.Split(string(shape[1]), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			n, _ := strconv.Atoi(d)
+			a.shape = append(a.shape, n)
+			count *= n
+		}
+	}
+	order, kind, width := string(descr[1]), string(descr[2]), string(descr[3])
+	if order == ">" {
+		return a, fmt.Errorf("unsupported big-endian .npy array")
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return a, err
+	}
+
+	switch kind + width {
+	case "f4", "f8":
+		w := 4
+		if width == "8" {
+			w = 8
+		}
+		if len(data) != w*count {
+			return a, fmt.Errorf("%d bytes for %d values", len(data), count)
+		}
+		a.values = make([]float64, count)
+		for i := range a.values {
+			if w == 4 {
+				a.values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:])))
+			} else {
+				a.values[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[8*i:]))
+			}
+		}
+		if string(fortran[1]) == "True" && len(a.shape) == 2 {
+			a.values = transpose(a.values, a.shape[1], a.shape[0])
+		}
+	default:
+		if kind != "U" || count != 1 {
+			return a, fmt.Errorf("unsupported .npy array of %s%s", kind, width)
+		}
+		// UTF-32 code points, padded by zeros
+		var text []rune
+		for i := 0; i+4 <= len(data); i += 4 {
+			if c := rune(binary.LittleEndian.Uint32(data[i:])); c != 0 {
+				text = append(text, c)
+			}
+		}
+		a.text = string(text)
+	}
+	return a, nil
+}
+
+// transpose returns the row-major values of the transpose of the row-major
+// matrix of values of rows by cols
+func transpose(values []float64, rows, cols int) []float64 {
+	t := make([]float64, len(values))
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			t[j*rows+i] = values[i*cols+j]
+		}
+	}
+	return t
+}
@@ -0,0 +1,80 @@
+package deep
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func kerasNetwork() *Neural {
+	return NewNeural(&Config{
+		Inputs:      4,
+		Layout:      []int{8, 6, 3},
+		Activations: []ActivationType{ActivationReLU, ActivationTanh, ActivationNone},
+		Mode:        ModeMultiClass,
+		Bias:        true,
+	})
+}
+
+func Test_ImportWeightsNPZ(t *testing.T) {
+	// float32 weights of a model of Dense layers in the layout written by
+	// Keras, and its predictions recorded by a reference forward pass
+	f, err := os.Open(filepath.Join("testdata", "keras_dense.npz"))
+	assert.NoError(t, err)
+	defer f.Close()
+	n := kerasNetwork()
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	assert.NoError(t, ImportWeights(n, f, WeightsNPZ))
+	assert.Empty(t, logged.String())
+
+	for i, in := range [][]float64{{0.5, -1, 2, 0.25}, {-0.3, 0.8, 0.1, -1.5}, {1, 1, -1, 0}} {
+		expected := [][]float64{
+			{0.1752122940927614, 0.28595728335785847, 0.5388304225493802},
+			{0.4388137948207145, 0.19469137357453728, 0.36649483160474833},
+			{0.32489326080186176, 0.06292979791677085, 0.6121769412813675},
+		}[i]
+		assert.InDeltaSlice(t, expected, n.Predict(in), 1e-6)
+	}
+
+	// a mismatched activation is logged
+	f.Seek(0, 0)
+	n = NewNeural(&Config{Inputs: 4, Layout: []int{8, 6, 3}, Activation: ActivationReLU, Mode: ModeMultiClass, Bias: true})
+	assert.NoError(t, ImportWeights(n, f, WeightsNPZ))
+	assert.Contains(t, logged.String(), "layer 1: imported activation tanh, the network has ReLU")
+}
+
+func Test_ImportWeightsJSON(t *testing.T) {
+	n := NewNeural(&Config{Inputs: 2, Layout: []int{3, 1}, Activation: ActivationTanh, Mode: ModeRegression, Bias: true})
+	weights := `{"layers": [
+		{"kernel": [[1, 2, 3], [4, 5, 6]], "bias": [0.1, 0.2, 0.3], "activation": "tanh"},
+		{"kernel": [[-1], [0.5], [2]]}
+	]}`
+	assert.NoError(t, ImportWeights(n, strings.NewReader(weights), WeightsJSON))
+	assert.Equal(t, [][][]float64{
+		{{1, 4, 0.1}, {2, 5, 0.2}, {3, 6, 0.3}},
+		{{-1, 0.5, 2}},
+	}, n.Weights())
+}
+
+func Test_ImportWeightsShapes(t *testing.T) {
+	for weights, message := range map[string]string{
+		`{"layers": [{"kernel": [[1, 2, 3]], "bias": [0, 0, 0]}, {"kernel": [[1], [1], [1]]}]}`:                         "layer 0: kernel of shape (1, 3), expected (2, 3)",
+		`{"layers": [{"kernel": [[1, 2, 3], [4, 5, 6]]}, {"kernel": [[1], [1], [1]]}]}`:                                 "layer 0: missing bias of shape (3,)",
+		`{"layers": [{"kernel": [[1, 2, 3], [4, 5, 6]], "bias": [0, 0]}, {"kernel": [[1], [1], [1]]}]}`:                 "layer 0: bias of shape (2,), expected (3,)",
+		`{"layers": [{"kernel": [[1, 2, 3], [4, 5, 6]], "bias": [0, 0, 0]}, {"kernel": [[1], [1], [1]], "bias": [0]}]}`: "layer 1: bias of shape (1,) for a layer without biases",
+		`{"layers": [{"kernel": [[1, 2, 3], [4, 5, 6]], "bias": [0, 0, 0]}]}`:                                           "1 layers of weights for a network of 2",
+	} {
+		n := NewNeural(&Config{Inputs: 2, Layout: []int{3, 1}, Activation: ActivationTanh, Mode: ModeRegression, Bias: true})
+		before := n.Weights()
+		assert.EqualError(t, ImportWeights(n, strings.NewReader(weights), WeightsJSON), message)
+		assert.Equal(t, before, n.Weights())
+	}
+}
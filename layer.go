@@ -1,64 +1,249 @@
 package deep
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
 
 // Layer is a set of neurons and corresponding activation
 type Layer struct {
 	Neurons []*Neuron
 	A       ActivationType
+	// Alpha is the learned negative slope of an ActivationPReLU layer
+	Alpha float64
+	// Dropout is the probability of dropping the output of each neuron
+	// during training
+	Dropout float64
+	// Norm is the batch or layer normalization of the layer, if any
+	Norm *Norm
+	// Frozen layers are not updated in training
+	Frozen bool `json:"-"`
+	// Recurrent are the synapses of each neuron from the outputs of the
+	// layer at the previous step, also found in its inputs, if the layer
+	// is recurrent
+	Recurrent [][]*Synapse `json:"-"`
+
+	// state are the outputs of a recurrent layer at the previous step
+	state []float64
+
+	// skips are the layers whose outputs are added to the outputs of l
+	skips []*Layer
+
+	// softmax ranges of neurons with a softmax over them, other than
+	// a softmax over the whole layer given by A
+	softmax [][2]int
+
+	// rand is the source of dropout, nil for the global source
+	rand *rand.Rand
 }
 
 // NewLayer creates a new layer with n nodes
 func NewLayer(n int, activation ActivationType) *Layer {
-	neurons := make([]*Neuron, n)
+	l := &Layer{
+		Neurons: make([]*Neuron, n),
+		A:       activation,
+	}
+	if activation == ActivationPReLU {
+		l.Alpha = 0.25
+	}
 
 	for i := 0; i < n; i++ {
 		act := activation
 		if activation == ActivationSoftmax {
 			act = ActivationLinear
 		}
-		neurons[i] = NewNeuron(act)
+		l.Neurons[i] = NewNeuron(act)
+		l.Neurons[i].alpha = &l.Alpha
 	}
-	return &Layer{
-		Neurons: neurons,
-		A:       activation,
+	return l
+}
+
+// newHeadsLayer creates an output layer where each head has the output
+// activation of its mode, or act for ModeDefault
+func newHeadsLayer(heads []Head, act ActivationType) *Layer {
+	var n int
+	for _, h := range heads {
+		if h.To > n {
+			n = h.To
+		}
+	}
+	l := &Layer{Neurons: make([]*Neuron, n)}
+	for _, h := range heads {
+		a := act
+		if h.Mode != ModeDefault {
+			a = OutputActivation(h.Mode)
+		}
+		if a == ActivationSoftmax {
+			l.softmax = append(l.softmax, [2]int{h.From, h.To})
+		}
+		if a == ActivationPReLU {
+			l.Alpha = 0.25
+		}
+		copy(l.Neurons[h.From:h.To], NewLayer(h.To-h.From, a).Neurons)
 	}
+	// the slope of PReLU heads is that of the layer, trained as one
+	for _, neuron := range l.Neurons {
+		neuron.alpha = &l.Alpha
+	}
+	return l
+}
+
+// fire computes the outputs of l, batch normalized by the running
+// statistics, dropping them if dropout is set
+func (l *Layer) fire(dropout bool) {
+	l.sum()
+	if l.Norm != nil {
+		if l.Norm.Layer {
+			l.layerNormalize()
+		} else {
+			l.batchNormalize(l.Norm.Mean, l.Norm.Var)
+		}
+	}
+	l.activate(dropout)
 }
 
-func (l *Layer) fire() {
+// sum sums the inputs of each neuron, including the state of a recurrent
+// layer
+func (l *Layer) sum() {
+	l.recur()
 	for _, n := range l.Neurons {
-		n.fire()
+		n.sum()
 	}
-	if l.A == ActivationSoftmax {
-		outs := make([]float64, len(l.Neurons))
-		for i, neuron := range l.Neurons {
-			outs[i] = neuron.Value
+}
+
+// batchNormalize normalizes the sum of each neuron by mean and variance
+func (l *Layer) batchNormalize(mean, variance []float64) {
+	for i := range l.Neurons {
+		l.normalizeSum(i, mean[i], variance[i])
+	}
+}
+
+// layerNormalize normalizes the sums of the neurons by their mean and
+// variance
+func (l *Layer) layerNormalize() {
+	mean, variance := moments(len(l.Neurons), func(i int) float64 { return l.Neurons[i].Sum })
+	for i := range l.Neurons {
+		l.normalizeSum(i, mean, variance)
+	}
+}
+
+// moments returns the mean and variance of the n sums of sum
+func moments(n int, sum func(i int) float64) (mean, variance float64) {
+	size := float64(n)
+	for i := 0; i < n; i++ {
+		mean += sum(i) / size
+	}
+	for i := 0; i < n; i++ {
+		variance += (sum(i) - mean) * (sum(i) - mean) / size
+	}
+	return mean, variance
+}
+
+// normalizeSum normalizes the sum of neuron i by mean and variance, then
+// scales and shifts it
+func (l *Layer) normalizeSum(i int, mean, variance float64) {
+	n := l.Neurons[i]
+	n.Normalized, n.Sum, n.normScale = l.normalized(i, n.Sum, mean, variance)
+}
+
+// normalized returns sum of neuron i normalized by mean and variance, then
+// scaled and shifted, and the scale of the sum
+func (l *Layer) normalized(i int, sum, mean, variance float64) (normalized, scaled, scale float64) {
+	s := math.Sqrt(variance + normEpsilon)
+	normalized = (sum - mean) / s
+	return normalized, l.Norm.Gamma[i]*normalized + l.Norm.Beta[i], l.Norm.Gamma[i] / s
+}
+
+// activate activates each neuron, dropping them if dropout is set
+func (l *Layer) activate(dropout bool) {
+	for j, n := range l.Neurons {
+		n.residual = 0
+		for _, s := range l.skips {
+			n.residual += s.Neurons[j].output()
 		}
-		sm := Softmax(outs)
-		for i, neuron := range l.Neurons {
-			neuron.Value = sm[i]
+		n.mask = 1
+		if dropout && l.Dropout > 0 {
+			if l.draw() < l.Dropout {
+				n.mask = 0
+			} else {
+				n.mask = 1 / (1 - l.Dropout)
+			}
 		}
+		n.fire()
+	}
+	for _, r := range l.softmaxRanges() {
+		l.normalize(l.Neurons[r[0]:r[1]])
+	}
+	l.remember()
+}
+
+// draw returns a value from u[0, 1) by the source of dropout
+func (l *Layer) draw() float64 {
+	if l.rand != nil {
+		return l.rand.Float64()
+	}
+	return rand.Float64()
+}
+
+// softmaxRanges returns the ranges of neurons with a softmax over them
+func (l *Layer) softmaxRanges() [][2]int {
+	if l.A == ActivationSoftmax {
+		return [][2]int{{0, len(l.Neurons)}}
+	}
+	return l.softmax
+}
+
+// normalize applies a softmax over neurons
+func (l *Layer) normalize(neurons []*Neuron) {
+	outs := make([]float64, len(neurons))
+	for i, neuron := range neurons {
+		outs[i] = neuron.Value
+	}
+	sm := Softmax(outs)
+	for i, neuron := range neurons {
+		neuron.Value = sm[i]
 	}
 }
 
 // Connect fully connects layer l to next, and initializes each
 // synapse with the given weight function
 func (l *Layer) Connect(next *Layer, weight WeightInitializer) {
-	for i := range l.Neurons {
-		for j := range next.Neurons {
-			syn := NewSynapse(weight())
-			l.Neurons[i].Out = append(l.Neurons[i].Out, syn)
-			next.Neurons[j].In = append(next.Neurons[j].In, syn)
+	// weights are drawn by neuron of l, then of next, while the synapses
+	// into each neuron of next are allocated together and the inputs and
+	// outputs grown once, as networks are built often, e.g. by Clone
+	from, to := len(l.Neurons), len(next.Neurons)
+	weights := make([]float64, from*to)
+	for k := range weights {
+		weights[k] = weight()
+	}
+	synapses := make([]Synapse, from*to)
+	for j, n := range next.Neurons {
+		in := make([]*Synapse, len(n.In), len(n.In)+from+1)
+		copy(in, n.In)
+		for i := 0; i < from; i++ {
+			syn := &synapses[j*from+i]
+			syn.Weight = weights[i*to+j]
+			in = append(in, syn)
+		}
+		n.In = in
+	}
+	for i, n := range l.Neurons {
+		out := make([]*Synapse, len(n.Out), len(n.Out)+to)
+		copy(out, n.Out)
+		for j := 0; j < to; j++ {
+			out = append(out, &synapses[j*from+i])
 		}
+		n.Out = out
 	}
 }
 
 // ApplyBias creates and returns a bias synapse for each neuron in l
 func (l *Layer) ApplyBias(weight WeightInitializer) []*Synapse {
-	biases := make([]*Synapse, len(l.Neurons))
+	biases, synapses := make([]*Synapse, len(l.Neurons)), make([]Synapse, len(l.Neurons))
 	for i := range l.Neurons {
-		biases[i] = NewSynapse(weight())
-		biases[i].IsBias = true
+		biases[i] = &synapses[i]
+		biases[i].Weight, biases[i].IsBias = weight(), true
 		l.Neurons[i].In = append(l.Neurons[i].In, biases[i])
 	}
 	return biases
@@ -1,10 +1,14 @@
 package deep
 
 import (
+	"encoding/json"
+	"fmt"
 	"math"
+	"sync"
 )
 
-// GetLoss returns a loss function given a LossType
+// GetLoss returns a loss function given a LossType, and panics if the
+// LossType is unknown
 func GetLoss(loss LossType) Loss {
 	switch loss {
 	case LossCrossEntropy:
@@ -13,8 +17,35 @@ func GetLoss(loss LossType) Loss {
 		return MeanSquared{}
 	case LossBinaryCrossEntropy:
 		return BinaryCrossEntropy{}
+	case LossHuber:
+		return Huber{Delta: 1}
+	case LossMeanAbsolute:
+		return MeanAbsolute{}
+	case LossFocal:
+		return FocalLoss{Gamma: 2, Alpha: 0.25}
+	case LossKL:
+		return KLDivergence{}
+	case LossQuantile:
+		return NewQuantile(0.5)
+	case LossLogCosh:
+		return LogCosh{}
+	case LossHinge:
+		return Hinge{}
+	case LossPoisson:
+		return Poisson{}
+	case LossCosine:
+		return CosineLoss{}
+	case LossActor:
+		return ActorPolicyGradient{}
+	case LossCritic:
+		return CriticPolicyGradient{}
+	case LossPPO:
+		return PPOClip{Epsilon: 0.2}
+	}
+	if factory, ok := losses.factory(loss); ok {
+		return factory()
 	}
-	return CrossEntropy{}
+	panic(fmt.Sprintf("deep: unknown loss type %d", loss))
 }
 
 // LossType represents a loss function
@@ -32,10 +63,135 @@ func (l LossType) String() string {
 		return "APG"
 	case LossCritic:
 		return "CPG"
+	case LossHuber:
+		return "Huber"
+	case LossMeanAbsolute:
+		return "MAE"
+	case LossFocal:
+		return "Focal"
+	case LossKL:
+		return "KL"
+	case LossQuantile:
+		return "Quantile"
+	case LossLogCosh:
+		return "LogCosh"
+	case LossHinge:
+		return "Hinge"
+	case LossPoisson:
+		return "Poisson"
+	case LossCosine:
+		return "Cosine"
+	case LossPPO:
+		return "PPO"
+	}
+	if name, ok := losses.name(l); ok {
+		return name
 	}
 	return "N/A"
 }
 
+// known reports whether l is a builtin or registered loss
+func (l LossType) known() bool {
+	_, registered := losses.name(l)
+	return (l >= LossNone && l <= LossPPO) || registered
+}
+
+// MarshalJSON encodes registered losses by name, as their LossType
+// depends on the order of registration
+func (l LossType) MarshalJSON() ([]byte, error) {
+	if name, ok := losses.name(l); ok {
+		return json.Marshal(name)
+	}
+	return json.Marshal(int(l))
+}
+
+// UnmarshalJSON decodes a LossType, where registered losses must have been
+// registered prior to decoding
+func (l *LossType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var id int
+		if err := json.Unmarshal(data, &id); err != nil {
+			return err
+		}
+		*l = LossType(id)
+		return nil
+	}
+	loss, ok := losses.lookup(name)
+	if !ok {
+		return fmt.Errorf("deep: loss %q is not registered", name)
+	}
+	*l = loss
+	return nil
+}
+
+// RegisterLoss registers a custom loss under name, returning a LossType
+// usable with Config.Loss and GetLoss. Registering a name again replaces
+// its factory and returns the same LossType. Networks persisted with a
+// registered loss can only be restored once it has been registered again.
+func RegisterLoss(name string, factory func() Loss) LossType {
+	return losses.register(name, factory)
+}
+
+// firstRegisteredLoss is the first LossType allocated by RegisterLoss
+const firstRegisteredLoss LossType = 1000
+
+type lossRegistry struct {
+	sync.RWMutex
+	names     []string
+	factories []func() Loss
+}
+
+var losses lossRegistry
+
+func (r *lossRegistry) register(name string, factory func() Loss) LossType {
+	r.Lock()
+	defer r.Unlock()
+	for i, n := range r.names {
+		if n == name {
+			r.factories[i] = factory
+			return firstRegisteredLoss + LossType(i)
+		}
+	}
+	r.names = append(r.names, name)
+	r.factories = append(r.factories, factory)
+	return firstRegisteredLoss + LossType(len(r.names)-1)
+}
+
+func (r *lossRegistry) index(l LossType) (int, bool) {
+	i := int(l - firstRegisteredLoss)
+	return i, i >= 0 && i < len(r.names)
+}
+
+func (r *lossRegistry) factory(l LossType) (func() Loss, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	if i, ok := r.index(l); ok {
+		return r.factories[i], true
+	}
+	return nil, false
+}
+
+func (r *lossRegistry) name(l LossType) (string, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	if i, ok := r.index(l); ok {
+		return r.names[i], true
+	}
+	return "", false
+}
+
+func (r *lossRegistry) lookup(name string) (LossType, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	for i, n := range r.names {
+		if n == name {
+			return firstRegisteredLoss + LossType(i), true
+		}
+	}
+	return LossNone, false
+}
+
 const (
 	// LossNone signifies unspecified loss
 	LossNone LossType = 0
@@ -45,10 +201,30 @@ const (
 	LossBinaryCrossEntropy LossType = 2
 	// LossMeanSquared is MSE
 	LossMeanSquared LossType = 3
-	// ActorPolicyGradient
+	// LossActor is the policy gradient loss of an actor
 	LossActor LossType = 4
-	// CriticPolicyGradient
+	// LossCritic is the squared TD error loss of a critic
 	LossCritic LossType = 5
+	// LossHuber is Huber loss, quadratic for small residuals and linear for large
+	LossHuber LossType = 6
+	// LossMeanAbsolute is MAE
+	LossMeanAbsolute LossType = 7
+	// LossFocal is focal loss, for imbalanced binary classification
+	LossFocal LossType = 8
+	// LossKL is Kullback-Leibler divergence, for soft targets
+	LossKL LossType = 9
+	// LossQuantile is quantile (pinball) loss for the median
+	LossQuantile LossType = 10
+	// LossLogCosh is log-cosh loss
+	LossLogCosh LossType = 11
+	// LossHinge is hinge loss, for max-margin binary classification
+	LossHinge LossType = 12
+	// LossPoisson is Poisson negative log likelihood, for count regression
+	LossPoisson LossType = 13
+	// LossCosine is cosine distance
+	LossCosine LossType = 14
+	// LossPPO is the PPO clipped surrogate loss of an actor
+	LossPPO LossType = 15
 )
 
 // Loss is satisfied by loss functions
@@ -57,36 +233,337 @@ type Loss interface {
 	Df(estimate, ideal, activation float64) float64
 }
 
+// VectorLoss is satisfied by losses whose derivative with respect to an
+// output depends on the other outputs, or on the index of the output
+type VectorLoss interface {
+	Loss
+	// DfVector writes Df(...) for every output of a single example to deltas
+	DfVector(estimate, ideal, activation, deltas []float64)
+}
+
+// OutputDeltas computes the derivative of loss with respect to every output
+// of a single example, where activation holds the activation derivatives
+func OutputDeltas(loss Loss, estimate, ideal, activation, deltas []float64) {
+	if l, ok := loss.(VectorLoss); ok {
+		l.DfVector(estimate, ideal, activation, deltas)
+		return
+	}
+	for i := range deltas {
+		deltas[i] = loss.Df(estimate[i], ideal[i], activation[i])
+	}
+}
+
+// ActivationLoss is a Loss differentiated by the activation of the output
+// layer, such as by the inputs of a softmax
+type ActivationLoss interface {
+	Loss
+	// ForActivation returns the loss of an output layer of activation a
+	ForActivation(a ActivationType) Loss
+}
+
+// IdealSizer is a Loss whose ideals are not of a value for each output
+type IdealSizer interface {
+	Loss
+	IdealSize(outputs int) int
+}
+
+// IdealSize returns the number of values of the ideals of loss for a
+// network of outputs outputs, see IdealSizer
+func IdealSize(loss Loss, outputs int) int {
+	if l, ok := loss.(IdealSizer); ok {
+		return l.IdealSize(outputs)
+	}
+	return outputs
+}
+
+// LossValidator is a Loss whose parameters must suit the outputs of the
+// network, checked once before training rather than by F and Df
+type LossValidator interface {
+	Loss
+	Validate(outputs int) error
+}
+
+// ValidateLoss returns an error if loss cannot train a network of outputs
+// outputs, see LossValidator
+func ValidateLoss(loss Loss, outputs int) error {
+	if l, ok := loss.(LossValidator); ok {
+		return l.Validate(outputs)
+	}
+	return nil
+}
+
+// MultiHeadLoss is the weighted sum of the losses of the heads of a
+// multi-head network, each applied to its own range of outputs
+type MultiHeadLoss struct {
+	Heads  []Head
+	losses []Loss
+}
+
+// NewMultiHeadLoss returns the combined loss of heads
+func NewMultiHeadLoss(heads []Head) *MultiHeadLoss {
+	l := &MultiHeadLoss{Heads: heads, losses: make([]Loss, len(heads))}
+	for i, h := range heads {
+		l.losses[i] = GetLoss(h.Loss)
+	}
+	return l
+}
+
+func (l *MultiHeadLoss) weight(i int) float64 {
+	if l.Heads[i].Weight == 0 {
+		return 1
+	}
+	return l.Heads[i].Weight
+}
+
+// F is the weighted sum of the loss of each head
+func (l *MultiHeadLoss) F(estimate, ideal [][]float64) float64 {
+	e, y := make([][]float64, len(estimate)), make([][]float64, len(ideal))
+	var sum float64
+	for i, h := range l.Heads {
+		for j := range estimate {
+			e[j], y[j] = estimate[j][h.From:h.To], ideal[j][h.From:h.To]
+		}
+		sum += l.weight(i) * l.losses[i].F(e, y)
+	}
+	return sum
+}
+
+// Df is undefined without the index of the output, and returns 0; see DfVector
+func (l *MultiHeadLoss) Df(estimate, ideal, activation float64) float64 {
+	return 0
+}
+
+// DfVector applies the derivative of each head to its range of outputs
+func (l *MultiHeadLoss) DfVector(estimate, ideal, activation, deltas []float64) {
+	for i, h := range l.Heads {
+		d := deltas[h.From:h.To]
+		OutputDeltas(l.losses[i], estimate[h.From:h.To], ideal[h.From:h.To], activation[h.From:h.To], d)
+		for j := range d {
+			d[j] *= l.weight(i)
+		}
+	}
+}
+
 // CrossEntropy is CE loss
-type CrossEntropy struct{}
+type CrossEntropy struct {
+	// Smoothing in [0,1), see Validate, applies label smoothing, such that
+	// an ideal of 1 becomes 1-Smoothing and an ideal of 0 becomes
+	// Smoothing/(K-1) for K outputs. Zero is plain CE.
+	Smoothing float64
+}
 
-// F is CE(...)
+// Validate returns an error unless Smoothing is in [0,1)
+func (l CrossEntropy) Validate(outputs int) error {
+	if l.Smoothing < 0 || l.Smoothing >= 1 {
+		return fmt.Errorf("label smoothing must be in [0,1), got %g", l.Smoothing)
+	}
+	return nil
+}
+
+// smooth returns the smoothed ideal of an output given the number of outputs
+func (l CrossEntropy) smooth(ideal float64, outputs int) float64 {
+	if l.Smoothing == 0 || outputs < 2 {
+		return ideal
+	}
+	return ideal*(1-l.Smoothing) + (1-ideal)*l.Smoothing/float64(outputs-1)
+}
+
+// F is CE(...), where estimates are clamped to 1e-16 inside the log
 func (l CrossEntropy) F(estimate, ideal [][]float64) float64 {
 
-	var sum float64
+	var sum compensated
 	for i := range estimate {
 		ce := 0.0
 		for j := range estimate[i] {
-			ce += ideal[i][j] * math.Log(estimate[i][j])
+			y := l.smooth(ideal[i][j], len(estimate[i]))
+			if y == 0 {
+				continue
+			}
+			ce += y * math.Log(math.Max(estimate[i][j], 1e-16))
 		}
 
-		sum -= ce
+		sum.add(-ce)
 	}
-	return sum / float64(len(estimate))
+	return sum.value() / float64(len(estimate))
 }
 
-// Df is CE'(...)
+// Df is CE'(...), without label smoothing as that depends on the number
+// of outputs, see DfVector
 func (l CrossEntropy) Df(estimate, ideal, activation float64) float64 {
 	return estimate - ideal
 }
 
-// Actor Policy Gradient
-type ActorPolicyGradient struct{}
+// DfVector is CE'(...) with label smoothing applied to ideal
+func (l CrossEntropy) DfVector(estimate, ideal, activation, deltas []float64) {
+	for i := range deltas {
+		deltas[i] = estimate[i] - l.smooth(ideal[i], len(ideal))
+	}
+}
+
+// WeightedCrossEntropy is CE loss where each class term is scaled by a
+// per-class weight, to be used with a softmax output
+type WeightedCrossEntropy struct {
+	Weights []float64
+}
+
+// NewWeightedCrossEntropy returns CE loss weighted by weights, which must
+// contain one weight per output, see Validate
+func NewWeightedCrossEntropy(weights []float64) WeightedCrossEntropy {
+	return WeightedCrossEntropy{Weights: weights}
+}
+
+// Validate returns an error unless l has a weight for each of outputs
+func (l WeightedCrossEntropy) Validate(outputs int) error {
+	if len(l.Weights) != outputs {
+		return fmt.Errorf("weighted cross entropy has %d weights, network has %d outputs", len(l.Weights), outputs)
+	}
+	return nil
+}
+
+// F is CE(...) with each class term scaled by its weight
+func (l WeightedCrossEntropy) F(estimate, ideal [][]float64) float64 {
+	var sum compensated
+	for i := range estimate {
+		ce := 0.0
+		for j := range estimate[i] {
+			ce += l.Weights[j] * ideal[i][j] * math.Log(math.Max(estimate[i][j], 1e-16))
+		}
+		sum.add(-ce)
+	}
+	return sum.value() / float64(len(estimate))
+}
+
+// Df is the unweighted CE'(...), as the weight depends on the index of the
+// output, see DfVector
+func (l WeightedCrossEntropy) Df(estimate, ideal, activation float64) float64 {
+	return estimate - ideal
+}
 
-// No need for F as loss is precalculated based on action
+// DfVector is CE'(...) with respect to the inputs of a softmax output,
+// which for a one-hot ideal is CE' scaled by the weight of the true class
+func (l WeightedCrossEntropy) DfVector(estimate, ideal, activation, deltas []float64) {
+	var wy float64
+	for j := range ideal {
+		wy += l.Weights[j] * ideal[j]
+	}
+	for i := range deltas {
+		deltas[i] = estimate[i]*wy - l.Weights[i]*ideal[i]
+	}
+}
+
+// CosineLoss is cosine distance, 1 - cos(estimate, ideal), which only
+// depends on the direction of the estimate. A zero vector has a cosine of 0
+// to any other vector.
+type CosineLoss struct{}
+
+// F is Cosine(...)
+func (l CosineLoss) F(estimate, ideal [][]float64) float64 {
+	var sum compensated
+	for i := range estimate {
+		norm := math.Sqrt(Dot(estimate[i], estimate[i]) * Dot(ideal[i], ideal[i]))
+		if norm == 0 {
+			sum.add(1)
+			continue
+		}
+		sum.add(1 - Dot(estimate[i], ideal[i])/norm)
+	}
+	return sum.value() / float64(len(estimate))
+}
+
+// Df is Cosine'(...) for a single output, which is 0 as the cosine of
+// two scalars is the product of their signs, see DfVector
+func (l CosineLoss) Df(estimate, ideal, activation float64) float64 {
+	return 0
+}
+
+// DfVector is Cosine'(...), which is orthogonal to the estimate. For a zero
+// estimate it is -ideal/|ideal|, and for a zero ideal it is 0.
+func (l CosineLoss) DfVector(estimate, ideal, activation, deltas []float64) {
+	en, in := math.Sqrt(Dot(estimate, estimate)), math.Sqrt(Dot(ideal, ideal))
+	if in == 0 {
+		for i := range deltas {
+			deltas[i] = 0
+		}
+		return
+	}
+	if en == 0 {
+		for i := range deltas {
+			deltas[i] = -activation[i] * ideal[i] / in
+		}
+		return
+	}
+	cos := Dot(estimate, ideal) / (en * in)
+	for i := range deltas {
+		deltas[i] = -activation[i] * (ideal[i]/in - cos*estimate[i]/en) / en
+	}
+}
+
+// KLDivergence is KL(ideal || estimate), for targets that are probability
+// distributions rather than one-hot labels
+type KLDivergence struct{}
+
+// F is KL(...), where terms with an ideal of 0 contribute 0
+func (l KLDivergence) F(estimate, ideal [][]float64) float64 {
+	var sum compensated
+	for i := range estimate {
+		for j := range estimate[i] {
+			if ideal[i][j] == 0 {
+				continue
+			}
+			sum.add(ideal[i][j] * math.Log(ideal[i][j]/math.Max(estimate[i][j], 1e-16)))
+		}
+	}
+	return sum.value() / float64(len(estimate))
+}
+
+// Df is KL'(...) with respect to the input of a softmax output, which
+// coincides with that of CE as the two only differ by the entropy of ideal
+func (l KLDivergence) Df(estimate, ideal, activation float64) float64 {
+	return estimate - ideal
+}
+
+// ActorPolicyGradient is the policy gradient loss of an actor, where the
+// estimate is the probability pi of an action and the ideal is the TD error
+// delta of taking it, which is 0 for actions not taken
+type ActorPolicyGradient struct {
+	// EntropyCoeff is the weight beta of an entropy bonus beta*H(pi) on the
+	// objective of the actor, which keeps the policy from collapsing early.
+	// Zero disables it.
+	EntropyCoeff float64
+
+	// perOutput differentiates by each output rather than by the inputs of
+	// a softmax, see ForActivation
+	perOutput bool
+}
+
+// ForActivation returns l differentiated by the inputs of the output layer
+// if a is ActivationSoftmax, and otherwise by each output, see
+// Neural.OutputLoss
+func (l ActorPolicyGradient) ForActivation(a ActivationType) Loss {
+	l.perOutput = a != ActivationSoftmax
+	return l
+}
 
-// Df is J'(theta)
-func (l ActorPolicyGradient) Df(pi, delta, activation float64) float64{
+// F is J(theta) = -delta*log(pi) - beta*H(pi), precalculated from the action taken
+func (l ActorPolicyGradient) F(estimate, ideal [][]float64) float64 {
+	var sum compensated
+	for i := range estimate {
+		for j := range estimate[i] {
+			if ideal[i][j] == 0 {
+				continue
+			}
+			sum.add(-ideal[i][j] * math.Log(math.Max(estimate[i][j], 1e-16)))
+		}
+		if l.EntropyCoeff != 0 {
+			sum.add(-l.EntropyCoeff * entropy(estimate[i]))
+		}
+	}
+	return sum.value() / float64(len(estimate))
+}
+
+// Df is J'(theta) with respect to pi, times activation, of the action taken
+// alone and without the entropy bonus, see DfVector
+func (l ActorPolicyGradient) Df(pi, delta, activation float64) float64 {
 	/*
 		delta = reward + gamma*new_state_val - state_val
 		loss = -delta * log(pi)
@@ -97,20 +574,162 @@ func (l ActorPolicyGradient) Df(pi, delta, activation float64) float64{
 		so
 		dloss/doutput = -delta/pi * activation
 	*/
-	return -delta/pi * activation
+	return -delta / pi * activation
+}
+
+// DfVector is J'(theta), for both the policy gradient and the entropy
+// bonus, with respect to the inputs of the softmax output of an actor or,
+// for other outputs, see ForActivation, to each output times activation
+func (l ActorPolicyGradient) DfVector(estimate, ideal, activation, deltas []float64) {
+	if l.perOutput {
+		// dH/dpi_i = -(log(pi_i) + 1)
+		for i := range deltas {
+			deltas[i] = l.Df(estimate[i], ideal[i], activation[i])
+			if l.EntropyCoeff != 0 {
+				deltas[i] += l.EntropyCoeff * (math.Log(math.Max(estimate[i], 1e-16)) + 1) * activation[i]
+			}
+		}
+		return
+	}
+	/*
+		J = -sum(delta_j * log(pi_j)) - beta*H
+		dpi_j/dz_i = pi_j * (1[i=j] - pi_i)
+		d(-sum(delta_j * log(pi_j)))/dz_i = -delta_i + pi_i * sum(delta_j)
+		dH/dz_i = -pi_i * (log(pi_i) + H)
+		so
+		dJ/dz_i = -delta_i + pi_i * (sum(delta_j) + beta*(log(pi_i) + H))
+	*/
+	var sum float64
+	for _, delta := range ideal {
+		sum += delta
+	}
+	var h float64
+	if l.EntropyCoeff != 0 {
+		h = entropy(estimate)
+	}
+	for i := range deltas {
+		deltas[i] = -ideal[i] + estimate[i]*sum
+		if l.EntropyCoeff != 0 {
+			deltas[i] += l.EntropyCoeff * estimate[i] * (math.Log(math.Max(estimate[i], 1e-16)) + h)
+		}
+	}
 }
 
+// entropy is the entropy of the distribution p
+func entropy(p []float64) float64 {
+	var h float64
+	for _, x := range p {
+		if x > 0 {
+			h -= x * math.Log(x)
+		}
+	}
+	return h
+}
+
+// CriticPolicyGradient is the loss of a critic, where the ideal is the
+// TD error delta (scaled by gamma) of the estimated state value
 type CriticPolicyGradient struct{}
 
-func (l CriticPolicyGradient) Df(estimate, deltagamma, activation float64) float64{
+// F is delta², precalculated from the TD error
+func (l CriticPolicyGradient) F(estimate, ideal [][]float64) float64 {
+	var sum compensated
+	for i := range ideal {
+		for j := range ideal[i] {
+			sum.add(ideal[i][j] * ideal[i][j])
+		}
+	}
+	return sum.value() / float64(len(ideal)*len(ideal[0]))
+}
+
+// Df is delta²'
+func (l CriticPolicyGradient) Df(estimate, deltagamma, activation float64) float64 {
 	/*
-	loss = delta**2
+		loss = delta**2
 		dloss/dOutput = dloss/destimate * destimate/dOutput
 		 = 2*delta*(gamma) * activation
 	*/
 	return 2 * deltagamma * activation
 }
 
+// PPOClip is the clipped surrogate loss of proximal policy optimization,
+// for an actor with a softmax output. The ideal of an example holds the
+// advantage of each action (0 for actions not taken) followed by the
+// probability of each action under the policy that collected the example,
+// see PPOTarget. The probability ratio r = pi/pi_old is clipped to
+// [1-Epsilon, 1+Epsilon].
+type PPOClip struct {
+	Epsilon float64
+}
+
+// IdealSize is the number of values of the ideals of PPOClip, twice the
+// outputs
+func (l PPOClip) IdealSize(outputs int) int { return 2 * outputs }
+
+// PPOTarget returns the ideal of a PPOClip example where action was taken
+// with the given advantage, and oldProbs is the output of the actor at the
+// time the action was taken
+func PPOTarget(action int, advantage float64, oldProbs []float64) []float64 {
+	ideal := make([]float64, 2*len(oldProbs))
+	ideal[action] = advantage
+	copy(ideal[len(oldProbs):], oldProbs)
+	return ideal
+}
+
+// surrogate returns the clipped surrogate objective of an action, and its
+// derivative with respect to pi
+func (l PPOClip) surrogate(pi, advantage, old float64) (float64, float64) {
+	old = math.Max(old, 1e-16)
+	r := pi / old
+	clipped := clamp(r, 1-l.Epsilon, 1+l.Epsilon)
+	if clipped*advantage < r*advantage {
+		// the clipped term is the minimum, which is constant in pi
+		return clipped * advantage, 0
+	}
+	return r * advantage, advantage / old
+}
+
+// F is -min(r*A, clip(r, 1-Epsilon, 1+Epsilon)*A)
+func (l PPOClip) F(estimate, ideal [][]float64) float64 {
+	var sum compensated
+	for i := range estimate {
+		k := len(estimate[i])
+		for j := range estimate[i] {
+			if ideal[i][j] == 0 {
+				continue
+			}
+			obj, _ := l.surrogate(estimate[i][j], ideal[i][j], ideal[i][k+j])
+			sum.add(-obj)
+		}
+	}
+	return sum.value() / float64(len(estimate))
+}
+
+// Df is the unclipped surrogate gradient for an old probability of 1, as
+// the old probability is part of the ideal vector, see DfVector
+func (l PPOClip) Df(estimate, ideal, activation float64) float64 {
+	return -ideal * activation
+}
+
+// DfVector is PPO'(...) with respect to the inputs of the softmax output,
+// which is 0 where clipping keeps the ratio from improving the objective
+// any further
+func (l PPOClip) DfVector(estimate, ideal, activation, deltas []float64) {
+	k := len(estimate)
+	var sum float64
+	for j := range deltas {
+		deltas[j] = 0
+		if ideal[j] == 0 {
+			continue
+		}
+		_, d := l.surrogate(estimate[j], ideal[j], ideal[k+j])
+		deltas[j] = -d
+		sum += deltas[j] * estimate[j]
+	}
+	// chain rule through the softmax: dpi_j/dz_i = pi_j(1[i=j] - pi_i)
+	for i := range deltas {
+		deltas[i] = estimate[i] * (deltas[i] - sum)
+	}
+}
 
 // BinaryCrossEntropy is binary CE loss
 type BinaryCrossEntropy struct{}
@@ -118,15 +737,15 @@ type BinaryCrossEntropy struct{}
 // F is CE(...)
 func (l BinaryCrossEntropy) F(estimate, ideal [][]float64) float64 {
 	epsilon := 1e-16
-	var sum float64
+	var sum compensated
 	for i := range estimate {
 		ce := 0.0
 		for j := range estimate[i] {
 			ce += ideal[i][j]*math.Log(estimate[i][j]+epsilon) + (1.0-ideal[i][j])*math.Log(1.0-estimate[i][j]+epsilon)
 		}
-		sum -= ce
+		sum.add(-ce)
 	}
-	return sum / float64(len(estimate))
+	return sum.value() / float64(len(estimate))
 }
 
 // Df is CE'(...)
@@ -134,18 +753,55 @@ func (l BinaryCrossEntropy) Df(estimate, ideal, activation float64) float64 {
 	return estimate - ideal
 }
 
+// FocalLoss is binary focal loss, which down-weights well-classified
+// examples by (1-p)^Gamma. Alpha weighs the positive class and 1-Alpha
+// the negative class. Gamma = 0 and Alpha = 0.5 is half of BCE.
+type FocalLoss struct {
+	Gamma float64
+	Alpha float64
+}
+
+// F is FL(...)
+func (l FocalLoss) F(estimate, ideal [][]float64) float64 {
+	var sum compensated
+	for i := range estimate {
+		fl := 0.0
+		for j := range estimate[i] {
+			p := clamp(estimate[i][j], 1e-16, 1-1e-16)
+			y := ideal[i][j]
+			fl += y*l.Alpha*math.Pow(1-p, l.Gamma)*math.Log(p) +
+				(1-y)*(1-l.Alpha)*math.Pow(p, l.Gamma)*math.Log(1-p)
+		}
+		sum.add(-fl)
+	}
+	return sum.value() / float64(len(estimate))
+}
+
+// Df is FL'(...) with respect to the input of a sigmoid output, which
+// like BinaryCrossEntropy means the activation derivative is folded in
+func (l FocalLoss) Df(estimate, ideal, activation float64) float64 {
+	p := clamp(estimate, 1e-16, 1-1e-16)
+	pos := l.Alpha * math.Pow(1-p, l.Gamma) * (l.Gamma*p*math.Log(p) - (1 - p))
+	neg := -(1 - l.Alpha) * math.Pow(p, l.Gamma) * (l.Gamma*(1-p)*math.Log(1-p) - p)
+	return ideal*pos + (1-ideal)*neg
+}
+
+func clamp(x, min, max float64) float64 {
+	return math.Min(math.Max(x, min), max)
+}
+
 // MeanSquared in MSE loss
 type MeanSquared struct{}
 
 // F is MSE(...)
 func (l MeanSquared) F(estimate, ideal [][]float64) float64 {
-	var sum float64
+	var sum compensated
 	for i := 0; i < len(estimate); i++ {
 		for j := 0; j < len(estimate[i]); j++ {
-			sum += math.Pow(estimate[i][j]-ideal[i][j], 2)
+			sum.add(math.Pow(estimate[i][j]-ideal[i][j], 2))
 		}
 	}
-	return sum / float64(len(estimate)*len(estimate[0]))
+	return sum.value() / float64(len(estimate)*len(estimate[0]))
 }
 
 // Df is MSE'(...)
@@ -153,3 +809,194 @@ func (l MeanSquared) Df(estimate, ideal, activation float64) float64 {
 	return activation * (estimate - ideal)
 }
 
+// MeanAbsolute is MAE (L1) loss
+type MeanAbsolute struct{}
+
+// F is MAE(...)
+func (l MeanAbsolute) F(estimate, ideal [][]float64) float64 {
+	var sum compensated
+	for i := 0; i < len(estimate); i++ {
+		for j := 0; j < len(estimate[i]); j++ {
+			sum.add(math.Abs(estimate[i][j] - ideal[i][j]))
+		}
+	}
+	return sum.value() / float64(len(estimate)*len(estimate[0]))
+}
+
+// Df is MAE'(...), defined as 0 for a zero residual
+func (l MeanAbsolute) Df(estimate, ideal, activation float64) float64 {
+	return activation * Sgn(estimate-ideal)
+}
+
+// Quantile is quantile (pinball) loss, for estimating the Tau quantile
+type Quantile struct {
+	Tau float64
+}
+
+// NewQuantile returns a quantile loss for the tau quantile, and panics
+// unless tau is in (0,1)
+func NewQuantile(tau float64) Quantile {
+	l := Quantile{Tau: tau}
+	if err := l.Validate(1); err != nil {
+		panic("deep: " + err.Error())
+	}
+	return l
+}
+
+// Validate returns an error unless Tau is in (0,1)
+func (l Quantile) Validate(outputs int) error {
+	if l.Tau <= 0 || l.Tau >= 1 {
+		return fmt.Errorf("quantile must be in (0,1), got %g", l.Tau)
+	}
+	return nil
+}
+
+// F is Quantile(...)
+func (l Quantile) F(estimate, ideal [][]float64) float64 {
+	tau := l.Tau
+	var sum compensated
+	for i := 0; i < len(estimate); i++ {
+		for j := 0; j < len(estimate[i]); j++ {
+			if r := ideal[i][j] - estimate[i][j]; r > 0 {
+				sum.add(tau * r)
+			} else {
+				sum.add(-(1 - tau) * r)
+			}
+		}
+	}
+	return sum.value() / float64(len(estimate)*len(estimate[0]))
+}
+
+// Df is Quantile'(...), defined as 0 for a zero residual
+func (l Quantile) Df(estimate, ideal, activation float64) float64 {
+	tau := l.Tau
+	switch {
+	case ideal > estimate:
+		return -tau * activation
+	case ideal < estimate:
+		return (1 - tau) * activation
+	}
+	return 0
+}
+
+// LogCosh is log(cosh(...)) loss, which behaves like MSE for small
+// residuals and like MAE for large ones
+type LogCosh struct{}
+
+// F is LogCosh(...)
+func (l LogCosh) F(estimate, ideal [][]float64) float64 {
+	var sum compensated
+	for i := 0; i < len(estimate); i++ {
+		for j := 0; j < len(estimate[i]); j++ {
+			sum.add(logCosh(estimate[i][j] - ideal[i][j]))
+		}
+	}
+	return sum.value() / float64(len(estimate)*len(estimate[0]))
+}
+
+// Df is LogCosh'(...)
+func (l LogCosh) Df(estimate, ideal, activation float64) float64 {
+	return activation * math.Tanh(estimate-ideal)
+}
+
+// logCosh is log(cosh(x)) rewritten as |x| + log(1+exp(-2|x|)) - log(2),
+// as cosh overflows for large x
+func logCosh(x float64) float64 {
+	x = math.Abs(x)
+	return x + math.Log1p(math.Exp(-2*x)) - math.Ln2
+}
+
+// Hinge is hinge loss for labels in {-1,+1} and a linear output. Ideals
+// of 0 are treated as -1, so {0,1} labels may be used as is.
+type Hinge struct{}
+
+func (l Hinge) label(ideal float64) float64 {
+	if ideal <= 0 {
+		return -1
+	}
+	return 1
+}
+
+// F is Hinge(...)
+func (l Hinge) F(estimate, ideal [][]float64) float64 {
+	var sum compensated
+	for i := 0; i < len(estimate); i++ {
+		for j := 0; j < len(estimate[i]); j++ {
+			sum.add(math.Max(0, 1-l.label(ideal[i][j])*estimate[i][j]))
+		}
+	}
+	return sum.value() / float64(len(estimate)*len(estimate[0]))
+}
+
+// Df is a subgradient of Hinge(...), which is 0 once the margin is satisfied
+func (l Hinge) Df(estimate, ideal, activation float64) float64 {
+	y := l.label(ideal)
+	if y*estimate >= 1 {
+		return 0
+	}
+	return -y * activation
+}
+
+// Poisson is the Poisson negative log likelihood (up to a constant), for
+// count targets. Estimates must be positive, so it is best paired with an
+// ActivationExp output, the canonical log link, where Df reduces to
+// estimate - ideal. Estimates are clamped to 1e-16.
+type Poisson struct{}
+
+// F is Poisson(...)
+func (l Poisson) F(estimate, ideal [][]float64) float64 {
+	var sum compensated
+	for i := 0; i < len(estimate); i++ {
+		for j := 0; j < len(estimate[i]); j++ {
+			est := math.Max(estimate[i][j], 1e-16)
+			sum.add(est - ideal[i][j]*math.Log(est))
+		}
+	}
+	return sum.value() / float64(len(estimate)*len(estimate[0]))
+}
+
+// Df is Poisson'(...)
+func (l Poisson) Df(estimate, ideal, activation float64) float64 {
+	return activation * (1 - ideal/math.Max(estimate, 1e-16))
+}
+
+// Huber is Huber loss, which is quadratic for residuals within Delta and
+// linear beyond it, making it less sensitive to outliers than MSE
+type Huber struct {
+	// Delta is the residual threshold, a zero value is treated as 1
+	Delta float64
+}
+
+func (l Huber) delta() float64 {
+	if l.Delta == 0 {
+		return 1
+	}
+	return l.Delta
+}
+
+// F is Huber(...)
+func (l Huber) F(estimate, ideal [][]float64) float64 {
+	delta := l.delta()
+	var sum compensated
+	for i := 0; i < len(estimate); i++ {
+		for j := 0; j < len(estimate[i]); j++ {
+			r := math.Abs(estimate[i][j] - ideal[i][j])
+			if r <= delta {
+				sum.add(0.5 * r * r)
+			} else {
+				sum.add(delta * (r - 0.5*delta))
+			}
+		}
+	}
+	return sum.value() / float64(len(estimate)*len(estimate[0]))
+}
+
+// Df is Huber'(...)
+func (l Huber) Df(estimate, ideal, activation float64) float64 {
+	delta := l.delta()
+	r := estimate - ideal
+	if math.Abs(r) > delta {
+		r = delta * Sgn(r)
+	}
+	return activation * r
+}
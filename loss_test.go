@@ -2,6 +2,9 @@ package deep
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -32,6 +35,24 @@ func Test_Loss(t *testing.T) {
 			target: [][]float64{{0.5}},
 			res:    0.69,
 		},
+		{
+			loss:   LossHuber,
+			input:  [][]float64{{0.5, 1.0, 4.0}},
+			target: [][]float64{{0.0, 1.0, 1.0}},
+			res:    0.875,
+		},
+		{
+			loss:   LossMeanAbsolute,
+			input:  [][]float64{{0.5, 1.0, 4.0}},
+			target: [][]float64{{0.0, 2.0, 1.0}},
+			res:    1.5,
+		},
+		{
+			loss:   LossQuantile,
+			input:  [][]float64{{0.5, 1.0, 4.0}},
+			target: [][]float64{{0.0, 2.0, 1.0}},
+			res:    0.75,
+		},
 	}
 	for _, test := range tests {
 		loss := GetLoss(test.loss)
@@ -40,3 +61,416 @@ func Test_Loss(t *testing.T) {
 		assert.NotEqual(t, "N/A", test.loss.String())
 	}
 }
+
+func Test_HuberDf(t *testing.T) {
+	l := Huber{Delta: 1.5}
+
+	assert.Equal(t, 0.5, l.Df(1.5, 1.0, 1))
+	assert.Equal(t, 1.5, l.Df(5.0, 1.0, 1))
+	assert.Equal(t, -1.5, l.Df(-5.0, 1.0, 1))
+	assert.Equal(t, 0.75, l.Df(5.0, 1.0, 0.5))
+
+	// derivative is continuous at the delta boundary
+	eps := 1e-9
+	for _, sign := range []float64{-1, 1} {
+		below := l.Df(sign*(1.5-eps), 0, 1)
+		above := l.Df(sign*(1.5+eps), 0, 1)
+		assert.InDelta(t, below, above, 1e-8)
+		assert.InDelta(t, sign*1.5, above, 1e-8)
+	}
+
+	// and so is the loss itself
+	below := l.F([][]float64{{1.5 - eps}}, [][]float64{{0}})
+	above := l.F([][]float64{{1.5 + eps}}, [][]float64{{0}})
+	assert.InDelta(t, below, above, 1e-8)
+}
+
+func Test_MeanAbsoluteDf(t *testing.T) {
+	l := MeanAbsolute{}
+
+	assert.Equal(t, 0.5, l.Df(2.0, 1.0, 0.5))
+	assert.Equal(t, -0.5, l.Df(0.0, 1.0, 0.5))
+	assert.Equal(t, 0.0, l.Df(1.0, 1.0, 0.5))
+}
+
+func Test_FocalLoss(t *testing.T) {
+	// gamma = 0 and alpha = 0.5 reduces to half of binary cross entropy
+	half := FocalLoss{Gamma: 0, Alpha: 0.5}
+	bce := BinaryCrossEntropy{}
+	for _, p := range []float64{0.1, 0.5, 0.9} {
+		for _, y := range []float64{0, 1} {
+			assert.InDelta(t, 0.5*bce.Df(p, y, 0), half.Df(p, y, 0), 1e-12)
+			assert.InDelta(t, 0.5*bce.F([][]float64{{p}}, [][]float64{{y}}), half.F([][]float64{{p}}, [][]float64{{y}}), 1e-12)
+		}
+	}
+
+	// derivative agrees with finite differences through the sigmoid
+	l := GetLoss(LossFocal).(FocalLoss)
+	h := 1e-6
+	for _, z := range []float64{-3, -0.5, 0, 0.7, 4} {
+		for _, y := range []float64{0, 1} {
+			f := func(z float64) float64 { return l.F([][]float64{{Logistic(z, 1)}}, [][]float64{{y}}) }
+			numeric := (f(z+h) - f(z-h)) / (2 * h)
+			assert.InDelta(t, numeric, l.Df(Logistic(z, 1), y, 0), 1e-6)
+		}
+	}
+
+	// well-classified examples contribute less than with BCE
+	assert.True(t, math.Abs(l.Df(0.95, 1, 0)) < math.Abs(bce.Df(0.95, 1, 0))*0.01)
+
+	// saturated estimates stay finite
+	for _, p := range []float64{0, 1} {
+		for _, y := range []float64{0, 1} {
+			assert.False(t, math.IsNaN(l.Df(p, y, 0)) || math.IsInf(l.Df(p, y, 0), 0))
+			loss := l.F([][]float64{{p}}, [][]float64{{y}})
+			assert.False(t, math.IsNaN(loss) || math.IsInf(loss, 0))
+		}
+	}
+}
+
+func Test_KLDivergence(t *testing.T) {
+	l := GetLoss(LossKL)
+
+	p := [][]float64{{0.2, 0.5, 0.3}, {0, 0.25, 0.75}}
+	assert.Equal(t, 0.0, l.F(p, p))
+
+	q := [][]float64{{0.3, 0.4, 0.3}}
+	expected := 0.3*math.Log(0.3/0.2) + 0.4*math.Log(0.4/0.5)
+	assert.InDelta(t, expected, l.F([][]float64{p[0]}, q), 1e-12)
+
+	// zero ideals are skipped, zero estimates are clamped
+	loss := l.F([][]float64{{0, 1}}, [][]float64{{1, 0}})
+	assert.False(t, math.IsNaN(loss) || math.IsInf(loss, 0))
+	assert.True(t, loss > 10)
+
+	assert.Equal(t, 0.25, l.Df(0.5, 0.25, 0))
+}
+
+func Test_WeightedCrossEntropy(t *testing.T) {
+	l := NewWeightedCrossEntropy([]float64{1, 3})
+
+	estimate := []float64{0.25, 0.75}
+	plain, weighted := make([]float64, 2), make([]float64, 2)
+	OutputDeltas(CrossEntropy{}, estimate, []float64{1, 0}, []float64{1, 1}, plain)
+	OutputDeltas(l, estimate, []float64{1, 0}, []float64{1, 1}, weighted)
+	assert.Equal(t, plain, weighted)
+
+	OutputDeltas(CrossEntropy{}, estimate, []float64{0, 1}, []float64{1, 1}, plain)
+	OutputDeltas(l, estimate, []float64{0, 1}, []float64{1, 1}, weighted)
+	for i := range plain {
+		assert.InDelta(t, 3*plain[i], weighted[i], 1e-12)
+	}
+
+	ce := CrossEntropy{}.F([][]float64{estimate}, [][]float64{{0, 1}})
+	assert.InDelta(t, 3*ce, l.F([][]float64{estimate}, [][]float64{{0, 1}}), 1e-12)
+
+	assert.NoError(t, ValidateLoss(l, 2))
+	assert.EqualError(t, ValidateLoss(l, 3), "weighted cross entropy has 2 weights, network has 3 outputs")
+}
+
+func Test_LabelSmoothing(t *testing.T) {
+	ideal := [][]float64{{0, 1, 0}}
+
+	// plain CE approaches zero as the estimate approaches ideal
+	assert.InDelta(t, 0, CrossEntropy{}.F([][]float64{{1e-6, 1 - 2e-6, 1e-6}}, ideal), 1e-5)
+
+	// with smoothing the minimum is at the smoothed target, and is nonzero
+	l := CrossEntropy{Smoothing: 0.1}
+	smoothed := [][]float64{{0.05, 0.9, 0.05}}
+	floor := l.F(smoothed, ideal)
+	assert.InDelta(t, -(0.9*math.Log(0.9) + 0.1*math.Log(0.05)), floor, 1e-12)
+	assert.True(t, floor > 0)
+	assert.True(t, l.F([][]float64{{0.04, 0.92, 0.04}}, ideal) > floor)
+	assert.True(t, l.F([][]float64{{0.06, 0.88, 0.06}}, ideal) > floor)
+
+	deltas := make([]float64, 3)
+	OutputDeltas(l, smoothed[0], ideal[0], []float64{1, 1, 1}, deltas)
+	for _, d := range deltas {
+		assert.InDelta(t, 0, d, 1e-12)
+	}
+	OutputDeltas(CrossEntropy{}, smoothed[0], ideal[0], []float64{1, 1, 1}, deltas)
+	assert.Equal(t, []float64{0.05, -0.09999999999999998, 0.05}, deltas)
+
+	assert.NoError(t, ValidateLoss(l, 3))
+	for _, s := range []float64{-0.1, 1, 1.5} {
+		assert.EqualError(t, ValidateLoss(CrossEntropy{Smoothing: s}, 3), fmt.Sprintf("label smoothing must be in [0,1), got %g", s))
+	}
+}
+
+func Test_Quantile(t *testing.T) {
+	l := NewQuantile(0.9)
+
+	assert.InDelta(t, 0.9, l.F([][]float64{{0}}, [][]float64{{1}}), 1e-12)
+	assert.InDelta(t, 0.1, l.F([][]float64{{1}}, [][]float64{{0}}), 1e-12)
+
+	assert.InDelta(t, -0.9, l.Df(0, 1, 1), 1e-12)
+	assert.InDelta(t, 0.05, l.Df(1, 0, 0.5), 1e-12)
+	assert.Equal(t, 0.0, l.Df(1, 1, 1))
+
+	for _, tau := range []float64{0, 1, -0.5} {
+		assert.Panics(t, func() { NewQuantile(tau) })
+		assert.EqualError(t, ValidateLoss(Quantile{Tau: tau}, 1), fmt.Sprintf("quantile must be in (0,1), got %g", tau))
+	}
+}
+
+func Test_LogCosh(t *testing.T) {
+	l := GetLoss(LossLogCosh)
+
+	for _, r := range []float64{-2, -0.5, 0, 0.1, 3} {
+		assert.InDelta(t, math.Log(math.Cosh(r)), l.F([][]float64{{r}}, [][]float64{{0}}), 1e-12)
+		assert.InDelta(t, math.Tanh(r)*0.5, l.Df(r, 0, 0.5), 1e-12)
+	}
+
+	// cosh(1e3) overflows float64
+	assert.True(t, math.IsInf(math.Log(math.Cosh(1e3)), 1))
+	loss := l.F([][]float64{{1e3, -1e3}}, [][]float64{{0, 0}})
+	assert.False(t, math.IsInf(loss, 0) || math.IsNaN(loss))
+	assert.InDelta(t, 1e3-math.Ln2, loss, 1e-9)
+	assert.Equal(t, 1.0, l.Df(1e3, 0, 1))
+}
+
+func Test_CrossEntropyZeroEstimate(t *testing.T) {
+	l := GetLoss(LossCrossEntropy)
+
+	loss := l.F([][]float64{{0, 1, 0}}, [][]float64{{1, 0, 0}})
+	assert.False(t, math.IsNaN(loss) || math.IsInf(loss, 0))
+	assert.InDelta(t, -math.Log(1e-16), loss, 1e-9)
+
+	// zero estimates where ideal is 0 contribute nothing
+	assert.Equal(t, 0.0, l.F([][]float64{{0, 1, 0}}, [][]float64{{0, 1, 0}}))
+}
+
+func Test_PolicyGradientLosses(t *testing.T) {
+	assert.IsType(t, ActorPolicyGradient{}, GetLoss(LossActor))
+	assert.IsType(t, CriticPolicyGradient{}, GetLoss(LossCritic))
+
+	actor := GetLoss(LossActor)
+	// action 1 taken with probability 0.5 and delta 2
+	assert.InDelta(t, -2*math.Log(0.5), actor.F([][]float64{{0.5, 0.5}}, [][]float64{{0, 2}}), 1e-12)
+	assert.InDelta(t, -4.0*0.25, actor.Df(0.5, 2, 0.25), 1e-12)
+	assert.Equal(t, 0.0, actor.Df(0.5, 0, 0.25))
+
+	critic := GetLoss(LossCritic)
+	assert.InDelta(t, 2.5, critic.F([][]float64{{3}, {0}}, [][]float64{{1}, {-2}}), 1e-12)
+	assert.Equal(t, 1.0, critic.Df(3, 2, 0.25))
+}
+
+func Test_UnknownLoss(t *testing.T) {
+	assert.Panics(t, func() { GetLoss(LossNone) })
+	assert.Panics(t, func() { GetLoss(LossType(99)) })
+}
+
+// underForecast is MSE with under-forecasts penalized by a factor of 4
+type underForecast struct{}
+
+func (l underForecast) F(estimate, ideal [][]float64) float64 {
+	var sum float64
+	for i := range estimate {
+		for j := range estimate[i] {
+			r := estimate[i][j] - ideal[i][j]
+			if r < 0 {
+				r *= 2
+			}
+			sum += r * r
+		}
+	}
+	return sum / float64(len(estimate)*len(estimate[0]))
+}
+
+func (l underForecast) Df(estimate, ideal, activation float64) float64 {
+	r := estimate - ideal
+	if r < 0 {
+		r *= 4
+	}
+	return activation * r
+}
+
+func Test_RegisterLoss(t *testing.T) {
+	loss := RegisterLoss("under-forecast", func() Loss { return underForecast{} })
+
+	assert.Equal(t, "under-forecast", loss.String())
+	assert.IsType(t, underForecast{}, GetLoss(loss))
+	assert.Equal(t, loss, RegisterLoss("under-forecast", func() Loss { return underForecast{} }))
+
+	var unmarshaled LossType
+	assert.Nil(t, unmarshaled.UnmarshalJSON([]byte(`"under-forecast"`)))
+	assert.Equal(t, loss, unmarshaled)
+	assert.Nil(t, unmarshaled.UnmarshalJSON([]byte(`3`)))
+	assert.Equal(t, LossMeanSquared, unmarshaled)
+	assert.Error(t, unmarshaled.UnmarshalJSON([]byte(`"unregistered"`)))
+}
+
+func Test_RegisterLossConcurrent(t *testing.T) {
+	types := make([]LossType, 16)
+	var wg sync.WaitGroup
+	for i := range types {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			types[i] = RegisterLoss(fmt.Sprintf("concurrent-%d", i), func() Loss { return MeanSquared{} })
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[LossType]bool)
+	for i, l := range types {
+		assert.False(t, seen[l])
+		seen[l] = true
+		assert.Equal(t, fmt.Sprintf("concurrent-%d", i), l.String())
+	}
+}
+
+func Test_Hinge(t *testing.T) {
+	l := GetLoss(LossHinge)
+
+	assert.InDelta(t, 0.25, l.F([][]float64{{0.5}, {-2}}, [][]float64{{1}, {-1}}), 1e-12)
+	// {0,1} labels are remapped to {-1,+1}
+	assert.Equal(t, l.F([][]float64{{0.5}, {0.2}}, [][]float64{{1}, {-1}}), l.F([][]float64{{0.5}, {0.2}}, [][]float64{{1}, {0}}))
+
+	assert.Equal(t, -0.5, l.Df(0.5, 1, 0.5))
+	assert.Equal(t, 0.5, l.Df(0.5, 0, 0.5))
+	assert.Equal(t, 0.0, l.Df(1, 1, 1))
+	assert.Equal(t, 0.0, l.Df(-3, -1, 1))
+}
+
+func Test_Poisson(t *testing.T) {
+	l := GetLoss(LossPoisson)
+
+	assert.InDelta(t, 2-3*math.Log(2), l.F([][]float64{{2}}, [][]float64{{3}}), 1e-12)
+	assert.False(t, math.IsInf(l.F([][]float64{{0}}, [][]float64{{3}}), 0))
+
+	// paired with an exponential output, Df is estimate - ideal
+	est := Exp{}.F(0.7)
+	assert.InDelta(t, est-3, l.Df(est, 3, Exp{}.Df(est)), 1e-12)
+}
+
+func Test_CosineLoss(t *testing.T) {
+	l := GetLoss(LossCosine)
+
+	assert.InDelta(t, 0, l.F([][]float64{{1, 2, 3}}, [][]float64{{1, 2, 3}}), 1e-12)
+	assert.InDelta(t, 0, l.F([][]float64{{1, 2, 3}}, [][]float64{{2, 4, 6}}), 1e-12)
+	assert.InDelta(t, 1, l.F([][]float64{{1, 0}}, [][]float64{{0, 3}}), 1e-12)
+	assert.InDelta(t, 2, l.F([][]float64{{1, 0}}, [][]float64{{-1, 0}}), 1e-12)
+	assert.Equal(t, 1.0, l.F([][]float64{{0, 0}}, [][]float64{{0, 3}}))
+
+	estimate, ideal := []float64{2, 1, 0}, []float64{0, 1, 1}
+	deltas := make([]float64, 3)
+	OutputDeltas(l, estimate, ideal, []float64{1, 1, 1}, deltas)
+
+	// agrees with finite differences
+	h := 1e-6
+	for i := range estimate {
+		plus, minus := append([]float64{}, estimate...), append([]float64{}, estimate...)
+		plus[i] += h
+		minus[i] -= h
+		numeric := (l.F([][]float64{plus}, [][]float64{ideal}) - l.F([][]float64{minus}, [][]float64{ideal})) / (2 * h)
+		assert.InDelta(t, numeric, deltas[i], 1e-6)
+	}
+
+	// the gradient rotates the estimate toward ideal without scaling it
+	assert.InDelta(t, 0, Dot(deltas, estimate), 1e-12)
+	step := make([]float64, 3)
+	for i := range step {
+		step[i] = estimate[i] - 0.1*deltas[i]
+	}
+	assert.True(t, l.F([][]float64{step}, [][]float64{ideal}) < l.F([][]float64{estimate}, [][]float64{ideal}))
+
+	// zero vectors have defined gradients
+	OutputDeltas(l, []float64{0, 0}, []float64{0, 2}, []float64{1, 1}, deltas[:2])
+	assert.Equal(t, []float64{0, -1}, deltas[:2])
+	OutputDeltas(l, []float64{1, 2}, []float64{0, 0}, []float64{1, 1}, deltas[:2])
+	assert.Equal(t, []float64{0, 0}, deltas[:2])
+}
+
+func Test_PPOClip(t *testing.T) {
+	l := GetLoss(LossPPO).(PPOClip)
+	old := []float64{0.5, 0.5}
+
+	objective := func(pi []float64, ideal []float64) float64 { return -l.F([][]float64{pi}, [][]float64{ideal}) }
+	// within the clip range the objective is r*A
+	assert.InDelta(t, 1.1*2, objective([]float64{0.55, 0.45}, PPOTarget(0, 2, old)), 1e-12)
+	// and beyond it the ratio is clipped
+	assert.InDelta(t, 1.2*2, objective([]float64{0.9, 0.1}, PPOTarget(0, 2, old)), 1e-12)
+	assert.InDelta(t, 0.8*-2, objective([]float64{0.1, 0.9}, PPOTarget(0, -2, old)), 1e-12)
+	// unless clipping would make the objective better
+	assert.InDelta(t, 0.2*2, objective([]float64{0.1, 0.9}, PPOTarget(0, 2, old)), 1e-12)
+	assert.InDelta(t, 1.8*-2, objective([]float64{0.9, 0.1}, PPOTarget(0, -2, old)), 1e-12)
+
+	deltas := make([]float64, 2)
+	grad := func(pi []float64, ideal []float64) []float64 {
+		OutputDeltas(l, pi, ideal, []float64{1, 1}, deltas)
+		return deltas
+	}
+	// positive advantage beyond 1+epsilon, no further incentive
+	assert.Equal(t, []float64{0, 0}, grad([]float64{0.9, 0.1}, PPOTarget(0, 2, old)))
+	// negative advantage below 1-epsilon
+	assert.Equal(t, []float64{0, 0}, grad([]float64{0.1, 0.9}, PPOTarget(0, -2, old)))
+	// clipping never hides a worsened objective
+	assert.True(t, grad([]float64{0.1, 0.9}, PPOTarget(0, 2, old))[0] < 0)
+	assert.True(t, grad([]float64{0.9, 0.1}, PPOTarget(0, -2, old))[0] > 0)
+
+	// agrees with finite differences through the softmax within the clip range
+	h := 1e-6
+	for _, ideal := range [][]float64{PPOTarget(0, 2, old), PPOTarget(1, -1, old)} {
+		z := []float64{0.1, -0.05}
+		analytic := append([]float64{}, grad(Softmax(z), ideal)...)
+		for i := range z {
+			plus, minus := append([]float64{}, z...), append([]float64{}, z...)
+			plus[i] += h
+			minus[i] -= h
+			numeric := (l.F([][]float64{Softmax(plus)}, [][]float64{ideal}) - l.F([][]float64{Softmax(minus)}, [][]float64{ideal})) / (2 * h)
+			assert.InDelta(t, numeric, analytic[i], 1e-6)
+		}
+	}
+}
+
+func Test_ActorEntropyBonus(t *testing.T) {
+	z := []float64{1, 0.2, -0.5}
+	pi := Softmax(z)
+	ideal := []float64{0, 1.5, 0}
+
+	l := ActorPolicyGradient{EntropyCoeff: 0.1}
+	assert.InDelta(t, ActorPolicyGradient{}.F([][]float64{pi}, [][]float64{ideal})-0.1*entropy(pi),
+		l.F([][]float64{pi}, [][]float64{ideal}), 1e-12)
+
+	// the policy gradient and the entropy term agree with finite differences
+	// through the softmax, alone and together
+	for _, l := range []ActorPolicyGradient{{}, {EntropyCoeff: 0.1}, {EntropyCoeff: 2}} {
+		for _, ideal := range [][]float64{ideal, {0, 0, 0}, {-0.7, 0, 0}} {
+			deltas := make([]float64, 3)
+			OutputDeltas(l, Softmax(z), ideal, []float64{1, 1, 1}, deltas)
+			h := 1e-6
+			for i := range z {
+				plus, minus := append([]float64{}, z...), append([]float64{}, z...)
+				plus[i] += h
+				minus[i] -= h
+				numeric := (l.F([][]float64{Softmax(plus)}, [][]float64{ideal}) - l.F([][]float64{Softmax(minus)}, [][]float64{ideal})) / (2 * h)
+				assert.InDelta(t, numeric, deltas[i], 1e-6, "%+v %v", l, ideal)
+			}
+		}
+	}
+}
+
+func Test_CompensatedLoss(t *testing.T) {
+	// a few large residuals ahead of a million tiny ones, which naive
+	// summation rounds away
+	estimate, ideal := make([][]float64, 1000003), make([][]float64, 1000003)
+	reference := new(big.Float).SetPrec(512)
+	for i := range estimate {
+		r := 1e-4
+		if i < 3 {
+			r = 1e4
+		}
+		estimate[i], ideal[i] = []float64{r}, []float64{0}
+		reference.Add(reference, big.NewFloat(math.Pow(r, 2)))
+	}
+	mean, _ := reference.Quo(reference, big.NewFloat(float64(len(estimate)))).Float64()
+
+	loss := MeanSquared{}.F(estimate, ideal)
+	assert.InDelta(t, mean, loss, math.Nextafter(mean, math.Inf(1))-mean)
+
+	var c compensated
+	c.add(math.Inf(1))
+	c.add(1)
+	assert.Equal(t, math.Inf(1), c.value())
+}
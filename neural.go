@@ -2,6 +2,8 @@ package deep
 
 import (
 	"fmt"
+	"math/rand"
+	"sort"
 )
 
 // Neural is a neural network
@@ -9,6 +11,13 @@ type Neural struct {
 	Layers []*Layer
 	Biases [][]*Synapse
 	Config *Config
+	// Conv is the convolutional input stage, if any
+	Conv *Convolution
+
+	// training enables dropout in Forward
+	training bool
+	// rand is the source of dropout, nil for the global source
+	rand *rand.Rand
 }
 
 // Config defines the network topology, activations, losses etc
@@ -20,39 +29,222 @@ type Config struct {
 	// containing 5 and 3 nodes respectively, followed an output layer
 	// containing 3 nodes.
 	Layout []int
-	// Activation functions: {ActivationTanh, ActivationReLU, ActivationSigmoid}
+	// Activation functions: {ActivationTanh, ActivationReLU, ActivationSigmoid, ActivationExp,
+	// ActivationLeakyReLU, ActivationELU, ActivationSELU, ActivationGELU,
+	// ActivationSwish, ActivationSoftplus, ActivationPReLU, ActivationHardSigmoid,
+	// ActivationHardTanh}
 	Activation ActivationType
-	// Solver modes: {ModeRegression, ModeBinary, ModeMultiClass, ModeMultiLabel}
+	// Activations optionally sets the activation of each layer of Layout,
+	// where ActivationNone falls back to Activation. Mode still determines
+	// the output activation, unless it is ModeDefault.
+	Activations []ActivationType
+	// Parameters of parameterized activations
+	ActivationParams ActivationParams
+	// Solver modes: {ModeRegression, ModeBinary, ModeMultiClass, ModeMultiLabel,
+	// ModePositiveRegression}
 	Mode Mode
-	// Initializer for weights: {NewNormal(σ, μ), NewUniform(σ, μ)}
-	Weight WeightInitializer `json:"-"`
-	// Loss functions: {LossCrossEntropy, LossBinaryCrossEntropy, LossMeanSquared}
+	// Initializer for weights: {NewNormal(σ, μ), NewUniform(σ, μ), WeightLeCun,
+	// WeightXavier, WeightHe}
+	Weight Initializer `json:"-"`
+	// Seed seeds a source of the network of its own for Weight, which must
+	// then be a RandInitializer, for reproducible initialization. Zero
+	// draws from the global source.
+	Seed int64 `json:",omitempty"`
+	// Loss functions: {LossCrossEntropy, LossBinaryCrossEntropy, LossMeanSquared,
+	// LossHuber, LossMeanAbsolute, LossFocal, LossKL, LossQuantile, LossLogCosh,
+	// LossHinge, LossPoisson, LossCosine}
 	Loss LossType
 	// Apply bias nodes
 	Bias bool
+	// Dropout optionally sets the probability of dropping the output of each
+	// neuron of each layer of Layout during training, other than the output
+	// layer. Survivors are scaled by 1/(1-p), and Predict never drops.
+	Dropout []float64
+	// BatchNorm optionally batch normalizes the sums of each layer of Layout
+	// but the output layer, by the statistics of each batch of the
+	// BatchTrainer and by running statistics otherwise
+	BatchNorm []bool
+	// LayerNorm optionally normalizes the sums of each example across each
+	// layer of Layout but the output layer, alike in training and Predict
+	LayerNorm []bool
+	// L1 and L2 penalize the absolute and squared values of all weights but
+	// biases during training, by L1*|w| + L2*w²/2. Both give an elastic net.
+	L1, L2 float64
+	// Heads optionally splits the output layer into ranges with their own
+	// output activation and loss, in place of Mode and Loss. The ranges
+	// must cover all outputs without overlapping.
+	Heads []Head
+	// Skips are identity skip connections between hidden layers
+	Skips []Skip
+	// Conv optionally convolves the inputs before the first layer
+	Conv *Conv1D `json:",omitempty"`
+	// Recurrent optionally feeds the outputs of each layer of Layout but
+	// the output layer back into the layer at the next step, as the hidden
+	// state of an Elman network. The state carries across calls of Forward
+	// and Predict until ResetState, and is not part of a Dump.
+	Recurrent []bool `json:",omitempty"`
+}
+
+// Skip adds the outputs of layer From to the outputs of layer To, a later
+// hidden layer of the same size
+type Skip struct {
+	From, To int
 }
 
-// NewNeural returns a new neural network
+// Head is the range [From, To) of outputs of a multi-head network
+type Head struct {
+	From, To int
+	// Mode determines the output activation of the head
+	Mode Mode
+	// Loss of the head, which defaults by Mode like Config.Loss
+	Loss LossType
+	// Weight of the head's loss in the combined loss, zero is 1
+	Weight float64
+}
+
+// Validate reports whether c describes a valid network
+func (c *Config) Validate() error {
+	if len(c.Layout) == 0 {
+		return fmt.Errorf("empty layout")
+	}
+	if c.L1 < 0 || c.L2 < 0 {
+		return fmt.Errorf("negative regularization L1 %v, L2 %v", c.L1, c.L2)
+	}
+	if len(c.Dropout) > 0 {
+		if len(c.Dropout) != len(c.Layout) {
+			return fmt.Errorf("%d dropout rates for %d layers", len(c.Dropout), len(c.Layout))
+		}
+		for _, p := range c.Dropout {
+			if p < 0 || p > 1 {
+				return fmt.Errorf("invalid dropout rate %v", p)
+			}
+		}
+		if c.Dropout[len(c.Dropout)-1] != 0 {
+			return fmt.Errorf("dropout on output layer")
+		}
+	}
+	if len(c.BatchNorm) > 0 {
+		if len(c.BatchNorm) != len(c.Layout) {
+			return fmt.Errorf("%d batch norms for %d layers", len(c.BatchNorm), len(c.Layout))
+		}
+		if c.BatchNorm[len(c.BatchNorm)-1] {
+			return fmt.Errorf("batch norm on output layer")
+		}
+	}
+	if len(c.LayerNorm) > 0 {
+		if len(c.LayerNorm) != len(c.Layout) {
+			return fmt.Errorf("%d layer norms for %d layers", len(c.LayerNorm), len(c.Layout))
+		}
+		if c.LayerNorm[len(c.LayerNorm)-1] {
+			return fmt.Errorf("layer norm on output layer")
+		}
+		for i, norm := range c.LayerNorm {
+			if norm && len(c.BatchNorm) > 0 && c.BatchNorm[i] {
+				return fmt.Errorf("batch and layer norm on layer %d", i)
+			}
+		}
+	}
+	if len(c.Recurrent) > 0 {
+		if len(c.Recurrent) != len(c.Layout) {
+			return fmt.Errorf("%d recurrences for %d layers", len(c.Recurrent), len(c.Layout))
+		}
+		if c.Recurrent[len(c.Recurrent)-1] {
+			return fmt.Errorf("recurrent output layer")
+		}
+		for i, recurrent := range c.Recurrent {
+			if !recurrent {
+				continue
+			}
+			if (len(c.BatchNorm) > 0 && c.BatchNorm[i]) || (len(c.LayerNorm) > 0 && c.LayerNorm[i]) {
+				return fmt.Errorf("normalized recurrent layer %d", i)
+			}
+			if c.Conv != nil {
+				return fmt.Errorf("convolution with recurrent layer %d", i)
+			}
+		}
+	}
+	if len(c.Activations) > 0 && len(c.Activations) != len(c.Layout) {
+		return fmt.Errorf("%d activations for %d layers", len(c.Activations), len(c.Layout))
+	}
+	if c.Conv != nil {
+		if err := c.Conv.validate(c.Inputs); err != nil {
+			return err
+		}
+	}
+	for _, s := range c.Skips {
+		if s.From < 0 || s.From >= s.To || s.To >= len(c.Layout)-1 {
+			return fmt.Errorf("invalid skip from layer %d to %d", s.From, s.To)
+		}
+		if c.Layout[s.From] != c.Layout[s.To] {
+			return fmt.Errorf("skip from layer %d of %d neurons to layer %d of %d", s.From, c.Layout[s.From], s.To, c.Layout[s.To])
+		}
+	}
+	if len(c.Heads) > 0 {
+		outputs := c.Layout[len(c.Layout)-1]
+		heads := make([]Head, len(c.Heads))
+		copy(heads, c.Heads)
+		sort.Slice(heads, func(i, j int) bool { return heads[i].From < heads[j].From })
+		var next int
+		for _, h := range heads {
+			if h.To <= h.From {
+				return fmt.Errorf("empty head [%d, %d)", h.From, h.To)
+			}
+			if h.From < next {
+				return fmt.Errorf("head [%d, %d) overlaps output %d", h.From, h.To, next-1)
+			}
+			if h.From > next {
+				return fmt.Errorf("outputs [%d, %d) have no head", next, h.From)
+			}
+			next = h.To
+		}
+		if next != outputs {
+			return fmt.Errorf("heads cover %d outputs, layout has %d", next, outputs)
+		}
+	}
+	return nil
+}
+
+func defaultLoss(mode Mode) LossType {
+	switch mode {
+	case ModeMultiClass, ModeMultiLabel:
+		return LossCrossEntropy
+	case ModeBinary:
+		return LossBinaryCrossEntropy
+	}
+	return LossMeanSquared
+}
+
+// NewNeural returns a new neural network, and panics if c is invalid
 func NewNeural(c *Config) *Neural {
+	if err := c.Validate(); err != nil {
+		panic(fmt.Sprintf("deep: invalid config: %s", err))
+	}
+	c.defaults()
+	return newNeural(c, c.initializer())
+}
 
-	if c.Weight == nil {
+// defaults sets the unset initializer, activation and losses of c
+func (c *Config) defaults() {
+	if unset(c.Weight) {
 		c.Weight = NewUniform(0.5, 0)
 	}
 	if c.Activation == ActivationNone {
 		c.Activation = ActivationSigmoid
 	}
 	if c.Loss == LossNone {
-		switch c.Mode {
-		case ModeMultiClass, ModeMultiLabel:
-			c.Loss = LossCrossEntropy
-		case ModeBinary:
-			c.Loss = LossBinaryCrossEntropy
-		default:
-			c.Loss = LossMeanSquared
+		c.Loss = defaultLoss(c.Mode)
+	}
+	for i := range c.Heads {
+		if c.Heads[i].Loss == LossNone {
+			c.Heads[i].Loss = defaultLoss(c.Heads[i].Mode)
 		}
 	}
+}
 
-	layers := initializeLayers(c)
+// newNeural returns a new neural network of the valid config c, whose
+// weights are initialized by weight
+func newNeural(c *Config, weight Initializer) *Neural {
+	layers := initializeLayers(c, weight)
 
 	var biases [][]*Synapse
 	if c.Bias {
@@ -61,69 +253,200 @@ func NewNeural(c *Config) *Neural {
 			if c.Mode == ModeRegression && i == len(layers)-1 {
 				continue
 			}
-			biases[i] = layers[i].ApplyBias(c.Weight)
+			biases[i] = layers[i].ApplyBias(biasInitializer(weight))
 		}
 	}
 
-	return &Neural{
+	n := &Neural{
 		Layers: layers,
 		Biases: biases,
 		Config: c,
 	}
+	if c.Conv != nil {
+		n.Conv = newConvolution(c, weight)
+	}
+	return n
 }
 
-func initializeLayers(c *Config) []*Layer {
+// layerActivation is the activation of layer i, other than by Mode
+func (c *Config) layerActivation(i int) ActivationType {
+	if len(c.Activations) > 0 && c.Activations[i] != ActivationNone {
+		return c.Activations[i]
+	}
+	return c.Activation
+}
+
+// Regularization returns the gradient of the L1 and L2 penalties of s
+func (c *Config) Regularization(s *Synapse) float64 {
+	if s.IsBias {
+		return 0
+	}
+	return c.Penalty(s.Weight)
+}
+
+// Penalty returns the gradient of the L1 and L2 penalties of a weight w
+// other than a bias
+func (c *Config) Penalty(w float64) float64 {
+	var sign float64
+	if w > 0 {
+		sign = 1
+	} else if w < 0 {
+		sign = -1
+	}
+	return c.L1*sign + c.L2*w
+}
+
+// initializer returns the initializer of the weights of c, drawing from a
+// source seeded by c.Seed if set
+func (c *Config) initializer() Initializer {
+	if c.Seed == 0 {
+		return c.Weight
+	}
+	w, ok := c.Weight.(RandInitializer)
+	if !ok {
+		panic(fmt.Sprintf("deep: initializer %T cannot be seeded", c.Weight))
+	}
+	return seeded{w, rand.New(rand.NewSource(c.Seed))}
+}
+
+func initializeLayers(c *Config, weight Initializer) []*Layer {
 	layers := make([]*Layer, len(c.Layout))
 	for i := range layers {
-		act := c.Activation
+		act := c.layerActivation(i)
 		if i == (len(layers)-1) && c.Mode != ModeDefault {
 			act = OutputActivation(c.Mode)
 		}
 		layers[i] = NewLayer(c.Layout[i], act)
 	}
+	if len(c.Heads) > 0 {
+		layers[len(layers)-1] = newHeadsLayer(c.Heads, c.layerActivation(len(layers)-1))
+	}
+
+	for i, l := range layers {
+		for _, neuron := range l.Neurons {
+			neuron.params = &c.ActivationParams
+		}
+		if len(c.Dropout) > 0 {
+			l.Dropout = c.Dropout[i]
+		}
+		if len(c.BatchNorm) > 0 && c.BatchNorm[i] {
+			l.Norm = newNorm(len(l.Neurons))
+		}
+		if len(c.LayerNorm) > 0 && c.LayerNorm[i] {
+			l.Norm = newLayerNorm(len(l.Neurons))
+		}
+	}
+	for _, s := range c.Skips {
+		layers[s.To].skips = append(layers[s.To].skips, layers[s.From])
+	}
 
 	for i := 0; i < len(layers)-1; i++ {
-		layers[i].Connect(layers[i+1], c.Weight)
+		layers[i].Connect(layers[i+1], weight.Layer(c.Layout[i], c.Layout[i+1]))
 	}
 
-	for _, neuron := range layers[0].Neurons {
-		neuron.In = make([]*Synapse, c.Inputs)
+	inputs := c.Inputs
+	if c.Conv != nil {
+		inputs = c.Conv.Outputs(c.Inputs)
+	}
+	first := weight.Layer(inputs, c.Layout[0])
+	synapses := make([]Synapse, inputs*len(layers[0].Neurons))
+	for j, neuron := range layers[0].Neurons {
+		neuron.In = make([]*Synapse, inputs, inputs+1)
 		for i := range neuron.In {
-			neuron.In[i] = NewSynapse(c.Weight())
+			neuron.In[i] = &synapses[j*inputs+i]
+			neuron.In[i].Weight = first()
+		}
+	}
+
+	for i, recurrent := range c.Recurrent {
+		if recurrent {
+			layers[i].connectRecurrent(weight.Layer(c.Layout[i], c.Layout[i]))
 		}
 	}
 
 	return layers
 }
 
-func (n *Neural) fire() {
-	for _, b := range n.Biases {
-		for _, s := range b {
-			s.fire(1)
-		}
-	}
+// SetTraining sets whether n is being trained, which enables dropout in
+// Forward
+func (n *Neural) SetTraining(training bool) {
+	n.training = training
+}
+
+// Training reports whether n is being trained
+func (n *Neural) Training() bool {
+	return n.training
+}
+
+// SetRand sets the source of dropout, or the global source if r is nil.
+// Like the network, a source must not be used concurrently.
+func (n *Neural) SetRand(r *rand.Rand) {
+	n.rand = r
 	for _, l := range n.Layers {
-		l.fire()
+		l.rand = r
 	}
 }
 
-// Forward computes a forward pass
+// Rand returns the source of dropout, nil for the global source
+func (n *Neural) Rand() *rand.Rand {
+	return n.rand
+}
+
+// FreezeLayer excludes the weights, biases and other learned parameters of
+// layer i from training updates
+func (n *Neural) FreezeLayer(i int) {
+	n.Layers[i].Frozen = true
+}
+
+// UnfreezeLayer undoes FreezeLayer
+func (n *Neural) UnfreezeLayer(i int) {
+	n.Layers[i].Frozen = false
+}
+
+// Forward computes a forward pass, with dropout in training mode
 func (n *Neural) Forward(input []float64) error {
+	return n.forward(input, n.training)
+}
+
+func (n *Neural) forward(input []float64, dropout bool) error {
+	if err := n.fireInputs(input); err != nil {
+		return err
+	}
+	for _, l := range n.Layers {
+		l.fire(dropout)
+	}
+	return nil
+}
+
+// fireInputs passes input and the biases to the layers
+func (n *Neural) fireInputs(input []float64) error {
 	if len(input) != n.Config.Inputs {
 		return fmt.Errorf("Invalid input dimension - expected: %d got: %d", n.Config.Inputs, len(input))
 	}
+	if n.Conv != nil {
+		input = n.Conv.forward(input)
+	}
 	for _, n := range n.Layers[0].Neurons {
 		for i := 0; i < len(input); i++ {
 			n.In[i].fire(input[i])
 		}
 	}
-	n.fire()
+	for _, b := range n.Biases {
+		for _, s := range b {
+			s.fire(1)
+		}
+	}
 	return nil
 }
 
-// Predict computes a forward pass and returns a prediction
+// Predict computes a forward pass without dropout and returns a prediction.
+// The pass is computed apart from the neurons of n, so that Predict is safe
+// for concurrent use, but for recurrent networks, whose state it updates.
 func (n *Neural) Predict(input []float64) []float64 {
-	n.Forward(input)
+	if !n.Recurrent() {
+		return n.predict(input)
+	}
+	n.forward(input, false)
 
 	outLayer := n.Layers[len(n.Layers)-1]
 	out := make([]float64, len(outLayer.Neurons))
@@ -133,6 +456,109 @@ func (n *Neural) Predict(input []float64) []float64 {
 	return out
 }
 
+// PredictWithTemperature computes a prediction where the logits of softmax
+// and sigmoid outputs are divided by temperature, such that low
+// temperatures approach the argmax and high temperatures a uniform
+// distribution. Like Predict, it is safe for concurrent use but for
+// recurrent networks.
+func (n *Neural) PredictWithTemperature(input []float64, temperature float64) ([]float64, error) {
+	if temperature <= 0 {
+		return nil, fmt.Errorf("invalid temperature %v, must be positive", temperature)
+	}
+	sums, values, err := n.activations(input)
+	if err != nil {
+		return nil, err
+	}
+
+	outLayer := n.Layers[len(n.Layers)-1]
+	logits, out := sums[len(sums)-1], values[len(values)-1]
+	for i, neuron := range outLayer.Neurons {
+		if neuron.A == ActivationSigmoid {
+			out[i] = Logistic(logits[i], 1/temperature)
+		}
+	}
+	for _, r := range outLayer.softmaxRanges() {
+		scaled := make([]float64, r[1]-r[0])
+		for i, logit := range logits[r[0]:r[1]] {
+			scaled[i] = logit / temperature
+		}
+		copy(out[r[0]:r[1]], Softmax(scaled))
+	}
+	return out, nil
+}
+
+// activations returns the inputs to the activations and the values of the
+// neurons of each layer at a forward pass of input without dropout, apart
+// from the neurons of n like Predict but for recurrent networks, whose
+// state is updated
+func (n *Neural) activations(input []float64) (sums, values [][]float64, err error) {
+	if !n.Recurrent() {
+		if len(input) != n.Config.Inputs {
+			return nil, nil, ErrInputSize{Want: n.Config.Inputs, Got: len(input)}
+		}
+		sums, values = n.pass(input, true)
+		return sums, values, nil
+	}
+	if err := n.forward(input, false); err != nil {
+		return nil, nil, err
+	}
+	sums, values = make([][]float64, len(n.Layers)), make([][]float64, len(n.Layers))
+	for i, l := range n.Layers {
+		sums[i], values[i] = make([]float64, len(l.Neurons)), make([]float64, len(l.Neurons))
+		for j, neuron := range l.Neurons {
+			sums[i][j], values[i][j] = neuron.Sum, neuron.Value
+		}
+	}
+	return sums, values, nil
+}
+
+// Prediction is a class and its score, the output of the class
+type Prediction struct {
+	Class int
+	Score float64
+}
+
+// PredictTopK computes a prediction and returns the k classes of the
+// highest outputs with their scores, from the highest down and the lowest
+// class first among ties. All classes are returned if there are fewer.
+// Like Predict, it is safe for concurrent use but for recurrent networks.
+func (n *Neural) PredictTopK(input []float64, k int) ([]Prediction, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("invalid k %d, must be positive", k)
+	}
+	_, values, err := n.activations(input)
+	if err != nil {
+		return nil, err
+	}
+	out := values[len(values)-1]
+	predictions := make([]Prediction, len(out))
+	for i, score := range out {
+		predictions[i] = Prediction{Class: i, Score: score}
+	}
+	sort.SliceStable(predictions, func(i, j int) bool { return predictions[i].Score > predictions[j].Score })
+	if k < len(predictions) {
+		predictions = predictions[:k]
+	}
+	return predictions, nil
+}
+
+// Loss returns the loss function given by the config of n
+func (n *Neural) Loss() Loss {
+	if len(n.Config.Heads) > 0 {
+		return NewMultiHeadLoss(n.Config.Heads)
+	}
+	return GetLoss(n.Config.Loss)
+}
+
+// OutputLoss returns loss as differentiated for the output layer of n, see
+// ActivationLoss
+func (n *Neural) OutputLoss(loss Loss) Loss {
+	if l, ok := loss.(ActivationLoss); ok {
+		return l.ForActivation(n.Layers[len(n.Layers)-1].A)
+	}
+	return loss
+}
+
 // NumWeights returns the number of weights in the network
 func (n *Neural) NumWeights() (num int) {
 	for _, l := range n.Layers {
@@ -140,6 +566,9 @@ func (n *Neural) NumWeights() (num int) {
 			num += len(n.In)
 		}
 	}
+	if n.Conv != nil {
+		num += len(n.Conv.Kernels)*len(n.Conv.Kernels[0]) + len(n.Conv.Biases)
+	}
 	return
 }
 
@@ -1,6 +1,8 @@
 package deep
 
 import (
+	"math"
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -82,7 +84,396 @@ func Test_Forward(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func Test_Heads(t *testing.T) {
+	n := NewNeural(&Config{
+		Inputs: 2,
+		Layout: []int{4, 5},
+		Heads: []Head{
+			{From: 0, To: 3, Mode: ModeMultiClass},
+			{From: 3, To: 5, Mode: ModeRegression},
+		},
+		Activation: ActivationTanh,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+	})
+	assert.Equal(t, LossCrossEntropy, n.Config.Heads[0].Loss)
+	assert.Equal(t, LossMeanSquared, n.Config.Heads[1].Loss)
+
+	out := n.Predict([]float64{0.5, -1})
+	assert.InEpsilon(t, 1, out[0]+out[1]+out[2], 1e-12)
+	for _, neuron := range n.Layers[1].Neurons[3:] {
+		assert.Equal(t, ActivationLinear, neuron.A)
+	}
+
+	// the slope of a PReLU head is that of the layer
+	n = NewNeural(&Config{
+		Inputs:     2,
+		Layout:     []int{4, 5},
+		Heads:      []Head{{From: 0, To: 3, Mode: ModeMultiClass}, {From: 3, To: 5}},
+		Activation: ActivationPReLU,
+		Weight:     NewNormal(1, 0),
+	})
+	assert.Equal(t, 0.25, n.Layers[1].Alpha)
+	n.Layers[1].Alpha = 0.5
+	assert.Equal(t, PReLU{Alpha: 0.5}, n.Layers[1].Neurons[4].activation())
+
+	for _, heads := range [][]Head{
+		{{From: 0, To: 3}, {From: 2, To: 5}},
+		{{From: 0, To: 2}, {From: 3, To: 5}},
+		{{From: 0, To: 3}},
+		{{From: 0, To: 3}, {From: 3, To: 6}},
+		{{From: 0, To: 0}, {From: 0, To: 5}},
+	} {
+		c := &Config{Inputs: 2, Layout: []int{4, 5}, Heads: heads}
+		assert.Error(t, c.Validate())
+		assert.Panics(t, func() { NewNeural(c) })
+	}
+	c := &Config{Inputs: 2, Layout: []int{4, 5}, Heads: []Head{{From: 2, To: 5}, {From: 0, To: 2}}}
+	assert.NoError(t, c.Validate())
+}
+
+func Test_MultiClassExtremeInputs(t *testing.T) {
+	rand.Seed(0)
+
+	n := NewNeural(&Config{
+		Inputs:     4,
+		Layout:     []int{8, 3},
+		Activation: ActivationReLU,
+		Mode:       ModeMultiClass,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+	})
+	for i := 0; i < 20; i++ {
+		input := make([]float64, 4)
+		for j := range input {
+			input[j] = rand.NormFloat64() * 1e3
+		}
+		out := n.Predict(input)
+		for _, p := range out {
+			assert.False(t, math.IsNaN(p) || math.IsInf(p, 0))
+			assert.True(t, p >= 0 && p <= 1)
+		}
+		assert.InDelta(t, 1, Sum(out), 1e-12)
+	}
+
+	// sums overflowing to infinity
+	n = NewNeural(&Config{Inputs: 1, Layout: []int{3}, Mode: ModeMultiClass, Weight: NewNormal(0, 0)})
+	n.Layers[0].Neurons[0].In[0].Weight = math.MaxFloat64
+	n.Layers[0].Neurons[1].In[0].Weight = math.MaxFloat64
+	assert.Equal(t, []float64{0.5, 0.5, 0}, n.Predict([]float64{2}))
+}
+
+func Test_PredictTopK(t *testing.T) {
+	// the softmax of the inputs
+	n := NewNeural(&Config{Inputs: 4, Layout: []int{4}, Mode: ModeMultiClass, Weight: NewNormal(0, 0)})
+	for j, neuron := range n.Layers[0].Neurons {
+		neuron.In[j].Weight = 1
+	}
+	input := []float64{0.5, 2, 0.5, 1}
+	probs := n.Predict(input)
+
+	top, err := n.PredictTopK(input, 3)
+	assert.NoError(t, err)
+	// ties by class
+	assert.Equal(t, []Prediction{{1, probs[1]}, {3, probs[3]}, {0, probs[0]}}, top)
+
+	top, _ = n.PredictTopK(input, 1)
+	assert.Equal(t, []Prediction{{ArgMax(probs), probs[ArgMax(probs)]}}, top)
+
+	// k is clamped to the outputs
+	top, err = n.PredictTopK(input, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []Prediction{{1, probs[1]}, {3, probs[3]}, {0, probs[0]}, {2, probs[2]}}, top)
+	for i := 1; i < len(top); i++ {
+		assert.True(t, top[i-1].Score >= top[i].Score)
+	}
+
+	top, _ = n.PredictTopK([]float64{1, 1, 1, 1}, 4)
+	for i, p := range top {
+		assert.Equal(t, i, p.Class)
+	}
+
+	for _, k := range []int{0, -1} {
+		_, err = n.PredictTopK(input, k)
+		assert.Error(t, err)
+	}
+}
+
+func Test_PredictWithTemperature(t *testing.T) {
+	rand.Seed(0)
+
+	n := NewNeural(&Config{
+		Inputs:     2,
+		Layout:     []int{4, 3},
+		Activation: ActivationTanh,
+		Mode:       ModeMultiClass,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+	})
+	input := []float64{0.3, -0.8}
+	probs := n.Predict(input)
+
+	out, err := n.PredictWithTemperature(input, 1)
+	assert.NoError(t, err)
+	assert.InDeltaSlice(t, probs, out, 1e-12)
+
+	out, err = n.PredictWithTemperature(input, 1e-6)
+	assert.NoError(t, err)
+	onehot := make([]float64, 3)
+	onehot[ArgMax(probs)] = 1
+	assert.InDeltaSlice(t, onehot, out, 1e-9)
+
+	out, err = n.PredictWithTemperature(input, 1e6)
+	assert.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{1.0 / 3, 1.0 / 3, 1.0 / 3}, out, 1e-5)
+
+	// the network itself is unaffected
+	assert.Equal(t, probs, n.Predict(input))
+
+	for _, temperature := range []float64{0, -1} {
+		_, err = n.PredictWithTemperature(input, temperature)
+		assert.Error(t, err)
+	}
+	_, err = n.PredictWithTemperature([]float64{1}, 1)
+	assert.Error(t, err)
+
+	// the logits of sigmoid outputs are divided alike
+	b := NewNeural(&Config{Inputs: 2, Layout: []int{3, 2}, Mode: ModeMultiLabel, Weight: NewNormal(1, 0), Bias: true})
+	out, err = b.PredictWithTemperature(input, 2)
+	assert.NoError(t, err)
+	for i, p := range b.Predict(input) {
+		assert.InDelta(t, Logistic(math.Log(p/(1-p)), 0.5), out[i], 1e-9)
+	}
+}
+
+func Test_LayerActivations(t *testing.T) {
+	rand.Seed(0)
+
+	n := NewNeural(&Config{
+		Inputs:      4,
+		Layout:      []int{8, 2, 8, 4},
+		Activation:  ActivationReLU,
+		Activations: []ActivationType{ActivationNone, ActivationTanh, ActivationNone, ActivationSigmoid},
+		Mode:        ModeRegression,
+		Weight:      NewNormal(1, 0),
+		Bias:        true,
+	})
+	dump, err := n.Marshal()
+	assert.NoError(t, err)
+	new, err := Unmarshal(dump)
+	assert.NoError(t, err)
+
+	expected := []ActivationType{ActivationReLU, ActivationTanh, ActivationReLU, ActivationLinear}
+	for _, n := range []*Neural{n, new} {
+		for i, l := range n.Layers {
+			assert.Equal(t, expected[i], l.A)
+			for _, neuron := range l.Neurons {
+				assert.Equal(t, expected[i], neuron.A)
+			}
+		}
+	}
+	input := []float64{0.1, -0.4, 2, 0.7}
+	assert.Equal(t, n.Predict(input), new.Predict(input))
+
+	// without a mode the last activation applies to the output layer
+	n = NewNeural(&Config{
+		Inputs:      4,
+		Layout:      []int{8, 4},
+		Activations: []ActivationType{ActivationReLU, ActivationTanh},
+	})
+	assert.Equal(t, ActivationTanh, n.Layers[1].A)
+
+	c := &Config{Inputs: 4, Layout: []int{8, 4}, Activations: []ActivationType{ActivationReLU}}
+	assert.Error(t, c.Validate())
+	assert.Panics(t, func() { NewNeural(c) })
+}
+
 func Test_NumWeights(t *testing.T) {
 	n := NewNeural(&Config{Layout: []int{5, 5, 3}})
 	assert.Equal(t, n.NumWeights(), 5*5+3*5)
 }
+
+func Test_Regularization(t *testing.T) {
+	c := &Config{L1: 0.1, L2: 0.01}
+	assert.InDelta(t, 0.1+0.01*2, c.Regularization(&Synapse{Weight: 2}), 1e-12)
+	assert.InDelta(t, -0.1-0.01*3, c.Regularization(&Synapse{Weight: -3}), 1e-12)
+	assert.Equal(t, 0.0, c.Regularization(&Synapse{Weight: 0}))
+	assert.Equal(t, 0.0, c.Regularization(&Synapse{Weight: 2, IsBias: true}))
+	assert.Equal(t, 0.0, (&Config{}).Regularization(&Synapse{Weight: 2}))
+
+	assert.Panics(t, func() { NewNeural(&Config{Inputs: 1, Layout: []int{1}, L2: -1}) })
+}
+
+func Test_Dropout(t *testing.T) {
+	config := func(dropout []float64) *Config {
+		return &Config{
+			Inputs:     2,
+			Layout:     []int{8, 2},
+			Activation: ActivationTanh,
+			Mode:       ModeRegression,
+			Weight:     NewNormal(1, 0),
+			Dropout:    dropout,
+		}
+	}
+	input := []float64{0.5, -1}
+
+	rand.Seed(0)
+	n := NewNeural(config([]float64{1, 0}))
+	n.SetTraining(true)
+	assert.True(t, n.Training())
+	assert.NoError(t, n.Forward(input))
+	for _, neuron := range n.Layers[0].Neurons {
+		assert.Equal(t, 0.0, neuron.Mask())
+	}
+	for _, neuron := range n.Layers[1].Neurons {
+		assert.Equal(t, 0.0, neuron.Value)
+	}
+	// Predict never drops
+	assert.NotEqual(t, []float64{0, 0}, n.Predict(input))
+
+	// survivors are scaled
+	rand.Seed(0)
+	n = NewNeural(config([]float64{0.5, 0}))
+	n.SetTraining(true)
+	n.Forward(input)
+	var dropped int
+	for _, neuron := range n.Layers[0].Neurons {
+		if neuron.Mask() == 0 {
+			dropped++
+		} else {
+			assert.Equal(t, 2.0, neuron.Mask())
+		}
+	}
+	assert.True(t, dropped > 0 && dropped < 8)
+
+	// no dropout behaves as before
+	rand.Seed(0)
+	n = NewNeural(config([]float64{0, 0}))
+	rand.Seed(0)
+	reference := NewNeural(config(nil))
+	n.SetTraining(true)
+	n.Forward(input)
+	reference.Forward(input)
+	for i, neuron := range n.Layers[1].Neurons {
+		assert.Equal(t, reference.Layers[1].Neurons[i].Value, neuron.Value)
+	}
+
+	assert.Panics(t, func() { NewNeural(config([]float64{0.5})) })
+	assert.Panics(t, func() { NewNeural(config([]float64{1.5, 0})) })
+	assert.Panics(t, func() { NewNeural(config([]float64{0, 0.5})) })
+}
+
+func Test_BatchNorm(t *testing.T) {
+	rand.Seed(0)
+	config := &Config{
+		Inputs:     2,
+		Layout:     []int{3, 1},
+		Activation: ActivationReLU,
+		Mode:       ModeRegression,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+		BatchNorm:  []bool{true, false},
+	}
+	n := NewNeural(config)
+	assert.True(t, n.Normalized())
+	nets := []*Neural{n, NewNeural(config), NewNeural(config)}
+	for _, r := range nets[1:] {
+		r.ApplyWeights(n.Weights())
+	}
+	inputs := [][]float64{{1, 2}, {-1, 0.5}, {3, -2}}
+	assert.NoError(t, ForwardBatch(nets, inputs))
+
+	// sums are normalized by the statistics of the batch
+	for j := range n.Layers[0].Neurons {
+		var mean, variance float64
+		for _, r := range nets {
+			mean += r.Layers[0].Neurons[j].Normalized / 3
+		}
+		for _, r := range nets {
+			variance += math.Pow(r.Layers[0].Neurons[j].Normalized-mean, 2) / 3
+		}
+		assert.InDelta(t, 0, mean, 1e-9)
+		assert.InDelta(t, 1, variance, 1e-3)
+	}
+	// and added to the running statistics, which normalize predictions
+	assert.NotEqual(t, []float64{0, 0, 0}, n.Layers[0].Norm.Mean)
+	assert.Equal(t, nets[1].Norms(), n.Norms())
+	n.Forward(inputs[0])
+	norm := n.Layers[0].Norm
+	for j, neuron := range n.Layers[0].Neurons {
+		assert.InDelta(t, (neuron.Sum-norm.Beta[j])/norm.Gamma[j], neuron.Normalized, 1e-9)
+		assert.InDelta(t, norm.Gamma[j]/math.Sqrt(norm.Var[j]+normEpsilon), neuron.NormScale(), 1e-9)
+	}
+
+	assert.Error(t, ForwardBatch(nets, inputs[:2]))
+	assert.Panics(t, func() { NewNeural(&Config{Inputs: 1, Layout: []int{2, 1}, BatchNorm: []bool{false, true}}) })
+	assert.Panics(t, func() { NewNeural(&Config{Inputs: 1, Layout: []int{2, 1}, BatchNorm: []bool{true}}) })
+}
+
+func Test_LayerNorm(t *testing.T) {
+	rand.Seed(0)
+	config := &Config{
+		Inputs:     2,
+		Layout:     []int{4, 1},
+		Activation: ActivationTanh,
+		Mode:       ModeRegression,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+		LayerNorm:  []bool{true, false},
+	}
+	n := NewNeural(config)
+	assert.False(t, n.Normalized())
+	input := []float64{1, -2}
+
+	// sums are normalized across the layer, with no running statistics
+	predicted := n.Predict(input)
+	n.Forward(input)
+	var mean, variance float64
+	for _, neuron := range n.Layers[0].Neurons {
+		mean += neuron.Normalized / 4
+	}
+	for _, neuron := range n.Layers[0].Neurons {
+		variance += math.Pow(neuron.Normalized-mean, 2) / 4
+	}
+	assert.InDelta(t, 0, mean, 1e-9)
+	assert.InDelta(t, 1, variance, 1e-3)
+	assert.Nil(t, n.Layers[0].Norm.Mean)
+
+	// alike in training and in batches
+	output := func() float64 { return n.Layers[1].Neurons[0].Value }
+	n.SetTraining(true)
+	assert.NoError(t, n.Forward(input))
+	assert.Equal(t, predicted[0], output())
+	r := NewNeural(config)
+	r.ApplyWeights(n.Weights())
+	assert.NoError(t, ForwardBatch([]*Neural{n, r}, [][]float64{input, {0, 3}}))
+	assert.Equal(t, predicted[0], output())
+
+	assert.Panics(t, func() { NewNeural(&Config{Inputs: 1, Layout: []int{2, 1}, LayerNorm: []bool{false, true}}) })
+	assert.Panics(t, func() {
+		NewNeural(&Config{Inputs: 1, Layout: []int{2, 1}, LayerNorm: []bool{true, false}, BatchNorm: []bool{true, false}})
+	})
+}
+
+func Test_Skips(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{
+		Inputs:     2,
+		Layout:     []int{3, 3, 1},
+		Activation: ActivationTanh,
+		Mode:       ModeRegression,
+		Weight:     NewNormal(1, 0),
+		Skips:      []Skip{{From: 0, To: 1}},
+	})
+	n.Predict([]float64{0.5, -1})
+	for k, neuron := range n.Layers[2].Neurons[0].In {
+		from, to := n.Layers[0].Neurons[k], n.Layers[1].Neurons[k]
+		assert.InDelta(t, to.Value+from.Value, neuron.In, 1e-12)
+	}
+
+	for _, skips := range [][]Skip{{{From: 0, To: 3}}, {{From: 1, To: 1}}, {{From: 0, To: 1}}} {
+		assert.Panics(t, func() {
+			NewNeural(&Config{Inputs: 1, Layout: []int{3, 2, 3, 1}, Skips: skips})
+		})
+	}
+}
@@ -6,36 +6,99 @@ type Neuron struct {
 	In    []*Synapse
 	Out   []*Synapse
 	Value float64 `json:"-"`
+	// Sum is the input to the activation at the last forward pass
+	Sum float64 `json:"-"`
+	// Normalized is the normalized sum of inputs at the last forward pass,
+	// if the layer is normalized, such that Sum = γ*Normalized + β
+	Normalized float64 `json:"-"`
+
+	// params of the activation, or the defaults if nil
+	params *ActivationParams
+	// alpha is the learned slope of ActivationPReLU, shared by the layer
+	alpha *float64
+	// mask scales the output at the last forward pass, by dropout
+	mask float64
+	// normScale is γ/sqrt(σ²+ε) at the last forward pass, if the layer is
+	// normalized
+	normScale float64
+	// residual is the sum of the outputs skipped to n at the last forward
+	// pass
+	residual float64
 }
 
 // NewNeuron returns a neuron with the given activation
 func NewNeuron(activation ActivationType) *Neuron {
 	return &Neuron{
-		A: activation,
+		A:    activation,
+		mask: 1,
 	}
 }
 
-func (n *Neuron) fire() {
+// sum sets Sum to the sum of the inputs of n
+func (n *Neuron) sum() {
 	var sum float64
 	for _, s := range n.In {
 		sum += s.Out
 	}
-	n.Value = n.Activate(sum)
+	n.Sum = sum
+}
+
+// fire activates Sum and passes the output on
+func (n *Neuron) fire() {
+	n.Value = n.Activate(n.Sum)
 
-	nVal := n.Value
+	nVal := n.output()
 	for _, s := range n.Out {
 		s.fire(nVal)
 	}
 }
 
+// output is the value n passes on, after dropout and with the outputs
+// skipped to it
+func (n *Neuron) output() float64 {
+	return n.Value*n.mask + n.residual
+}
+
+func (n *Neuron) activation() Differentiable {
+	if n.A == ActivationPReLU && n.alpha != nil {
+		return PReLU{Alpha: *n.alpha}
+	}
+	if n.params != nil {
+		return n.params.Activation(n.A)
+	}
+	return GetActivation(n.A)
+}
+
 // Activate applies the neurons activation
 func (n *Neuron) Activate(x float64) float64 {
-	return GetActivation(n.A).F(x)
+	return n.activation().F(x)
 }
 
 // DActivate applies the derivative of the neurons activation
 func (n *Neuron) DActivate(x float64) float64 {
-	return GetActivation(n.A).Df(x)
+	return n.activation().Df(x)
+}
+
+// Derivative is the derivative of the neurons output at the last forward
+// pass, including its dropout mask
+func (n *Neuron) Derivative() float64 {
+	a := n.activation()
+	if a, ok := a.(InputDifferentiable); ok {
+		return n.mask * a.DfInput(n.Sum)
+	}
+	return n.mask * a.Df(n.Value)
+}
+
+// NormScale is γ/sqrt(σ²+ε) at the last forward pass of a normalized
+// neuron, the derivative of Sum by the sum of inputs under fixed statistics
+func (n *Neuron) NormScale() float64 {
+	return n.normScale
+}
+
+// Mask is the scale of the neurons output by dropout at the last forward
+// pass, 0 if dropped and otherwise 1/(1-p), or 1 without dropout
+func (n *Neuron) Mask() float64 {
+	return n.mask
 }
 
 // Synapse is an edge between neurons
@@ -43,6 +106,8 @@ type Synapse struct {
 	Weight  float64
 	In, Out float64 `json:"-"`
 	IsBias  bool
+	// Pruned synapses are kept at zero by training
+	Pruned bool
 }
 
 // NewSynapse returns a synapse with the specified initialized weight
@@ -0,0 +1,153 @@
+package deep
+
+import "fmt"
+
+const (
+	// normEpsilon keeps the normalization of constant sums finite
+	normEpsilon = 1e-5
+	// normMomentum is the weight of the statistics of a batch in the
+	// running statistics
+	normMomentum = 0.1
+)
+
+// Norm is the batch or layer normalization of the sums of the neurons of a
+// layer
+type Norm struct {
+	// Layer normalizes the sums of each example by their statistics across
+	// the layer rather than by batch statistics
+	Layer bool `json:",omitempty"`
+	// Gamma and Beta scale and shift each normalized sum
+	Gamma, Beta []float64
+	// Mean and Var are the running statistics of each sum, which normalize
+	// outside of ForwardBatch. Layer normalizations have none.
+	Mean, Var []float64 `json:",omitempty"`
+}
+
+func newNorm(n int) *Norm {
+	norm := &Norm{
+		Gamma: make([]float64, n),
+		Beta:  make([]float64, n),
+		Mean:  make([]float64, n),
+		Var:   make([]float64, n),
+	}
+	for i := 0; i < n; i++ {
+		norm.Gamma[i], norm.Var[i] = 1, 1
+	}
+	return norm
+}
+
+func newLayerNorm(n int) *Norm {
+	norm := &Norm{
+		Layer: true,
+		Gamma: make([]float64, n),
+		Beta:  make([]float64, n),
+	}
+	for i := 0; i < n; i++ {
+		norm.Gamma[i] = 1
+	}
+	return norm
+}
+
+// copy returns a copy of n
+func (n *Norm) copy() *Norm {
+	return &Norm{
+		Layer: n.Layer,
+		Gamma: append([]float64(nil), n.Gamma...),
+		Beta:  append([]float64(nil), n.Beta...),
+		Mean:  append([]float64(nil), n.Mean...),
+		Var:   append([]float64(nil), n.Var...),
+	}
+}
+
+// update adds the statistics of a batch of size to the running statistics
+func (n *Norm) update(mean, variance []float64, size int) {
+	unbiased := 1.0
+	if size > 1 {
+		unbiased = float64(size) / float64(size-1)
+	}
+	for i := range n.Mean {
+		n.Mean[i] = (1-normMomentum)*n.Mean[i] + normMomentum*mean[i]
+		n.Var[i] = (1-normMomentum)*n.Var[i] + normMomentum*unbiased*variance[i]
+	}
+}
+
+// Norms returns a copy of the normalization of each layer, nil for layers
+// without
+func (n Neural) Norms() []*Norm {
+	norms := make([]*Norm, len(n.Layers))
+	for i, l := range n.Layers {
+		if l.Norm != nil {
+			norms[i] = l.Norm.copy()
+		}
+	}
+	return norms
+}
+
+// ApplyNorms sets the normalization of each layer that has one
+func (n *Neural) ApplyNorms(norms []*Norm) {
+	for i, l := range n.Layers {
+		if l.Norm != nil && norms[i] != nil {
+			*l.Norm = *norms[i].copy()
+		}
+	}
+}
+
+// Normalized reports whether any layer of n is batch normalized
+func (n *Neural) Normalized() bool {
+	for _, l := range n.Layers {
+		if l.Norm != nil && !l.Norm.Layer {
+			return true
+		}
+	}
+	return false
+}
+
+// ForwardBatch computes a forward pass of each of nets, which must be
+// replicas of one network, over the corresponding input. Batch normalized
+// layers are normalized by the statistics of the batch, which are added to
+// the running statistics of each replica. Layer normalized layers are
+// normalized by example as in Forward.
+func ForwardBatch(nets []*Neural, inputs [][]float64) error {
+	if len(nets) != len(inputs) {
+		return fmt.Errorf("%d networks for %d inputs", len(nets), len(inputs))
+	}
+	for r, n := range nets {
+		if err := n.fireInputs(inputs[r]); err != nil {
+			return err
+		}
+	}
+	if len(nets) == 0 {
+		return nil
+	}
+
+	size := float64(len(nets))
+	for i, l := range nets[0].Layers {
+		for _, n := range nets {
+			n.Layers[i].sum()
+		}
+		if l.Norm != nil && !l.Norm.Layer {
+			mean, variance := make([]float64, len(l.Neurons)), make([]float64, len(l.Neurons))
+			for _, n := range nets {
+				for j, neuron := range n.Layers[i].Neurons {
+					mean[j] += neuron.Sum / size
+				}
+			}
+			for _, n := range nets {
+				for j, neuron := range n.Layers[i].Neurons {
+					variance[j] += (neuron.Sum - mean[j]) * (neuron.Sum - mean[j]) / size
+				}
+			}
+			for _, n := range nets {
+				n.Layers[i].batchNormalize(mean, variance)
+				n.Layers[i].Norm.update(mean, variance, len(nets))
+			}
+		}
+		for _, n := range nets {
+			if l.Norm != nil && l.Norm.Layer {
+				n.Layers[i].layerNormalize()
+			}
+			n.Layers[i].activate(n.training)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package deep
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ONNX versions of the exported models: IR version 7 and opset 13
+const (
+	onnxIRVersion = 7
+	onnxOpset     = 13
+	onnxDouble    = 11
+)
+
+// onnxOps are the ONNX operators of the activations that ExportONNX maps,
+// where linear activations need none
+var onnxOps = map[ActivationType]string{
+	ActivationSigmoid: "Sigmoid",
+	ActivationTanh:    "Tanh",
+	ActivationReLU:    "Relu",
+	ActivationSoftmax: "Softmax",
+	ActivationLinear:  "",
+}
+
+// ExportONNX writes n to w as an ONNX model, for serving it elsewhere. The
+// graph takes an "input" of shape [N, Config.Inputs] and computes an
+// "output" of shape [N, outputs] in doubles, by a MatMul, an Add of the
+// biases if any and the activation of each layer. Only dense networks of
+// sigmoid, tanh, relu, softmax and linear layers can be exported; other
+// activations, convolutions, normalizations, skips, recurrent layers and
+// heads return an error.
+func (n *Neural) ExportONNX(w io.Writer) error {
+	if err := n.exportable(); err != nil {
+		return err
+	}
+
+	var graph proto
+	graph.string(2, "go-deep")
+	in := "input"
+	for i, l := range n.Layers {
+		fanIn := len(l.Neurons[0].In)
+		biased := l.Neurons[0].In[fanIn-1].IsBias
+		if biased {
+			fanIn--
+		}
+		out := len(l.Neurons)
+
+		// the weights are transposed to [in, out]
+		kernel := make([]float64, fanIn*out)
+		bias := make([]float64, out)
+		for j, neuron := range l.Neurons {
+			for k := 0; k < fanIn; k++ {
+				kernel[k*out+j] = neuron.In[k].Weight
+			}
+			if biased {
+				bias[j] = neuron.In[fanIn].Weight
+			}
+		}
+		name := fmt.Sprintf("layer%d", i)
+		graph.message(5, onnxTensor(name+".weight", kernel, fanIn, out))
+		if biased {
+			graph.message(5, onnxTensor(name+".bias", bias, out))
+		}
+
+		steps := []struct{ op, input string }{{"MatMul", name + ".weight"}}
+		if biased {
+			steps = append(steps, struct{ op, input string }{"Add", name + ".bias"})
+		}
+		if op := onnxOps[l.A]; op != "" {
+			steps = append(steps, struct{ op, input string }{op, ""})
+		}
+		for k, step := range steps {
+			output := fmt.Sprintf("%s.%s", name, step.op)
+			if i == len(n.Layers)-1 && k == len(steps)-1 {
+				output = "output"
+			}
+			graph.message(1, onnxNode(output, step.op, in, step.input))
+			in = output
+		}
+	}
+	graph.message(11, onnxValue("input", n.Config.Inputs))
+	graph.message(12, onnxValue("output", len(n.Layers[len(n.Layers)-1].Neurons)))
+
+	var opset proto
+	opset.varint(2, onnxOpset)
+	var model proto
+	model.varint(1, onnxIRVersion)
+	model.string(2, "go-deep")
+	model.message(7, graph)
+	model.message(8, opset)
+	_, err := w.Write(model)
+	return err
+}
+
+// exportable returns an error if n cannot be exported to ONNX
+func (n *Neural) exportable() error {
+	c := n.Config
+	switch {
+	case n.Conv != nil:
+		return fmt.Errorf("cannot export convolutions to ONNX")
+	case len(c.Heads) > 0:
+		return fmt.Errorf("cannot export heads to ONNX")
+	case len(c.Skips) > 0:
+		return fmt.Errorf("cannot export skips to ONNX")
+	case n.Recurrent():
+		return fmt.Errorf("cannot export recurrent layers to ONNX")
+	}
+	for i, l := range n.Layers {
+		if l.Norm != nil {
+			return fmt.Errorf("cannot export the normalization of layer %d to ONNX", i)
+		}
+		if _, ok := onnxOps[l.A]; !ok {
+			return fmt.Errorf("cannot export the %s activation of layer %d to ONNX", l.A, i)
+		}
+	}
+	return nil
+}
+
+// onnxTensor returns a TensorProto of values of shape dims
+func onnxTensor(name string, values []float64, dims ...int) proto {
+	var t proto
+	for _, d := range dims {
+		t.varint(1, uint64(d))
+	}
+	t.varint(2, onnxDouble)
+	t.string(8, name)
+	raw := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint64(raw[8*i:], math.Float64bits(v))
+	}
+	t.bytes(9, raw)
+	return t
+}
+
+// onnxNode returns a NodeProto of op on the given inputs
+func onnxNode(output, op string, inputs ...string) proto {
+	var node proto
+	for _, in := range inputs {
+		if in != "" {
+			node.string(1, in)
+		}
+	}
+	node.string(2, output)
+	node.string(3, output)
+	node.string(4, op)
+	return node
+}
+
+// onnxValue returns a ValueInfoProto of a tensor of doubles of shape
+// [N, size]
+func onnxValue(name string, size int) proto {
+	var batch, features, shape, tensor, typ, value proto
+	batch.string(2, "N")
+	features.varint(1, uint64(size))
+	shape.message(1, batch)
+	shape.message(1, features)
+	tensor.varint(1, onnxDouble)
+	tensor.message(2, shape)
+	typ.message(1, tensor)
+	value.string(1, name)
+	value.message(2, typ)
+	return value
+}
+
+// proto is an encoded protocol buffer message
+type proto []byte
+
+func (p *proto) tag(field, wire int) {
+	*p = appendVarint(*p, uint64(field<<3|wire))
+}
+
+func (p *proto) varint(field int, v uint64) {
+	p.tag(field, 0)
+	*p = appendVarint(*p, v)
+}
+
+func (p *proto) bytes(field int, b []byte) {
+	p.tag(field, 2)
+	*p = appendVarint(*p, uint64(len(b)))
+	*p = append(*p, b...)
+}
+
+func (p *proto) string(field int, s string) {
+	p.bytes(field, []byte(s))
+}
+
+func (p *proto) message(field int, m proto) {
+	p.bytes(field, m)
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
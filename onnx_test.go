@@ -0,0 +1,198 @@
+package deep
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// field is a decoded protocol buffer field
+type field struct {
+	num   int
+	value uint64
+	bytes []byte
+}
+
+// decode decodes the fields of a protocol buffer message of varints and
+// length-delimited fields only
+func decode(t *testing.T, b []byte) []field {
+	var fields []field
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		f := field{num: int(tag >> 3)}
+		switch tag & 7 {
+		case 0:
+			f.value, n = binary.Uvarint(b)
+			b = b[n:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			f.bytes, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// sub returns the fields num of m
+func sub(t *testing.T, m []byte, num int) (fields []field) {
+	for _, f := range decode(t, m) {
+		if f.num == num {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// onnxGraph is a decoded graph of nodes and initializers of doubles
+type onnxGraph struct {
+	nodes        []onnxGraphNode
+	initializers map[string][]float64
+	dims         map[string][]int
+}
+
+type onnxGraphNode struct {
+	op      string
+	inputs  []string
+	outputs []string
+}
+
+func decodeGraph(t *testing.T, model []byte) onnxGraph {
+	g := onnxGraph{initializers: map[string][]float64{}, dims: map[string][]int{}}
+	assert.Equal(t, uint64(7), sub(t, model, 1)[0].value)
+	assert.Equal(t, uint64(13), sub(t, sub(t, model, 8)[0].bytes, 2)[0].value)
+	graph := sub(t, model, 7)[0].bytes
+	for _, n := range sub(t, graph, 1) {
+		var node onnxGraphNode
+		for _, f := range decode(t, n.bytes) {
+			switch f.num {
+			case 1:
+				node.inputs = append(node.inputs, string(f.bytes))
+			case 2:
+				node.outputs = append(node.outputs, string(f.bytes))
+			case 4:
+				node.op = string(f.bytes)
+			}
+		}
+		g.nodes = append(g.nodes, node)
+	}
+	for _, i := range sub(t, graph, 5) {
+		var name string
+		var dims []int
+		var values []float64
+		for _, f := range decode(t, i.bytes) {
+			switch f.num {
+			case 1:
+				dims = append(dims, int(f.value))
+			case 2:
+				assert.Equal(t, uint64(11), f.value)
+			case 8:
+				name = string(f.bytes)
+			case 9:
+				for k := 0; k < len(f.bytes); k += 8 {
+					values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(f.bytes[k:])))
+				}
+			}
+		}
+		g.initializers[name], g.dims[name] = values, dims
+	}
+	return g
+}
+
+// run evaluates the graph on a single input, as a runtime would
+func (g onnxGraph) run(t *testing.T, input []float64) []float64 {
+	values := map[string][]float64{"input": input}
+	cols := map[string]int{"input": len(input)}
+	for _, n := range g.nodes {
+		x := values[n.inputs[0]]
+		out := make([]float64, len(x))
+		switch n.op {
+		case "MatMul":
+			w, dims := g.initializers[n.inputs[1]], g.dims[n.inputs[1]]
+			assert.Equal(t, cols[n.inputs[0]], dims[0])
+			out = make([]float64, dims[1])
+			for j := range out {
+				for k, v := range x {
+					out[j] += v * w[k*dims[1]+j]
+				}
+			}
+		case "Add":
+			for j, v := range x {
+				out[j] = v + g.initializers[n.inputs[1]][j]
+			}
+		case "Tanh":
+			for j, v := range x {
+				out[j] = math.Tanh(v)
+			}
+		case "Relu":
+			for j, v := range x {
+				out[j] = math.Max(0, v)
+			}
+		case "Sigmoid":
+			for j, v := range x {
+				out[j] = 1 / (1 + math.Exp(-v))
+			}
+		case "Softmax":
+			out = Softmax(x)
+		default:
+			t.Fatalf("unexpected op %s", n.op)
+		}
+		values[n.outputs[0]], cols[n.outputs[0]] = out, len(out)
+	}
+	return values["output"]
+}
+
+func Test_ExportONNX(t *testing.T) {
+	rand.Seed(0)
+	for _, c := range []*Config{
+		{Inputs: 3, Layout: []int{5, 4, 2}, Activation: ActivationTanh, Mode: ModeMultiClass, Weight: NewNormal(1, 0), Bias: true},
+		{Inputs: 3, Layout: []int{4, 1}, Activation: ActivationReLU, Mode: ModeRegression, Weight: NewNormal(1, 0), Bias: true},
+		{Inputs: 2, Layout: []int{3, 3}, Activations: []ActivationType{ActivationLinear, ActivationNone}, Activation: ActivationSigmoid, Mode: ModeMultiLabel, Weight: NewNormal(1, 0)},
+	} {
+		n := NewNeural(c)
+		var b bytes.Buffer
+		assert.NoError(t, n.ExportONNX(&b))
+		g := decodeGraph(t, b.Bytes())
+
+		var nodes int
+		for i, l := range n.Layers {
+			fanIn := len(l.Neurons[0].In)
+			nodes++
+			if l.Neurons[0].In[fanIn-1].IsBias {
+				fanIn--
+				nodes++
+				assert.Equal(t, []int{len(l.Neurons)}, g.dims[fmt.Sprintf("layer%d.bias", i)])
+			}
+			if l.A != ActivationLinear {
+				nodes++
+			}
+			assert.Equal(t, []int{fanIn, len(l.Neurons)}, g.dims[fmt.Sprintf("layer%d.weight", i)])
+		}
+		assert.Len(t, g.nodes, nodes)
+		assert.Equal(t, "output", g.nodes[len(g.nodes)-1].outputs[0])
+
+		for _, in := range [][]float64{{0.5, -1, 2}, {-0.25, 0.75, 0}, {1, 1, -1}} {
+			in = in[:c.Inputs]
+			assert.InDeltaSlice(t, n.Predict(in), g.run(t, in), 1e-6)
+		}
+	}
+}
+
+func Test_ExportONNXUnsupported(t *testing.T) {
+	for _, c := range []*Config{
+		{Inputs: 2, Layout: []int{3, 1}, Activation: ActivationELU, Mode: ModeBinary},
+		{Inputs: 2, Layout: []int{3, 1}, Activation: ActivationTanh, Mode: ModeBinary, BatchNorm: []bool{true, false}},
+		{Inputs: 4, Layout: []int{3, 1}, Activation: ActivationTanh, Mode: ModeBinary, Conv: &Conv1D{Kernel: 2, Filters: 1}},
+	} {
+		var b bytes.Buffer
+		assert.Error(t, NewNeural(c).ExportONNX(&b))
+		assert.Equal(t, 0, b.Len())
+	}
+}
@@ -2,12 +2,29 @@ package deep
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
 )
 
+// DumpVersion is the version of the dumps written by Dump
+const DumpVersion = 1
+
 // Dump is a neural network dump
 type Dump struct {
+	// Version of the format of the dump, zero for dumps written before
+	// dumps were versioned
+	Version int
 	Config  *Config
 	Weights [][][]float64
+	// Alphas are the learned slopes of each layer, if any is ActivationPReLU
+	Alphas []float64 `json:",omitempty"`
+	// Norms are the normalizations of each layer, if any is normalized
+	Norms []*Norm `json:",omitempty"`
+	// Pruned are the layer, neuron and input of each pruned synapse
+	Pruned [][3]int `json:",omitempty"`
+	// Conv are the kernels of the convolution, if any
+	Conv *Convolution `json:",omitempty"`
 }
 
 // ApplyWeights sets the weights from a three-dimensional slice
@@ -36,20 +53,399 @@ func (n Neural) Weights() [][][]float64 {
 	return weights
 }
 
+// SetWeights sets the weights like ApplyWeights, but returns an error
+// rather than panic if weights are not shaped like the weights of n
+func (n *Neural) SetWeights(weights [][][]float64) error {
+	if len(weights) != len(n.Layers) {
+		return fmt.Errorf("weights of %d layers for %d layers", len(weights), len(n.Layers))
+	}
+	for i, l := range n.Layers {
+		if len(weights[i]) != len(l.Neurons) {
+			return fmt.Errorf("weights of %d neurons for layer %d of %d neurons", len(weights[i]), i, len(l.Neurons))
+		}
+		for j, neuron := range l.Neurons {
+			if len(weights[i][j]) != len(neuron.In) {
+				return fmt.Errorf("%d weights for neuron %d of layer %d of %d inputs", len(weights[i][j]), j, i, len(neuron.In))
+			}
+		}
+	}
+	n.ApplyWeights(weights)
+	return nil
+}
+
+// CopyWeightsFrom sets the weights and other learned parameters of n to
+// those of other, which must have the same config, e.g. to update a target
+// network
+func (n *Neural) CopyWeightsFrom(other *Neural) error {
+	if !sameConfig(n.Config, other.Config) {
+		return fmt.Errorf("networks of different configs")
+	}
+	for i, l := range n.Layers {
+		src := other.Layers[i]
+		for j, neuron := range l.Neurons {
+			for k, s := range neuron.In {
+				s.Weight = src.Neurons[j].In[k].Weight
+			}
+		}
+		l.Alpha = src.Alpha
+		if l.Norm != nil {
+			copy(l.Norm.Gamma, src.Norm.Gamma)
+			copy(l.Norm.Beta, src.Norm.Beta)
+			copy(l.Norm.Mean, src.Norm.Mean)
+			copy(l.Norm.Var, src.Norm.Var)
+		}
+	}
+	n.ApplyConvolution(other.Conv)
+	return nil
+}
+
+// SoftUpdateFrom moves the weights and other learned parameters of n
+// towards those of src, which must be shaped like n, setting each to
+// tau*src + (1-tau)*current as for the target networks of DDPG
+func (n *Neural) SoftUpdateFrom(src *Neural, tau float64) error {
+	if tau < 0 || tau > 1 {
+		return fmt.Errorf("invalid tau %v", tau)
+	}
+	if !sameShape(n, src) {
+		return fmt.Errorf("networks of different shapes")
+	}
+	if tau == 0 {
+		return nil
+	}
+	for i, l := range n.Layers {
+		from := src.Layers[i]
+		for j, neuron := range l.Neurons {
+			for k, s := range neuron.In {
+				s.Weight = interpolate(s.Weight, from.Neurons[j].In[k].Weight, tau)
+			}
+		}
+		l.Alpha = interpolate(l.Alpha, from.Alpha, tau)
+		if l.Norm != nil {
+			for j := range l.Norm.Gamma {
+				l.Norm.Gamma[j] = interpolate(l.Norm.Gamma[j], from.Norm.Gamma[j], tau)
+				l.Norm.Beta[j] = interpolate(l.Norm.Beta[j], from.Norm.Beta[j], tau)
+			}
+			for j := range l.Norm.Mean {
+				l.Norm.Mean[j] = interpolate(l.Norm.Mean[j], from.Norm.Mean[j], tau)
+				l.Norm.Var[j] = interpolate(l.Norm.Var[j], from.Norm.Var[j], tau)
+			}
+		}
+	}
+	if n.Conv != nil {
+		for f, kernel := range n.Conv.Kernels {
+			for k := range kernel {
+				kernel[k] = interpolate(kernel[k], src.Conv.Kernels[f][k], tau)
+			}
+		}
+		for f := range n.Conv.Biases {
+			n.Conv.Biases[f] = interpolate(n.Conv.Biases[f], src.Conv.Biases[f], tau)
+		}
+	}
+	return nil
+}
+
+// interpolate returns tau*to + (1-tau)*from, exactly to for tau 1
+func interpolate(from, to, tau float64) float64 {
+	if tau == 1 {
+		return to
+	}
+	return tau*to + (1-tau)*from
+}
+
+// sameShape reports whether a and b have alike layers, neurons, synapses,
+// normalizations and convolutions
+func sameShape(a, b *Neural) bool {
+	if len(a.Layers) != len(b.Layers) || (a.Conv == nil) != (b.Conv == nil) {
+		return false
+	}
+	if a.Conv != nil && (len(a.Conv.Kernels) != len(b.Conv.Kernels) ||
+		len(a.Conv.Kernels[0]) != len(b.Conv.Kernels[0]) || len(a.Conv.Biases) != len(b.Conv.Biases)) {
+		return false
+	}
+	for i, l := range a.Layers {
+		other := b.Layers[i]
+		if len(l.Neurons) != len(other.Neurons) || (l.Norm == nil) != (other.Norm == nil) {
+			return false
+		}
+		if l.Norm != nil && (len(l.Norm.Mean) != len(other.Norm.Mean) || l.Norm.Layer != other.Norm.Layer) {
+			return false
+		}
+		for j, neuron := range l.Neurons {
+			if len(neuron.In) != len(other.Neurons[j].In) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// sameConfig reports whether a and b describe the same network, regardless
+// of their weight initializers and of whether unset options are nil or
+// empty slices
+func sameConfig(a, b *Config) bool {
+	if a == b {
+		return true
+	}
+	x, y := *a, *b
+	x.Weight, y.Weight = nil, nil
+	nilEmpty(reflect.ValueOf(&x).Elem())
+	nilEmpty(reflect.ValueOf(&y).Elem())
+	return reflect.DeepEqual(x, y)
+}
+
+// nilEmpty sets the empty slice fields of the struct v to nil
+func nilEmpty(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		if f := v.Field(i); f.Kind() == reflect.Slice && f.Len() == 0 {
+			f.Set(reflect.Zero(f.Type()))
+		}
+	}
+}
+
+// Alphas returns the learned slope of each layer
+func (n Neural) Alphas() []float64 {
+	alphas := make([]float64, len(n.Layers))
+	for i, l := range n.Layers {
+		alphas[i] = l.Alpha
+	}
+	return alphas
+}
+
+// ApplyAlphas sets the learned slope of each layer
+func (n *Neural) ApplyAlphas(alphas []float64) {
+	for i, l := range n.Layers {
+		l.Alpha = alphas[i]
+	}
+}
+
 // Dump generates a network dump
 func (n Neural) Dump() *Dump {
-	return &Dump{
+	dump := n.dumpParameters()
+	dump.Weights = n.Weights()
+	return dump
+}
+
+// dumpParameters returns the dump of n without its weights
+func (n Neural) dumpParameters() *Dump {
+	dump := &Dump{
+		Version: DumpVersion,
 		Config:  n.Config,
-		Weights: n.Weights(),
 	}
+	for _, l := range n.Layers {
+		if l.A == ActivationPReLU {
+			dump.Alphas = n.Alphas()
+			break
+		}
+	}
+	for _, l := range n.Layers {
+		if l.Norm != nil {
+			dump.Norms = n.Norms()
+			break
+		}
+	}
+	dump.Pruned = n.pruned()
+	dump.Conv = n.Convolution()
+	return dump
 }
 
-// FromDump restores a Neural from a dump
+// ErrUnsupportedDumpVersion is returned for dumps of a version unknown to
+// this package, such as those written by a later one
+type ErrUnsupportedDumpVersion struct {
+	Version int
+}
+
+func (e ErrUnsupportedDumpVersion) Error() string {
+	return fmt.Sprintf("unsupported dump version %d, latest is %d", e.Version, DumpVersion)
+}
+
+// migrations migrate dumps of each version to the next one
+var migrations = map[int]func(*Dump) error{
+	// unversioned dumps hold the config and weights, and those fields
+	// added since that are in use, all of which version 1 still reads
+	0: func(*Dump) error { return nil },
+}
+
+// Migrate migrates dump in place from its version to DumpVersion
+func (dump *Dump) Migrate() error {
+	for dump.Version != DumpVersion {
+		migrate, ok := migrations[dump.Version]
+		if !ok {
+			return ErrUnsupportedDumpVersion{Version: dump.Version}
+		}
+		if err := migrate(dump); err != nil {
+			return fmt.Errorf("migrating dump version %d: %v", dump.Version, err)
+		}
+		dump.Version++
+	}
+	return nil
+}
+
+// Validate returns an error unless dump holds a valid config of known
+// activations, losses and modes, and finite weights of exactly the shape
+// the config implies, along with alphas, norms and convolution kernels of
+// the shapes of its layers
+func (dump *Dump) Validate() error {
+	n, err := dump.validateParameters()
+	if err != nil {
+		return err
+	}
+	if len(dump.Weights) != len(n.Layers) {
+		return fmt.Errorf("weights of %d layers, config has %d", len(dump.Weights), len(n.Layers))
+	}
+	for i, l := range n.Layers {
+		if len(dump.Weights[i]) != len(l.Neurons) {
+			return fmt.Errorf("layer %d: weights of %d neurons, config has %d", i, len(dump.Weights[i]), len(l.Neurons))
+		}
+		for j, neuron := range l.Neurons {
+			weights := dump.Weights[i][j]
+			if len(weights) != len(neuron.In) {
+				return fmt.Errorf("layer %d, neuron %d: %d weights, config has %d", i, j, len(weights), len(neuron.In))
+			}
+			for k, w := range weights {
+				if err := checkWeight(i, j, k, w); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkWeight returns an error unless weight k of neuron j of layer i is
+// finite
+func checkWeight(i, j, k int, w float64) error {
+	if math.IsNaN(w) || math.IsInf(w, 0) {
+		return fmt.Errorf("layer %d, neuron %d, weight %d: %v is not finite", i, j, k, w)
+	}
+	return nil
+}
+
+// validateParameters validates dump as Validate does but for its weights,
+// and returns a network of its config, built only for its shape
+func (dump *Dump) validateParameters() (*Neural, error) {
+	c := dump.Config
+	if c == nil {
+		return nil, fmt.Errorf("missing config")
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := c.validateTypes(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	config := *c
+	config.Weight, config.Seed = WeightInitializer(func() float64 { return 0 }), 0
+	n := NewNeural(&config)
+	if dump.Alphas != nil && len(dump.Alphas) != len(n.Layers) {
+		return nil, fmt.Errorf("%d alphas for %d layers", len(dump.Alphas), len(n.Layers))
+	}
+	if dump.Norms != nil {
+		if len(dump.Norms) != len(n.Layers) {
+			return nil, fmt.Errorf("%d norms for %d layers", len(dump.Norms), len(n.Layers))
+		}
+		for i, norm := range dump.Norms {
+			if (norm == nil) != (n.Layers[i].Norm == nil) {
+				return nil, fmt.Errorf("layer %d: norm does not match config", i)
+			}
+			if norm != nil && (len(norm.Gamma) != len(n.Layers[i].Neurons) || len(norm.Beta) != len(norm.Gamma)) {
+				return nil, fmt.Errorf("layer %d: norm of %d scales and %d shifts for %d neurons", i, len(norm.Gamma), len(norm.Beta), len(n.Layers[i].Neurons))
+			}
+			if norm != nil && !norm.Layer && (len(norm.Mean) != len(norm.Gamma) || len(norm.Var) != len(norm.Gamma)) {
+				return nil, fmt.Errorf("layer %d: norm of %d means and %d variances for %d neurons", i, len(norm.Mean), len(norm.Var), len(norm.Gamma))
+			}
+		}
+	}
+	for _, p := range dump.Pruned {
+		if p[0] < 0 || p[0] >= len(n.Layers) || p[1] < 0 || p[1] >= len(n.Layers[p[0]].Neurons) || p[2] < 0 || p[2] >= len(n.Layers[p[0]].Neurons[p[1]].In) {
+			return nil, fmt.Errorf("pruned synapse %v out of range", p)
+		}
+	}
+	if (dump.Conv == nil) != (n.Conv == nil) {
+		return nil, fmt.Errorf("convolution does not match config")
+	}
+	if dump.Conv != nil {
+		if len(dump.Conv.Kernels) != len(n.Conv.Kernels) || len(dump.Conv.Biases) != len(n.Conv.Biases) {
+			return nil, fmt.Errorf("%d kernels and %d biases of convolution, config has %d and %d",
+				len(dump.Conv.Kernels), len(dump.Conv.Biases), len(n.Conv.Kernels), len(n.Conv.Biases))
+		}
+		for i, k := range dump.Conv.Kernels {
+			if len(k) != len(n.Conv.Kernels[i]) {
+				return nil, fmt.Errorf("kernel %d: %d weights, config has %d", i, len(k), len(n.Conv.Kernels[i]))
+			}
+		}
+	}
+	return n, nil
+}
+
+// validateTypes returns an error unless the activations, losses and modes
+// of c are known
+func (c *Config) validateTypes() error {
+	if !c.Activation.known() {
+		return fmt.Errorf("unknown activation %d", c.Activation)
+	}
+	for i, a := range c.Activations {
+		if !a.known() {
+			return fmt.Errorf("layer %d: unknown activation %d", i, a)
+		}
+	}
+	if c.Conv != nil && !c.Conv.Activation.known() {
+		return fmt.Errorf("unknown convolution activation %d", c.Conv.Activation)
+	}
+	if !c.Mode.known() {
+		return fmt.Errorf("unknown mode %d", c.Mode)
+	}
+	if !c.Loss.known() {
+		return fmt.Errorf("unknown loss %d", c.Loss)
+	}
+	for i, h := range c.Heads {
+		if !h.Mode.known() {
+			return fmt.Errorf("head %d: unknown mode %d", i, h.Mode)
+		}
+		if !h.Loss.known() {
+			return fmt.Errorf("head %d: unknown loss %d", i, h.Loss)
+		}
+	}
+	return nil
+}
+
+// FromDump restores a Neural from a dump like RestoreDump, and panics if
+// the version is unsupported or the dump is invalid
 func FromDump(dump *Dump) *Neural {
+	n, err := RestoreDump(dump)
+	if err != nil {
+		panic("deep: " + err.Error())
+	}
+	return n
+}
+
+// RestoreDump restores a Neural from a dump, migrating it to DumpVersion,
+// and returns an error if the version is unsupported or the dump is
+// invalid, see Migrate and Validate
+func RestoreDump(dump *Dump) (*Neural, error) {
+	if err := dump.Migrate(); err != nil {
+		return nil, err
+	}
+	if err := dump.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid dump: %w", err)
+	}
 	n := NewNeural(dump.Config)
 	n.ApplyWeights(dump.Weights)
+	n.applyDump(dump)
+	return n, nil
+}
 
-	return n
+// applyDump sets the learned parameters of n other than its weights to
+// those of dump
+func (n *Neural) applyDump(dump *Dump) {
+	if len(dump.Alphas) == len(n.Layers) {
+		n.ApplyAlphas(dump.Alphas)
+	}
+	if len(dump.Norms) == len(n.Layers) {
+		n.ApplyNorms(dump.Norms)
+	}
+	n.applyPruned(dump.Pruned)
+	n.ApplyConvolution(dump.Conv)
 }
 
 // Marshal marshals to JSON from network
@@ -63,5 +459,5 @@ func Unmarshal(bytes []byte) (*Neural, error) {
 	if err := json.Unmarshal(bytes, &dump); err != nil {
 		return nil, err
 	}
-	return FromDump(&dump), nil
+	return RestoreDump(&dump)
 }
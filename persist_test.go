@@ -1,7 +1,13 @@
 package deep
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
 	"math/rand"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -55,3 +61,469 @@ func Test_Marshal(t *testing.T) {
 	assert.Equal(t, n.String(), new.String())
 	assert.Equal(t, n.Predict([]float64{0}), new.Predict([]float64{0}))
 }
+
+func Test_MarshalRegisteredLoss(t *testing.T) {
+	loss := RegisterLoss("persisted", func() Loss { return MeanSquared{} })
+
+	n := NewNeural(&Config{
+		Inputs: 1,
+		Layout: []int{2, 1},
+		Mode:   ModeRegression,
+		Loss:   loss,
+	})
+
+	dump, err := n.Marshal()
+	assert.Nil(t, err)
+	assert.Contains(t, string(dump), `"Loss":"persisted"`)
+
+	new, err := Unmarshal(dump)
+	assert.Nil(t, err)
+	assert.Equal(t, loss, new.Config.Loss)
+
+	_, err = Unmarshal([]byte(strings.Replace(string(dump), `"persisted"`, `"unknown"`, 1)))
+	assert.Error(t, err)
+}
+
+func Test_MarshalRegisteredActivation(t *testing.T) {
+	act := RegisterActivation("persisted", math.Sin, math.Cos)
+
+	n := NewNeural(&Config{
+		Inputs:      1,
+		Layout:      []int{2, 2, 1},
+		Activations: []ActivationType{act, ActivationTanh, ActivationNone},
+		Mode:        ModeRegression,
+	})
+
+	dump, err := n.Marshal()
+	assert.Nil(t, err)
+	assert.Contains(t, string(dump), `"Activations":["persisted",2,0]`)
+
+	new, err := Unmarshal(dump)
+	assert.Nil(t, err)
+	assert.Equal(t, act, new.Layers[0].A)
+	assert.Equal(t, n.Predict([]float64{0.4}), new.Predict([]float64{0.4}))
+
+	_, err = Unmarshal([]byte(strings.Replace(string(dump), `"persisted"`, `"unknown"`, 1)))
+	assert.Error(t, err)
+}
+
+func Test_MarshalRegularization(t *testing.T) {
+	n := NewNeural(&Config{
+		Inputs: 2,
+		Layout: []int{1},
+		Mode:   ModeRegression,
+		L1:     0.01,
+		L2:     0.001,
+	})
+
+	dump, err := n.Marshal()
+	assert.Nil(t, err)
+	new, err := Unmarshal(dump)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.01, new.Config.L1)
+	assert.Equal(t, 0.001, new.Config.L2)
+
+	_, err = Unmarshal([]byte(strings.Replace(string(dump), `"L1":0.01`, `"L1":-0.01`, 1)))
+	assert.Error(t, err)
+}
+
+func Test_MarshalBatchNorm(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{
+		Inputs:     2,
+		Layout:     []int{3, 1},
+		Activation: ActivationTanh,
+		Mode:       ModeRegression,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+		BatchNorm:  []bool{true, false},
+	})
+	norm := n.Layers[0].Norm
+	copy(norm.Gamma, []float64{0.5, 2, 1.5})
+	copy(norm.Beta, []float64{0.1, -0.2, 0.3})
+	copy(norm.Mean, []float64{1, -1, 0.5})
+	copy(norm.Var, []float64{2, 0.5, 4})
+
+	dump, err := n.Marshal()
+	assert.Nil(t, err)
+	new, err := Unmarshal(dump)
+	assert.Nil(t, err)
+	assert.Equal(t, n.Norms(), new.Norms())
+	assert.Nil(t, new.Layers[1].Norm)
+	assert.Equal(t, n.Predict([]float64{0.3, -0.7}), new.Predict([]float64{0.3, -0.7}))
+}
+
+func Test_MarshalLayerNorm(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{
+		Inputs:     2,
+		Layout:     []int{3, 1},
+		Activation: ActivationTanh,
+		Mode:       ModeRegression,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+		LayerNorm:  []bool{true, false},
+	})
+	copy(n.Layers[0].Norm.Gamma, []float64{0.5, 2, 1.5})
+	copy(n.Layers[0].Norm.Beta, []float64{0.1, -0.2, 0.3})
+
+	dump, err := n.Marshal()
+	assert.Nil(t, err)
+	assert.NotContains(t, string(dump), `"Mean"`)
+	new, err := Unmarshal(dump)
+	assert.Nil(t, err)
+	assert.Equal(t, n.Norms(), new.Norms())
+	assert.Equal(t, n.Predict([]float64{0.3, -0.7}), new.Predict([]float64{0.3, -0.7}))
+}
+
+func Test_MarshalSkips(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{
+		Inputs:     1,
+		Layout:     []int{3, 3, 3, 1},
+		Activation: ActivationReLU,
+		Mode:       ModeRegression,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+		Skips:      []Skip{{From: 0, To: 2}},
+	})
+
+	dump, err := n.Marshal()
+	assert.Nil(t, err)
+	new, err := Unmarshal(dump)
+	assert.Nil(t, err)
+	assert.Equal(t, n.Config.Skips, new.Config.Skips)
+	assert.Equal(t, n.Predict([]float64{0.6}), new.Predict([]float64{0.6}))
+}
+
+func Test_SetWeights(t *testing.T) {
+	rand.Seed(0)
+	config := &Config{
+		Inputs:     2,
+		Layout:     []int{3, 2},
+		Activation: ActivationTanh,
+		Mode:       ModeRegression,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+	}
+	n, other := NewNeural(config), NewNeural(config)
+
+	weights := other.Weights()
+	assert.NoError(t, n.SetWeights(weights))
+	assert.Equal(t, weights, n.Weights())
+
+	assert.Error(t, n.SetWeights(weights[:1]))
+	weights[1] = weights[1][:1]
+	assert.Error(t, n.SetWeights(weights))
+	weights = other.Weights()
+	weights[0][2] = append(weights[0][2], 1)
+	assert.Error(t, n.SetWeights(weights))
+	// weights are left untouched by errors
+	assert.Equal(t, other.Weights(), n.Weights())
+}
+
+func Test_CopyWeightsFrom(t *testing.T) {
+	rand.Seed(0)
+	config := func() *Config {
+		return &Config{
+			Inputs:     2,
+			Layout:     []int{4, 2},
+			Activation: ActivationPReLU,
+			Mode:       ModeRegression,
+			Weight:     NewNormal(1, 0),
+			Bias:       true,
+			BatchNorm:  []bool{true, false},
+		}
+	}
+	n, target := NewNeural(config()), NewNeural(config())
+	n.Layers[0].Alpha = 0.1
+	n.Layers[0].Norm.Mean[1] = 0.5
+	input := []float64{0.3, -0.8}
+	assert.NotEqual(t, n.Predict(input), target.Predict(input))
+
+	assert.NoError(t, target.CopyWeightsFrom(n))
+	assert.Equal(t, n.Weights(), target.Weights())
+	assert.Equal(t, n.Predict(input), target.Predict(input))
+	// copies do not share state
+	n.Layers[0].Norm.Mean[1] = 0
+	assert.Equal(t, 0.5, target.Layers[0].Norm.Mean[1])
+
+	other := config()
+	other.Layout = []int{5, 2}
+	other.BatchNorm = nil
+	assert.Error(t, target.CopyWeightsFrom(NewNeural(other)))
+
+	// unset options are alike whether nil or empty
+	other = config()
+	other.Dropout, other.Heads = []float64{}, []Head{}
+	assert.NoError(t, target.CopyWeightsFrom(NewNeural(other)))
+}
+
+func Test_SoftUpdateFrom(t *testing.T) {
+	rand.Seed(0)
+	config := &Config{
+		Inputs:     2,
+		Layout:     []int{3, 1},
+		Activation: ActivationPReLU,
+		Mode:       ModeRegression,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+		LayerNorm:  []bool{true, false},
+	}
+	src, target := NewNeural(config), NewNeural(config)
+	src.Layers[0].Alpha = 0.5
+	src.Layers[0].Norm.Gamma[0] = 2
+	before, weights := target.Weights(), src.Weights()
+
+	assert.NoError(t, target.SoftUpdateFrom(src, 0))
+	assert.Equal(t, before, target.Weights())
+
+	assert.NoError(t, target.SoftUpdateFrom(src, 0.1))
+	for i := range before {
+		for j := range before[i] {
+			for k := range before[i][j] {
+				assert.InDelta(t, 0.1*weights[i][j][k]+0.9*before[i][j][k], target.Weights()[i][j][k], 1e-12)
+			}
+		}
+	}
+	assert.InDelta(t, 0.1*0.5+0.9*0.25, target.Layers[0].Alpha, 1e-12)
+	assert.InDelta(t, 1.1, target.Layers[0].Norm.Gamma[0], 1e-12)
+
+	assert.NoError(t, target.SoftUpdateFrom(src, 1))
+	assert.Equal(t, weights, target.Weights())
+	assert.Equal(t, src.Norms(), target.Norms())
+
+	assert.Error(t, target.SoftUpdateFrom(src, 1.5))
+	assert.Error(t, target.SoftUpdateFrom(NewNeural(&Config{Inputs: 2, Layout: []int{3, 1}}), 0.1))
+
+	allocs := testing.AllocsPerRun(10, func() { target.SoftUpdateFrom(src, 0.01) })
+	assert.Equal(t, 0.0, allocs)
+}
+
+func Benchmark_SoftUpdateFrom(b *testing.B) {
+	config := &Config{
+		Inputs:     128,
+		Layout:     []int{128, 128, 128},
+		Activation: ActivationReLU,
+		Mode:       ModeRegression,
+		Bias:       true,
+	}
+	src, target := NewNeural(config), NewNeural(config)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		target.SoftUpdateFrom(src, 0.005)
+	}
+}
+
+func Test_MarshalPruned(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{
+		Inputs:     3,
+		Layout:     []int{4, 1},
+		Activation: ActivationReLU,
+		Mode:       ModeRegression,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+	})
+	report := n.Prune(0.7)
+
+	dump, err := n.Marshal()
+	assert.Nil(t, err)
+	new, err := Unmarshal(dump)
+	assert.Nil(t, err)
+	assert.Equal(t, report, new.Prune(0))
+	assert.Equal(t, n.Weights(), new.Weights())
+}
+
+func Test_MarshalConv(t *testing.T) {
+	rand.Seed(0)
+	config := func() *Config {
+		return &Config{
+			Inputs:     8,
+			Layout:     []int{3, 1},
+			Activation: ActivationReLU,
+			Mode:       ModeRegression,
+			Weight:     NewNormal(1, 0),
+			Bias:       true,
+			Conv:       &Conv1D{Kernel: 3, Filters: 2},
+		}
+	}
+	n := NewNeural(config())
+	input := []float64{1, 0, -1, 0.5, 2, -0.5, 0, 1}
+
+	dump, err := n.Marshal()
+	assert.Nil(t, err)
+	new, err := Unmarshal(dump)
+	assert.Nil(t, err)
+	assert.Equal(t, *n.Config.Conv, *new.Config.Conv)
+	assert.Equal(t, n.Convolution(), new.Convolution())
+	assert.Equal(t, n.Predict(input), new.Predict(input))
+
+	target := NewNeural(config())
+	assert.NoError(t, target.CopyWeightsFrom(n))
+	assert.Equal(t, n.Predict(input), target.Predict(input))
+}
+
+func Test_UnmarshalVersions(t *testing.T) {
+	// dumps written before dumps were versioned, and predictions recorded
+	// when they were written
+	for _, c := range []struct {
+		file    string
+		inputs  [][]float64
+		outputs [][]float64
+	}{
+		{
+			file:   "dump_v0_multiclass.json",
+			inputs: [][]float64{{0.5, -1, 2}, {-0.25, 0.75, 0}, {1, 1, -1}},
+			outputs: [][]float64{
+				{0.004552149973728667, 0.95306018493388, 0.04238766509239141},
+				{0.8923885686465186, 0.09584096309427877, 0.011770468259202608},
+				{0.037581018343322635, 0.943252733791752, 0.019166247864925323},
+			},
+		},
+		{
+			file:   "dump_v0_regression.json",
+			inputs: [][]float64{{0.5, -1, 2}, {-0.25, 0.75, 0}, {1, 1, -1}},
+			outputs: [][]float64{
+				{-0.23542789739939834, 0.6866590456670555},
+				{-0.026694778555588664, -0.006909193639946243},
+				{-0.05824592143475311, -0.29694134986122883},
+			},
+		},
+		{
+			// PReLU, batch and layer norms, pruning and a convolution
+			file:   "dump_v0_extended.json",
+			inputs: [][]float64{{0.5, -1, 2, 0, 1, -0.5}, {-0.25, 0.75, 0, 1, 1, 1}, {1, 1, -1, -1, 0.5, 2}},
+			outputs: [][]float64{
+				{0.2996927926389696, 0.7080295375862422},
+				{0.02634784358013021, 0.4010901429935251},
+				{0.22828169294101056, 0.2555748154435896},
+			},
+		},
+	} {
+		b, err := ioutil.ReadFile(filepath.Join("testdata", c.file))
+		assert.Nil(t, err)
+		n, err := Unmarshal(b)
+		assert.Nil(t, err, c.file)
+		for i, in := range c.inputs {
+			assert.InDeltaSlice(t, c.outputs[i], n.Predict(in), 1e-12, c.file)
+		}
+
+		// they are written again as the latest version
+		dump, err := n.Marshal()
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(string(dump), `{"Version":1,`), c.file)
+		restored, err := Unmarshal(dump)
+		assert.Nil(t, err)
+		assert.Equal(t, n.Weights(), restored.Weights(), c.file)
+	}
+}
+
+func Test_UnsupportedDumpVersion(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{Inputs: 2, Layout: []int{2, 1}, Mode: ModeBinary, Bias: true})
+	dump, err := n.Marshal()
+	assert.Nil(t, err)
+
+	for _, version := range []int{DumpVersion + 1, -1} {
+		future := strings.Replace(string(dump), `"Version":1`, fmt.Sprintf(`"Version":%d`, version), 1)
+		_, err = Unmarshal([]byte(future))
+		assert.Equal(t, ErrUnsupportedDumpVersion{Version: version}, err)
+	}
+	assert.Panics(t, func() { FromDump(&Dump{Version: DumpVersion + 1, Config: n.Config}) })
+	_, err = RestoreDump(&Dump{Version: DumpVersion + 1, Config: n.Config})
+	assert.Equal(t, ErrUnsupportedDumpVersion{Version: DumpVersion + 1}, err)
+
+	b, err := n.MarshalBinary()
+	assert.Nil(t, err)
+	b = []byte(strings.Replace(string(b), `"Version":1`, `"Version":2`, 1))
+	assert.Equal(t, ErrUnsupportedDumpVersion{Version: 2}, n.UnmarshalBinary(b))
+}
+
+func Test_ValidateDump(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{
+		Inputs:      3,
+		Layout:      []int{4, 3, 2},
+		Activations: []ActivationType{ActivationPReLU, ActivationTanh, ActivationNone},
+		BatchNorm:   []bool{true, false, false},
+		Mode:        ModeMultiClass,
+		Bias:        true,
+	})
+	n.Prune(0.1)
+	assert.NoError(t, n.Dump().Validate())
+	dump, err := n.Marshal()
+	assert.Nil(t, err)
+
+	for message, corrupt := range map[string]func(d *Dump){
+		"missing config":                                  func(d *Dump) { d.Config = nil },
+		"invalid config: empty layout":                    func(d *Dump) { d.Config.Layout = nil },
+		"invalid config: layer 1: unknown activation 42":  func(d *Dump) { d.Config.Activations[1] = 42 },
+		"invalid config: unknown activation -1":           func(d *Dump) { d.Config.Activation = -1 },
+		"invalid config: unknown mode 6":                  func(d *Dump) { d.Config.Mode = 6 },
+		"invalid config: unknown loss 999":                func(d *Dump) { d.Config.Loss = 999 },
+		"weights of 2 layers, config has 3":               func(d *Dump) { d.Weights = d.Weights[:2] },
+		"layer 1: weights of 4 neurons, config has 3":     func(d *Dump) { d.Weights[1] = append(d.Weights[1], d.Weights[1][0]) },
+		"layer 2, neuron 1: 3 weights, config has 4":      func(d *Dump) { d.Weights[2][1] = d.Weights[2][1][:3] },
+		"layer 0, neuron 3, weight 2: NaN is not finite":  func(d *Dump) { d.Weights[0][3][2] = math.NaN() },
+		"layer 1, neuron 0, weight 4: +Inf is not finite": func(d *Dump) { d.Weights[1][0][4] = math.Inf(1) },
+		"2 alphas for 3 layers":                           func(d *Dump) { d.Alphas = d.Alphas[:2] },
+		"4 norms for 3 layers":                            func(d *Dump) { d.Norms = append(d.Norms, nil) },
+		"layer 0: norm does not match config":             func(d *Dump) { d.Norms[0] = nil },
+		"layer 0: norm of 3 scales and 4 shifts for 4 neurons": func(d *Dump) {
+			d.Norms[0].Gamma = d.Norms[0].Gamma[:3]
+		},
+		"layer 0: norm of 4 means and 2 variances for 4 neurons": func(d *Dump) {
+			d.Norms[0].Var = d.Norms[0].Var[:2]
+		},
+		"pruned synapse [1 3 0] out of range": func(d *Dump) { d.Pruned = append(d.Pruned, [3]int{1, 3, 0}) },
+		"convolution does not match config":   func(d *Dump) { d.Conv = &Convolution{} },
+	} {
+		var corrupted Dump
+		assert.Nil(t, json.Unmarshal(dump, &corrupted))
+		corrupt(&corrupted)
+		assert.EqualError(t, corrupted.Validate(), message)
+		assert.Panics(t, func() { FromDump(&corrupted) }, message)
+		restored, err := RestoreDump(&corrupted)
+		assert.Nil(t, restored, message)
+		assert.EqualError(t, err, "invalid dump: "+message)
+	}
+}
+
+func Test_UnmarshalInvalid(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{
+		Inputs: 4,
+		Layout: []int{3, 2},
+		Conv:   &Conv1D{Kernel: 2, Filters: 2},
+		Heads:  []Head{{From: 0, To: 1, Mode: ModeBinary}, {From: 1, To: 2, Mode: ModeRegression}},
+		Bias:   true,
+	})
+	dump, err := n.Marshal()
+	assert.Nil(t, err)
+	restored, err := Unmarshal(dump)
+	assert.Nil(t, err)
+	assert.Equal(t, n.Weights(), restored.Weights())
+
+	for message, corrupt := range map[string]func(d *Dump){
+		"invalid dump: invalid config: head 1: unknown mode 9":            func(d *Dump) { d.Config.Heads[1].Mode = 9 },
+		"invalid dump: invalid config: head 0: unknown loss 9999":         func(d *Dump) { d.Config.Heads[0].Loss = 9999 },
+		"invalid dump: invalid config: unknown convolution activation 16": func(d *Dump) { d.Config.Conv.Activation = 16 },
+		"invalid dump: kernel 1: 1 weights, config has 2":                 func(d *Dump) { d.Conv.Kernels[1] = d.Conv.Kernels[1][:1] },
+		"invalid dump: 2 kernels and 1 biases of convolution, config has 2 and 2": func(d *Dump) {
+			d.Conv.Biases = d.Conv.Biases[:1]
+		},
+		"invalid dump: layer 0, neuron 2: 8 weights, config has 7": func(d *Dump) {
+			d.Weights[0][2] = append(d.Weights[0][2], 0)
+		},
+	} {
+		var corrupted Dump
+		assert.Nil(t, json.Unmarshal(dump, &corrupted))
+		corrupt(&corrupted)
+		b, err := json.Marshal(corrupted)
+		assert.Nil(t, err)
+		_, err = Unmarshal(b)
+		assert.EqualError(t, err, message)
+	}
+}
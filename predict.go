@@ -0,0 +1,285 @@
+package deep
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// ErrInputSize is returned for inputs of other than Config.Inputs values
+type ErrInputSize struct {
+	Want, Got int
+}
+
+func (e ErrInputSize) Error() string {
+	return fmt.Sprintf("input of %d values, expected %d", e.Got, e.Want)
+}
+
+// ErrNonFiniteInput is returned for inputs of a NaN or infinite value, at
+// Index
+type ErrNonFiniteInput struct {
+	Index int
+}
+
+func (e ErrNonFiniteInput) Error() string {
+	return fmt.Sprintf("input %d is not finite", e.Index)
+}
+
+// CheckInput returns an ErrInputSize unless input is of Config.Inputs
+// values, or an ErrNonFiniteInput for its first value that is not finite
+func (n *Neural) CheckInput(input []float64) error {
+	if len(input) != n.Config.Inputs {
+		return ErrInputSize{Want: n.Config.Inputs, Got: len(input)}
+	}
+	for i, x := range input {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return ErrNonFiniteInput{Index: i}
+		}
+	}
+	return nil
+}
+
+// PredictSafe returns the prediction of input like Predict, or the error
+// of CheckInput for an invalid input rather than panic
+func (n *Neural) PredictSafe(input []float64) ([]float64, error) {
+	if err := n.CheckInput(input); err != nil {
+		return nil, err
+	}
+	return n.Predict(input), nil
+}
+
+// PredictOption configures PredictBatch and PredictMC
+type PredictOption func(*predictOptions)
+
+type predictOptions struct {
+	workers int
+	seed    *int64
+}
+
+// WithWorkers predicts the rows of PredictBatch or the samples of PredictMC
+// over workers goroutines, or one per CPU if not positive
+func WithWorkers(workers int) PredictOption {
+	return func(o *predictOptions) {
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+		o.workers = workers
+	}
+}
+
+// PredictBatch returns the prediction of each row of inputs, in order, as
+// by Predict, over the workers of WithWorkers with the same results. An
+// error naming the first row of the wrong width is returned before any is
+// predicted. The rows of recurrent networks are a sequence, and are
+// predicted in order.
+func (n *Neural) PredictBatch(inputs [][]float64, opts ...PredictOption) ([][]float64, error) {
+	o := predictOptions{workers: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	for i, input := range inputs {
+		if len(input) != n.Config.Inputs {
+			return nil, fmt.Errorf("row %d: %d inputs, expected %d", i, len(input), n.Config.Inputs)
+		}
+	}
+
+	outputs := make([][]float64, len(inputs))
+	workers := o.workers
+	if workers > len(inputs) {
+		workers = len(inputs)
+	}
+	if workers <= 1 || n.Recurrent() {
+		for i, input := range inputs {
+			outputs[i] = n.Predict(input)
+		}
+		return outputs, nil
+	}
+
+	// each worker predicts a contiguous range of rows
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w * len(inputs) / workers; i < (w+1)*len(inputs)/workers; i++ {
+				outputs[i] = n.predict(inputs[i])
+			}
+		}(w)
+	}
+	wg.Wait()
+	return outputs, nil
+}
+
+// WithSeed drops out the samples of PredictMC by sources seeded from seed,
+// rather than from the global source
+func WithSeed(seed int64) PredictOption {
+	return func(o *predictOptions) {
+		o.seed = &seed
+	}
+}
+
+// PredictMC returns the mean and standard deviation of each output over
+// samples forward passes of input with dropout, as a measure of the
+// uncertainty of the prediction. The passes are computed by clones of n,
+// which is left as it was, over the workers of WithWorkers with the same
+// results. The passes of recurrent networks each start from the state of n.
+func (n *Neural) PredictMC(input []float64, samples int, opts ...PredictOption) (mean, stddev []float64) {
+	if len(input) != n.Config.Inputs {
+		panic(fmt.Sprintf("deep: invalid input dimension - expected: %d got: %d", n.Config.Inputs, len(input)))
+	}
+	if samples <= 0 {
+		panic(fmt.Sprintf("deep: invalid number of samples %d", samples))
+	}
+	o := predictOptions{workers: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	// each sample drops out by a seed of its own, whichever worker draws it
+	seeds := make([]int64, samples)
+	r := rand.New(rand.NewSource(rand.Int63()))
+	if o.seed != nil {
+		r = rand.New(rand.NewSource(*o.seed))
+	}
+	for s := range seeds {
+		seeds[s] = r.Int63()
+	}
+
+	outputs := make([][]float64, samples)
+	workers := o.workers
+	if workers > samples {
+		workers = samples
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			clone, source := n.Clone(), rand.NewSource(0)
+			clone.SetRand(rand.New(source))
+			out := clone.Layers[len(clone.Layers)-1].Neurons
+			for s := w * samples / workers; s < (w+1)*samples/workers; s++ {
+				for i, l := range n.Layers {
+					copy(clone.Layers[i].state, l.state)
+				}
+				source.Seed(seeds[s])
+				clone.forward(input, true)
+				outputs[s] = make([]float64, len(out))
+				for i, neuron := range out {
+					outputs[s][i] = neuron.Value
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// Welford's updates, in order of the samples, such that equal samples
+	// have exactly their value as mean and a deviation of zero
+	mean, stddev = make([]float64, len(outputs[0])), make([]float64, len(outputs[0]))
+	for s, output := range outputs {
+		for i, x := range output {
+			delta := x - mean[i]
+			mean[i] += delta / float64(s+1)
+			stddev[i] += delta * (x - mean[i])
+		}
+	}
+	for i := range stddev {
+		stddev[i] = math.Sqrt(stddev[i] / float64(samples))
+	}
+	return mean, stddev
+}
+
+// predict returns the outputs of a forward pass of input without dropout,
+// computed into buffers of its own rather than the neurons of n, such that
+// it is safe for concurrent use. It is not for recurrent networks, whose
+// outputs depend on their state.
+func (n *Neural) predict(input []float64) []float64 {
+	_, values := n.pass(input, false)
+	return values[len(values)-1]
+}
+
+// pass returns the values of the neurons of each layer at a forward pass of
+// input like predict, and the inputs to their activations, after any
+// normalization, if keep is set
+func (n *Neural) pass(input []float64, keep bool) (inputs, values [][]float64) {
+	if len(input) != n.Config.Inputs {
+		panic(fmt.Sprintf("deep: invalid input dimension - expected: %d got: %d", n.Config.Inputs, len(input)))
+	}
+	if n.Conv != nil {
+		sums, values := make([]float64, len(n.Conv.values)), make([]float64, len(n.Conv.values))
+		n.Conv.filter(input, sums, values)
+		input = values
+	}
+
+	// the values and skipped outputs of each layer, which pass on their sum
+	values, residuals := make([][]float64, len(n.Layers)), make([][]float64, len(n.Layers))
+	if keep {
+		inputs = make([][]float64, len(n.Layers))
+	}
+	for i, l := range n.Layers {
+		sums := make([]float64, len(l.Neurons))
+		for j, neuron := range l.Neurons {
+			var sum float64
+			for k, s := range neuron.In {
+				in := 1.0
+				if k < len(input) {
+					in = input[k]
+				}
+				sum += in * s.Weight
+			}
+			sums[j] = sum
+		}
+		if l.Norm != nil {
+			if l.Norm.Layer {
+				mean, variance := moments(len(sums), func(j int) float64 { return sums[j] })
+				for j := range sums {
+					_, sums[j], _ = l.normalized(j, sums[j], mean, variance)
+				}
+			} else {
+				for j := range sums {
+					_, sums[j], _ = l.normalized(j, sums[j], l.Norm.Mean[j], l.Norm.Var[j])
+				}
+			}
+		}
+
+		values[i], input = sums, make([]float64, len(l.Neurons))
+		if keep {
+			inputs[i], values[i] = sums, make([]float64, len(l.Neurons))
+		}
+		skips := make([]int, len(l.skips))
+		for s, skip := range l.skips {
+			skips[s] = n.layerIndex(skip)
+		}
+		if len(skips) > 0 {
+			residuals[i] = make([]float64, len(l.Neurons))
+		}
+		for j, neuron := range l.Neurons {
+			values[i][j] = neuron.Activate(sums[j])
+			for _, skipped := range skips {
+				residuals[i][j] += values[skipped][j]
+				if residuals[skipped] != nil {
+					residuals[i][j] += residuals[skipped][j]
+				}
+			}
+			input[j] = values[i][j]
+			if residuals[i] != nil {
+				input[j] += residuals[i][j]
+			}
+		}
+		for _, r := range l.softmaxRanges() {
+			copy(values[i][r[0]:r[1]], Softmax(values[i][r[0]:r[1]]))
+		}
+	}
+	return inputs, values
+}
+
+// layerIndex returns the index of l in the layers of n
+func (n *Neural) layerIndex(l *Layer) int {
+	for i, layer := range n.Layers {
+		if layer == l {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,269 @@
+package deep
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func predictInputs(rows, width int) [][]float64 {
+	inputs := make([][]float64, rows)
+	for i := range inputs {
+		inputs[i] = make([]float64, width)
+		for j := range inputs[i] {
+			inputs[i][j] = rand.NormFloat64()
+		}
+	}
+	return inputs
+}
+
+func Test_PredictBatch(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{
+		Inputs:      3,
+		Layout:      []int{5, 5, 4},
+		Activations: []ActivationType{ActivationPReLU, ActivationTanh, ActivationNone},
+		LayerNorm:   []bool{true, false, false},
+		Skips:       []Skip{{From: 0, To: 1}},
+		Mode:        ModeMultiClass,
+		Bias:        true,
+	})
+	inputs := predictInputs(37, 3)
+	expected := make([][]float64, len(inputs))
+	for i, input := range inputs {
+		expected[i] = n.Predict(input)
+	}
+
+	for _, workers := range []int{1, 2, 3, 8, 100, 0} {
+		outputs, err := n.PredictBatch(inputs, WithWorkers(workers))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, outputs, "%d workers", workers)
+	}
+	outputs, err := n.PredictBatch(inputs)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, outputs)
+
+	outputs, err = n.PredictBatch(nil, WithWorkers(4))
+	assert.NoError(t, err)
+	assert.Empty(t, outputs)
+
+	inputs[20] = inputs[20][:2]
+	_, err = n.PredictBatch(inputs, WithWorkers(4))
+	assert.EqualError(t, err, "row 20: 2 inputs, expected 3")
+}
+
+func Test_PredictBatchRecurrent(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{Inputs: 2, Layout: []int{4, 1}, Recurrent: []bool{true, false}, Mode: ModeRegression, Bias: true})
+	inputs := predictInputs(10, 2)
+	expected := make([][]float64, len(inputs))
+	for i, input := range inputs {
+		expected[i] = n.Predict(input)
+	}
+
+	// the rows are a sequence, predicted in order whatever the workers
+	n.ResetState()
+	outputs, err := n.PredictBatch(inputs, WithWorkers(4))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, outputs)
+}
+
+func benchmarkNetwork() *Neural {
+	rand.Seed(0)
+	return NewNeural(&Config{Inputs: 64, Layout: []int{256, 256, 256, 10}, Activation: ActivationReLU, Mode: ModeMultiClass, Bias: true})
+}
+
+func Benchmark_PredictLoop(b *testing.B) {
+	n, inputs := benchmarkNetwork(), predictInputs(1000, 64)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, input := range inputs {
+			n.Predict(input)
+		}
+	}
+}
+
+func Benchmark_PredictBatch(b *testing.B) {
+	n, inputs := benchmarkNetwork(), predictInputs(1000, 64)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n.PredictBatch(inputs, WithWorkers(runtime.NumCPU()))
+	}
+}
+
+func Test_PredictForward(t *testing.T) {
+	rand.Seed(0)
+	for _, c := range []*Config{
+		{Inputs: 3, Layout: []int{4, 2}, Activation: ActivationSigmoid, Mode: ModeBinary, Bias: true},
+		{Inputs: 3, Layout: []int{4, 4, 3}, Activations: []ActivationType{ActivationPReLU, ActivationGELU, ActivationNone},
+			Skips: []Skip{{From: 0, To: 1}}, Mode: ModeMultiClass, Bias: true},
+		{Inputs: 3, Layout: []int{5, 3}, Activation: ActivationTanh, BatchNorm: []bool{true, false}, Dropout: []float64{0.5, 0}, Mode: ModeRegression},
+		{Inputs: 3, Layout: []int{5, 3}, Activation: ActivationELU, LayerNorm: []bool{true, false}, Mode: ModeMultiLabel, Bias: true},
+		{Inputs: 6, Layout: []int{4, 3}, Activation: ActivationReLU, Conv: &Conv1D{Kernel: 2, Stride: 2, Filters: 2}, Bias: true,
+			Heads: []Head{{From: 0, To: 2, Mode: ModeMultiClass}, {From: 2, To: 3, Mode: ModeRegression}}},
+	} {
+		n := NewNeural(c)
+		if n.Normalized() {
+			for j := range n.Layers[0].Norm.Mean {
+				n.Layers[0].Norm.Mean[j], n.Layers[0].Norm.Var[j] = rand.NormFloat64(), rand.Float64()+0.5
+				n.Layers[0].Norm.Gamma[j], n.Layers[0].Norm.Beta[j] = rand.Float64()+0.5, rand.NormFloat64()
+			}
+		}
+		for _, input := range predictInputs(10, c.Inputs) {
+			predicted := n.Predict(input)
+			assert.NoError(t, n.forward(input, false))
+			for j, neuron := range n.Layers[len(n.Layers)-1].Neurons {
+				assert.Equal(t, neuron.Value, predicted[j])
+			}
+		}
+		assert.Panics(t, func() { n.Predict(make([]float64, c.Inputs+1)) })
+	}
+}
+
+func Test_PredictConcurrent(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{
+		Inputs:    4,
+		Layout:    []int{8, 8, 3},
+		LayerNorm: []bool{true, false, false},
+		Skips:     []Skip{{From: 0, To: 1}},
+		Mode:      ModeMultiClass,
+		Bias:      true,
+	})
+	inputs := predictInputs(50, 4)
+	// the predictions of Predict, PredictWithTemperature, PredictTopK and
+	// WriteActivationsCSV of each input
+	predictions := func(input []float64) []interface{} {
+		tempered, _ := n.PredictWithTemperature(input, 2)
+		top, _ := n.PredictTopK(input, 2)
+		var csv bytes.Buffer
+		n.WriteActivationsCSV(&csv, input)
+		return []interface{}{n.Predict(input), tempered, top, csv.String()}
+	}
+	expected := make([][]interface{}, len(inputs))
+	for i, input := range inputs {
+		expected[i] = predictions(input)
+	}
+
+	outputs := make([][][]interface{}, 16)
+	var wg sync.WaitGroup
+	for g := range outputs {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for _, input := range inputs {
+				outputs[g] = append(outputs[g], predictions(input))
+			}
+		}(g)
+	}
+	wg.Wait()
+	for _, predicted := range outputs {
+		assert.Equal(t, expected, predicted)
+	}
+}
+
+func Test_PredictSafe(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{Inputs: 3, Layout: []int{4, 2}, Mode: ModeMultiClass, Bias: true})
+	input := []float64{0.5, -1, 2}
+	predicted, err := n.PredictSafe(input)
+	assert.NoError(t, err)
+	assert.Equal(t, n.Predict(input), predicted)
+
+	for _, c := range []struct {
+		input []float64
+		err   error
+	}{
+		{[]float64{0.5, -1}, ErrInputSize{Want: 3, Got: 2}},
+		{[]float64{0.5, -1, 2, 0}, ErrInputSize{Want: 3, Got: 4}},
+		{nil, ErrInputSize{Want: 3, Got: 0}},
+		{[]float64{0.5, math.NaN(), 2}, ErrNonFiniteInput{Index: 1}},
+		{[]float64{0.5, -1, math.Inf(-1)}, ErrNonFiniteInput{Index: 2}},
+	} {
+		predicted, err := n.PredictSafe(c.input)
+		assert.Equal(t, c.err, err)
+		assert.Nil(t, predicted)
+	}
+	assert.EqualError(t, ErrInputSize{Want: 3, Got: 2}, "input of 2 values, expected 3")
+	assert.EqualError(t, ErrNonFiniteInput{Index: 1}, "input 1 is not finite")
+}
+
+func mcNetwork(dropout float64) *Neural {
+	rand.Seed(0)
+	return NewNeural(&Config{
+		Inputs:  3,
+		Layout:  []int{16, 16, 2},
+		Dropout: []float64{dropout, dropout, 0},
+		Mode:    ModeRegression,
+		Bias:    true,
+	})
+}
+
+func Test_PredictMCNoDropout(t *testing.T) {
+	n := mcNetwork(0)
+	input := []float64{0.5, -1, 2}
+	mean, stddev := n.PredictMC(input, 20, WithWorkers(3))
+	assert.Equal(t, n.Predict(input), mean)
+	assert.Equal(t, []float64{0, 0}, stddev)
+}
+
+func Test_PredictMC(t *testing.T) {
+	n := mcNetwork(0.5)
+	input := []float64{0.5, -1, 2}
+	expected := n.Predict(input)
+
+	mean, stddev := n.PredictMC(input, 100, WithSeed(1))
+	for i := range stddev {
+		assert.True(t, stddev[i] > 0, "stddev %v", stddev)
+	}
+	// the same samples whatever the workers, and the network as it was
+	for _, workers := range []int{2, 7, 0} {
+		m, s := n.PredictMC(input, 100, WithSeed(1), WithWorkers(workers))
+		assert.Equal(t, mean, m, "%d workers", workers)
+		assert.Equal(t, stddev, s, "%d workers", workers)
+	}
+	assert.Equal(t, expected, n.Predict(input))
+	assert.False(t, n.Training())
+	assert.Nil(t, n.Rand())
+	for _, l := range n.Layers {
+		for _, neuron := range l.Neurons {
+			assert.Equal(t, 0.0, neuron.Value)
+		}
+	}
+
+	// the mean converges as the samples grow
+	reference, _ := n.PredictMC(input, 20000, WithSeed(2), WithWorkers(0))
+	errors := make([]float64, 0, 3)
+	for _, samples := range []int{10, 100, 1000} {
+		var e float64
+		for seed := int64(0); seed < 5; seed++ {
+			m, _ := n.PredictMC(input, samples, WithSeed(seed), WithWorkers(0))
+			for i := range m {
+				e += math.Abs(m[i] - reference[i])
+			}
+		}
+		errors = append(errors, e)
+	}
+	assert.True(t, errors[0] > errors[1] && errors[1] > errors[2], "errors %v", errors)
+
+	assert.Panics(t, func() { n.PredictMC(input, 0) })
+	assert.Panics(t, func() { n.PredictMC(input[:2], 10) })
+}
+
+func Test_PredictMCRecurrent(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{Inputs: 2, Layout: []int{4, 1}, Recurrent: []bool{true, false}, Dropout: []float64{0, 0}, Mode: ModeRegression, Bias: true})
+	n.Predict([]float64{1, -1})
+	state := append([]float64(nil), n.Layers[0].state...)
+
+	// each pass starts from the state of n, which is left as it was
+	mean, stddev := n.PredictMC([]float64{0.5, 0.5}, 10, WithWorkers(2))
+	assert.Equal(t, state, n.Layers[0].state)
+	assert.Equal(t, []float64{0}, stddev)
+	assert.Equal(t, n.Clone().Predict([]float64{0.5, 0.5}), mean)
+}
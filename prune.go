@@ -0,0 +1,94 @@
+package deep
+
+import "math"
+
+// PruneReport counts the pruned synapses of each layer
+type PruneReport struct {
+	// Pruned is the number of pruned synapses of each layer
+	Pruned []int
+	// Synapses is the number of synapses of each layer, biases excluded
+	Synapses []int
+}
+
+// Total returns the number of pruned synapses
+func (r PruneReport) Total() int {
+	var total int
+	for _, p := range r.Pruned {
+		total += p
+	}
+	return total
+}
+
+// Fraction returns the fraction of synapses that are pruned
+func (r PruneReport) Fraction() float64 {
+	var synapses int
+	for _, s := range r.Synapses {
+		synapses += s
+	}
+	if synapses == 0 {
+		return 0
+	}
+	return float64(r.Total()) / float64(synapses)
+}
+
+// Prune zeroes the weights of the synapses of n, other than biases, below
+// threshold in magnitude and marks them as pruned, so that training keeps
+// them at zero. The report counts all pruned synapses, including those
+// pruned before.
+func (n *Neural) Prune(threshold float64) PruneReport {
+	report := PruneReport{
+		Pruned:   make([]int, len(n.Layers)),
+		Synapses: make([]int, len(n.Layers)),
+	}
+	for i, l := range n.Layers {
+		for _, neuron := range l.Neurons {
+			for _, s := range neuron.In {
+				if s.IsBias {
+					continue
+				}
+				report.Synapses[i]++
+				if math.Abs(s.Weight) < threshold {
+					s.Weight, s.Pruned = 0, true
+				}
+				if s.Pruned {
+					report.Pruned[i]++
+				}
+			}
+		}
+	}
+	return report
+}
+
+// Unprune clears the pruned marks, so that training may regrow the
+// synapses
+func (n *Neural) Unprune() {
+	for _, l := range n.Layers {
+		for _, neuron := range l.Neurons {
+			for _, s := range neuron.In {
+				s.Pruned = false
+			}
+		}
+	}
+}
+
+// pruned returns the layer, neuron and input of each pruned synapse of n
+func (n *Neural) pruned() [][3]int {
+	var pruned [][3]int
+	for i, l := range n.Layers {
+		for j, neuron := range l.Neurons {
+			for k, s := range neuron.In {
+				if s.Pruned {
+					pruned = append(pruned, [3]int{i, j, k})
+				}
+			}
+		}
+	}
+	return pruned
+}
+
+// applyPruned marks the synapses of pruned as pruned
+func (n *Neural) applyPruned(pruned [][3]int) {
+	for _, p := range pruned {
+		n.Layers[p[0]].Neurons[p[1]].In[p[2]].Pruned = true
+	}
+}
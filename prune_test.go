@@ -0,0 +1,53 @@
+package deep
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Prune(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{
+		Inputs:     4,
+		Layout:     []int{5, 2},
+		Activation: ActivationTanh,
+		Mode:       ModeRegression,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+	})
+	for _, biases := range n.Biases {
+		for _, b := range biases {
+			b.Weight = 0.01
+		}
+	}
+	weights := n.Weights()
+
+	report := n.Prune(0.5)
+	assert.Equal(t, []int{20, 10}, report.Synapses)
+	for i, l := range n.Layers {
+		var pruned int
+		for j, neuron := range l.Neurons {
+			for k, s := range neuron.In {
+				small := !s.IsBias && math.Abs(weights[i][j][k]) < 0.5
+				assert.Equal(t, small, s.Pruned)
+				if small {
+					pruned++
+					assert.Equal(t, 0.0, s.Weight)
+				} else {
+					assert.Equal(t, weights[i][j][k], s.Weight)
+				}
+			}
+		}
+		assert.Equal(t, pruned, report.Pruned[i])
+	}
+	assert.True(t, report.Total() > 0)
+	assert.InDelta(t, float64(report.Total())/30, report.Fraction(), 1e-12)
+
+	// pruned synapses stay pruned
+	assert.Equal(t, report, n.Prune(0))
+	n.Unprune()
+	assert.Equal(t, 0, n.Prune(0).Total())
+}
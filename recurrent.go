@@ -0,0 +1,52 @@
+package deep
+
+// connectRecurrent adds a synapse to each neuron of l from the output of
+// each neuron at the previous step, initialized by weight
+func (l *Layer) connectRecurrent(weight WeightInitializer) {
+	l.state = make([]float64, len(l.Neurons))
+	l.Recurrent = make([][]*Synapse, len(l.Neurons))
+	for j, neuron := range l.Neurons {
+		l.Recurrent[j] = make([]*Synapse, len(l.Neurons))
+		for m := range l.Recurrent[j] {
+			l.Recurrent[j][m] = NewSynapse(weight())
+		}
+		neuron.In = append(neuron.In, l.Recurrent[j]...)
+	}
+}
+
+// recur passes the state of a recurrent layer l to its recurrent synapses
+func (l *Layer) recur() {
+	for _, synapses := range l.Recurrent {
+		for m, s := range synapses {
+			s.fire(l.state[m])
+		}
+	}
+}
+
+// remember keeps the outputs of a recurrent layer l, after dropout, as its
+// state for the next step
+func (l *Layer) remember() {
+	for m := range l.state {
+		l.state[m] = l.Neurons[m].Value * l.Neurons[m].mask
+	}
+}
+
+// ResetState zeroes the state of each recurrent layer of n, e.g. before
+// the first step of a sequence
+func (n *Neural) ResetState() {
+	for _, l := range n.Layers {
+		for m := range l.state {
+			l.state[m] = 0
+		}
+	}
+}
+
+// Recurrent reports whether any layer of n is recurrent
+func (n *Neural) Recurrent() bool {
+	for _, l := range n.Layers {
+		if l.Recurrent != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package deep
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Recurrent(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{
+		Inputs:     2,
+		Layout:     []int{3, 1},
+		Activation: ActivationTanh,
+		Mode:       ModeRegression,
+		Weight:     NewNormal(1, 0),
+		Bias:       true,
+		Recurrent:  []bool{true, false},
+	})
+	assert.True(t, n.Recurrent())
+	// inputs, state and bias
+	for _, neuron := range n.Layers[0].Neurons {
+		assert.Len(t, neuron.In, 2+3+1)
+	}
+	assert.Equal(t, 3*6+3, n.NumWeights())
+
+	sequence := [][]float64{{1, 0}, {0, 1}, {-1, 0.5}}
+	state := make([]float64, 3)
+	var outputs [][]float64
+	for _, input := range sequence {
+		next := make([]float64, 3)
+		for j, neuron := range n.Layers[0].Neurons {
+			sum := n.Biases[0][j].Weight
+			for k, x := range input {
+				sum += neuron.In[k].Weight * x
+			}
+			for m, h := range state {
+				sum += n.Layers[0].Recurrent[j][m].Weight * h
+			}
+			next[j] = math.Tanh(sum)
+		}
+		state = next
+		var out float64
+		for j, h := range state {
+			out += n.Layers[1].Neurons[0].In[j].Weight * h
+		}
+		outputs = append(outputs, []float64{out})
+		assert.InDeltaSlice(t, []float64{out}, n.Predict(input), 1e-12)
+	}
+
+	// the state carries, until reset
+	assert.NotEqual(t, outputs[0], n.Predict(sequence[0]))
+	n.ResetState()
+	assert.InDeltaSlice(t, outputs[0], n.Predict(sequence[0]), 1e-12)
+
+	// a dump has the weights of the recurrent synapses, but no state
+	dump, err := n.Marshal()
+	assert.Nil(t, err)
+	new, err := Unmarshal(dump)
+	assert.Nil(t, err)
+	for i, input := range sequence {
+		assert.InDeltaSlice(t, outputs[i], new.Predict(input), 1e-12)
+	}
+
+	for _, c := range []*Config{
+		{Inputs: 2, Layout: []int{3, 1}, Recurrent: []bool{true}},
+		{Inputs: 2, Layout: []int{3, 1}, Recurrent: []bool{false, true}},
+		{Inputs: 2, Layout: []int{3, 1}, Recurrent: []bool{true, false}, LayerNorm: []bool{true, false}},
+		{Inputs: 2, Layout: []int{3, 1}, Recurrent: []bool{true, false}, Conv: &Conv1D{Kernel: 1, Filters: 1}},
+	} {
+		assert.Error(t, c.Validate())
+	}
+	assert.False(t, NewNeural(&Config{Inputs: 2, Layout: []int{3, 1}}).Recurrent())
+}
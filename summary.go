@@ -0,0 +1,145 @@
+package deep
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+)
+
+// LayerSummary describes a layer of a network
+type LayerSummary struct {
+	// Inputs is the number of outputs of the previous layer, or of the
+	// inputs or convolution of the network, and Outputs that of the layer
+	Inputs, Outputs int
+	Activation      ActivationType
+	// Weights is the number of weights other than biases, Recurrent of
+	// them recurrent, and Biases the number of biases
+	Weights, Recurrent, Biases int
+	// Alphas and Norms are the number of learned PReLU slopes and of the
+	// scales and shifts of the normalization
+	Alphas, Norms int
+	// Params is the number of learned parameters of the layer
+	Params  int
+	Dropout float64
+	// Norm is "batch" or "layer" for normalized layers
+	Norm   string
+	Frozen bool
+}
+
+// SummaryInfo describes a network, with the parameters of each layer
+type SummaryInfo struct {
+	// Conv is the number of kernel weights and biases of the convolution,
+	// zero without
+	Conv   int
+	Layers []LayerSummary
+	// Params is the number of learned parameters, Trainable those of
+	// layers that are not frozen
+	Params, Trainable int
+	// Size is the number of bytes of the network in the binary format of
+	// MarshalBinary
+	Size int
+}
+
+// SummaryInfo returns the description of the layers and parameters of n
+func (n *Neural) SummaryInfo() SummaryInfo {
+	var s SummaryInfo
+	inputs := n.Config.Inputs
+	if n.Conv != nil {
+		s.Conv = len(n.Conv.Kernels)*len(n.Conv.Kernels[0]) + len(n.Conv.Biases)
+		s.Params, s.Trainable = s.Conv, s.Conv
+		inputs = n.Config.Conv.Outputs(n.Config.Inputs)
+	}
+	for _, l := range n.Layers {
+		ls := LayerSummary{
+			Inputs:     inputs,
+			Outputs:    len(l.Neurons),
+			Activation: l.A,
+			Dropout:    l.Dropout,
+			Frozen:     l.Frozen,
+		}
+		for _, neuron := range l.Neurons {
+			for _, syn := range neuron.In {
+				if syn.IsBias {
+					ls.Biases++
+				} else {
+					ls.Weights++
+				}
+			}
+		}
+		for _, r := range l.Recurrent {
+			ls.Recurrent += len(r)
+		}
+		if l.A == ActivationPReLU {
+			ls.Alphas = 1
+		}
+		if l.Norm != nil {
+			ls.Norms = len(l.Norm.Gamma) + len(l.Norm.Beta)
+			ls.Norm = "batch"
+			if l.Norm.Layer {
+				ls.Norm = "layer"
+			}
+		}
+		ls.Params = ls.Weights + ls.Biases + ls.Alphas + ls.Norms
+		s.Params += ls.Params
+		if !l.Frozen {
+			s.Trainable += ls.Params
+		}
+		s.Layers = append(s.Layers, ls)
+		inputs = len(l.Neurons)
+	}
+	header, _ := json.Marshal(n.dumpParameters())
+	s.Size = len(binaryMagic) + 1 + 4 + len(header) + 8 + 8*n.synapses()
+	return s
+}
+
+// Summary returns a table of the layers of n and their parameters, with
+// columns of dropout rates and normalizations if any
+func (n *Neural) Summary() string {
+	s := n.SummaryInfo()
+	var dropout, norm bool
+	for _, l := range s.Layers {
+		dropout = dropout || l.Dropout > 0
+		norm = norm || l.Norm != ""
+	}
+
+	var b bytes.Buffer
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "layer\tinputs\toutputs\tactivation\tweights\tbiases\tparams\t")
+	if dropout {
+		fmt.Fprint(w, "dropout\t")
+	}
+	if norm {
+		fmt.Fprint(w, "norm\t")
+	}
+	fmt.Fprintln(w, "frozen")
+	if n.Conv != nil {
+		fmt.Fprintf(w, "conv\t%d\t%d\t%s\t%d\t%d\t%d\t", n.Config.Inputs, s.Layers[0].Inputs, n.Config.convActivation(),
+			len(n.Conv.Kernels)*len(n.Conv.Kernels[0]), len(n.Conv.Biases), s.Conv)
+		if dropout {
+			fmt.Fprint(w, "\t")
+		}
+		if norm {
+			fmt.Fprint(w, "\t")
+		}
+		fmt.Fprintln(w, "no")
+	}
+	for i, l := range s.Layers {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%s\t%d\t%d\t%d\t", i, l.Inputs, l.Outputs, l.Activation, l.Weights, l.Biases, l.Params)
+		if dropout {
+			fmt.Fprintf(w, "%g\t", l.Dropout)
+		}
+		if norm {
+			fmt.Fprintf(w, "%s\t", l.Norm)
+		}
+		frozen := "no"
+		if l.Frozen {
+			frozen = "yes"
+		}
+		fmt.Fprintln(w, frozen)
+	}
+	w.Flush()
+	fmt.Fprintf(&b, "params: %d, trainable: %d, non-trainable: %d\n", s.Params, s.Trainable, s.Params-s.Trainable)
+	fmt.Fprintf(&b, "size: %d bytes\n", s.Size)
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package deep
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SummaryInfo(t *testing.T) {
+	for _, c := range []struct {
+		config *Config
+		params []int
+		total  int
+	}{
+		{&Config{Inputs: 2, Layout: []int{3, 1}, Mode: ModeBinary, Bias: true}, []int{9, 4}, 13},
+		// regression outputs have no biases
+		{&Config{Inputs: 3, Layout: []int{4, 2}, Mode: ModeRegression, Bias: true}, []int{16, 8}, 24},
+		{&Config{Inputs: 5, Layout: []int{10, 10, 3}, Mode: ModeMultiClass}, []int{50, 100, 30}, 180},
+		{&Config{Inputs: 2, Layout: []int{3, 1}, Activation: ActivationPReLU, Mode: ModeBinary, Bias: true}, []int{10, 4}, 14},
+	} {
+		n := NewNeural(c.config)
+		s := n.SummaryInfo()
+		assert.Len(t, s.Layers, len(c.params))
+		for i, l := range s.Layers {
+			assert.Equal(t, c.params[i], l.Params, "%v layer %d", c.config.Layout, i)
+		}
+		assert.Equal(t, c.total, s.Params)
+		assert.Equal(t, c.total, s.Trainable)
+		assert.Equal(t, n.NumWeights()+s.Layers[0].Alphas, s.Params)
+		b, err := n.MarshalBinary()
+		assert.NoError(t, err)
+		assert.Equal(t, len(b), s.Size)
+	}
+}
+
+func Test_Summary(t *testing.T) {
+	n := NewNeural(&Config{
+		Inputs:      2,
+		Layout:      []int{4, 3, 2},
+		Activations: []ActivationType{ActivationReLU, ActivationTanh, ActivationNone},
+		Mode:        ModeMultiClass,
+		Bias:        true,
+		Dropout:     []float64{0.5, 0, 0},
+		BatchNorm:   []bool{true, false, false},
+	})
+	n.FreezeLayer(0)
+	s := n.SummaryInfo()
+	assert.Equal(t, LayerSummary{
+		Inputs: 2, Outputs: 4, Activation: ActivationReLU, Weights: 8, Biases: 4, Norms: 8, Params: 20,
+		Dropout: 0.5, Norm: "batch", Frozen: true,
+	}, s.Layers[0])
+	assert.Equal(t, LayerSummary{Inputs: 4, Outputs: 3, Activation: ActivationTanh, Weights: 12, Biases: 3, Params: 15}, s.Layers[1])
+	assert.Equal(t, LayerSummary{Inputs: 3, Outputs: 2, Activation: ActivationSoftmax, Weights: 6, Biases: 2, Params: 8}, s.Layers[2])
+	assert.Equal(t, 43, s.Params)
+	assert.Equal(t, 23, s.Trainable)
+
+	lines := strings.Split(n.Summary(), "\n")
+	assert.Equal(t, strings.Fields("layer inputs outputs activation weights biases params dropout norm frozen"), strings.Fields(lines[0]))
+	assert.Equal(t, strings.Fields("0 2 4 ReLU 8 4 20 0.5 batch yes"), strings.Fields(lines[1]))
+	assert.Equal(t, strings.Fields("1 4 3 Tanh 12 3 15 0 no"), strings.Fields(lines[2]))
+	assert.Equal(t, "params: 43, trainable: 23, non-trainable: 20", lines[4])
+}
+
+func Test_SummaryConv(t *testing.T) {
+	n := NewNeural(&Config{
+		Inputs:     8,
+		Conv:       &Conv1D{Kernel: 3, Filters: 2},
+		Layout:     []int{3, 1},
+		Activation: ActivationReLU,
+		Mode:       ModeBinary,
+		Bias:       true,
+	})
+	s := n.SummaryInfo()
+	assert.Equal(t, 8, s.Conv)
+	assert.Equal(t, 12, s.Layers[0].Inputs)
+	assert.Equal(t, n.NumWeights(), s.Params)
+	lines := strings.Split(n.Summary(), "\n")
+	assert.Equal(t, strings.Fields("conv 8 12 ReLU 6 2 8 no"), strings.Fields(lines[1]))
+}
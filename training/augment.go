@@ -0,0 +1,102 @@
+package training
+
+import (
+	"math/rand"
+)
+
+// Augmenter augments the input and ideal output of each training example
+// just before its forward pass. It must return new slices rather than
+// modify in and out, which belong to the examples. Validation sets are
+// never augmented.
+type Augmenter interface {
+	Augment(in, out []float64) ([]float64, []float64)
+}
+
+// WithAugmenter augments the training examples by a. The built-in
+// augmenters draw from the source of WithSeed, if any.
+func WithAugmenter(a Augmenter) Option {
+	return func(o *options) {
+		o.augmenter = a
+	}
+}
+
+// randAugmenter is implemented by augmenters that draw from a source
+type randAugmenter interface {
+	withRand(r *rand.Rand) Augmenter
+}
+
+// augmentation returns the augmenter of a training run, bound to the
+// source of o if it draws from one
+func (o options) augmentation() Augmenter {
+	if a, ok := o.augmenter.(randAugmenter); ok && o.rand != nil {
+		return a.withRand(o.rand)
+	}
+	return o.augmenter
+}
+
+// augment returns e augmented by a, if any
+func augment(a Augmenter, e Example) Example {
+	if a != nil {
+		e.Input, e.Response = a.Augment(e.Input, e.Response)
+	}
+	return e
+}
+
+// GaussianNoise adds noise from N(0, StdDev) to every input
+type GaussianNoise struct {
+	StdDev float64
+	rand   *rand.Rand
+}
+
+// Augment returns in with noise, and out
+func (g GaussianNoise) Augment(in, out []float64) ([]float64, []float64) {
+	noisy := make([]float64, len(in))
+	copy(noisy, in)
+	if g.StdDev == 0 {
+		return noisy, out
+	}
+	normal := rand.NormFloat64
+	if g.rand != nil {
+		normal = g.rand.NormFloat64
+	}
+	for i := range noisy {
+		noisy[i] += g.StdDev * normal()
+	}
+	return noisy, out
+}
+
+func (g GaussianNoise) withRand(r *rand.Rand) Augmenter {
+	g.rand = r
+	return g
+}
+
+// InputDropout zeroes every input with probability P, and scales the
+// others by 1/(1-P)
+type InputDropout struct {
+	P    float64
+	rand *rand.Rand
+}
+
+// Augment returns in with dropout, and out
+func (d InputDropout) Augment(in, out []float64) ([]float64, []float64) {
+	dropped := make([]float64, len(in))
+	if d.P == 0 {
+		copy(dropped, in)
+		return dropped, out
+	}
+	draw := rand.Float64
+	if d.rand != nil {
+		draw = d.rand.Float64
+	}
+	for i, v := range in {
+		if draw() >= d.P {
+			dropped[i] = v / (1 - d.P)
+		}
+	}
+	return dropped, out
+}
+
+func (d InputDropout) withRand(r *rand.Rand) Augmenter {
+	d.rand = r
+	return d
+}
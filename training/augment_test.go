@@ -0,0 +1,94 @@
+package training
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder records the inputs it augments by Augmenter
+type recorder struct {
+	Augmenter
+	in, augmented [][]float64
+}
+
+func (r *recorder) Augment(in, out []float64) ([]float64, []float64) {
+	a, o := r.Augmenter.Augment(in, out)
+	r.in, r.augmented = append(r.in, in), append(r.augmented, a)
+	return a, o
+}
+
+func Test_Augmenter(t *testing.T) {
+	data, validation := Examples{}, Examples{}
+	for i := 0.0; i < 1; i += 0.1 {
+		data = append(data, Example{Input: []float64{i, 1 - i}, Response: []float64{math.Sin(3 * i)}})
+		validation = append(validation, Example{Input: []float64{i + 10, 1 - i}, Response: []float64{math.Sin(3 * i)}})
+	}
+	original := make(Examples, len(data))
+	for i, e := range data {
+		original[i] = Example{Input: append([]float64{}, e.Input...), Response: append([]float64{}, e.Response...)}
+	}
+	network := func() *deep.Neural {
+		rand.Seed(0)
+		return deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{4, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(0.5, 0),
+			Bias:       true,
+		})
+	}
+	trainers := map[string]func(...Option) Trainer{
+		"online": func(opts ...Option) Trainer { return NewTrainer(NewSGD(0.1, 0, 0, false), 0, opts...) },
+		"batch":  func(opts ...Option) Trainer { return NewBatchTrainer(NewSGD(0.1, 0, 0, false), 0, 3, 2, opts...) },
+	}
+
+	for name, trainer := range trainers {
+		baseline := network()
+		trainer(WithSeed(1)).Train(baseline, data, validation, 5)
+
+		// no noise changes nothing
+		for _, a := range []Augmenter{GaussianNoise{}, InputDropout{}} {
+			n := network()
+			trainer(WithSeed(1), WithAugmenter(a)).Train(n, data, validation, 5)
+			assert.Equal(t, baseline.Weights(), n.Weights(), "%s %T", name, a)
+		}
+
+		// noise is drawn anew every epoch, for the training examples only
+		r := &recorder{Augmenter: GaussianNoise{StdDev: 0.1}}
+		n := network()
+		trainer(WithSeed(1), WithAugmenter(r), WithEarlyStopping(EarlyStopping{Patience: 10})).Train(n, data, validation, 2)
+		assert.Len(t, r.in, 2*len(data), name)
+		first := map[float64][]float64{}
+		for i, in := range r.in {
+			assert.True(t, in[0] < 1, "%s: validation input %v augmented", name, in)
+			assert.NotEqual(t, in, r.augmented[i], name)
+			if f, ok := first[in[0]]; ok {
+				assert.NotEqual(t, f, r.augmented[i], name)
+			}
+			first[in[0]] = r.augmented[i]
+		}
+		assert.NotEqual(t, baseline.Weights(), n.Weights(), name)
+		assert.Equal(t, original, data, name)
+	}
+}
+
+func Test_InputDropout(t *testing.T) {
+	in, out := []float64{1, 2, 3, 4, 5, 6, 7, 8}, []float64{1}
+	dropped, o := InputDropout{P: 0.5}.withRand(rand.New(rand.NewSource(0))).Augment(in, out)
+	assert.Equal(t, out, o)
+	var zeros int
+	for i, v := range dropped {
+		if v == 0 {
+			zeros++
+		} else {
+			assert.Equal(t, 2*in[i], v)
+		}
+	}
+	assert.True(t, zeros > 0 && zeros < len(in))
+	assert.Equal(t, []float64{1, 2, 3, 4, 5, 6, 7, 8}, in)
+}
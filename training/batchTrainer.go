@@ -1,8 +1,11 @@
 package training
 
 import (
+	"context"
+	"math"
+	"math/rand"
+	"runtime"
 	"sync"
-	"time"
 
 	deep "github.com/patrikeh/go-deep"
 )
@@ -10,6 +13,10 @@ import (
 // BatchTrainer implements parallelized batch training
 type BatchTrainer struct {
 	*internalb
+	averaging
+	stopping
+	progress
+	opts        options
 	verbosity   int
 	batchSize   int
 	parallelism int
@@ -18,168 +25,597 @@ type BatchTrainer struct {
 }
 
 type internalb struct {
+	loss              deep.Loss
+	weighted          bool
+	augmenter         Augmenter
 	deltas            [][][]float64
+	estimates         [][]float64
+	activations       [][]float64
+	outputs           [][]float64
+	outGradients      [][][]float64
 	partialDeltas     [][][][]float64
 	accumulatedDeltas [][][]float64
-	moments           [][][]float64
+	partialAlphas     [][]float64
+	accumulatedAlphas []float64
+	// rounding errors of the accumulated gradients, by compensate
+	compensations      [][][]float64
+	alphaCompensations []float64
+	partialNorms       []normGradients
+	accumulatedNorms   normGradients
+	partialConvs       []convGradients
+	accumulatedConv    convGradients
+	moments            [][][]float64
+	// ones is shared by the workers, see outputAlpha
+	ones []float64
 }
 
-func newBatchTraining(layers []*deep.Layer, parallelism int) *internalb {
+func newBatchTraining(layers []*deep.Layer, parallelism int, loss deep.Loss) *internalb {
+	outputs := len(layers[len(layers)-1].Neurons)
+	estimates := make([][]float64, parallelism)
+	activations := make([][]float64, parallelism)
+	outs := make([][]float64, parallelism)
 	deltas := make([][][]float64, parallelism)
+	outGradients := make([][][]float64, parallelism)
 	partialDeltas := make([][][][]float64, parallelism)
 	accumulatedDeltas := make([][][]float64, len(layers))
+	compensations := make([][][]float64, len(layers))
+	partialAlphas := make([][]float64, parallelism)
+	partialNorms := make([]normGradients, parallelism)
 	for w := 0; w < parallelism; w++ {
+		partialNorms[w] = newNormGradients(layers)
+		estimates[w] = make([]float64, outputs)
+		activations[w] = make([]float64, outputs)
+		outs[w] = make([]float64, outputs)
+		partialAlphas[w] = make([]float64, len(layers))
 		deltas[w] = make([][]float64, len(layers))
+		outGradients[w] = make([][]float64, len(layers))
 		partialDeltas[w] = make([][][]float64, len(layers))
 
 		for i, l := range layers {
 			deltas[w][i] = make([]float64, len(l.Neurons))
+			outGradients[w][i] = make([]float64, len(l.Neurons))
 			accumulatedDeltas[i] = make([][]float64, len(l.Neurons))
+			compensations[i] = make([][]float64, len(l.Neurons))
 			partialDeltas[w][i] = make([][]float64, len(l.Neurons))
 			for j, n := range l.Neurons {
 				partialDeltas[w][i][j] = make([]float64, len(n.In))
 				accumulatedDeltas[i][j] = make([]float64, len(n.In))
+				compensations[i][j] = make([]float64, len(n.In))
 			}
 		}
 	}
 	return &internalb{
-		deltas:            deltas,
-		partialDeltas:     partialDeltas,
-		accumulatedDeltas: accumulatedDeltas,
+		loss:               loss,
+		deltas:             deltas,
+		estimates:          estimates,
+		activations:        activations,
+		outputs:            outs,
+		ones:               ones(outputs),
+		outGradients:       outGradients,
+		partialDeltas:      partialDeltas,
+		accumulatedDeltas:  accumulatedDeltas,
+		partialAlphas:      partialAlphas,
+		accumulatedAlphas:  make([]float64, len(layers)),
+		compensations:      compensations,
+		alphaCompensations: make([]float64, len(layers)),
+		partialNorms:       partialNorms,
+		accumulatedNorms:   newNormGradients(layers),
+		partialConvs:       make([]convGradients, parallelism),
 	}
 }
 
-// NewBatchTrainer returns a BatchTrainer
-func NewBatchTrainer(solver Solver, verbosity, batchSize, parallelism int) *BatchTrainer {
+// initConv allocates the gradients of the convolution of n for workers
+func (t *internalb) initConv(n *deep.Neural, workers int) {
+	t.partialConvs = make([]convGradients, workers)
+	for w := range t.partialConvs {
+		t.partialConvs[w] = newConvGradients(n)
+	}
+	t.accumulatedConv = newConvGradients(n)
+}
+
+// NewBatchTrainer returns a BatchTrainer of mini-batches of batchSize
+// examples, the last of each epoch possibly smaller, over parallelism
+// workers, or one per CPU if not positive, unless set by WithParallelism.
+// Results do not depend on the parallelism.
+func NewBatchTrainer(solver Solver, verbosity, batchSize, parallelism int, opts ...Option) *BatchTrainer {
+	o := newOptions(opts)
+	if o.parallelism > 0 {
+		parallelism = o.parallelism
+	}
+	if parallelism <= 0 {
+		parallelism = runtime.NumCPU()
+	}
 	return &BatchTrainer{
+		opts:        o,
 		solver:      solver,
 		verbosity:   verbosity,
 		batchSize:   iparam(batchSize, 1),
-		parallelism: iparam(parallelism, 1),
-		printer:     NewStatsPrinter(),
+		parallelism: parallelism,
+		printer:     newStatsPrinter(o.output),
 	}
 }
 
-// Train trains n
+// WithParallelism sets the number of workers of a BatchTrainer
+func WithParallelism(workers int) Option {
+	return func(o *options) {
+		o.parallelism = workers
+	}
+}
+
+// Train trains n. Batch normalized networks are trained on a replica for
+// each example of a batch. Recurrent networks are trained on each example
+// as a sequence of its own. Train panics if the loss or the input or
+// response of an example is invalid, see TrainContext.
 func (t *BatchTrainer) Train(n *deep.Neural, examples, validation Examples, iterations int) {
-	t.internalb = newBatchTraining(n.Layers, t.parallelism)
+	if err := checkExamples(n, t.opts.lossFor(n), examples, validation); err != nil {
+		panic("training: " + err.Error())
+	}
+	t.train(context.Background(), n, sliceStream(examples), validation, iterations)
+}
+
+// TrainContext trains n until ctx is done, checked before every batch, and
+// returns the error of ctx or of the callback that stopped training.
+// Batches accumulated towards an update are then discarded. The workers
+// stop before it returns. Examples are checked before training like those
+// of OnlineTrainer.TrainContext.
+func (t *BatchTrainer) TrainContext(ctx context.Context, n *deep.Neural, examples, validation Examples, iterations int) error {
+	if err := checkExamples(n, t.opts.lossFor(n), examples, validation); err != nil {
+		return err
+	}
+	return t.train(ctx, n, sliceStream(examples), validation, iterations)
+}
 
-	train := make(Examples, len(examples))
-	copy(train, examples)
+// TrainSource trains n like TrainContext on the examples of source, drawn
+// anew every epoch and batched in order, see OnlineTrainer.TrainSource
+func (t *BatchTrainer) TrainSource(ctx context.Context, n *deep.Neural, source ExampleSource, validation Examples, iterations int) error {
+	if err := checkLoss(n, t.opts.lossFor(n)); err != nil {
+		return err
+	}
+	return t.train(ctx, n, t.opts.sourceStream(source), validation, iterations)
+}
 
-	workCh := make(chan Example, t.parallelism)
-	nets := make([]*deep.Neural, t.parallelism)
+func (t *BatchTrainer) train(ctx context.Context, n *deep.Neural, train *stream, validation Examples, iterations int) error {
+	normalized := n.Normalized()
+	replicas := t.parallelism
+	if normalized {
+		replicas = t.batchSize
+	}
+	t.internalb = newBatchTraining(n.Layers, replicas, t.opts.lossFor(n))
+	t.augmenter = t.opts.augmentation()
+	t.initConv(n, replicas)
+	t.resetAverage()
+	t.resetStopping()
+	t.weighted = train.train.weighted()
+	schedule := newSchedule(t.opts.scheduler, t.solver)
+	defer schedule.restore()
 
-	wg := sync.WaitGroup{}
-	for i := 0; i < t.parallelism; i++ {
+	// each example of a batch drops out by a source seeded by a draw of the
+	// source of the trainer for the batch plus the position of the example
+	// in the batch, whichever replica computes it
+	var seed int64
+	var reseed func(replica, position int)
+	dropout := t.opts.rand != nil && len(n.Config.Dropout) > 0
+	nets := make([]*deep.Neural, replicas)
+	for i := range nets {
 		nets[i] = deep.NewNeural(n.Config)
+		nets[i].SetTraining(true)
+		if dropout {
+			nets[i].SetRand(rand.New(rand.NewSource(0)))
+		}
+		for l, layer := range n.Layers {
+			nets[i].Layers[l].Frozen = layer.Frozen
+		}
+	}
+	if dropout {
+		reseed = func(replica, position int) {
+			nets[replica].Rand().Seed(seed + int64(position))
+		}
+	}
 
-		go func(id int, workCh <-chan Example) {
+	// each worker computes the gradients of one example at a time, which
+	// are merged in the order of the batch, for results that do not depend
+	// on the parallelism
+	work, done := make([]chan Example, t.parallelism), make([]chan struct{}, t.parallelism)
+	var workers sync.WaitGroup
+	defer workers.Wait()
+	for i := 0; i < t.parallelism && !normalized; i++ {
+		work[i], done[i] = make(chan Example, 1), make(chan struct{}, 1)
+		workers.Add(1)
+		go func(id int) {
+			defer workers.Done()
 			n := nets[id]
-			for e := range workCh {
+			for e := range work[id] {
+				n.ResetState()
 				n.Forward(e.Input)
-				t.calculateDeltas(n, e.Response, id)
-				wg.Done()
+				t.calculateDeltas(n, e.Response, e.weight(t.weighted), id)
+				done[id] <- struct{}{}
 			}
-		}(i, workCh)
+		}(i)
+		defer close(work[i])
 	}
 
-	t.printer.Init(n)
-	t.solver.Init(n.NumWeights())
+	t.printer.loss = t.loss
+	t.printer.schedule = schedule
+	t.printer.metrics = t.opts.metrics
+	start := t.opts.resume(t.solver, n)
+	callbacks := newCallbacks(t.opts, t.printer, t.verbosity, n, t.solver, t.loss, train.train, validation)
 
-	ts := time.Now()
-	for it := 1; it <= iterations; it++ {
-		train.Shuffle()
-		batches := train.SplitSize(t.batchSize)
+	updates, shuffles := t.opts.restoreState(&t.stopping, schedule, train.train)
 
-		for _, b := range batches {
-			currentWeights := n.Weights()
-			for _, n := range nets {
-				n.ApplyWeights(currentWeights)
-			}
+	epoch := start
+	var err error
+	var (
+		steps   int
+		weights float64
+	)
+	step := func(it int) {
+		schedule.apply(it-1, updates)
+		t.update(n, it, weights)
+		updates++
+		steps, weights = 0, 0
+	}
+	deadline := t.opts.deadline()
+	for it := start + 1; it <= start+iterations; it++ {
+		t.opts.emit(EpochStartEvent{Epoch: it})
+		if train.epoch(t.opts, true) {
+			shuffles++
+		}
 
-			wg.Add(len(b))
-			for _, item := range b {
-				workCh <- item
+		passed := false
+		for b := train.nextBatch(t.batchSize); len(b) > 0; b = train.nextBatch(t.batchSize) {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			if passed = deadline.batch(); passed {
+				break
+			}
+			for _, replica := range nets {
+				replica.CopyWeightsFrom(n)
+			}
+			if dropout {
+				seed = t.opts.rand.Int63()
 			}
-			wg.Wait()
 
-			for _, wPD := range t.partialDeltas {
-				for i, iPD := range wPD {
-					iAD := t.accumulatedDeltas[i]
-					for j, jPD := range iPD {
-						jAD := iAD[j]
-						for k, v := range jPD {
-							jAD[k] += v
-							jPD[k] = 0
-						}
+			var batchWeights float64
+			if normalized {
+				batchWeights = t.normalizedBatch(nets, b, reseed)
+				// keep the running statistics of the batch
+				n.ApplyNorms(nets[0].Norms())
+				for r := range nets {
+					t.merge(n, r)
+				}
+			} else {
+				var items Examples
+				for _, item := range b {
+					if w := item.weight(t.weighted); w != 0 {
+						batchWeights += w
+						items = append(items, augment(t.augmenter, item))
 					}
 				}
+				t.pipeline(n, items, work, done, reseed)
 			}
+			if batchWeights == 0 {
+				continue
+			}
+
+			weights += batchWeights
+			if steps++; steps == t.opts.accumulation() {
+				step(it)
+			}
+		}
+		if err != nil {
+			break
+		}
+		if passed {
+			t.reason = StopMaxDuration
+			break
+		}
+		if steps > 0 {
+			step(it)
+		}
+		t.average(n, t.opts.swa, it)
+		schedule.observe(n, t.loss, it, validation)
+
+		epoch = it
+		if err = callbacks.epochEnd(n, it); err != nil {
+			break
+		}
+		if t.stop(n, t.opts.stopping, t.loss, it, validation) {
+			t.opts.emit(EarlyStopEvent{Epoch: it, BestEpoch: t.bestEpoch, BestLoss: t.bestLoss})
+			break
+		}
+		if deadline.passed() {
+			t.reason = StopMaxDuration
+			break
+		}
+	}
+	if err != nil {
+		t.reason = StopInterrupted
+	}
+	t.record(epoch, updates, shuffles, t.opts, &t.stopping, schedule)
+	t.restoreBest(n, t.opts.stopping)
+	callbacks.trainEnd(n, epoch, err)
+	return err
+}
 
-			t.update(n, it)
+// pipeline passes items to the workers in turn, merging the gradients of
+// each in order as soon as they are computed. The replica of a worker is
+// reseeded, if reseed is not nil, for the position of each item while the
+// worker is idle.
+func (t *BatchTrainer) pipeline(n *deep.Neural, items Examples, work []chan Example, done []chan struct{}, reseed func(replica, position int)) {
+	send := func(w, i int) {
+		if reseed != nil {
+			reseed(w, i)
 		}
+		work[w] <- items[i]
+	}
+	for i := 0; i < len(items) && i < t.parallelism; i++ {
+		send(i, i)
+	}
+	for i := range items {
+		w := i % t.parallelism
+		<-done[w]
+		t.merge(n, w)
+		if next := i + t.parallelism; next < len(items) {
+			send(w, next)
+		}
+	}
+}
 
-		if t.verbosity > 0 && it%t.verbosity == 0 && len(validation) > 0 {
-			t.printer.PrintProgress(n, validation, time.Since(ts), it)
+// merge adds the partial gradients of worker w to the accumulated gradients
+// of the weights and slopes by compensated summation, and zeroes them
+func (t *BatchTrainer) merge(n *deep.Neural, w int) {
+	for i, iPD := range t.partialDeltas[w] {
+		if n.Layers[i].Frozen {
+			continue
+		}
+		iAD, iC := t.accumulatedDeltas[i], t.compensations[i]
+		for j, jPD := range iPD {
+			jAD, jC := iAD[j], iC[j]
+			for k, v := range jPD {
+				compensate(&jAD[k], &jC[k], v)
+				jPD[k] = 0
+			}
 		}
 	}
+	for i, v := range t.partialAlphas[w] {
+		compensate(&t.accumulatedAlphas[i], &t.alphaCompensations[i], v)
+		t.partialAlphas[w][i] = 0
+	}
+	t.accumulatedNorms.add(t.partialNorms[w])
+	t.accumulatedConv.add(t.partialConvs[w])
 }
 
-func (t *BatchTrainer) calculateDeltas(n *deep.Neural, ideal []float64, wid int) {
-	loss := deep.GetLoss(n.Config.Loss)
+// normalizedBatch computes the gradients of the examples of b by forward
+// and backward passes over a replica of nets for each, reseeded for its
+// position if reseed is not nil, normalizing by the statistics of the
+// batch, and returns the total weight of b
+func (t *BatchTrainer) normalizedBatch(nets []*deep.Neural, b Examples, reseed func(replica, position int)) float64 {
+	var (
+		batch   Examples
+		inputs  [][]float64
+		weights float64
+	)
+	for _, e := range b {
+		if w := e.weight(t.weighted); w != 0 {
+			e = augment(t.augmenter, e)
+			batch = append(batch, e)
+			inputs = append(inputs, e.Input)
+			weights += w
+		}
+	}
+	if len(batch) == 0 {
+		return 0
+	}
+	nets = nets[:len(batch)]
+	for r, n := range nets {
+		n.ResetState()
+		if reseed != nil {
+			reseed(r, r)
+		}
+	}
+	deep.ForwardBatch(nets, inputs)
+
+	t.parallel(len(batch), func(r int) {
+		t.outputDeltas(nets[r], batch[r].Response, batch[r].weight(t.weighted), r)
+	})
+	for i := len(nets[0].Layers) - 2; i >= trainable(nets[0]); i-- {
+		t.parallel(len(batch), func(r int) { t.hiddenDeltas(nets[r], i, r) })
+		if norm := nets[0].Layers[i].Norm; norm != nil && norm.Layer {
+			t.parallel(len(batch), func(r int) {
+				normalizeDeltas(nets[r].Layers[i], t.deltas[r][i], t.partialNorms[r].gammas[i], t.partialNorms[r].betas[i])
+			})
+		} else if norm != nil {
+			normalizeBatchDeltas(nets, i, t.deltas, t.accumulatedNorms.gammas[i], t.accumulatedNorms.betas[i])
+		}
+	}
+	t.parallel(len(batch), func(r int) { t.accumulateDeltas(nets[r], r) })
+	return weights
+}
+
+// parallel calls f for each of count replicas on up to parallelism
+// goroutines
+func (t *BatchTrainer) parallel(count int, f func(r int)) {
+	var wg sync.WaitGroup
+	for w := 0; w < t.parallelism && w < count; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for r := w; r < count; r += t.parallelism {
+				f(r)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+// calculateDeltas computes the gradients of the example last passed forward
+// through n by worker wid, normalizing by fixed statistics
+func (t *BatchTrainer) calculateDeltas(n *deep.Neural, ideal []float64, weight float64, wid int) {
+	t.outputDeltas(n, ideal, weight, wid)
+	for i := len(n.Layers) - 2; i >= trainable(n); i-- {
+		t.hiddenDeltas(n, i, wid)
+		if l := n.Layers[i]; l.Norm != nil {
+			normalizeDeltas(l, t.deltas[wid][i], t.partialNorms[wid].gammas[i], t.partialNorms[wid].betas[i])
+		}
+	}
+	t.accumulateDeltas(n, wid)
+}
+
+// outputDeltas computes the deltas of the output layer of n by worker wid
+func (t *BatchTrainer) outputDeltas(n *deep.Neural, ideal []float64, weight float64, wid int) {
 	deltas := t.deltas[wid]
-	partialDeltas := t.partialDeltas[wid]
-	lastDeltas := deltas[len(n.Layers)-1]
+	estimate, activation := t.estimates[wid], t.activations[wid]
 
 	for i, n := range n.Layers[len(n.Layers)-1].Neurons {
-		lastDeltas[i] = loss.Df(
-			n.Value,
-			ideal[i],
-			n.DActivate(n.Value))
+		estimate[i] = n.Value
+		activation[i] = n.Derivative()
 	}
+	deep.OutputDeltas(t.loss, estimate, ideal, activation, deltas[len(n.Layers)-1])
+	if weight != 1 {
+		for i := range deltas[len(n.Layers)-1] {
+			deltas[len(n.Layers)-1][i] *= weight
+		}
+	}
+	if last := n.Layers[len(n.Layers)-1]; last.A == deep.ActivationPReLU {
+		t.partialAlphas[wid][len(n.Layers)-1] += weight * outputAlpha(t.loss, last, estimate, ideal, t.ones, t.outputs[wid])
+	}
+}
 
-	for i := len(n.Layers) - 2; i >= 0; i-- {
-		l := n.Layers[i]
-		iD := deltas[i]
-		nextD := deltas[i+1]
-		for j, n := range l.Neurons {
-			var sum float64
-			for k, s := range n.Out {
-				sum += s.Weight * nextD[k]
-			}
-			iD[j] = n.DActivate(n.Value) * sum
+// hiddenDeltas computes the deltas of the activations of hidden layer i of
+// n from those of layer i+1 and of the layers skipped to, by worker wid
+func (t *BatchTrainer) hiddenDeltas(n *deep.Neural, i, wid int) {
+	l := n.Layers[i]
+	iD := t.deltas[wid][i]
+	nextD := t.deltas[wid][i+1]
+	alphas := t.partialAlphas[wid]
+	outGradients := t.outGradients[wid]
+	prelu := l.A == deep.ActivationPReLU
+	for j, n := range l.Neurons {
+		var sum float64
+		for k, s := range n.Out {
+			sum += s.Weight * nextD[k]
+		}
+		outGradients[i][j] = sum
+	}
+	addSkipped(n, i, outGradients)
+	for j, n := range l.Neurons {
+		sum := outGradients[i][j]
+		iD[j] = n.Derivative() * sum
+		if prelu {
+			alphas[i] += sum * n.Mask() * deep.PReLU{}.DfAlpha(n.Sum)
 		}
 	}
+}
 
+// accumulateDeltas adds the gradients of the weights of the layers of n
+// that are not frozen, by worker wid
+func (t *BatchTrainer) accumulateDeltas(n *deep.Neural, wid int) {
 	for i, l := range n.Layers {
-		iD := deltas[i]
-		iPD := partialDeltas[i]
+		if l.Frozen {
+			continue
+		}
+		iD := t.deltas[wid][i]
+		iPD := t.partialDeltas[wid][i]
 		for j, n := range l.Neurons {
 			jD := iD[j]
 			jPD := iPD[j]
 			for k, s := range n.In {
-				jPD[k] += jD * s.In
+				if !s.Pruned {
+					jPD[k] += jD * s.In
+				}
 			}
 		}
 	}
+	t.partialConvs[wid].backward(n, t.deltas[wid][0])
+}
+
+// compensate adds v to sum by Neumaier's variant of Kahan summation,
+// carrying its rounding error in c, so that the gradients of many examples
+// sum to the same whatever their order
+func compensate(sum, c *float64, v float64) {
+	t := *sum + v
+	if math.Abs(*sum) >= math.Abs(v) {
+		*c += (*sum - t) + v
+	} else {
+		*c += (v - t) + *sum
+	}
+	*sum = t
 }
 
-func (t *BatchTrainer) update(n *deep.Neural, it int) {
+// settle adds the rounding errors of the accumulated gradients to them
+func (t *internalb) settle() {
+	for i, iC := range t.compensations {
+		for j, jC := range iC {
+			for k, c := range jC {
+				if c != 0 && !math.IsInf(t.accumulatedDeltas[i][j][k], 0) {
+					t.accumulatedDeltas[i][j][k] += c
+				}
+				jC[k] = 0
+			}
+		}
+	}
+	for i, c := range t.alphaCompensations {
+		if c != 0 && !math.IsInf(t.accumulatedAlphas[i], 0) {
+			t.accumulatedAlphas[i] += c
+		}
+		t.alphaCompensations[i] = 0
+	}
+}
+
+// update applies the accumulated gradients, averaged over the total weight
+// of the batches
+func (t *BatchTrainer) update(n *deep.Neural, it int, weights float64) {
+	t.settle()
+	scale := 1.0
+	if t.opts.clipNorm > 0 {
+		var squared float64
+		for i, l := range n.Layers {
+			for _, jAD := range t.accumulatedDeltas[i] {
+				for _, v := range jAD {
+					squared += (v / weights) * (v / weights)
+				}
+			}
+			if l.A == deep.ActivationPReLU && !l.Frozen {
+				squared += math.Pow(t.accumulatedAlphas[i]/weights, 2)
+			}
+		}
+		squared += t.accumulatedNorms.squared(n, weights)
+		squared += t.accumulatedConv.squared(weights)
+		scale = t.opts.clipScale(squared)
+	}
+
 	var idx int
 	for i, l := range n.Layers {
+		if l.Frozen {
+			idx += layerWeights(l)
+			continue
+		}
 		iAD := t.accumulatedDeltas[i]
-		for j, n := range l.Neurons {
+		for j, neuron := range l.Neurons {
 			jAD := iAD[j]
-			for k, s := range n.In {
+			for k, s := range neuron.In {
+				if s.Pruned {
+					idx++
+					continue
+				}
 				update := t.solver.Update(s.Weight,
-					jAD[k],
+					t.opts.clip(jAD[k]/weights, scale)+n.Config.Regularization(s),
 					it,
 					idx)
-				s.Weight += update
+				s.Weight += t.opts.lr(i) * update
 				jAD[k] = 0
 				idx++
 			}
 		}
 	}
+	for i, l := range n.Layers {
+		if l.A == deep.ActivationPReLU && !l.Frozen {
+			l.Alpha += t.opts.lr(i) * t.solver.Update(l.Alpha, t.opts.clip(t.accumulatedAlphas[i]/weights, scale), it, idx+i)
+		}
+		t.accumulatedAlphas[i] = 0
+	}
+	idx = t.accumulatedNorms.apply(n, t.solver, t.opts, it, idx+len(n.Layers), weights, scale)
+	t.accumulatedConv.apply(n, t.solver, t.opts, it, idx, weights, scale)
+	t.opts.constrain(n)
 }
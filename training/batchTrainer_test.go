@@ -1,11 +1,15 @@
 package training
 
 import (
+	"fmt"
+	"math"
+	"math/big"
 	"math/rand"
 	"runtime"
 	"testing"
 
 	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
 )
 
 func Benchmark_xor(b *testing.B) {
@@ -19,10 +23,10 @@ func Benchmark_xor(b *testing.B) {
 		Bias:       true,
 	})
 	exs := Examples{
-		{[]float64{0, 0}, []float64{0}},
-		{[]float64{1, 0}, []float64{1}},
-		{[]float64{0, 1}, []float64{1}},
-		{[]float64{1, 1}, []float64{0}},
+		{Input: []float64{0, 0}, Response: []float64{0}},
+		{Input: []float64{1, 0}, Response: []float64{1}},
+		{Input: []float64{0, 1}, Response: []float64{1}},
+		{Input: []float64{1, 1}, Response: []float64{0}},
 	}
 	const minExamples = 4000
 	var dupExs Examples
@@ -37,3 +41,392 @@ func Benchmark_xor(b *testing.B) {
 		trainer.Train(n, dupExs, dupExs, iterations)
 	}
 }
+
+func Test_BatchNormGradient(t *testing.T) {
+	config := &deep.Config{
+		Inputs:     2,
+		Layout:     []int{4, 3, 2},
+		Activation: deep.ActivationTanh,
+		Loss:       deep.LossMeanSquared,
+		Weight:     deep.NewNormal(1, 0),
+		Bias:       true,
+		BatchNorm:  []bool{true, true, false},
+	}
+	checkBatchGradient(t, config)
+
+	config.BatchNorm = []bool{true, false, false}
+	config.LayerNorm = []bool{false, true, false}
+	checkBatchGradient(t, config)
+}
+
+// checkBatchGradient compares the gradients of a batch computed by the
+// BatchTrainer for a network of config to numerical derivatives
+func checkBatchGradient(t *testing.T, config *deep.Config) {
+	rand.Seed(0)
+	n := deep.NewNeural(config)
+	batch := Examples{
+		{Input: []float64{0.7, -1.2}, Response: []float64{0.5, -0.3}},
+		{Input: []float64{-0.4, 0.9}, Response: []float64{-1, 0.2}},
+		{Input: []float64{1.5, 0.3}, Response: []float64{0.1, 0.8}},
+		{Input: []float64{-1.1, -0.6}, Response: []float64{0.7, -0.5}},
+	}
+	nets := make([]*deep.Neural, len(batch))
+	inputs := make([][]float64, len(batch))
+	for r := range nets {
+		nets[r] = deep.NewNeural(config)
+		nets[r].ApplyWeights(n.Weights())
+		inputs[r] = batch[r].Input
+	}
+	// the loss summed over the batch, as at every replica
+	loss := func() float64 {
+		deep.ForwardBatch(nets, inputs)
+		var sum float64
+		for r, n := range nets {
+			for i, neuron := range n.Layers[len(n.Layers)-1].Neurons {
+				sum += 0.5 * math.Pow(neuron.Value-batch[r].Response[i], 2)
+			}
+		}
+		return sum
+	}
+	// perturb applies f to the corresponding parameter of every replica
+	perturb := func(f func(n *deep.Neural) *float64) float64 {
+		const h = 1e-6
+		step := func(d float64) {
+			for _, n := range nets {
+				*f(n) += d
+			}
+		}
+		step(h)
+		plus := loss()
+		step(-2 * h)
+		minus := loss()
+		step(h)
+		return (plus - minus) / (2 * h)
+	}
+
+	trainer := NewBatchTrainer(NewSGD(0.1, 0, 0, false), 0, len(batch), 2)
+	trainer.internalb = newBatchTraining(n.Layers, len(batch), n.Loss())
+	assert.Equal(t, 4.0, trainer.normalizedBatch(nets, batch, nil))
+	for _, partial := range trainer.partialNorms {
+		trainer.accumulatedNorms.add(partial)
+	}
+
+	for i, l := range n.Layers {
+		for j, neuron := range l.Neurons {
+			for k := range neuron.In {
+				var analytic float64
+				for r := range nets {
+					analytic += trainer.partialDeltas[r][i][j][k]
+				}
+				numeric := perturb(func(n *deep.Neural) *float64 { return &n.Layers[i].Neurons[j].In[k].Weight })
+				assert.InDelta(t, numeric, analytic, 1e-6)
+			}
+			if l.Norm == nil {
+				continue
+			}
+			numeric := perturb(func(n *deep.Neural) *float64 { return &n.Layers[i].Norm.Gamma[j] })
+			assert.InDelta(t, numeric, trainer.accumulatedNorms.gammas[i][j], 1e-6)
+			numeric = perturb(func(n *deep.Neural) *float64 { return &n.Layers[i].Norm.Beta[j] })
+			assert.InDelta(t, numeric, trainer.accumulatedNorms.betas[i][j], 1e-6)
+		}
+	}
+}
+
+func Test_BatchNormTraining(t *testing.T) {
+	train := func(norm []bool) float64 {
+		rand.Seed(0)
+		var exs Examples
+		for i := 0; i < 256; i++ {
+			x, y := rand.Float64()*2-1, rand.Float64()*2-1
+			exs = append(exs, Example{Input: []float64{x, y}, Response: []float64{math.Sin(3*x) * y}})
+		}
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{16, 16, 16, 16, 16, 1},
+			Activation: deep.ActivationSigmoid,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(0.5, 0),
+			Bias:       true,
+			BatchNorm:  norm,
+		})
+		trainer := NewBatchTrainer(NewSGD(0.1, 0.9, 0, false), 0, 32, 4)
+		trainer.Train(n, exs, nil, 30)
+		// predictions are normalized by the running statistics
+		return validationLoss(n, trainer.loss, exs)
+	}
+
+	plain := train(nil)
+	normalized := train([]bool{true, true, true, true, true, false})
+	assert.True(t, normalized < plain/4, "%f, %f", normalized, plain)
+}
+
+func Test_Skips(t *testing.T) {
+	loss := func(residual bool) float64 {
+		rand.Seed(0)
+		var exs Examples
+		for i := 0; i < 200; i++ {
+			x := rand.Float64()*2 - 1
+			exs = append(exs, Example{Input: []float64{x}, Response: []float64{math.Sin(3 * x)}})
+		}
+		var skips []deep.Skip
+		if residual {
+			for i := 1; i < 9; i++ {
+				skips = append(skips, deep.Skip{From: i - 1, To: i})
+			}
+		}
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     1,
+			Layout:     []int{8, 8, 8, 8, 8, 8, 8, 8, 8, 1},
+			Activation: deep.ActivationReLU,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(0.1, 0),
+			Bias:       true,
+			Skips:      skips,
+		})
+		trainer := NewBatchTrainer(NewSGD(0.01, 0.9, 0, false), 0, 16, 1)
+		trainer.Train(n, exs, nil, 200)
+		return validationLoss(n, trainer.loss, exs)
+	}
+
+	// the signal vanishes through the plain network
+	assert.True(t, loss(false) > 0.3)
+	assert.True(t, loss(true) < 0.05)
+}
+
+func Test_Conv(t *testing.T) {
+	// detect a short pulse anywhere in a noisy signal of random level
+	rand.Seed(0)
+	sample := func() Example {
+		x := make([]float64, 32)
+		level, pulse := rand.Float64(), -1
+		if rand.Intn(2) == 0 {
+			pulse = rand.Intn(30)
+		}
+		for i := range x {
+			x[i] = level + 0.1*rand.NormFloat64()
+			if pulse >= 0 && i >= pulse && i < pulse+2 {
+				x[i]++
+			}
+		}
+		if pulse >= 0 {
+			return Example{Input: x, Response: []float64{1}}
+		}
+		return Example{Input: x, Response: []float64{0}}
+	}
+	var train, validation Examples
+	for i := 0; i < 1000; i++ {
+		train = append(train, sample())
+		validation = append(validation, sample())
+	}
+	accuracy := func(config *deep.Config) (int, float64) {
+		n := deep.NewNeural(config)
+		trainer := NewBatchTrainer(NewAdam(0.01, 0.9, 0.999, 1e-8), 0, 32, 2)
+		trainer.Train(n, train, nil, 50)
+		var correct int
+		for _, e := range validation {
+			if (n.Predict(e.Input)[0] > 0.5) == (e.Response[0] == 1) {
+				correct++
+			}
+		}
+		return n.NumWeights(), float64(correct) / float64(len(validation))
+	}
+
+	convWeights, conv := accuracy(&deep.Config{
+		Inputs: 32,
+		Layout: []int{1},
+		Mode:   deep.ModeBinary,
+		Weight: deep.WeightXavier,
+		Bias:   true,
+		Conv:   &deep.Conv1D{Kernel: 4, Filters: 4, Activation: deep.ActivationReLU},
+	})
+	denseWeights, dense := accuracy(&deep.Config{
+		Inputs:     32,
+		Layout:     []int{4, 1},
+		Activation: deep.ActivationReLU,
+		Mode:       deep.ModeBinary,
+		Weight:     deep.WeightHe,
+		Bias:       true,
+	})
+	assert.Equal(t, convWeights, denseWeights)
+	assert.True(t, conv > 0.97, "%f", conv)
+	assert.True(t, dense < 0.95, "%f", dense)
+
+	// a dense network needs four times the weights
+	_, dense = accuracy(&deep.Config{
+		Inputs:     32,
+		Layout:     []int{16, 1},
+		Activation: deep.ActivationReLU,
+		Mode:       deep.ModeBinary,
+		Weight:     deep.WeightHe,
+		Bias:       true,
+	})
+	assert.True(t, dense > 0.97, "%f", dense)
+}
+
+func Test_BatchShuffle(t *testing.T) {
+	var data Examples
+	for i := 0; i < 20; i++ {
+		x := float64(i) / 10
+		data = append(data, Example{Input: []float64{x}, Response: []float64{math.Sin(3 * x)}})
+	}
+	// trajectory returns the loss on data after each epoch, with the global
+	// source seeded by global once the network is initialized
+	trajectory := func(global int64, opts ...Option) []float64 {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     1,
+			Layout:     []int{4, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(0.5, 0),
+			Bias:       true,
+		})
+		rand.Seed(global)
+		trainer := NewBatchTrainer(NewSGD(0.1, 0, 0, false), 0, 3, 1, opts...)
+		var losses []float64
+		for i := 0; i < 10; i++ {
+			trainer.Train(n, data, nil, 1)
+			losses = append(losses, validationLoss(n, nil, data))
+		}
+		return losses
+	}
+
+	// in order, training does not depend on any source
+	assert.Equal(t, trajectory(1, WithShuffle(false)), trajectory(2, WithShuffle(false)))
+	// shuffles by the source of the trainer are reproducible
+	seeded := trajectory(1, WithSeed(7))
+	assert.Equal(t, seeded, trajectory(2, WithSeed(7)))
+	assert.NotEqual(t, seeded, trajectory(1, WithSeed(8)))
+	assert.NotEqual(t, trajectory(1, WithShuffle(false)), seeded)
+	assert.NotEqual(t, trajectory(1), trajectory(2))
+}
+
+func Test_PartialBatch(t *testing.T) {
+	n := deep.NewNeural(&deep.Config{
+		Inputs: 2,
+		Layout: []int{1},
+		Mode:   deep.ModeRegression,
+		Weight: deep.NewNormal(0.5, 0),
+	})
+	n.ApplyWeights([][][]float64{{{0.5, -1}}})
+	data := Examples{
+		{Input: []float64{1, 2}, Response: []float64{1}},
+		{Input: []float64{-1, 1}, Response: []float64{0}},
+		{Input: []float64{2, 1}, Response: []float64{3}},
+	}
+	solver := &gradientSolver{}
+	NewBatchTrainer(solver, 0, 2, 2, WithShuffle(false)).Train(n, data, nil, 1)
+
+	// the errors 0.5-2-1, -0.5-1-0 and 1-1-3 of the examples by weight, the
+	// last batch of one averaged over one
+	assert.InDeltaSlice(t, []float64{
+		(-2.5*1 + -1.5*-1) / 2, (-2.5*2 + -1.5*1) / 2,
+		-3 * 2, -3 * 1,
+	}, solver.gradients, 1e-12)
+}
+
+func parallelData() (Examples, func() *deep.Neural) {
+	r := rand.New(rand.NewSource(1))
+	data := make(Examples, 64)
+	for i := range data {
+		x, y := r.Float64(), r.Float64()
+		data[i] = Example{Input: []float64{x, y}, Response: []float64{math.Sin(3*x) * y}}
+	}
+	return data, func() *deep.Neural {
+		rand.Seed(0)
+		return deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{16, 16, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(0.5, 0),
+			Bias:       true,
+		})
+	}
+}
+
+func Test_Parallelism(t *testing.T) {
+	data, network := parallelData()
+	// dropout masks are drawn for the position of each example in a batch,
+	// whichever worker computes it
+	for _, dropout := range [][]float64{nil, {0.3, 0.3, 0}} {
+		var weights [][][]float64
+		for _, workers := range []int{1, 4, 3} {
+			config := *network().Config
+			config.Dropout = dropout
+			rand.Seed(0)
+			n := deep.NewNeural(&config)
+			NewBatchTrainer(NewAdam(0.01, 0, 0, 0), 0, 10, 0, WithSeed(3), WithParallelism(workers)).Train(n, data, nil, 5)
+			if weights == nil {
+				weights = n.Weights()
+				continue
+			}
+			assert.Equal(t, weights, n.Weights(), "%d workers, dropout %v", workers, dropout)
+		}
+	}
+
+	assert.Equal(t, runtime.NumCPU(), NewBatchTrainer(NewSGD(0.1, 0, 0, false), 0, 10, 0).parallelism)
+	assert.Equal(t, 2, NewBatchTrainer(NewSGD(0.1, 0, 0, false), 0, 10, 2).parallelism)
+	assert.Equal(t, 3, NewBatchTrainer(NewSGD(0.1, 0, 0, false), 0, 10, 2, WithParallelism(3)).parallelism)
+}
+
+func Benchmark_Parallelism(b *testing.B) {
+	data, network := parallelData()
+	for len(data) < 4096 {
+		data = append(data, data...)
+	}
+	for workers := 1; workers <= runtime.NumCPU(); workers *= 2 {
+		b.Run(fmt.Sprintf("%d", workers), func(b *testing.B) {
+			n := network()
+			trainer := NewBatchTrainer(NewAdam(0.001, 0, 0, 0), 0, 256, workers)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				trainer.Train(n, data, nil, 1)
+			}
+		})
+	}
+}
+
+func Test_CompensatedMerge(t *testing.T) {
+	n := deep.NewNeural(&deep.Config{Inputs: 1, Layout: []int{1}, Mode: deep.ModeRegression, Weight: deep.NewNormal(1, 0)})
+	trainer := NewBatchTrainer(NewSGD(0.1, 0, 0, false), 0, 1, 1)
+	trainer.internalb = newBatchTraining(n.Layers, 1, n.Loss())
+
+	reference := new(big.Float).SetPrec(512)
+	for i := 0; i < 1000003; i++ {
+		g := 1e-8
+		if i < 3 {
+			g = 1e8
+		}
+		trainer.partialDeltas[0][0][0][0] = g
+		trainer.merge(n, 0)
+		reference.Add(reference, big.NewFloat(g))
+	}
+	trainer.settle()
+	sum, _ := reference.Float64()
+	assert.Equal(t, sum, trainer.accumulatedDeltas[0][0][0])
+	assert.Equal(t, 0.0, trainer.compensations[0][0][0])
+}
+
+func Test_CompensatedValidationLoss(t *testing.T) {
+	n := deep.NewNeural(&deep.Config{Inputs: 1, Layout: []int{1}, Activation: deep.ActivationLinear, Mode: deep.ModeRegression, Weight: deep.NewNormal(0, 1)})
+	examples := make(Examples, 100003)
+	reference := new(big.Float).SetPrec(512)
+	for i := range examples {
+		x := 1e-4
+		if i < 3 {
+			x = 1e4
+		}
+		examples[i] = Example{Input: []float64{x}, Response: []float64{0}, Weight: 1}
+		reference.Add(reference, big.NewFloat(x*x))
+	}
+	mean, _ := reference.Quo(reference, big.NewFloat(float64(len(examples)))).Float64()
+	ulp := math.Nextafter(mean, math.Inf(1)) - mean
+
+	// weighted and unweighted
+	assert.InDelta(t, mean, validationLoss(n, nil, examples), ulp)
+	for i := range examples {
+		examples[i].Weight = 0
+	}
+	assert.InDelta(t, mean, validationLoss(n, nil, examples), ulp)
+}
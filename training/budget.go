@@ -0,0 +1,80 @@
+package training
+
+import "time"
+
+// TimeBudget stops training once Duration has passed since it started,
+// checked after early stopping, which wins if both trigger at once
+type TimeBudget struct {
+	Duration time.Duration
+	// PerBatch checks the budget after every mini-batch of the BatchTrainer
+	// and every example of the OnlineTrainer rather than every epoch. The
+	// epoch in progress is then abandoned, as if cancelled.
+	PerBatch bool
+}
+
+// WithTimeBudget stops training by b. The number of epochs completed is
+// given by State, and StopReason reports StopMaxDuration.
+func WithTimeBudget(b TimeBudget) Option {
+	return func(o *options) {
+		o.budget = &b
+	}
+}
+
+// WithMaxDuration stops training at the end of the first epoch after d
+// has passed, see WithTimeBudget
+func WithMaxDuration(d time.Duration) Option {
+	return WithTimeBudget(TimeBudget{Duration: d})
+}
+
+// StopReason is why a training run ended
+type StopReason int
+
+const (
+	// StopCompleted is a run of all its epochs
+	StopCompleted StopReason = iota
+	// StopEarly is a run stopped by early stopping
+	StopEarly
+	// StopMaxDuration is a run out of its time budget
+	StopMaxDuration
+	// StopInterrupted is a run stopped by its context or a callback, whose
+	// error TrainContext returns
+	StopInterrupted
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopCompleted:
+		return "completed"
+	case StopEarly:
+		return "early stopping"
+	case StopMaxDuration:
+		return "max duration"
+	case StopInterrupted:
+		return "interrupted"
+	}
+	return "unknown"
+}
+
+// deadline is the end of the time budget of a training run, if any
+type deadline struct {
+	end      time.Time
+	perBatch bool
+}
+
+// deadline returns the deadline of a training run started now
+func (o options) deadline() deadline {
+	if o.budget == nil {
+		return deadline{}
+	}
+	return deadline{end: time.Now().Add(o.budget.Duration), perBatch: o.budget.PerBatch}
+}
+
+// passed reports whether the budget is exhausted
+func (d deadline) passed() bool {
+	return !d.end.IsZero() && !time.Now().Before(d.end)
+}
+
+// batch reports whether the budget is exhausted and checked per batch
+func (d deadline) batch() bool {
+	return d.perBatch && d.passed()
+}
@@ -0,0 +1,126 @@
+package training
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TimeBudget(t *testing.T) {
+	type budgetTrainer interface {
+		TrainContext(ctx context.Context, n *deep.Neural, examples, validation Examples, iterations int) error
+		StopReason() StopReason
+		State() State
+	}
+	trainers := map[string]func(...Option) budgetTrainer{
+		"online": func(opts ...Option) budgetTrainer { return NewTrainer(NewSGD(0.1, 0, 0, false), 0, opts...) },
+		"batch":  func(opts ...Option) budgetTrainer { return NewBatchTrainer(NewSGD(0.1, 0, 0, false), 0, 1, 2, opts...) },
+	}
+	data := Examples{}
+	for i := 0.0; i < 1; i += 0.1 {
+		data = append(data, Example{Input: []float64{i}, Response: []float64{math.Sin(3 * i)}})
+	}
+	network := func() *deep.Neural {
+		rand.Seed(0)
+		return deep.NewNeural(&deep.Config{
+			Inputs:     1,
+			Layout:     []int{4, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(0.5, 0),
+			Bias:       true,
+		})
+	}
+
+	for name, trainer := range trainers {
+		// the first epoch ends past the budget
+		tr := trainer(WithMaxDuration(time.Nanosecond))
+		started := time.Now()
+		assert.NoError(t, tr.TrainContext(context.Background(), network(), data, nil, 1000000), name)
+		assert.True(t, time.Since(started) < time.Second, name)
+		assert.Equal(t, StopMaxDuration, tr.StopReason(), name)
+		assert.Equal(t, 1, tr.State().Epoch, name)
+
+		// and its batches, leaving it incomplete
+		n := network()
+		weights := n.Weights()
+		tr = trainer(WithTimeBudget(TimeBudget{Duration: time.Nanosecond, PerBatch: true}))
+		assert.NoError(t, tr.TrainContext(context.Background(), n, data, nil, 1000000), name)
+		assert.Equal(t, StopMaxDuration, tr.StopReason(), name)
+		assert.Equal(t, 0, tr.State().Epoch, name)
+		assert.Equal(t, weights, n.Weights(), name)
+
+		// an ample budget runs every epoch
+		tr = trainer(WithMaxDuration(time.Hour))
+		tr.TrainContext(context.Background(), network(), data, nil, 3)
+		assert.Equal(t, StopCompleted, tr.StopReason(), name)
+		assert.Equal(t, 3, tr.State().Epoch, name)
+	}
+}
+
+func Test_TimeBudgetComposition(t *testing.T) {
+	data := Examples{}
+	for i := 0.0; i < 1; i += 0.1 {
+		data = append(data, Example{Input: []float64{i}, Response: []float64{i}})
+	}
+	network := func() *deep.Neural {
+		rand.Seed(0)
+		return deep.NewNeural(&deep.Config{
+			Inputs:     1,
+			Layout:     []int{1},
+			Activation: deep.ActivationLinear,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(0.5, 0),
+		})
+	}
+	// the validation loss gets worse after the second epoch
+	var epochs int
+	worsen := CallbackFuncs{EpochEnd: func(epoch int, trainLoss, valLoss float64, n *deep.Neural) error {
+		if epochs++; epochs > 2 {
+			n.Layers[0].Neurons[0].In[0].Weight += 10
+		}
+		return nil
+	}}
+	stopping := WithEarlyStopping(EarlyStopping{Patience: 2, RestoreBest: true})
+
+	// early stopping wins over an ample budget
+	n := network()
+	tr := NewTrainer(NewSGD(0.1, 0, 0, false), 0, stopping, WithMaxDuration(time.Hour), WithCallbacks(worsen))
+	tr.Train(n, data, data, 100)
+	assert.Equal(t, StopEarly, tr.StopReason())
+	assert.Equal(t, 4, tr.StoppedEpoch())
+
+	// a budget stop still restores the best epoch
+	epochs = 0
+	var best [][][]float64
+	keep := CallbackFuncs{EpochEnd: func(epoch int, trainLoss, valLoss float64, n *deep.Neural) error {
+		switch epoch {
+		case 2:
+			best = n.Weights()
+		case 3:
+			time.Sleep(20 * time.Millisecond)
+		}
+		return nil
+	}}
+	n = network()
+	tr = NewTrainer(NewSGD(0.1, 0, 0, false), 0, stopping, WithMaxDuration(10*time.Millisecond),
+		WithCallbacks(keep, worsen))
+	tr.Train(n, data, data, 100)
+	assert.Equal(t, StopMaxDuration, tr.StopReason())
+	assert.Equal(t, 3, tr.State().Epoch)
+	assert.Equal(t, 2, tr.BestEpoch())
+	assert.Equal(t, best, n.Weights())
+
+	// interruptions are reported as such
+	tr = NewTrainer(NewSGD(0.1, 0, 0, false), 0, WithCallbacks(CallbackFuncs{
+		EpochEnd: func(int, float64, float64, *deep.Neural) error { return errors.New("stop") },
+	}))
+	tr.Train(network(), data, nil, 10)
+	assert.Equal(t, StopInterrupted, tr.StopReason())
+}
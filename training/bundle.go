@@ -0,0 +1,182 @@
+package training
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+
+	deep "github.com/patrikeh/go-deep"
+)
+
+// bundleVersion is the version of the bundles written by Save
+const bundleVersion = 1
+
+// Bundle is all the state of a training run after some epochs: the network,
+// the solver, the trainer and the source of WithSeed, from which training
+// is resumed exactly by WithBundle, as if it had not been interrupted.
+type Bundle struct {
+	Network *deep.Dump
+	// Solver is the type of the solver, and SolverState its state
+	Solver      string
+	SolverState json.RawMessage
+	// Trainer is the state of the trainer, including the seed of
+	// WithSeed and the number of values drawn from its source
+	Trainer State
+}
+
+// bundleSection is a section of a saved bundle, checked by its SHA-256
+type bundleSection struct {
+	Name   string
+	SHA256 string
+	Data   json.RawMessage
+}
+
+// NewBundle returns the bundle of n trained by solver, at the state of the
+// trainer, as returned by State after training
+func NewBundle(n *deep.Neural, solver StatefulSolver, state State) (*Bundle, error) {
+	solverState, err := solver.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &Bundle{
+		Network:     n.Dump(),
+		Solver:      fmt.Sprintf("%T", solver),
+		SolverState: solverState,
+		Trainer:     state,
+	}, nil
+}
+
+// Neural restores the network of b
+func (b *Bundle) Neural() *deep.Neural {
+	return deep.FromDump(b.Network)
+}
+
+// Save writes b to w as JSON, in sections of the network, solver and
+// trainer, each with a checksum
+func (b *Bundle) Save(w io.Writer) error {
+	container := struct {
+		Version  int
+		Sections []bundleSection
+	}{Version: bundleVersion}
+	for _, s := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"network", b.Network},
+		{"solver", struct {
+			Type  string
+			State json.RawMessage
+		}{b.Solver, b.SolverState}},
+		{"trainer", b.Trainer},
+	} {
+		data, err := json.Marshal(s.value)
+		if err != nil {
+			return fmt.Errorf("bundle section %s: %v", s.name, err)
+		}
+		sum := sha256.Sum256(data)
+		container.Sections = append(container.Sections, bundleSection{Name: s.name, SHA256: hex.EncodeToString(sum[:]), Data: data})
+	}
+	return json.NewEncoder(w).Encode(container)
+}
+
+// LoadBundle reads a bundle written by Save from r, checking each section
+// by its checksum and validating the network
+func LoadBundle(r io.Reader) (*Bundle, error) {
+	var container struct {
+		Version  int
+		Sections []bundleSection
+	}
+	if err := json.NewDecoder(r).Decode(&container); err != nil {
+		return nil, err
+	}
+	if container.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", container.Version)
+	}
+	sections := map[string]json.RawMessage{}
+	for _, s := range container.Sections {
+		sum := sha256.Sum256(s.Data)
+		if hex.EncodeToString(sum[:]) != s.SHA256 {
+			return nil, fmt.Errorf("bundle section %s fails its checksum", s.Name)
+		}
+		sections[s.Name] = s.Data
+	}
+
+	var b Bundle
+	var solver struct {
+		Type  string
+		State json.RawMessage
+	}
+	for _, s := range []struct {
+		name  string
+		value interface{}
+	}{{"network", &b.Network}, {"solver", &solver}, {"trainer", &b.Trainer}} {
+		data, ok := sections[s.name]
+		if !ok {
+			return nil, fmt.Errorf("missing bundle section %s", s.name)
+		}
+		if err := json.Unmarshal(data, s.value); err != nil {
+			return nil, fmt.Errorf("bundle section %s: %v", s.name, err)
+		}
+	}
+	b.Solver, b.SolverState = solver.Type, solver.State
+
+	if b.Network == nil || b.Network.Config == nil {
+		return nil, fmt.Errorf("missing network")
+	}
+	if err := b.Network.Migrate(); err != nil {
+		return nil, err
+	}
+	if err := b.Network.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid bundle network: %w", err)
+	}
+	return &b, nil
+}
+
+// WithBundle resumes training exactly from b: the solver, which must be of
+// the type bundled, is restored from b, the trainer continues from its
+// state and the source of WithSeed, if it was seeded, is restored. The
+// network passed to Train is expected to be restored from b, and must be
+// of its shape.
+func WithBundle(b *Bundle) Option {
+	return func(o *options) {
+		o.bundle = b
+		o.checkpoint = &Checkpoint{Network: b.Network, Solver: b.SolverState, Epoch: b.Trainer.Epoch, Trainer: &b.Trainer}
+		o.state = &b.Trainer
+		if b.Trainer.Seed != nil {
+			o.source = newCountingSource(*b.Trainer.Seed)
+			o.rand = rand.New(o.source)
+			o.seed = b.Trainer.Seed
+		}
+	}
+}
+
+// check panics unless solver and n are of the type and shape of b
+func (b *Bundle) check(solver Solver, n *deep.Neural) {
+	if t := fmt.Sprintf("%T", solver); t != b.Solver {
+		panic(fmt.Sprintf("training: bundle of a %s solver, not %s", b.Solver, t))
+	}
+	if !sameShape(n.Weights(), b.Network.Weights) {
+		panic("training: network is not of the shape of the bundle")
+	}
+}
+
+// sameShape reports whether the weights a and b are of the same shape
+func sameShape(a, b [][][]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if len(a[i][j]) != len(b[i][j]) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+package training
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Bundle(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	data := Examples{}
+	for i := 0; i < 24; i++ {
+		x, y := r.Float64(), r.Float64()
+		data = append(data, Example{Input: []float64{x, y}, Response: []float64{x * y}})
+	}
+	network := func() *deep.Neural {
+		return deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{5, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(1, 0),
+			Bias:       true,
+			Seed:       3,
+		})
+	}
+	type trainer interface {
+		Trainer
+		State() State
+	}
+	trainers := map[string]func(Solver, ...Option) trainer{
+		"online": func(s Solver, opts ...Option) trainer { return NewTrainer(s, 0, opts...) },
+		"batch":  func(s Solver, opts ...Option) trainer { return NewBatchTrainer(s, 0, 5, 2, opts...) },
+	}
+	options := func(opts ...Option) []Option {
+		return append([]Option{
+			WithScheduler(&ReduceLROnPlateau{Factor: 0.5, Patience: 3}),
+			WithEarlyStopping(EarlyStopping{Patience: 100}),
+		}, opts...)
+	}
+
+	for name, newTrainer := range trainers {
+		n := network()
+		newTrainer(NewAdam(0.01, 0, 0, 0), options(WithSeed(5))...).Train(n, data, data, 60)
+
+		// interrupted at epoch 37, saved and resumed without WithSeed
+		m, solver := network(), NewAdam(0.01, 0, 0, 0)
+		interrupted := newTrainer(solver, options(WithSeed(5))...)
+		interrupted.Train(m, data, data, 37)
+		b, err := NewBundle(m, solver, interrupted.State())
+		assert.NoError(t, err)
+		var buf bytes.Buffer
+		assert.NoError(t, b.Save(&buf))
+		b, err = LoadBundle(&buf)
+		assert.NoError(t, err)
+
+		resumed := b.Neural()
+		resumer := newTrainer(NewAdam(0.01, 0, 0, 0), options(WithBundle(b))...)
+		resumer.Train(resumed, data, data, 23)
+		assert.Equal(t, n.Weights(), resumed.Weights(), name)
+		assert.Equal(t, 60, resumer.State().Epoch, name)
+
+		// the solver and the network must be those bundled
+		assert.Panics(t, func() {
+			newTrainer(NewSGD(0.01, 0, 0, false), WithBundle(b)).Train(b.Neural(), data, data, 1)
+		}, name)
+		other := deep.NewNeural(&deep.Config{Inputs: 2, Layout: []int{4, 1}, Mode: deep.ModeRegression, Bias: true})
+		assert.Panics(t, func() {
+			newTrainer(NewAdam(0.01, 0, 0, 0), WithBundle(b)).Train(other, data, data, 1)
+		}, name)
+	}
+}
+
+func Test_LoadBundle(t *testing.T) {
+	rand.Seed(0)
+	n := deep.NewNeural(&deep.Config{Inputs: 2, Layout: []int{3, 1}, Mode: deep.ModeBinary, Bias: true})
+	solver := NewAdam(0.01, 0, 0, 0)
+	NewTrainer(solver, 0).Train(n, Examples{{Input: []float64{1, 0}, Response: []float64{1}}}, nil, 2)
+	b, err := NewBundle(n, solver, State{Epoch: 2})
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, b.Save(&buf))
+	saved := buf.String()
+
+	restored, err := LoadBundle(strings.NewReader(saved))
+	assert.NoError(t, err)
+	assert.Equal(t, "*training.Adam", restored.Solver)
+	assert.Equal(t, n.Weights(), restored.Neural().Weights())
+
+	// a change to any section fails its checksum
+	corrupted := strings.Replace(saved, `"Epoch":2`, `"Epoch":3`, 1)
+	_, err = LoadBundle(strings.NewReader(corrupted))
+	assert.EqualError(t, err, "bundle section trainer fails its checksum")
+	corrupted = strings.Replace(saved, `"Inputs":2`, `"Inputs":3`, 1)
+	_, err = LoadBundle(strings.NewReader(corrupted))
+	assert.EqualError(t, err, "bundle section network fails its checksum")
+	_, err = LoadBundle(strings.NewReader(`{"Version":1,"Sections":[]}`))
+	assert.EqualError(t, err, "missing bundle section network")
+}
+
+func Test_BundleDraws(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	data := Examples{}
+	for i := 0; i < 16; i++ {
+		x, y := r.Float64(), r.Float64()
+		data = append(data, Example{Input: []float64{x, y}, Response: []float64{x + y}})
+	}
+	// augmenters and dropout draw from the source of WithSeed between the
+	// shuffles, by as many values as they happen to
+	runs := map[string]struct {
+		batch   bool
+		dropout []float64
+		opts    []Option
+	}{
+		"noise":         {opts: []Option{WithAugmenter(GaussianNoise{StdDev: 0.01})}},
+		"input":         {opts: []Option{WithAugmenter(InputDropout{P: 0.3})}},
+		"dropout":       {dropout: []float64{0.3, 0}},
+		"batch noise":   {batch: true, opts: []Option{WithAugmenter(GaussianNoise{StdDev: 0.01})}},
+		"batch dropout": {batch: true, dropout: []float64{0.3, 0}},
+	}
+	for name, run := range runs {
+		network := func() *deep.Neural {
+			return deep.NewNeural(&deep.Config{
+				Inputs:     2,
+				Layout:     []int{4, 1},
+				Activation: deep.ActivationTanh,
+				Mode:       deep.ModeRegression,
+				Weight:     deep.NewNormal(1, 0),
+				Bias:       true,
+				Dropout:    run.dropout,
+				Seed:       1,
+			})
+		}
+		newTrainer := func(s Solver, opts ...Option) interface {
+			Trainer
+			State() State
+		} {
+			opts = append(append([]Option{}, run.opts...), opts...)
+			if run.batch {
+				return NewBatchTrainer(s, 0, 4, 2, opts...)
+			}
+			return NewTrainer(s, 0, opts...)
+		}
+
+		n := network()
+		newTrainer(NewSGD(0.01, 0, 0, false), WithSeed(7)).Train(n, data, nil, 10)
+
+		m, solver := network(), NewSGD(0.01, 0, 0, false)
+		interrupted := newTrainer(solver, WithSeed(7))
+		interrupted.Train(m, data, nil, 5)
+		assert.True(t, interrupted.State().Draws > int64(interrupted.State().Shuffles), name)
+		b, err := NewBundle(m, solver, interrupted.State())
+		assert.NoError(t, err)
+		resumed := b.Neural()
+		newTrainer(NewSGD(0.01, 0, 0, false), WithBundle(b)).Train(resumed, data, nil, 5)
+		assert.Equal(t, n.Weights(), resumed.Weights(), name)
+	}
+}
@@ -0,0 +1,129 @@
+package training
+
+import (
+	"math"
+
+	deep "github.com/patrikeh/go-deep"
+)
+
+// Callback is told of the progress of training
+type Callback interface {
+	// OnEpochEnd is called after every epoch with the loss of the network
+	// on the training examples and on the validation set, NaN without
+	// either, as for an ExampleSource.
+	// An error stops training.
+	OnEpochEnd(epoch int, trainLoss, valLoss float64, n *deep.Neural) error
+	// OnTrainEnd is called once training ends, after the last completed
+	// epoch, with the error of the callback that stopped it if any
+	OnTrainEnd(epoch int, n *deep.Neural, err error)
+}
+
+// CallbackFuncs is a Callback of optional functions
+type CallbackFuncs struct {
+	EpochEnd func(epoch int, trainLoss, valLoss float64, n *deep.Neural) error
+	TrainEnd func(epoch int, n *deep.Neural, err error)
+}
+
+// OnEpochEnd calls EpochEnd, if any
+func (c CallbackFuncs) OnEpochEnd(epoch int, trainLoss, valLoss float64, n *deep.Neural) error {
+	if c.EpochEnd == nil {
+		return nil
+	}
+	return c.EpochEnd(epoch, trainLoss, valLoss, n)
+}
+
+// OnTrainEnd calls TrainEnd, if any
+func (c CallbackFuncs) OnTrainEnd(epoch int, n *deep.Neural, err error) {
+	if c.TrainEnd != nil {
+		c.TrainEnd(epoch, n, err)
+	}
+}
+
+// WithCallbacks adds callbacks to training, which are called in order
+// after those added before
+func WithCallbacks(callbacks ...Callback) Option {
+	return func(o *options) {
+		o.callbacks = append(o.callbacks, callbacks...)
+	}
+}
+
+// periodic is implemented by callbacks that skip some epochs, for which
+// the losses need not be computed
+type periodic interface {
+	skips(epoch int) bool
+}
+
+// callbacks are the callbacks of a training run
+type callbacks struct {
+	list              []Callback
+	loss              deep.Loss
+	metrics           []Metric
+	train, validation Examples
+}
+
+// newCallbacks returns the callbacks of a training run of n by solver: its
+// logging if verbosity is positive and its events if any, followed by
+// those of o
+func newCallbacks(o options, printer *StatsPrinter, verbosity int, n *deep.Neural, solver Solver, loss deep.Loss, train, validation Examples) callbacks {
+	c := callbacks{loss: loss, metrics: o.metrics, train: train, validation: validation}
+	if l := newLogging(o, printer, verbosity, n, solver, validation); l != nil {
+		c.list = append(c.list, l)
+	}
+	if h := o.newHistory(n, solver, validation); h != nil {
+		c.list = append(c.list, h)
+	}
+	if o.events != nil {
+		c.list = append(c.list, &eventing{events: o.events, metrics: o.metrics})
+	}
+	for _, cb := range o.callbacks {
+		if e, ok := cb.(emitter); ok {
+			e.setEvents(o.events)
+		}
+	}
+	c.list = append(c.list, o.callbacks...)
+	return c
+}
+
+// epochEnd calls the callbacks after epoch in order, and returns the first
+// error
+func (c callbacks) epochEnd(n *deep.Neural, epoch int) error {
+	var needed bool
+	for _, cb := range c.list {
+		if p, ok := cb.(periodic); !ok || !p.skips(epoch) {
+			needed = true
+		}
+	}
+	if !needed {
+		return nil
+	}
+	trainLoss, valLoss := math.NaN(), math.NaN()
+	if len(c.train) > 0 {
+		trainLoss = validationLoss(n, c.loss, c.train)
+	}
+	if len(c.validation) > 0 {
+		valLoss = validationLoss(n, c.loss, c.validation)
+	}
+	var trainMetrics, valMetrics []float64
+	if len(c.metrics) > 0 {
+		trainMetrics, valMetrics = evaluate(n, c.metrics, c.train), evaluate(n, c.metrics, c.validation)
+	}
+	for _, cb := range c.list {
+		if p, ok := cb.(periodic); ok && p.skips(epoch) {
+			continue
+		}
+		if m, ok := cb.(MetricCallback); ok {
+			m.OnMetrics(epoch, trainMetrics, valMetrics)
+		}
+		if err := cb.OnEpochEnd(epoch, trainLoss, valLoss, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trainEnd calls the callbacks once training ends after epoch
+func (c callbacks) trainEnd(n *deep.Neural, epoch int, err error) {
+	for _, cb := range c.list {
+		cb.OnTrainEnd(epoch, n, err)
+	}
+}
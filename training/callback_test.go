@@ -0,0 +1,106 @@
+package training
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"text/tabwriter"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Callbacks(t *testing.T) {
+	data := Examples{
+		{Input: []float64{0}, Response: []float64{0}},
+		{Input: []float64{1}, Response: []float64{1}},
+	}
+	network := func() *deep.Neural {
+		rand.Seed(0)
+		return deep.NewNeural(&deep.Config{
+			Inputs: 1,
+			Layout: []int{1},
+			Mode:   deep.ModeRegression,
+			Weight: deep.NewNormal(0.5, 0),
+		})
+	}
+	var calls []string
+	recorder := func(name string, failAt int) Callback {
+		return CallbackFuncs{
+			EpochEnd: func(epoch int, trainLoss, valLoss float64, n *deep.Neural) error {
+				calls = append(calls, fmt.Sprintf("%s%d", name, epoch))
+				assert.InDelta(t, validationLoss(n, nil, data), trainLoss, 1e-12)
+				assert.True(t, math.IsNaN(valLoss))
+				if epoch == failAt {
+					return errors.New("stop")
+				}
+				return nil
+			},
+			TrainEnd: func(epoch int, n *deep.Neural, err error) {
+				calls = append(calls, fmt.Sprintf("%s end %d %v", name, epoch, err))
+			},
+		}
+	}
+
+	for _, trainer := range []func(...Option) Trainer{
+		func(opts ...Option) Trainer { return NewTrainer(NewSGD(0.1, 0, 0, false), 0, opts...) },
+		func(opts ...Option) Trainer { return NewBatchTrainer(NewSGD(0.1, 0, 0, false), 0, 2, 2, opts...) },
+	} {
+		calls = nil
+		trainer(WithCallbacks(recorder("a", 0)), WithCallbacks(recorder("b", 0))).Train(network(), data, nil, 3)
+		assert.Equal(t, []string{"a1", "b1", "a2", "b2", "a3", "b3", "a end 3 <nil>", "b end 3 <nil>"}, calls)
+
+		// an error stops training before the later callbacks of the epoch
+		calls = nil
+		trainer(WithCallbacks(recorder("a", 2), recorder("b", 0))).Train(network(), data, nil, 5)
+		assert.Equal(t, []string{"a1", "b1", "a2", "a end 2 stop", "b end 2 stop"}, calls)
+	}
+
+	// validation losses are those of the validation set
+	var losses []float64
+	NewTrainer(NewSGD(0.1, 0, 0, false), 0, WithCallbacks(CallbackFuncs{
+		EpochEnd: func(epoch int, trainLoss, valLoss float64, n *deep.Neural) error {
+			losses = append(losses, valLoss)
+			assert.InDelta(t, validationLoss(n, nil, data[:1]), valLoss, 1e-12)
+			return nil
+		},
+	})).Train(network(), data, data[:1], 2)
+	assert.Len(t, losses, 2)
+}
+
+func Test_PrinterCallback(t *testing.T) {
+	data := Examples{
+		{Input: []float64{0}, Response: []float64{0}},
+		{Input: []float64{1}, Response: []float64{1}},
+	}
+	rand.Seed(0)
+	n := deep.NewNeural(&deep.Config{
+		Inputs: 1,
+		Layout: []int{1},
+		Mode:   deep.ModeRegression,
+		Weight: deep.NewNormal(0.5, 0),
+	})
+	var epochs []int
+	trainer := NewTrainer(NewSGD(0.1, 0, 0, false), 3, WithCallbacks(CallbackFuncs{
+		EpochEnd: func(epoch int, trainLoss, valLoss float64, n *deep.Neural) error {
+			epochs = append(epochs, epoch)
+			return nil
+		},
+	}))
+	var buf bytes.Buffer
+	trainer.printer.w = tabwriter.NewWriter(&buf, 16, 0, 3, ' ', 0)
+	trainer.Train(n, data, data, 10)
+
+	// the header and every third epoch
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2+3)
+	for i, epoch := range []string{"3", "6", "9"} {
+		assert.Equal(t, epoch, strings.Fields(lines[2+i])[0])
+	}
+	// other callbacks are called after every epoch
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, epochs)
+}
@@ -0,0 +1,97 @@
+package training
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	deep "github.com/patrikeh/go-deep"
+)
+
+// Checkpoint is the state of a training run after some epochs, from which
+// training can be resumed by WithCheckpoint
+type Checkpoint struct {
+	Network *deep.Dump
+	Solver  json.RawMessage
+	// Epoch is the number of completed epochs
+	Epoch int
+	// Trainer is the state of the trainer, if saved, see WithState
+	Trainer *State `json:",omitempty"`
+}
+
+// NewCheckpoint returns a checkpoint of n trained by solver for epoch epochs
+func NewCheckpoint(n *deep.Neural, solver StatefulSolver, epoch int) (*Checkpoint, error) {
+	state, err := solver.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &Checkpoint{Network: n.Dump(), Solver: state, Epoch: epoch}, nil
+}
+
+// SaveCheckpoint writes c to w as JSON
+func SaveCheckpoint(w io.Writer, c *Checkpoint) error {
+	return json.NewEncoder(w).Encode(c)
+}
+
+// LoadCheckpoint reads a checkpoint written by SaveCheckpoint from r
+func LoadCheckpoint(r io.Reader) (*Checkpoint, error) {
+	var c Checkpoint
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, err
+	}
+	if c.Network == nil || c.Network.Config == nil {
+		return nil, fmt.Errorf("missing network")
+	}
+	if err := c.Network.Migrate(); err != nil {
+		return nil, err
+	}
+	if err := c.Network.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid network: %w", err)
+	}
+	return &c, nil
+}
+
+// Neural restores the network of c
+func (c *Checkpoint) Neural() *deep.Neural {
+	return deep.FromDump(c.Network)
+}
+
+// WithCheckpoint resumes training from c: the solver, which must be a
+// StatefulSolver configured like the one checkpointed, is restored from c
+// rather than initialized, and epochs are counted from c.Epoch. The network
+// passed to Train is expected to be restored from c. Schedules by iteration
+// restart, as the number of updates is not checkpointed, unless c holds
+// the state of the trainer, from which training is resumed by WithState.
+func WithCheckpoint(c *Checkpoint) Option {
+	return func(o *options) {
+		o.checkpoint = c
+		if c.Trainer != nil {
+			o.state = c.Trainer
+		}
+	}
+}
+
+// resume initializes solver for n, restoring it from the checkpoint if
+// any, and returns the number of completed epochs
+func (o options) resume(solver Solver, n *deep.Neural) int {
+	if o.bundle != nil {
+		o.bundle.check(solver, n)
+	}
+	initSolver(solver, n)
+	if o.checkpoint != nil {
+		s, ok := solver.(StatefulSolver)
+		if !ok {
+			panic("training: solver does not support checkpoints")
+		}
+		if err := s.Unmarshal(o.checkpoint.Solver); err != nil {
+			panic(fmt.Sprintf("training: invalid checkpoint: %s", err))
+		}
+	}
+	switch {
+	case o.state != nil:
+		return o.state.Epoch
+	case o.checkpoint != nil:
+		return o.checkpoint.Epoch
+	}
+	return 0
+}
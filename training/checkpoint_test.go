@@ -0,0 +1,124 @@
+package training
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+// trajectory records the validation loss after every epoch
+type trajectory []float64
+
+func (s *trajectory) LR(epoch, iteration int, base float64) float64 { return base }
+func (s *trajectory) Observe(epoch int, loss float64)               { *s = append(*s, loss) }
+
+func Test_Checkpoint(t *testing.T) {
+	// the examples are not shuffled, such that every run sees them in the
+	// same order, over several batches
+	data := Examples{
+		{Input: []float64{0, 1}, Response: []float64{1}},
+		{Input: []float64{1, 1}, Response: []float64{0}},
+		{Input: []float64{1, 0}, Response: []float64{1}},
+		{Input: []float64{0, 0}, Response: []float64{0}},
+		{Input: []float64{0.5, 1}, Response: []float64{1}},
+		{Input: []float64{1, 0.5}, Response: []float64{0}},
+	}
+	network := func() *deep.Neural {
+		rand.Seed(0)
+		return deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{4, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeBinary,
+			Weight:     deep.NewNormal(1, 0),
+			Bias:       true,
+		})
+	}
+	solvers := map[string]func() StatefulSolver{
+		"sgd":     func() StatefulSolver { return NewSGD(0.1, 0.9, 0, true) },
+		"adam":    func() StatefulSolver { return NewAdam(0.01, 0, 0, 0) },
+		"amsgrad": func() StatefulSolver { return NewAMSGrad(0.01, 0, 0, 0) },
+		"adamw":   func() StatefulSolver { return NewAdamW(0.01, 0, 0, 0, 0) },
+		"rmsprop": func() StatefulSolver { return NewRMSProp(0.01, 0, 0) },
+		"adagrad": func() StatefulSolver { return NewAdaGrad(0.1, 0) },
+	}
+	trainers := map[string]func(Solver, ...Option) Trainer{
+		"online": func(s Solver, opts ...Option) Trainer {
+			return NewTrainer(s, 0, append(opts, WithShuffle(false))...)
+		},
+		"batch": func(s Solver, opts ...Option) Trainer {
+			return NewBatchTrainer(s, 0, 2, 1, append(opts, WithShuffle(false))...)
+		},
+	}
+
+	for tname, trainer := range trainers {
+		for sname, solver := range solvers {
+			uninterrupted := &trajectory{}
+			n := network()
+			trainer(solver(), WithScheduler(uninterrupted)).Train(n, data, data, 20)
+
+			interrupted := &trajectory{}
+			m, s := network(), solver()
+			trainer(s, WithScheduler(interrupted)).Train(m, data, data, 10)
+			c, err := NewCheckpoint(m, s, 10)
+			assert.NoError(t, err)
+			var buf bytes.Buffer
+			assert.NoError(t, SaveCheckpoint(&buf, c))
+
+			c, err = LoadCheckpoint(&buf)
+			assert.NoError(t, err)
+			assert.Equal(t, 10, c.Epoch)
+			resumed := c.Neural()
+			trainer(solver(), WithScheduler(interrupted), WithCheckpoint(c)).Train(resumed, data, data, 10)
+
+			assert.Equal(t, *uninterrupted, *interrupted, tname+" "+sname)
+			assert.Equal(t, n.Weights(), resumed.Weights(), tname+" "+sname)
+
+			// the solver state matters
+			fresh := &trajectory{}
+			resumed = c.Neural()
+			trainer(solver(), WithScheduler(fresh)).Train(resumed, data, data, 10)
+			assert.NotEqual(t, (*uninterrupted)[10:], *fresh, tname+" "+sname)
+		}
+	}
+}
+
+func Test_CheckpointErrors(t *testing.T) {
+	_, err := LoadCheckpoint(bytes.NewBufferString(`{"Epoch": 1}`))
+	assert.Error(t, err)
+	_, err = LoadCheckpoint(bytes.NewBufferString(`{`))
+	assert.Error(t, err)
+
+	n := deep.NewNeural(&deep.Config{Inputs: 1, Layout: []int{1}, Mode: deep.ModeRegression})
+	c, err := NewCheckpoint(n, NewAdam(0, 0, 0, 0), 1)
+	assert.NoError(t, err)
+	assert.Panics(t, func() {
+		NewTrainer(solverFunc(nil), 0, WithCheckpoint(c)).
+			Train(n, Examples{{Input: []float64{1}, Response: []float64{1}}}, nil, 1)
+	})
+	assert.Error(t, NewAMSGrad(0, 0, 0, 0).Unmarshal([]byte(`{"M": [0], "V": [0]}`)))
+
+	// the state of a solver that was never initialized, or was initialized
+	// for another network, does not fit n
+	data := Examples{{Input: []float64{1}, Response: []float64{1}}}
+	c, err = NewCheckpoint(n, NewSGD(0.1, 0.9, 0, false), 0)
+	assert.NoError(t, err)
+	assert.Panics(t, func() {
+		NewTrainer(NewSGD(0.1, 0.9, 0, false), 0, WithCheckpoint(c)).Train(n, data, nil, 1)
+	})
+	other := deep.NewNeural(&deep.Config{Inputs: 1, Layout: []int{2, 1}, Mode: deep.ModeRegression})
+	s := NewAdam(0, 0, 0, 0)
+	NewTrainer(s, 0).Train(other, data, nil, 1)
+	c, err = NewCheckpoint(other, s, 1)
+	assert.NoError(t, err)
+	assert.Panics(t, func() {
+		NewBatchTrainer(NewAdam(0, 0, 0, 0), 0, 1, 1, WithCheckpoint(c)).Train(n, data, nil, 1)
+	})
+	sgd := NewSGD(0, 0, 0, false)
+	sgd.Init(2)
+	assert.Error(t, sgd.Unmarshal([]byte(`{"Moments": [0]}`)))
+	assert.NoError(t, sgd.Unmarshal([]byte(`{"Moments": [0, 1]}`)))
+}
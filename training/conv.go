@@ -0,0 +1,97 @@
+package training
+
+import (
+	deep "github.com/patrikeh/go-deep"
+)
+
+// convGradients are the gradients of the kernels and biases of the
+// convolution of a network, empty without
+type convGradients struct {
+	kernels [][]float64
+	biases  []float64
+	// outputs are the gradients of the outputs of the convolution
+	outputs []float64
+}
+
+func newConvGradients(n *deep.Neural) convGradients {
+	if n.Conv == nil {
+		return convGradients{}
+	}
+	g := convGradients{
+		kernels: make([][]float64, len(n.Conv.Kernels)),
+		biases:  make([]float64, len(n.Conv.Biases)),
+		outputs: make([]float64, len(n.Layers[0].Neurons[0].In)),
+	}
+	for f, kernel := range n.Conv.Kernels {
+		g.kernels[f] = make([]float64, len(kernel))
+	}
+	return g
+}
+
+// backward adds the gradients of the last forward pass of n, given the
+// deltas of its first layer
+func (g convGradients) backward(n *deep.Neural, deltas []float64) {
+	if n.Conv == nil || n.Layers[0].Frozen {
+		return
+	}
+	for q := range g.outputs {
+		g.outputs[q] = 0
+	}
+	for j, neuron := range n.Layers[0].Neurons {
+		for q := range g.outputs {
+			g.outputs[q] += neuron.In[q].Weight * deltas[j]
+		}
+	}
+	n.Conv.Backward(g.outputs, g.kernels, g.biases)
+}
+
+// add adds the gradients of other to g and zeroes other
+func (g convGradients) add(other convGradients) {
+	for f, kernel := range g.kernels {
+		for k := range kernel {
+			kernel[k] += other.kernels[f][k]
+			other.kernels[f][k] = 0
+		}
+	}
+	for f := range g.biases {
+		g.biases[f] += other.biases[f]
+		other.biases[f] = 0
+	}
+}
+
+// squared returns the squared L2 norm of the gradients divided by weights
+func (g convGradients) squared(weights float64) float64 {
+	var squared float64
+	for _, kernel := range g.kernels {
+		for _, v := range kernel {
+			squared += (v / weights) * (v / weights)
+		}
+	}
+	for _, v := range g.biases {
+		squared += (v / weights) * (v / weights)
+	}
+	return squared
+}
+
+// apply updates the kernels and biases of the convolution of n by the
+// gradients divided by weights, from solver index idx on, and zeroes the
+// gradients. The convolution shares the learning rate multiplier of the
+// first layer, and is frozen with it.
+func (g convGradients) apply(n *deep.Neural, solver Solver, opts options, it, idx int, weights, scale float64) {
+	if n.Conv == nil || n.Layers[0].Frozen {
+		return
+	}
+	for f, kernel := range n.Conv.Kernels {
+		for k, w := range kernel {
+			update := solver.Update(w, opts.clip(g.kernels[f][k]/weights, scale)+n.Config.Penalty(w), it, idx)
+			kernel[k] += opts.lr(0) * update
+			g.kernels[f][k] = 0
+			idx++
+		}
+	}
+	for f, b := range n.Conv.Biases {
+		n.Conv.Biases[f] += opts.lr(0) * solver.Update(b, opts.clip(g.biases[f]/weights, scale), it, idx)
+		g.biases[f] = 0
+		idx++
+	}
+}
@@ -0,0 +1,142 @@
+package training
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	deep "github.com/patrikeh/go-deep"
+)
+
+// Fold is the evaluation of the network trained on all but one fold of a
+// cross validation, on the held-out fold
+type Fold struct {
+	// Size is the number of held-out examples
+	Size int
+	Loss float64
+	// Accuracy is the fraction of held-out examples classified correctly,
+	// for ModeMultiClass and ModeBinary, otherwise zero
+	Accuracy float64
+}
+
+// CVResult is the result of a cross validation
+type CVResult struct {
+	Folds                     []Fold
+	MeanLoss, StdLoss         float64
+	MeanAccuracy, StdAccuracy float64
+}
+
+// CVOption configures a cross validation
+type CVOption func(*cvOptions)
+
+type cvOptions struct {
+	stratified bool
+	rand       *rand.Rand
+}
+
+// WithStratifiedFolds deals the examples of each class, by the argmax of
+// the response or the label of a single binary response, evenly to the
+// folds, so that small folds do not miss classes
+func WithStratifiedFolds() CVOption {
+	return func(o *cvOptions) {
+		o.stratified = true
+	}
+}
+
+// WithFoldSeed partitions the examples by a source of its own seeded by
+// seed rather than the global source, for reproducible folds. Seeding cfg
+// and the trainers too, see deep.Config.Seed and WithSeed, makes the whole
+// cross validation reproducible.
+func WithFoldSeed(seed int64) CVOption {
+	return func(o *cvOptions) {
+		o.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// CrossValidate partitions examples at random into k folds, and for each
+// fold trains a new network of cfg by a new trainer of newTrainer for
+// iterations epochs on the other folds, then evaluates it on the fold by
+// the loss of cfg, and by accuracy for classification modes. It panics if
+// k is not in [2, len(examples)].
+func CrossValidate(cfg deep.Config, examples Examples, k int, newTrainer func() Trainer, iterations int, opts ...CVOption) CVResult {
+	if k < 2 || k > len(examples) {
+		panic(fmt.Sprintf("training: invalid cross validation of %d folds of %d examples", k, len(examples)))
+	}
+	var o cvOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	folds := partition(examples, k, o.stratified, o.rand)
+	result := CVResult{Folds: make([]Fold, k)}
+	for i, test := range folds {
+		var train Examples
+		for j, fold := range folds {
+			if j != i {
+				train = append(train, fold...)
+			}
+		}
+		c := cfg.Clone()
+		n := deep.NewNeural(c)
+		newTrainer().Train(n, train, nil, iterations)
+
+		result.Folds[i] = Fold{Size: len(test), Loss: validationLoss(n, nil, test)}
+		switch c.Mode {
+		case deep.ModeMultiClass, deep.ModeBinary:
+			result.Folds[i].Accuracy = classAccuracy(n, test)
+		}
+	}
+
+	losses, accuracies := make([]float64, k), make([]float64, k)
+	for i, f := range result.Folds {
+		losses[i], accuracies[i] = f.Loss, f.Accuracy
+	}
+	result.MeanLoss, result.StdLoss = meanStd(losses)
+	result.MeanAccuracy, result.StdAccuracy = meanStd(accuracies)
+	return result
+}
+
+// partition deals a copy of examples shuffled by r, or the global source if
+// r is nil, into k folds, whose sizes differ by at most one, by class if
+// stratified
+func partition(examples Examples, k int, stratified bool, r *rand.Rand) []Examples {
+	shuffled := make(Examples, len(examples))
+	copy(shuffled, examples)
+	shuffled.ShuffleWith(r)
+
+	groups := []Examples{shuffled}
+	if stratified {
+		groups = shuffled.classes()
+	}
+	folds := make([]Examples, k)
+	var dealt int
+	for _, g := range groups {
+		for _, e := range g {
+			folds[dealt%k] = append(folds[dealt%k], e)
+			dealt++
+		}
+	}
+	return folds
+}
+
+// classAccuracy is the fraction of examples whose class n predicts
+func classAccuracy(n *deep.Neural, examples Examples) float64 {
+	var correct int
+	for _, e := range examples {
+		if (Example{Response: n.Predict(e.Input)}).class() == e.class() {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(examples))
+}
+
+// meanStd returns the mean and standard deviation of values
+func meanStd(values []float64) (mean, std float64) {
+	for _, v := range values {
+		mean += v / float64(len(values))
+	}
+	for _, v := range values {
+		std += (v - mean) * (v - mean) / float64(len(values))
+	}
+	return mean, math.Sqrt(std)
+}
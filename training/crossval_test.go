@@ -0,0 +1,126 @@
+package training
+
+import (
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+// labelled returns examples of points, labelled 1 above the diagonal, of
+// which one in ten is positive
+func labelled(size int) Examples {
+	var examples Examples
+	for i := 0; i < size; i++ {
+		x, y := rand.Float64(), rand.Float64()
+		label := 0.0
+		if i%10 == 0 {
+			x, y, label = x/2, 0.5+y/2, 1
+		} else if y > x {
+			x, y = y, x
+		}
+		examples = append(examples, Example{Input: []float64{x, y}, Response: []float64{label}})
+	}
+	return examples
+}
+
+func Test_Partition(t *testing.T) {
+	rand.Seed(0)
+	examples := labelled(43)
+	for _, stratified := range []bool{false, true} {
+		folds := partition(examples, 5, stratified, nil)
+		assert.Len(t, folds, 5)
+
+		seen := make(map[*float64]bool)
+		for _, fold := range folds {
+			assert.True(t, len(fold) == 8 || len(fold) == 9, "%d", len(fold))
+			for _, e := range fold {
+				assert.False(t, seen[&e.Input[0]])
+				seen[&e.Input[0]] = true
+			}
+		}
+		assert.Len(t, seen, len(examples))
+	}
+
+	// the 5 positives are dealt one to a fold
+	for _, fold := range partition(examples, 5, true, nil) {
+		var positives int
+		for _, e := range fold {
+			positives += e.class()
+		}
+		assert.Equal(t, 1, positives)
+	}
+
+	// a source of its own makes the folds independent of the global one
+	rand.Seed(1)
+	a := partition(examples, 5, false, rand.New(rand.NewSource(7)))
+	rand.Seed(2)
+	assert.Equal(t, a, partition(examples, 5, false, rand.New(rand.NewSource(7))))
+	assert.NotEqual(t, a, partition(examples, 5, false, rand.New(rand.NewSource(8))))
+}
+
+func Test_CrossValidate(t *testing.T) {
+	cfg := deep.Config{
+		Inputs:     2,
+		Layout:     []int{4, 1},
+		Activation: deep.ActivationTanh,
+		Mode:       deep.ModeBinary,
+		Weight:     deep.NewNormal(0.5, 0),
+		Bias:       true,
+	}
+	newTrainer := func() Trainer { return NewBatchTrainer(NewAdam(0.05, 0.9, 0.999, 1e-8), 0, 10, 1) }
+	validate := func() CVResult {
+		rand.Seed(0)
+		return CrossValidate(cfg, labelled(100), 4, newTrainer, 50, WithStratifiedFolds())
+	}
+
+	result := validate()
+	assert.Len(t, result.Folds, 4)
+	var loss, accuracy float64
+	for _, f := range result.Folds {
+		assert.Equal(t, 25, f.Size)
+		loss += f.Loss / 4
+		accuracy += f.Accuracy / 4
+	}
+	assert.InDelta(t, loss, result.MeanLoss, 1e-12)
+	assert.InDelta(t, accuracy, result.MeanAccuracy, 1e-12)
+	assert.True(t, result.MeanAccuracy > 0.9, "%f", result.MeanAccuracy)
+	assert.True(t, result.StdAccuracy < 0.1, "%f", result.StdAccuracy)
+	assert.True(t, result.StdLoss > 0)
+	assert.Equal(t, result, validate())
+
+	// seeded folds, network and trainers do not draw from the global source
+	seeded := cfg
+	seeded.Seed = 3
+	examples := labelled(40)
+	seededValidate := func(seed int64) CVResult {
+		rand.Seed(seed)
+		newTrainer := func() Trainer { return NewBatchTrainer(NewAdam(0.05, 0.9, 0.999, 1e-8), 0, 10, 1, WithSeed(5)) }
+		return CrossValidate(seeded, examples, 4, newTrainer, 5, WithFoldSeed(9))
+	}
+	assert.Equal(t, seededValidate(1), seededValidate(2))
+
+	// regression has no accuracy
+	cfg.Mode = deep.ModeRegression
+	rand.Seed(0)
+	result = CrossValidate(cfg, labelled(20), 2, newTrainer, 1)
+	assert.Equal(t, 0.0, result.MeanAccuracy)
+
+	assert.Panics(t, func() { CrossValidate(cfg, labelled(3), 4, newTrainer, 1) })
+
+	// the defaults of the networks of the folds leave cfg be
+	heads := deep.Config{
+		Inputs: 2,
+		Layout: []int{4, 2},
+		Heads:  []deep.Head{{From: 0, To: 1, Mode: deep.ModeBinary}, {From: 1, To: 2, Mode: deep.ModeRegression}},
+		Weight: deep.NewNormal(0.5, 0),
+	}
+	examples = labelled(8)
+	for i, e := range examples {
+		examples[i].Response = []float64{e.Response[0], e.Input[0]}
+	}
+	CrossValidate(heads, examples, 2, newTrainer, 1)
+	assert.Equal(t, []deep.Head{{From: 0, To: 1, Mode: deep.ModeBinary}, {From: 1, To: 2, Mode: deep.ModeRegression}}, heads.Heads)
+	assert.Equal(t, []int{4, 2}, heads.Layout)
+}
@@ -0,0 +1,91 @@
+package training
+
+import (
+	"math"
+
+	deep "github.com/patrikeh/go-deep"
+)
+
+// EarlyStopping stops training once the validation loss has not improved
+// on its best by more than MinDelta for Patience epochs
+type EarlyStopping struct {
+	Patience int
+	MinDelta float64
+	// RestoreBest sets the weights of the network to those of the epoch
+	// of the best validation loss at the end of training
+	RestoreBest bool
+}
+
+// WithEarlyStopping stops training early by e, if there is a validation set
+func WithEarlyStopping(e EarlyStopping) Option {
+	return func(o *options) {
+		o.stopping = &e
+	}
+}
+
+// stopping keeps the state of early stopping over a training run
+type stopping struct {
+	bestLoss                float64
+	waited                  int
+	bestEpoch, stoppedEpoch int
+	reason                  StopReason
+	// snapshot of the learned parameters at the best epoch
+	bestWeights [][][]float64
+	bestAlphas  []float64
+	bestNorms   []*deep.Norm
+	bestConv    *deep.Convolution
+}
+
+// resetStopping discards the state of the last training run
+func (s *stopping) resetStopping() {
+	*s = stopping{bestLoss: math.Inf(1)}
+}
+
+// stop records the loss of n on validation after epoch and reports whether
+// training should stop
+func (s *stopping) stop(n *deep.Neural, e *EarlyStopping, loss deep.Loss, epoch int, validation Examples) bool {
+	if e == nil || len(validation) == 0 {
+		return false
+	}
+	if l := validationLoss(n, loss, validation); l < s.bestLoss-e.MinDelta {
+		s.bestLoss, s.waited, s.bestEpoch = l, 0, epoch
+		if e.RestoreBest {
+			s.bestWeights, s.bestAlphas, s.bestNorms, s.bestConv = n.Weights(), n.Alphas(), n.Norms(), n.Convolution()
+		}
+		return false
+	}
+	if s.waited++; s.waited >= iparam(e.Patience, 1) {
+		s.stoppedEpoch, s.reason = epoch, StopEarly
+		return true
+	}
+	return false
+}
+
+// restoreBest sets the learned parameters of n to those of the best epoch,
+// if e restores them
+func (s *stopping) restoreBest(n *deep.Neural, e *EarlyStopping) {
+	if e == nil || !e.RestoreBest || s.bestWeights == nil {
+		return
+	}
+	n.ApplyWeights(s.bestWeights)
+	n.ApplyAlphas(s.bestAlphas)
+	n.ApplyNorms(s.bestNorms)
+	n.ApplyConvolution(s.bestConv)
+}
+
+// BestEpoch returns the epoch of the best validation loss of the last
+// training run with early stopping, or 0 if none
+func (s *stopping) BestEpoch() int {
+	return s.bestEpoch
+}
+
+// StoppedEpoch returns the epoch after which the last training run stopped
+// early, or 0 if it ran all epochs
+func (s *stopping) StoppedEpoch() int {
+	return s.stoppedEpoch
+}
+
+// StopReason returns why the last training run ended
+func (s *stopping) StopReason() StopReason {
+	return s.reason
+}
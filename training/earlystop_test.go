@@ -0,0 +1,109 @@
+package training
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptedLoss is MSE whose value on the validation set is given by script
+type scriptedLoss struct {
+	deep.MeanSquared
+	script []float64
+	calls  *int
+}
+
+func (l scriptedLoss) F(estimate, ideal [][]float64) float64 {
+	*l.calls++
+	return l.script[*l.calls-1]
+}
+
+func Test_EarlyStopping(t *testing.T) {
+	data := Examples{
+		{Input: []float64{0}, Response: []float64{0}},
+		{Input: []float64{1}, Response: []float64{1}},
+	}
+	network := func() *deep.Neural {
+		rand.Seed(0)
+		return deep.NewNeural(&deep.Config{
+			Inputs: 1,
+			Layout: []int{1},
+			Mode:   deep.ModeRegression,
+			Weight: deep.NewNormal(0.5, 0),
+		})
+	}
+	script := []float64{1, 0.8, 0.7, 0.69, 0.75, 0.71, 0.5, 0.4}
+	stop := EarlyStopping{Patience: 3, MinDelta: 0.02}
+
+	type stoppingTrainer interface {
+		Trainer
+		BestEpoch() int
+		StoppedEpoch() int
+	}
+	for _, trainer := range []func(...Option) stoppingTrainer{
+		func(opts ...Option) stoppingTrainer { return NewTrainer(NewSGD(0.1, 0, 0, false), 0, opts...) },
+		func(opts ...Option) stoppingTrainer {
+			return NewBatchTrainer(NewSGD(0.1, 0, 0, false), 0, 2, 2, opts...)
+		},
+	} {
+		// 0.69 is no improvement by MinDelta, so three epochs after 0.7 stop
+		var calls int
+		tr := trainer(WithLoss(scriptedLoss{script: script, calls: &calls}), WithEarlyStopping(stop))
+		tr.Train(network(), data, data, len(script))
+		assert.Equal(t, 6, calls)
+		assert.Equal(t, 3, tr.BestEpoch())
+		assert.Equal(t, 6, tr.StoppedEpoch())
+
+		// any improvement counts without MinDelta
+		calls = 0
+		tr = trainer(WithLoss(scriptedLoss{script: script, calls: &calls}), WithEarlyStopping(EarlyStopping{Patience: 3}))
+		tr.Train(network(), data, data, len(script))
+		assert.Equal(t, 8, calls)
+		assert.Equal(t, 8, tr.BestEpoch())
+		assert.Equal(t, 0, tr.StoppedEpoch())
+
+		// there is nothing to stop by without a validation set
+		tr = trainer(WithEarlyStopping(stop))
+		tr.Train(network(), data, nil, len(script))
+		assert.Equal(t, 0, tr.StoppedEpoch())
+	}
+}
+
+func Test_EarlyStoppingRestoreBest(t *testing.T) {
+	rand.Seed(0)
+	sample := func() Example {
+		x := rand.Float64()*4 - 2
+		return Example{Input: []float64{x}, Response: []float64{math.Sin(x) + 0.3*rand.NormFloat64()}}
+	}
+	var data, validation Examples
+	for i := 0; i < 40; i++ {
+		data = append(data, sample())
+		validation = append(validation, sample())
+	}
+	train := func(restore bool) (*deep.Neural, *OnlineTrainer) {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     1,
+			Layout:     []int{16, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(0.5, 0),
+			Bias:       true,
+		})
+		// a high learning rate makes the validation loss noisy
+		trainer := NewTrainer(NewSGD(0.1, 0, 0, false), 0, WithEarlyStopping(EarlyStopping{Patience: 5, RestoreBest: restore}))
+		trainer.Train(n, data, validation, 500)
+		return n, trainer
+	}
+
+	last, trainer := train(false)
+	assert.True(t, trainer.StoppedEpoch() > trainer.BestEpoch())
+	final := validationLoss(last, nil, validation)
+	assert.True(t, final > trainer.bestLoss, "%f %f", final, trainer.bestLoss)
+
+	best, trainer := train(true)
+	assert.InDelta(t, trainer.bestLoss, validationLoss(best, nil, validation), 1e-12)
+}
@@ -0,0 +1,124 @@
+package training
+
+import (
+	deep "github.com/patrikeh/go-deep"
+)
+
+// Event is an event of training: an EpochStartEvent, EpochEndEvent,
+// CheckpointEvent, EarlyStopEvent, UpdateSkippedEvent or LRReducedEvent
+type Event interface {
+	event()
+}
+
+// EpochStartEvent is sent before every epoch
+type EpochStartEvent struct {
+	Epoch int
+}
+
+// EpochEndEvent is sent after every epoch with the losses on the training
+// examples and the validation set, NaN without one, and the metrics of
+// WithMetrics
+type EpochEndEvent struct {
+	Epoch          int
+	TrainLoss      float64
+	ValidationLoss float64
+	Metrics        []MetricStats
+}
+
+// CheckpointEvent is sent whenever a CheckpointSaver saves the network, to
+// Path unless it was created by Create, and Best if to its Best path
+type CheckpointEvent struct {
+	Epoch int
+	Path  string
+	Best  bool
+}
+
+// EarlyStopEvent is sent once early stopping stops training after Epoch,
+// with its best validation loss
+type EarlyStopEvent struct {
+	Epoch     int
+	BestEpoch int
+	BestLoss  float64
+}
+
+// UpdateSkippedEvent is sent whenever Safeguards skip the update of an
+// example during Epoch, by its loss and the moving average of losses
+type UpdateSkippedEvent struct {
+	Epoch   int
+	Loss    float64
+	Average float64
+}
+
+// LRReducedEvent is sent whenever Safeguards reduce the learning rate
+// during Epoch, with the base learning rate as reduced
+type LRReducedEvent struct {
+	Epoch int
+	LR    float64
+}
+
+func (EpochStartEvent) event()    {}
+func (EpochEndEvent) event()      {}
+func (CheckpointEvent) event()    {}
+func (EarlyStopEvent) event()     {}
+func (UpdateSkippedEvent) event() {}
+func (LRReducedEvent) event()     {}
+
+// WithEvents sends the events of training to events. Sends never block:
+// events that do not fit in the buffer of events, or find no receiver
+// ready on an unbuffered channel, are dropped. Losses and metrics are then
+// computed after every epoch. The channel is not closed.
+func WithEvents(events chan<- Event) Option {
+	return func(o *options) {
+		o.events = events
+	}
+}
+
+// emit sends e to events, if any and unless it would block
+func emit(events chan<- Event, e Event) {
+	if events == nil {
+		return
+	}
+	select {
+	case events <- e:
+	default:
+	}
+}
+
+// emit sends e to the events of o
+func (o options) emit(e Event) {
+	emit(o.events, e)
+}
+
+// emitter is implemented by callbacks that send events of their own
+type emitter interface {
+	setEvents(events chan<- Event)
+}
+
+// eventing is the Callback that sends the EpochEndEvents of a training run
+type eventing struct {
+	events  chan<- Event
+	metrics []Metric
+	values  [2][]float64
+}
+
+// OnMetrics keeps the metrics of epoch for its event
+func (e *eventing) OnMetrics(epoch int, train, validation []float64) {
+	e.values = [2][]float64{train, validation}
+}
+
+// OnEpochEnd sends the EpochEndEvent of epoch
+func (e *eventing) OnEpochEnd(epoch int, trainLoss, valLoss float64, n *deep.Neural) error {
+	event := EpochEndEvent{Epoch: epoch, TrainLoss: trainLoss, ValidationLoss: valLoss}
+	for i, m := range e.metrics {
+		event.Metrics = append(event.Metrics, MetricStats{
+			Name:       metricName(m),
+			Train:      e.values[0][i],
+			Validation: e.values[1][i],
+		})
+	}
+	emit(e.events, event)
+	return nil
+}
+
+// OnTrainEnd does nothing
+func (e *eventing) OnTrainEnd(epoch int, n *deep.Neural, err error) {}
@@ -0,0 +1,82 @@
+package training
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Events(t *testing.T) {
+	data := Examples{}
+	for i := 0.0; i < 1; i += 0.1 {
+		data = append(data, Example{Input: []float64{i}, Response: []float64{i}})
+	}
+	rand.Seed(0)
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     1,
+		Layout:     []int{1},
+		Activation: deep.ActivationLinear,
+		Mode:       deep.ModeRegression,
+		Weight:     deep.NewNormal(0.5, 0),
+	})
+	saver := &CheckpointSaver{Every: 2, Create: func(int) (io.WriteCloser, error) {
+		return closingBuffer{&bytes.Buffer{}}, nil
+	}}
+	// the validation loss gets worse from the third epoch on
+	worsen := CallbackFuncs{EpochEnd: func(epoch int, trainLoss, valLoss float64, n *deep.Neural) error {
+		if epoch >= 3 {
+			n.Layers[0].Neurons[0].In[0].Weight += 10
+		}
+		return nil
+	}}
+
+	events := make(chan Event, 100)
+	NewTrainer(NewSGD(0.1, 0, 0, false), 0, WithEvents(events), WithMetrics(MAE{}), WithCheckpointSaver(saver),
+		WithCallbacks(worsen), WithEarlyStopping(EarlyStopping{Patience: 2})).Train(n, data, data, 100)
+	close(events)
+
+	var kinds []string
+	for e := range events {
+		switch e := e.(type) {
+		case EpochStartEvent:
+			kinds = append(kinds, "start")
+		case EpochEndEvent:
+			kinds = append(kinds, "end")
+			assert.False(t, math.IsNaN(e.TrainLoss))
+			assert.InDelta(t, e.TrainLoss, e.ValidationLoss, 1e-12)
+			assert.Len(t, e.Metrics, 1)
+			assert.Equal(t, "MAE", e.Metrics[0].Name)
+		case CheckpointEvent:
+			kinds = append(kinds, "checkpoint")
+			assert.Equal(t, 0, e.Epoch%2)
+		case EarlyStopEvent:
+			kinds = append(kinds, "stop")
+			assert.Equal(t, 4, e.Epoch)
+			assert.Equal(t, 2, e.BestEpoch)
+		}
+	}
+	assert.Equal(t, []string{
+		"start", "end",
+		"start", "end", "checkpoint",
+		"start", "end",
+		"start", "end", "checkpoint", "stop",
+	}, kinds)
+}
+
+func Test_EventsDropped(t *testing.T) {
+	data := Examples{{Input: []float64{1}, Response: []float64{1}}}
+	rand.Seed(0)
+	n := deep.NewNeural(&deep.Config{Inputs: 1, Layout: []int{1}, Mode: deep.ModeRegression})
+
+	// nobody receives, and a full buffer keeps its first events
+	NewTrainer(NewSGD(0.1, 0, 0, false), 0, WithEvents(make(chan Event))).Train(n, data, nil, 10)
+	events := make(chan Event, 1)
+	NewBatchTrainer(NewSGD(0.1, 0, 0, false), 0, 1, 1, WithEvents(events)).Train(n, data, nil, 10)
+	assert.Len(t, events, 1)
+	assert.Equal(t, EpochStartEvent{Epoch: 1}, <-events)
+}
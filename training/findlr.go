@@ -0,0 +1,132 @@
+package training
+
+import (
+	"math"
+
+	deep "github.com/patrikeh/go-deep"
+)
+
+// findLRBatchSize is the size of the mini-batches of a learning rate sweep
+const findLRBatchSize = 32
+
+// LRPoint is the smoothed loss after a step of a learning rate sweep
+type LRPoint struct {
+	LR, Loss float64
+	// Suggested marks the point of steepest descent of the loss
+	Suggested bool
+}
+
+// FindLR sweeps the learning rate of SGD from start to end over steps
+// mini-batches, see FindLRWith
+func FindLR(n *deep.Neural, examples Examples, start, end float64, steps int) []LRPoint {
+	return FindLRWith(n, NewSGD(start, 0, 0, false), examples, start, end, steps)
+}
+
+// FindLRWith trains n with solver for steps mini-batches while increasing
+// the learning rate exponentially from start to end, and returns the
+// smoothed loss of each step. The sweep ends early once the loss diverges.
+// The weights of n and the learning rate of solver are restored afterwards.
+func FindLRWith(n *deep.Neural, solver LRSolver, examples Examples, start, end float64, steps int) []LRPoint {
+	if len(examples) == 0 || steps < 1 {
+		return nil
+	}
+	weights, alphas, norms, conv := n.Weights(), n.Alphas(), n.Norms(), n.Convolution()
+	base, training := solver.LR(), n.Training()
+	defer func() {
+		n.ApplyWeights(weights)
+		n.ApplyAlphas(alphas)
+		n.ApplyNorms(norms)
+		n.ApplyConvolution(conv)
+		solver.SetLR(base)
+		n.SetTraining(training)
+	}()
+	n.SetTraining(true)
+
+	t := NewBatchTrainer(solver, 0, findLRBatchSize, 1)
+	t.internalb = newBatchTraining(n.Layers, 1, t.opts.lossFor(n))
+	t.initConv(n, 1)
+	t.weighted = examples.weighted()
+	initSolver(solver, n)
+
+	train := make(Examples, len(examples))
+	copy(train, examples)
+
+	factor := 1.0
+	if steps > 1 {
+		factor = math.Pow(end/start, 1/float64(steps-1))
+	}
+	const smoothing = 0.98
+	var (
+		batches   []Examples
+		avg, best float64
+		points    []LRPoint
+	)
+	for i := 0; i < steps; i++ {
+		if len(batches) == 0 {
+			train.Shuffle()
+			batches = train.SplitSize(findLRBatchSize)
+		}
+		b := batches[0]
+		batches = batches[1:]
+
+		lr := start * math.Pow(factor, float64(i))
+		avg = smoothing*avg + (1-smoothing)*validationLoss(n, t.loss, b)
+		loss := avg / (1 - math.Pow(smoothing, float64(i+1)))
+		if math.IsNaN(loss) || (i > 0 && loss > 4*best) {
+			break
+		}
+		if i == 0 || loss < best {
+			best = loss
+		}
+		points = append(points, LRPoint{LR: lr, Loss: loss})
+
+		var total float64
+		for _, e := range b {
+			if w := e.weight(t.weighted); w != 0 {
+				n.ResetState()
+				n.Forward(e.Input)
+				t.calculateDeltas(n, e.Response, w, 0)
+				total += w
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		for i, iPD := range t.partialDeltas[0] {
+			for j, jPD := range iPD {
+				for k, v := range jPD {
+					t.accumulatedDeltas[i][j][k] += v
+					jPD[k] = 0
+				}
+			}
+		}
+		for i, v := range t.partialAlphas[0] {
+			t.accumulatedAlphas[i] += v
+			t.partialAlphas[0][i] = 0
+		}
+		t.accumulatedNorms.add(t.partialNorms[0])
+		t.accumulatedConv.add(t.partialConvs[0])
+		solver.SetLR(lr)
+		t.update(n, i+1, total)
+	}
+
+	suggest(points)
+	return points
+}
+
+// suggest marks the point where the loss falls fastest with log(lr),
+// skipping the first tenth of points while the smoothed loss settles
+func suggest(points []LRPoint) {
+	if len(points) < 2 {
+		return
+	}
+	skip := len(points) / 10
+	steepest, slope := skip, math.Inf(1)
+	for i := skip; i < len(points)-1; i++ {
+		s := (points[i+1].Loss - points[i].Loss) / math.Log(points[i+1].LR/points[i].LR)
+		if s < slope {
+			steepest, slope = i, s
+		}
+	}
+	points[steepest].Suggested = true
+}
@@ -0,0 +1,62 @@
+package training
+
+import (
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FindLR(t *testing.T) {
+	rand.Seed(0)
+	// two gaussian clusters
+	var data Examples
+	for i := 0; i < 256; i++ {
+		class := i % 2
+		center := float64(2*class - 1)
+		data = append(data, Example{
+			Input:    []float64{center + rand.NormFloat64(), center + rand.NormFloat64()},
+			Response: []float64{float64(1 - class), float64(class)},
+		})
+	}
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     2,
+		Layout:     []int{8, 2},
+		Activation: deep.ActivationTanh,
+		Mode:       deep.ModeMultiClass,
+		Weight:     deep.NewNormal(0.5, 0),
+		Bias:       true,
+	})
+	weights := n.Weights()
+
+	points := FindLR(n, data, 1e-5, 100, 100)
+	assert.Equal(t, weights, n.Weights())
+	assert.True(t, len(points) > 10)
+	for i := range points[1:] {
+		assert.True(t, points[i+1].LR > points[i].LR)
+	}
+
+	var suggested float64
+	for _, p := range points {
+		if p.Suggested {
+			suggested = p.LR
+		}
+	}
+	// 0.5 trains this task well
+	assert.True(t, suggested > 0.05 && suggested < 5)
+
+	NewBatchTrainer(NewSGD(suggested, 0, 0, false), 0, 32, 1).Train(n, data, nil, 20)
+	var correct int
+	for _, e := range data {
+		if deep.ArgMax(n.Predict(e.Input)) == deep.ArgMax(e.Response) {
+			correct++
+		}
+	}
+	assert.True(t, float64(correct)/float64(len(data)) > 0.85)
+
+	// the solver is left as given
+	adam := NewAdam(0.001, 0, 0, 0)
+	assert.NotEmpty(t, FindLRWith(n, adam, data, 1e-5, 1, 50))
+	assert.Equal(t, 0.001, adam.LR())
+}
@@ -0,0 +1,91 @@
+package training
+
+import (
+	"math"
+
+	deep "github.com/patrikeh/go-deep"
+)
+
+// GradCheckReport compares the gradients of the weights of a network by
+// backpropagation with numerical gradients
+type GradCheckReport struct {
+	// Weights is the number of weights checked
+	Weights int
+	// MaxError and MeanError are the largest and the mean relative error,
+	// not counting differences within the rounding error of the quotients
+	MaxError, MeanError float64
+	// Layer, Neuron and Synapse locate the weight of MaxError, as in
+	// Weights of the network
+	Layer, Neuron, Synapse int
+	// Analytic and Numerical are the gradients of the weight of MaxError
+	Analytic, Numerical float64
+}
+
+// gradCheckFloor keeps the relative error of gradients near zero finite
+const gradCheckFloor = 1e-8
+
+// gradCheckRoundoff is a bound of the relative rounding error of the loss,
+// a few ulps, of which a difference quotient by eps has that over eps.
+// Differences of gradients within it are not counted as errors.
+const gradCheckRoundoff = 8 * 0x1p-52
+
+// GradientCheck compares the gradient of loss on an example with respect to
+// every weight of n that is trained, computed by backpropagation, with its
+// central difference quotient of loss.F by eps. The two are compared as
+// they are, so F must be the objective Df differentiates: losses whose F
+// averages over outputs, such as MeanSquared, call for an F scaled to the
+// sum. Dropout is disabled and the state of recurrent layers reset for
+// every pass. Weights are restored exactly. GradientCheck is part of this
+// package rather than deep as the backpropagation it checks is that of the
+// trainers, which deep cannot import.
+func GradientCheck(n *deep.Neural, loss deep.Loss, input, ideal []float64, eps float64) GradCheckReport {
+	defer n.SetTraining(n.Training())
+	n.SetTraining(false)
+
+	t := NewTrainer(nil, 0)
+	t.internal = newTraining(n.Layers, n.OutputLoss(loss))
+	n.ResetState()
+	n.Forward(input)
+	t.calculateDeltas(n, ideal, 1)
+
+	var analytic, numerical, roundoff []float64
+	var coordinates [][3]int
+	objective := func() float64 {
+		n.ResetState()
+		return loss.F([][]float64{n.Predict(input)}, [][]float64{ideal})
+	}
+	for i := trainable(n); i < len(n.Layers); i++ {
+		l := n.Layers[i]
+		if l.Frozen {
+			continue
+		}
+		for j, neuron := range l.Neurons {
+			for k, s := range neuron.In {
+				if s.Pruned {
+					continue
+				}
+				analytic = append(analytic, t.deltas[i][j]*s.In)
+				w := s.Weight
+				s.Weight = w + eps
+				plus := objective()
+				s.Weight = w - eps
+				minus := objective()
+				s.Weight = w
+				numerical = append(numerical, (plus-minus)/(2*eps))
+				roundoff = append(roundoff, gradCheckRoundoff*math.Max(math.Max(math.Abs(plus), math.Abs(minus)), 1)/eps)
+				coordinates = append(coordinates, [3]int{i, j, k})
+			}
+		}
+	}
+
+	r := GradCheckReport{Weights: len(analytic)}
+	for i := range analytic {
+		e := math.Max(math.Abs(analytic[i]-numerical[i])-roundoff[i], 0) / math.Max(math.Abs(analytic[i])+math.Abs(numerical[i]), gradCheckFloor)
+		r.MeanError += e / float64(len(analytic))
+		if i == 0 || e > r.MaxError {
+			r.MaxError, r.Analytic, r.Numerical = e, analytic[i], numerical[i]
+			r.Layer, r.Neuron, r.Synapse = coordinates[i][0], coordinates[i][1], coordinates[i][2]
+		}
+	}
+	return r
+}
@@ -0,0 +1,131 @@
+package training
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+// objective is a loss whose F is f, the objective that the Df of the loss
+// differentiates
+type objective struct {
+	deep.Loss
+	f func(estimate, ideal [][]float64) float64
+}
+
+func (o objective) F(estimate, ideal [][]float64) float64 {
+	return o.f(estimate, ideal)
+}
+
+func (o objective) DfVector(estimate, ideal, activation, deltas []float64) {
+	deep.OutputDeltas(o.Loss, estimate, ideal, activation, deltas)
+}
+
+// summed is l, whose F averages over the outputs of an example, summed over
+// them and scaled by scale
+func summed(l deep.Loss, scale float64) objective {
+	return objective{l, func(estimate, ideal [][]float64) float64 {
+		return scale * float64(len(estimate[0])) * l.F(estimate, ideal)
+	}}
+}
+
+func Test_GradientCheck(t *testing.T) {
+	hidden := []deep.ActivationType{
+		deep.ActivationSigmoid, deep.ActivationTanh, deep.ActivationReLU, deep.ActivationLinear,
+		deep.ActivationExp, deep.ActivationLeakyReLU, deep.ActivationELU, deep.ActivationSELU,
+		deep.ActivationGELU, deep.ActivationSwish, deep.ActivationSoftplus, deep.ActivationPReLU,
+		deep.ActivationHardSigmoid, deep.ActivationHardTanh,
+	}
+	critic := deep.CriticPolicyGradient{}
+	losses := []struct {
+		loss  deep.Loss
+		mode  deep.Mode
+		ideal []float64
+	}{
+		// the mean of squares over outputs, whose Df is of half the sum
+		{summed(deep.MeanSquared{}, 0.5), deep.ModeRegression, []float64{0.3, -0.2, 0.8}},
+		{summed(deep.MeanAbsolute{}, 1), deep.ModeRegression, []float64{3, -2, 8}},
+		{summed(deep.Huber{Delta: 1}, 1), deep.ModeRegression, []float64{0.3, -2, 0.8}},
+		{summed(deep.NewQuantile(0.3), 1), deep.ModeRegression, []float64{3, -2, 8}},
+		{summed(deep.LogCosh{}, 1), deep.ModeRegression, []float64{0.3, -0.2, 0.8}},
+		{summed(deep.Hinge{}, 1), deep.ModeRegression, []float64{1, -1, 1}},
+		{summed(deep.Poisson{}, 1), deep.ModePositiveRegression, []float64{1, 0, 3}},
+		// the F of the critic is the squared TD error, which does not depend
+		// on the estimate, and its Df that of 2*ideal*estimate
+		{objective{critic, func(estimate, ideal [][]float64) float64 {
+			return 2 * deep.Dot(estimate[0], ideal[0])
+		}}, deep.ModeRegression, []float64{0.5, -1, 0.2}},
+		{deep.CosineLoss{}, deep.ModeRegression, []float64{0.3, -0.2, 0.8}},
+		{deep.CrossEntropy{}, deep.ModeMultiClass, []float64{0, 1, 0}},
+		{deep.CrossEntropy{Smoothing: 0.1}, deep.ModeMultiClass, []float64{0, 1, 0}},
+		{deep.NewWeightedCrossEntropy([]float64{1, 2, 0.5}), deep.ModeMultiClass, []float64{0, 1, 0}},
+		{deep.KLDivergence{}, deep.ModeMultiClass, []float64{0.2, 0.5, 0.3}},
+		{deep.PPOClip{Epsilon: 0.2}, deep.ModeMultiClass, deep.PPOTarget(1, 0.5, []float64{0.3, 0.3, 0.4})},
+		{deep.BinaryCrossEntropy{}, deep.ModeBinary, []float64{0, 1, 1}},
+		{deep.FocalLoss{Gamma: 2, Alpha: 0.25}, deep.ModeBinary, []float64{0, 1, 1}},
+		// the TD error of the action taken
+		{deep.ActorPolicyGradient{}, deep.ModeMultiClass, []float64{0, 0.7, 0}},
+		{deep.ActorPolicyGradient{EntropyCoeff: 0.5}, deep.ModeMultiClass, []float64{0, -0.7, 0}},
+		// an actor of independent sigmoid outputs
+		{deep.ActorPolicyGradient{}, deep.ModeBinary, []float64{0, 0.7, 0}},
+		{deep.ActorPolicyGradient{EntropyCoeff: 0.5}, deep.ModeBinary, []float64{0.4, -0.7, 0}},
+	}
+	norms := []struct {
+		name             string
+		batch, layerNorm []bool
+	}{
+		{name: "plain"},
+		{name: "batch norm", batch: []bool{true, true, false}},
+		{name: "layer norm", layerNorm: []bool{true, true, false}},
+	}
+
+	for _, a := range hidden {
+		for _, l := range losses {
+			for _, norm := range norms {
+				name := fmt.Sprintf("%s/%T/%s", a, l.loss, norm.name)
+				if o, ok := l.loss.(objective); ok {
+					name = fmt.Sprintf("%s/%T/%s", a, o.Loss, norm.name)
+				}
+				rand.Seed(0)
+				n := deep.NewNeural(&deep.Config{
+					Inputs:     2,
+					Layout:     []int{4, 4, 3},
+					Activation: a,
+					Mode:       l.mode,
+					Weight:     deep.NewNormal(0.5, 0),
+					Bias:       true,
+					BatchNorm:  norm.batch,
+					LayerNorm:  norm.layerNorm,
+				})
+				r := GradientCheck(n, l.loss, []float64{0.5, -0.8}, l.ideal, 1e-6)
+				assert.Equal(t, n.NumWeights(), r.Weights, name)
+				assert.True(t, r.MaxError < 1e-4, "%s: %+v", name, r)
+			}
+		}
+	}
+}
+
+func Test_GradientCheckRestoresWeights(t *testing.T) {
+	rand.Seed(0)
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     2,
+		Layout:     []int{3, 1},
+		Activation: deep.ActivationTanh,
+		Mode:       deep.ModeRegression,
+		Weight:     deep.NewNormal(1, 0),
+		Bias:       true,
+	})
+	weights := n.Weights()
+
+	r := GradientCheck(n, deep.MeanSquared{}, []float64{0.1, 0.2}, []float64{0.7}, 1e-3)
+
+	assert.Equal(t, weights, n.Weights())
+	assert.Equal(t, 12, r.Weights)
+	// the F of MeanSquared is twice the objective of its Df, which the
+	// check reports rather than scales away
+	assert.InDelta(t, 2*r.Analytic, r.Numerical, 1e-6)
+	assert.True(t, r.MaxError > 0.3, "%+v", r)
+}
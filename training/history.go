@@ -0,0 +1,102 @@
+package training
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+
+	deep "github.com/patrikeh/go-deep"
+)
+
+// History is the progress of a training run, by the stats of every epoch
+// as a Logger would be given them at a verbosity of 1
+type History struct {
+	Epochs  []EpochStats
+	Stopped StopReason
+}
+
+// Epoch records the stats of an epoch
+func (h *History) Epoch(stats EpochStats) {
+	h.Epochs = append(h.Epochs, stats)
+}
+
+// Losses returns the training and validation loss of every epoch
+func (h History) Losses() (train, validation []float64) {
+	train, validation = make([]float64, len(h.Epochs)), make([]float64, len(h.Epochs))
+	for i, e := range h.Epochs {
+		train[i], validation[i] = e.TrainLoss, e.ValidationLoss
+	}
+	return train, validation
+}
+
+// Best returns the stats of the epoch of the lowest validation loss, or of
+// the lowest training loss without a validation set, and false if no epoch
+// has either
+func (h History) Best() (EpochStats, bool) {
+	var best EpochStats
+	found, validated := false, false
+	for _, e := range h.Epochs {
+		if !math.IsNaN(e.ValidationLoss) {
+			validated = true
+			break
+		}
+	}
+	for _, e := range h.Epochs {
+		loss, bestLoss := e.TrainLoss, best.TrainLoss
+		if validated {
+			loss, bestLoss = e.ValidationLoss, best.ValidationLoss
+		}
+		if !math.IsNaN(loss) && (!found || loss < bestLoss) {
+			best, found = e, true
+		}
+	}
+	return best, found
+}
+
+// MarshalJSON marshals h, with the reason training stopped as a string
+func (h History) MarshalJSON() ([]byte, error) {
+	epochs := h.Epochs
+	if epochs == nil {
+		epochs = []EpochStats{}
+	}
+	return json.Marshal(struct {
+		Epochs  []EpochStats
+		Stopped string
+	}{epochs, h.Stopped.String()})
+}
+
+// newHistory returns the logging of a run to the history of o, if any
+func (o options) newHistory(n *deep.Neural, solver Solver, validation Examples) *logging {
+	if o.history == nil {
+		return nil
+	}
+	o.logger, o.silent = o.history, false
+	return newLogging(o, nil, 1, n, solver, validation)
+}
+
+// trainHistory trains by train with the history of o recorded, and returns
+// it along with the reason training stopped
+func trainHistory(o *options, s *stopping, train func() error) (History, error) {
+	h := &History{}
+	o.history = h
+	defer func() { o.history = nil }()
+	err := train()
+	h.Stopped = s.StopReason()
+	return *h, err
+}
+
+// TrainHistory trains n like TrainContext, and returns its history whatever
+// the verbosity. Losses are then computed after every epoch.
+func (t *OnlineTrainer) TrainHistory(ctx context.Context, n *deep.Neural, examples, validation Examples, iterations int) (History, error) {
+	return trainHistory(&t.opts, &t.stopping, func() error {
+		return t.TrainContext(ctx, n, examples, validation, iterations)
+	})
+}
+
+// TrainHistory trains n like TrainContext, and returns its history whatever
+// the verbosity
+func (t *BatchTrainer) TrainHistory(ctx context.Context, n *deep.Neural, examples, validation Examples, iterations int) (History, error) {
+	return trainHistory(&t.opts, &t.stopping, func() error {
+		return t.TrainContext(ctx, n, examples, validation, iterations)
+	})
+}
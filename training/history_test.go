@@ -0,0 +1,86 @@
+package training
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_History(t *testing.T) {
+	n, data := loggedNetwork()
+	var buf bytes.Buffer
+	trainer := NewTrainer(NewSGD(0.1, 0, 0, false), 1, WithOutput(&buf), WithMetrics(MAE{}))
+	h, err := trainer.TrainHistory(context.Background(), n, data, data, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, StopCompleted, h.Stopped)
+
+	// the rows printed match the history
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")[2:]
+	if assert.Len(t, h.Epochs, 6) && assert.Len(t, lines, 6) {
+		for i, e := range h.Epochs {
+			fields := strings.Fields(lines[i])
+			assert.Equal(t, i+1, e.Epoch)
+			assert.Equal(t, fmt.Sprint(e.Epoch), fields[0])
+			assert.Equal(t, fmt.Sprintf("%.4f", e.ValidationLoss), fields[2])
+			assert.Equal(t, fmt.Sprintf("%.4f", e.Metrics[0].Validation), fields[3])
+			assert.Equal(t, e.TrainLoss, e.ValidationLoss)
+			assert.Equal(t, 0.1, e.LR)
+			if i > 0 {
+				assert.True(t, e.Elapsed >= h.Epochs[i-1].Elapsed)
+			}
+		}
+	}
+	train, validation := h.Losses()
+	assert.Len(t, train, 6)
+	assert.Equal(t, train, validation)
+	best, ok := h.Best()
+	assert.True(t, ok)
+	for _, l := range validation {
+		assert.True(t, best.ValidationLoss <= l)
+	}
+
+	// the history is not kept after the run
+	trainer.Train(n, data, data, 1)
+	assert.Len(t, h.Epochs, 6)
+}
+
+func Test_HistoryEarlyStopping(t *testing.T) {
+	n, data := loggedNetwork()
+	trainer := NewBatchTrainer(NewSGD(0.1, 0, 0, false), 0, 2, 1, WithEarlyStopping(EarlyStopping{Patience: 2, MinDelta: 1e9}))
+	h, err := trainer.TrainHistory(context.Background(), n, data, data, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, StopEarly, h.Stopped)
+	assert.Len(t, h.Epochs, 3)
+	best, _ := h.Best()
+	assert.Equal(t, 3, best.Epoch)
+
+	h, _ = trainer.TrainHistory(context.Background(), n, data, nil, 2)
+	assert.Len(t, h.Epochs, 2)
+	best, ok := h.Best()
+	assert.True(t, ok)
+	assert.True(t, math.IsNaN(best.ValidationLoss))
+
+	b, err := json.Marshal(h)
+	assert.NoError(t, err)
+	var decoded struct {
+		Epochs  []map[string]interface{}
+		Stopped string
+	}
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, "completed", decoded.Stopped)
+	if assert.Len(t, decoded.Epochs, 2) {
+		assert.Nil(t, decoded.Epochs[0]["ValidationLoss"])
+		assert.InDelta(t, h.Epochs[0].TrainLoss, decoded.Epochs[0]["TrainLoss"], 1e-12)
+	}
+
+	_, ok = History{}.Best()
+	assert.False(t, ok)
+	b, _ = json.Marshal(History{})
+	assert.Equal(t, `{"Epochs":[],"Stopped":"completed"}`, string(b))
+}
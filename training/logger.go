@@ -0,0 +1,162 @@
+package training
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"time"
+
+	deep "github.com/patrikeh/go-deep"
+)
+
+// EpochStats are the statistics of training logged after an epoch. Losses
+// and metrics that are not evaluated are NaN, and marshal to null.
+type EpochStats struct {
+	Epoch          int
+	Elapsed        time.Duration
+	TrainLoss      float64
+	ValidationLoss float64
+	// Accuracy on the validation set, of ModeMultiClass networks only
+	Accuracy float64
+	// LR is the learning rate of solvers that have one
+	LR      float64
+	Metrics []MetricStats
+}
+
+// MetricStats is a metric of WithMetrics on the training examples and on
+// the validation set
+type MetricStats struct {
+	Name              string
+	Train, Validation float64
+}
+
+// MarshalJSON marshals s, with NaN as null
+func (s EpochStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Epoch          int
+		Elapsed        time.Duration
+		TrainLoss      *float64
+		ValidationLoss *float64
+		Accuracy       *float64
+		LR             *float64
+		Metrics        []MetricStats
+	}{s.Epoch, s.Elapsed, jsonFloat(s.TrainLoss), jsonFloat(s.ValidationLoss),
+		jsonFloat(s.Accuracy), jsonFloat(s.LR), s.Metrics})
+}
+
+// MarshalJSON marshals s, with NaN as null
+func (s MetricStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name              string
+		Train, Validation *float64
+	}{s.Name, jsonFloat(s.Train), jsonFloat(s.Validation)})
+}
+
+// jsonFloat returns nil for values that JSON cannot represent
+func jsonFloat(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+// Logger logs the progress of training, every verbosity epochs of a
+// verbose trainer
+type Logger interface {
+	Epoch(stats EpochStats)
+}
+
+// WithLogger logs progress to l rather than printing it to stdout as a
+// table. A Logger that implements Init(*deep.Neural) is initialized with
+// the network before each training run, as is the StatsPrinter.
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.logger, o.silent = l, l == nil
+	}
+}
+
+// WithOutput prints the table of progress to w rather than stdout
+func WithOutput(w io.Writer) Option {
+	return func(o *options) {
+		o.output = w
+	}
+}
+
+// WithSilent logs nothing, whatever the verbosity
+func WithSilent() Option {
+	return WithLogger(nil)
+}
+
+// logging is the Callback that logs a training run to logger
+type logging struct {
+	logger     Logger
+	verbosity  int
+	solver     Solver
+	validation Examples
+	started    time.Time
+	metrics    []Metric
+	values     [2][]float64
+}
+
+// newLogging returns the logging of a training run of n by solver, nil if
+// silent
+func newLogging(o options, printer *StatsPrinter, verbosity int, n *deep.Neural, solver Solver, validation Examples) *logging {
+	logger := o.logger
+	if o.silent || verbosity <= 0 {
+		return nil
+	}
+	if logger == nil {
+		logger = printer
+	}
+	if i, ok := logger.(interface{ Init(*deep.Neural) }); ok {
+		i.Init(n)
+	}
+	return &logging{
+		logger:     logger,
+		verbosity:  verbosity,
+		solver:     solver,
+		validation: validation,
+		started:    time.Now(),
+		metrics:    o.metrics,
+	}
+}
+
+// skips reports whether nothing is logged after epoch
+func (l *logging) skips(epoch int) bool {
+	return epoch%l.verbosity != 0
+}
+
+// OnMetrics keeps the metrics of epoch for its stats
+func (l *logging) OnMetrics(epoch int, train, validation []float64) {
+	l.values = [2][]float64{train, validation}
+}
+
+// OnEpochEnd logs the stats of epoch
+func (l *logging) OnEpochEnd(epoch int, trainLoss, valLoss float64, n *deep.Neural) error {
+	stats := EpochStats{
+		Epoch:          epoch,
+		Elapsed:        time.Since(l.started),
+		TrainLoss:      trainLoss,
+		ValidationLoss: valLoss,
+		Accuracy:       math.NaN(),
+		LR:             math.NaN(),
+	}
+	if n.Config.Mode == deep.ModeMultiClass && len(l.validation) > 0 {
+		stats.Accuracy = accuracy(n, l.validation)
+	}
+	if s, ok := l.solver.(LRSolver); ok {
+		stats.LR = s.LR()
+	}
+	for i, m := range l.metrics {
+		stats.Metrics = append(stats.Metrics, MetricStats{
+			Name:       metricName(m),
+			Train:      l.values[0][i],
+			Validation: l.values[1][i],
+		})
+	}
+	l.logger.Epoch(stats)
+	return nil
+}
+
+// OnTrainEnd does nothing
+func (l *logging) OnTrainEnd(epoch int, n *deep.Neural, err error) {}
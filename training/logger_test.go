@@ -0,0 +1,94 @@
+package training
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingLogger struct {
+	init  int
+	stats []EpochStats
+}
+
+func (l *recordingLogger) Init(n *deep.Neural) { l.init++ }
+
+func (l *recordingLogger) Epoch(stats EpochStats) { l.stats = append(l.stats, stats) }
+
+func loggedNetwork() (*deep.Neural, Examples) {
+	rand.Seed(0)
+	n := deep.NewNeural(&deep.Config{
+		Inputs: 1,
+		Layout: []int{1},
+		Mode:   deep.ModeRegression,
+		Weight: deep.NewNormal(0.5, 0),
+	})
+	return n, Examples{
+		{Input: []float64{0}, Response: []float64{0}},
+		{Input: []float64{1}, Response: []float64{1}},
+	}
+}
+
+func Test_Logger(t *testing.T) {
+	n, data := loggedNetwork()
+	logger := &recordingLogger{}
+	NewBatchTrainer(NewSGD(0.1, 0, 0, false), 2, 2, 1, WithLogger(logger), WithMetrics(MAE{})).Train(n, data, nil, 5)
+
+	assert.Equal(t, 1, logger.init)
+	assert.Len(t, logger.stats, 2)
+	s := logger.stats[1]
+	assert.Equal(t, 4, s.Epoch)
+	assert.True(t, s.Elapsed > 0)
+	assert.True(t, math.IsNaN(s.ValidationLoss))
+	assert.True(t, math.IsNaN(s.Accuracy))
+	assert.Equal(t, 0.1, s.LR)
+	assert.Equal(t, "MAE", s.Metrics[0].Name)
+	assert.True(t, math.IsNaN(s.Metrics[0].Validation))
+
+	b, err := json.Marshal(logger.stats)
+	assert.Nil(t, err)
+	var decoded []map[string]interface{}
+	assert.Nil(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, 4.0, decoded[1]["Epoch"])
+	assert.Nil(t, decoded[1]["ValidationLoss"])
+	assert.InDelta(t, s.TrainLoss, decoded[1]["TrainLoss"], 1e-12)
+	metric := decoded[1]["Metrics"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "MAE", metric["Name"])
+	assert.InDelta(t, s.Metrics[0].Train, metric["Train"], 1e-12)
+	assert.Nil(t, metric["Validation"])
+}
+
+func Test_LoggerOutput(t *testing.T) {
+	n, data := loggedNetwork()
+	var buf bytes.Buffer
+	NewTrainer(NewSGD(0.1, 0, 0, false), 2, WithOutput(&buf)).Train(n, data, data, 4)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, []string{"Epochs", "Elapsed", "Loss", "(MSE)"}, strings.Fields(lines[0]))
+	assert.Equal(t, "2", strings.Fields(lines[2])[0])
+	assert.Equal(t, "4", strings.Fields(lines[3])[0])
+
+	// the table is only printed for a validation set
+	buf.Reset()
+	NewTrainer(NewSGD(0.1, 0, 0, false), 2, WithOutput(&buf)).Train(n, data, nil, 4)
+	assert.Empty(t, buf.String())
+}
+
+func Test_Silent(t *testing.T) {
+	n, data := loggedNetwork()
+	var buf bytes.Buffer
+	logger := &recordingLogger{}
+	NewTrainer(NewSGD(0.1, 0, 0, false), 1, WithOutput(&buf), WithLogger(logger), WithSilent()).Train(n, data, data, 3)
+	NewBatchTrainer(NewSGD(0.1, 0, 0, false), 1, 2, 1, WithOutput(&buf), WithSilent()).Train(n, data, data, 3)
+
+	assert.Empty(t, buf.String())
+	assert.Equal(t, 0, logger.init)
+	assert.Empty(t, logger.stats)
+}
@@ -0,0 +1,193 @@
+package training
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	deep "github.com/patrikeh/go-deep"
+)
+
+// Metric evaluates the estimates of a network against the ideals, one row
+// per example
+type Metric interface {
+	Compute(estimates, ideals [][]float64) float64
+}
+
+// WithMetrics adds metrics evaluated on the training examples and the
+// validation set after every epoch, see MetricCallback. They are printed
+// by verbose trainers, on the validation set.
+func WithMetrics(metrics ...Metric) Option {
+	return func(o *options) {
+		o.metrics = append(o.metrics, metrics...)
+	}
+}
+
+// MetricCallback is a Callback that is also given the metrics of a training
+// run, in the order given to WithMetrics, after every epoch it does not
+// skip, just before OnEpochEnd. Metrics on a missing validation set are NaN.
+type MetricCallback interface {
+	Callback
+	OnMetrics(epoch int, train, validation []float64)
+}
+
+// Accuracy is the fraction of examples whose class is estimated
+type Accuracy struct {
+	// Mode of the network: ModeMultiClass compares the argmax of the
+	// outputs, ModeBinary and ModeMultiLabel threshold every output at 0.5.
+	// Otherwise a single output is thresholded, and multiple compared by
+	// argmax.
+	Mode deep.Mode
+}
+
+// Compute returns the accuracy of estimates
+func (a Accuracy) Compute(estimates, ideals [][]float64) float64 {
+	if len(estimates) == 0 {
+		return math.NaN()
+	}
+	var correct int
+	for i, est := range estimates {
+		if a.correct(est, ideals[i]) {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(estimates))
+}
+
+func (a Accuracy) correct(estimate, ideal []float64) bool {
+	threshold := a.Mode == deep.ModeBinary || a.Mode == deep.ModeMultiLabel ||
+		a.Mode != deep.ModeMultiClass && len(ideal) == 1
+	if !threshold {
+		return deep.ArgMax(estimate) == deep.ArgMax(ideal)
+	}
+	for j := range ideal {
+		if (estimate[j] >= 0.5) != (ideal[j] >= 0.5) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a Accuracy) String() string { return "Accuracy" }
+
+// MAE is the mean absolute error over all outputs
+type MAE struct{}
+
+// Compute returns the mean absolute error of estimates
+func (MAE) Compute(estimates, ideals [][]float64) float64 {
+	var sum float64
+	var count int
+	for i, est := range estimates {
+		for j := range est {
+			sum += math.Abs(est[j] - ideals[i][j])
+			count++
+		}
+	}
+	return sum / float64(count)
+}
+
+func (MAE) String() string { return "MAE" }
+
+// RMSE is the root of the mean squared error over all outputs
+type RMSE struct{}
+
+// Compute returns the root mean squared error of estimates
+func (RMSE) Compute(estimates, ideals [][]float64) float64 {
+	var sum float64
+	var count int
+	for i, est := range estimates {
+		for j := range est {
+			sum += (est[j] - ideals[i][j]) * (est[j] - ideals[i][j])
+			count++
+		}
+	}
+	return math.Sqrt(sum / float64(count))
+}
+
+func (RMSE) String() string { return "RMSE" }
+
+// MAPE is the mean absolute percentage error over all outputs, as a
+// fraction of the ideals, skipping ideals of 0. It is NaN if all are 0.
+type MAPE struct{}
+
+// Compute returns the mean absolute percentage error of estimates
+func (MAPE) Compute(estimates, ideals [][]float64) float64 {
+	var sum float64
+	var count int
+	for i, est := range estimates {
+		for j := range est {
+			if ideals[i][j] != 0 {
+				sum += math.Abs((est[j] - ideals[i][j]) / ideals[i][j])
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		return math.NaN()
+	}
+	return sum / float64(count)
+}
+
+func (MAPE) String() string { return "MAPE" }
+
+// R2 is the coefficient of determination, averaged over outputs. An output
+// whose ideals are constant scores 1 if estimated exactly, else 0.
+type R2 struct{}
+
+// Compute returns the coefficient of determination of estimates
+func (R2) Compute(estimates, ideals [][]float64) float64 {
+	if len(estimates) == 0 {
+		return math.NaN()
+	}
+	outputs := len(ideals[0])
+	var total float64
+	for j := 0; j < outputs; j++ {
+		var mean float64
+		for _, ideal := range ideals {
+			mean += ideal[j] / float64(len(ideals))
+		}
+		var residual, variance float64
+		for i, ideal := range ideals {
+			residual += (ideal[j] - estimates[i][j]) * (ideal[j] - estimates[i][j])
+			variance += (ideal[j] - mean) * (ideal[j] - mean)
+		}
+		switch {
+		case variance > 0:
+			total += 1 - residual/variance
+		case residual == 0:
+			total++
+		}
+	}
+	return total / float64(outputs)
+}
+
+func (R2) String() string { return "R2" }
+
+// metricName names m by its String method, or else by its type
+func metricName(m Metric) string {
+	if s, ok := m.(fmt.Stringer); ok {
+		return s.String()
+	}
+	name := fmt.Sprintf("%T", m)
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// evaluate returns each of metrics on the estimates of n for examples, NaN
+// without examples
+func evaluate(n *deep.Neural, metrics []Metric, examples Examples) []float64 {
+	values := make([]float64, len(metrics))
+	if len(examples) == 0 {
+		for i := range values {
+			values[i] = math.NaN()
+		}
+		return values
+	}
+	estimates, ideals := make([][]float64, len(examples)), make([][]float64, len(examples))
+	for i, e := range examples {
+		estimates[i], ideals[i] = n.Predict(e.Input), e.Response
+	}
+	for i, m := range metrics {
+		values[i] = m.Compute(estimates, ideals)
+	}
+	return values
+}
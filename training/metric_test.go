@@ -0,0 +1,138 @@
+package training
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"text/tabwriter"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Accuracy(t *testing.T) {
+	multiclass := [][][]float64{
+		{{0.2, 0.7, 0.1}, {0.6, 0.3, 0.1}},
+		{{0, 1, 0}, {0, 0, 1}},
+	}
+	assert.Equal(t, 0.5, Accuracy{Mode: deep.ModeMultiClass}.Compute(multiclass[0], multiclass[1]))
+	assert.Equal(t, 0.5, Accuracy{}.Compute(multiclass[0], multiclass[1]))
+
+	binary := [][][]float64{
+		{{0.6}, {0.4}, {0.2}, {0.5}},
+		{{1}, {1}, {0}, {1}},
+	}
+	assert.Equal(t, 0.75, Accuracy{Mode: deep.ModeBinary}.Compute(binary[0], binary[1]))
+	assert.Equal(t, 0.75, Accuracy{}.Compute(binary[0], binary[1]))
+
+	multilabel := [][][]float64{
+		{{0.6, 0.4}, {0.6, 0.6}, {0.1, 0.9}},
+		{{1, 0}, {1, 0}, {0, 1}},
+	}
+	assert.InDelta(t, 2.0/3, Accuracy{Mode: deep.ModeMultiLabel}.Compute(multilabel[0], multilabel[1]), 1e-12)
+	// by argmax, every example is correct
+	assert.Equal(t, 1.0, Accuracy{}.Compute(multilabel[0], multilabel[1]))
+
+	assert.True(t, math.IsNaN(Accuracy{}.Compute(nil, nil)))
+}
+
+func Test_RegressionMetrics(t *testing.T) {
+	estimates := [][]float64{{1, 0}, {2, 0}, {4, 1}}
+	ideals := [][]float64{{1, 0}, {3, 0}, {2, 1}}
+
+	assert.InDelta(t, 3.0/6, MAE{}.Compute(estimates, ideals), 1e-12)
+	assert.InDelta(t, math.Sqrt(5.0/6), RMSE{}.Compute(estimates, ideals), 1e-12)
+	// 1 - 5/2 for the first output, variance 2/3 and no residual for the second
+	assert.InDelta(t, (-1.5+1)/2, R2{}.Compute(estimates, ideals), 1e-12)
+	// of the four ideals that are not 0
+	assert.InDelta(t, (1.0/3+1)/4, MAPE{}.Compute(estimates, ideals), 1e-12)
+	assert.True(t, math.IsNaN(MAPE{}.Compute([][]float64{{1}}, [][]float64{{0}})))
+
+	assert.Equal(t, 1.0, R2{}.Compute([][]float64{{1}, {1}}, [][]float64{{1}, {1}}))
+	assert.Equal(t, 0.0, R2{}.Compute([][]float64{{1}, {2}}, [][]float64{{1}, {1}}))
+}
+
+type meanEstimate struct{}
+
+func (meanEstimate) Compute(estimates, ideals [][]float64) float64 {
+	var sum float64
+	for _, e := range estimates {
+		sum += e[0] / float64(len(estimates))
+	}
+	return sum
+}
+
+func Test_MetricName(t *testing.T) {
+	assert.Equal(t, "R2", metricName(R2{}))
+	assert.Equal(t, "meanEstimate", metricName(meanEstimate{}))
+}
+
+type metricRecorder struct {
+	CallbackFuncs
+	train, validation [][]float64
+}
+
+func (r *metricRecorder) OnMetrics(epoch int, train, validation []float64) {
+	r.train, r.validation = append(r.train, train), append(r.validation, validation)
+}
+
+func Test_TrainerMetrics(t *testing.T) {
+	data := Examples{
+		{Input: []float64{0}, Response: []float64{0.1}},
+		{Input: []float64{0.5}, Response: []float64{0.6}},
+		{Input: []float64{1}, Response: []float64{0.9}},
+	}
+	network := func() *deep.Neural {
+		rand.Seed(0)
+		return deep.NewNeural(&deep.Config{
+			Inputs:     1,
+			Layout:     []int{3, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(0.5, 0),
+			Bias:       true,
+			Dropout:    []float64{0.2, 0},
+		})
+	}
+	for _, trainer := range []func(...Option) Trainer{
+		func(opts ...Option) Trainer { return NewTrainer(NewSGD(0.1, 0, 0, false), 0, opts...) },
+		func(opts ...Option) Trainer { return NewBatchTrainer(NewSGD(0.1, 0, 0, false), 0, 2, 2, opts...) },
+	} {
+		plain := network()
+		trainer(WithSeed(1)).Train(plain, data, data[:2], 4)
+
+		recorder := &metricRecorder{}
+		recorder.EpochEnd = func(epoch int, trainLoss, valLoss float64, n *deep.Neural) error {
+			// the training examples are evaluated in shuffled order
+			for i, v := range evaluate(n, []Metric{MAE{}, R2{}}, data) {
+				assert.InDelta(t, v, recorder.train[epoch-1][i], 1e-12)
+			}
+			assert.Equal(t, evaluate(n, []Metric{MAE{}, R2{}}, data[:2]), recorder.validation[epoch-1])
+			return nil
+		}
+		measured := network()
+		trainer(WithSeed(1), WithMetrics(MAE{}, R2{}), WithCallbacks(recorder)).Train(measured, data, data[:2], 4)
+
+		assert.Len(t, recorder.train, 4)
+		// metrics do not change training
+		assert.Equal(t, plain.Weights(), measured.Weights())
+	}
+
+	// without a validation set, its metrics are NaN
+	recorder := &metricRecorder{}
+	NewTrainer(NewSGD(0.1, 0, 0, false), 0, WithMetrics(RMSE{}), WithCallbacks(recorder)).Train(network(), data, nil, 1)
+	assert.True(t, math.IsNaN(recorder.validation[0][0]))
+	assert.False(t, math.IsNaN(recorder.train[0][0]))
+
+	// verbose trainers print them on the validation set
+	var buf bytes.Buffer
+	trainer := NewTrainer(NewSGD(0.1, 0, 0, false), 1, WithMetrics(MAE{}, R2{}))
+	trainer.printer.w = tabwriter.NewWriter(&buf, 16, 0, 3, ' ', 0)
+	n := network()
+	trainer.Train(n, data, data, 1)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, []string{"Epochs", "Elapsed", "Loss", "(MSE)", "MAE", "R2"}, strings.Fields(lines[0]))
+	assert.Len(t, strings.Fields(lines[2]), 5)
+}
@@ -1,20 +1,130 @@
 package training
 
-import "math/rand"
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	deep "github.com/patrikeh/go-deep"
+)
 
 // Example is an input-target pair
 type Example struct {
 	Input    []float64
 	Response []float64
+	// Weight scales the contribution of the example to training and to the
+	// reported loss. Zero is 1, unless some example of the set trained on or
+	// validated by has a nonzero weight, in which case zero weight examples
+	// are skipped. Examples of an ExampleSource are never skipped.
+	Weight float64
+	// Reset marks the first step of a sequence under WithBPTT, before which
+	// the state of recurrent networks is reset
+	Reset bool
+}
+
+// weight returns the weight of e in a set that is weighted or not, see
+// Example.Weight
+func (e Example) weight(weighted bool) float64 {
+	if e.Weight != 0 || weighted {
+		return e.Weight
+	}
+	return 1
+}
+
+// class returns the class of e: the argmax of its response, or the label
+// of a single binary response, rounded
+func (e Example) class() int {
+	if len(e.Response) == 1 {
+		if e.Response[0] >= 0.5 {
+			return 1
+		}
+		return 0
+	}
+	return deep.ArgMax(e.Response)
 }
 
 // Examples is a set of input-output pairs
 type Examples []Example
 
+// weighted reports whether any example has a nonzero weight
+func (e Examples) weighted() bool {
+	for _, ex := range e {
+		if ex.Weight != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns an error naming the first example of e whose input n
+// cannot take, see deep.Neural.CheckInput, or whose response is not of the
+// size of the ideals of loss, see deep.IdealSize
+func (e Examples) check(n *deep.Neural, loss deep.Loss) error {
+	size := deep.IdealSize(loss, len(n.Layers[len(n.Layers)-1].Neurons))
+	for i, ex := range e {
+		if err := n.CheckInput(ex.Input); err != nil {
+			return fmt.Errorf("example %d: %w", i, err)
+		}
+		if len(ex.Response) != size {
+			return fmt.Errorf("example %d: response of %d values, expected %d", i, len(ex.Response), size)
+		}
+	}
+	return nil
+}
+
+// checkLoss returns an error if loss cannot train n, see deep.ValidateLoss
+func checkLoss(n *deep.Neural, loss deep.Loss) error {
+	if err := deep.ValidateLoss(loss, len(n.Layers[len(n.Layers)-1].Neurons)); err != nil {
+		return fmt.Errorf("invalid loss: %w", err)
+	}
+	return nil
+}
+
+// checkExamples checks loss and then examples and validation for training
+// by it, see Examples.check
+func checkExamples(n *deep.Neural, loss deep.Loss, examples, validation Examples) error {
+	if err := checkLoss(n, loss); err != nil {
+		return err
+	}
+	if err := examples.check(n, loss); err != nil {
+		return err
+	}
+	if err := validation.check(n, loss); err != nil {
+		return fmt.Errorf("validation %w", err)
+	}
+	return nil
+}
+
+// classes groups e by class, in order of first occurrence
+func (e Examples) classes() []Examples {
+	var groups []Examples
+	index := make(map[int]int)
+	for _, ex := range e {
+		c := ex.class()
+		i, ok := index[c]
+		if !ok {
+			i = len(groups)
+			index[c] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], ex)
+	}
+	return groups
+}
+
 // Shuffle shuffles slice in-place
 func (e Examples) Shuffle() {
+	e.ShuffleWith(nil)
+}
+
+// ShuffleWith shuffles e in-place by r, or the global source if r is nil
+func (e Examples) ShuffleWith(r *rand.Rand) {
+	intn := rand.Intn
+	if r != nil {
+		intn = r.Intn
+	}
 	for i := range e {
-		j := rand.Intn(i + 1)
+		j := intn(i + 1)
 		e[i], e[j] = e[j], e[i]
 	}
 }
@@ -22,8 +132,21 @@ func (e Examples) Shuffle() {
 // Split assigns each element to two new slices
 // according to probability p
 func (e Examples) Split(p float64) (first, second Examples) {
+	return e.SplitWith(nil, p)
+}
+
+// SplitWith assigns each example to first with probability p, drawn from
+// r or the global source if r is nil, and otherwise to second, in order.
+// Every example is in exactly one of them, so all are in first for p of 1
+// and in second for p of 0.
+func (e Examples) SplitWith(r *rand.Rand, p float64) (first, second Examples) {
+	draw := rand.Float64
+	if r != nil {
+		draw = r.Float64
+	}
 	for i := 0; i < len(e); i++ {
-		if p > rand.Float64() {
+		// draws are in [0, 1)
+		if p > draw() {
 			first = append(first, e[i])
 		} else {
 			second = append(second, e[i])
@@ -32,6 +155,31 @@ func (e Examples) Split(p float64) (first, second Examples) {
 	return
 }
 
+// StratifiedSplit splits e like StratifiedSplitWith, shuffling by the
+// global source
+func (e Examples) StratifiedSplit(p float64) (train, test Examples) {
+	return e.StratifiedSplitWith(nil, p)
+}
+
+// StratifiedSplitWith assigns a fraction p in [0, 1] of the examples of
+// each class, by the argmax of the response or the label of a single
+// binary response, to train and the others to test, picked by shuffling
+// each class by r. A class of m examples puts round(p*m) of them, half
+// rounded up, in train, but a class of one example always does. Both
+// halves hold the classes in order of first occurrence in e.
+func (e Examples) StratifiedSplitWith(r *rand.Rand, p float64) (train, test Examples) {
+	for _, class := range e.classes() {
+		class.ShuffleWith(r)
+		size := len(class)
+		if size > 1 {
+			size = int(math.Round(p * float64(size)))
+		}
+		train = append(train, class[:size]...)
+		test = append(test, class[size:]...)
+	}
+	return
+}
+
 // SplitSize splits slice into parts of size size
 func (e Examples) SplitSize(size int) []Examples {
 	res := make([]Examples, 0)
@@ -41,7 +189,9 @@ func (e Examples) SplitSize(size int) []Examples {
 	return res
 }
 
-// SplitN splits slice into n parts
+// SplitN splits slice into n parts, dealing the examples in turn such that
+// the sizes of the parts differ by at most one, e.g. folds for cross
+// validation of shuffled examples
 func (e Examples) SplitN(n int) []Examples {
 	res := make([]Examples, n)
 	for i, el := range e {
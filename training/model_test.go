@@ -37,3 +37,114 @@ func Test_Split(t *testing.T) {
 	assert.InEpsilon(t, len(a), 50, 0.1)
 	assert.InEpsilon(t, len(b), 50, 0.1)
 }
+
+func indexedExamples(n int) Examples {
+	e := make(Examples, n)
+	for i := range e {
+		e[i].Input = []float64{float64(i)}
+	}
+	return e
+}
+
+func indices(e Examples) []int {
+	var res []int
+	for _, ex := range e {
+		res = append(res, int(ex.Input[0]))
+	}
+	return res
+}
+
+func Test_ShuffleWith(t *testing.T) {
+	e := indexedExamples(10)
+	e.ShuffleWith(rand.New(rand.NewSource(1)))
+	assert.Equal(t, []int{9, 4, 2, 6, 8, 0, 3, 1, 7, 5}, indices(e))
+
+	again := indexedExamples(10)
+	again.ShuffleWith(rand.New(rand.NewSource(1)))
+	assert.Equal(t, e, again)
+}
+
+func Test_SplitWith(t *testing.T) {
+	e := indexedExamples(10)
+
+	a, b := e.SplitWith(rand.New(rand.NewSource(1)), 0.5)
+	assert.Equal(t, []int{3, 4, 6, 7, 8, 9}, indices(a))
+	assert.Equal(t, []int{0, 1, 2, 5}, indices(b))
+
+	a, b = e.SplitWith(rand.New(rand.NewSource(1)), 0)
+	assert.Empty(t, a)
+	assert.Equal(t, e, b)
+	a, b = e.SplitWith(rand.New(rand.NewSource(1)), 1)
+	assert.Equal(t, e, a)
+	assert.Empty(t, b)
+}
+
+func Test_SplitNPartitions(t *testing.T) {
+	parts := indexedExamples(7).SplitN(3)
+	assert.Equal(t, []int{0, 3, 6}, indices(parts[0]))
+	assert.Equal(t, []int{1, 4}, indices(parts[1]))
+	assert.Equal(t, []int{2, 5}, indices(parts[2]))
+}
+
+func Test_StratifiedSplit(t *testing.T) {
+	// 5% positives of a binary label, and three classes of 60, 30 and 10
+	binary, classes := make(Examples, 200), make(Examples, 100)
+	for i := range binary {
+		binary[i].Input = []float64{float64(i)}
+		binary[i].Response = []float64{0}
+		if i%20 == 0 {
+			binary[i].Response[0] = 1
+		}
+	}
+	for i := range classes {
+		classes[i].Input = []float64{float64(i)}
+		classes[i].Response = make([]float64, 3)
+		switch {
+		case i < 60:
+			classes[i].Response[0] = 1
+		case i < 90:
+			classes[i].Response[1] = 1
+		default:
+			classes[i].Response[2] = 1
+		}
+	}
+	counts := func(e Examples) map[int]int {
+		c := make(map[int]int)
+		for _, ex := range e {
+			c[ex.class()]++
+		}
+		return c
+	}
+
+	for _, e := range []Examples{binary, classes} {
+		all := counts(e)
+		for _, p := range []float64{0.75, 0.7, 0.33} {
+			train, test := e.StratifiedSplitWith(rand.New(rand.NewSource(0)), p)
+			assert.Len(t, train, len(e)-len(test))
+			trainCounts, testCounts := counts(train), counts(test)
+			for c, n := range all {
+				assert.InDelta(t, p*float64(n), trainCounts[c], 1)
+				assert.InDelta(t, (1-p)*float64(n), testCounts[c], 1)
+			}
+			seen := make(map[float64]bool)
+			for _, ex := range append(train, test...) {
+				assert.False(t, seen[ex.Input[0]])
+				seen[ex.Input[0]] = true
+			}
+		}
+	}
+
+	// the split is reproducible by the source
+	a, _ := classes.StratifiedSplitWith(rand.New(rand.NewSource(1)), 0.5)
+	b, _ := classes.StratifiedSplitWith(rand.New(rand.NewSource(1)), 0.5)
+	assert.Equal(t, a, b)
+
+	// a class of one example goes to train
+	single := Examples{
+		{Response: []float64{1, 0}}, {Response: []float64{1, 0}}, {Response: []float64{1, 0}},
+		{Response: []float64{0, 1}},
+	}
+	train, test := single.StratifiedSplit(0.2)
+	assert.Equal(t, map[int]int{0: 1, 1: 1}, counts(train))
+	assert.Equal(t, map[int]int{0: 2}, counts(test))
+}
@@ -0,0 +1,119 @@
+package training
+
+import (
+	deep "github.com/patrikeh/go-deep"
+)
+
+// normGradients are the gradients of the scale and shift of each batch
+// normalized layer, nil for other layers
+type normGradients struct {
+	gammas, betas [][]float64
+}
+
+func newNormGradients(layers []*deep.Layer) normGradients {
+	g := normGradients{
+		gammas: make([][]float64, len(layers)),
+		betas:  make([][]float64, len(layers)),
+	}
+	for i, l := range layers {
+		if l.Norm != nil {
+			g.gammas[i] = make([]float64, len(l.Neurons))
+			g.betas[i] = make([]float64, len(l.Neurons))
+		}
+	}
+	return g
+}
+
+// add adds the gradients of other to g and zeroes other
+func (g normGradients) add(other normGradients) {
+	for i := range g.gammas {
+		for j := range g.gammas[i] {
+			g.gammas[i][j] += other.gammas[i][j]
+			g.betas[i][j] += other.betas[i][j]
+			other.gammas[i][j], other.betas[i][j] = 0, 0
+		}
+	}
+}
+
+// squared returns the squared L2 norm of the gradients of the layers of n
+// that are not frozen, divided by weights
+func (g normGradients) squared(n *deep.Neural, weights float64) float64 {
+	var squared float64
+	for i := range g.gammas {
+		if n.Layers[i].Frozen {
+			continue
+		}
+		for j := range g.gammas[i] {
+			squared += (g.gammas[i][j] / weights) * (g.gammas[i][j] / weights)
+			squared += (g.betas[i][j] / weights) * (g.betas[i][j] / weights)
+		}
+	}
+	return squared
+}
+
+// apply updates the scale and shift of each normalized layer of n that is
+// not frozen by the gradients divided by weights, from solver index idx on,
+// zeroes the gradients and returns the index after the last
+func (g normGradients) apply(n *deep.Neural, solver Solver, opts options, it, idx int, weights, scale float64) int {
+	for i, l := range n.Layers {
+		if l.Norm == nil {
+			continue
+		}
+		for j := range l.Neurons {
+			if l.Frozen {
+				g.gammas[i][j], g.betas[i][j] = 0, 0
+				idx += 2
+				continue
+			}
+			l.Norm.Gamma[j] += opts.lr(i) * solver.Update(l.Norm.Gamma[j], opts.clip(g.gammas[i][j]/weights, scale), it, idx)
+			l.Norm.Beta[j] += opts.lr(i) * solver.Update(l.Norm.Beta[j], opts.clip(g.betas[i][j]/weights, scale), it, idx+1)
+			g.gammas[i][j], g.betas[i][j] = 0, 0
+			idx += 2
+		}
+	}
+	return idx
+}
+
+// normalizeDeltas turns the deltas of the normalized sums of layer l into
+// deltas of its sums, for layer normalization or batch normalization by
+// fixed statistics, adding the gradients of its scale and shift to gammas
+// and betas
+func normalizeDeltas(l *deep.Layer, deltas []float64, gammas, betas []float64) {
+	for j, neuron := range l.Neurons {
+		gammas[j] += deltas[j] * neuron.Normalized
+		betas[j] += deltas[j]
+		deltas[j] *= neuron.NormScale()
+	}
+	if !l.Norm.Layer {
+		return
+	}
+	// the statistics of the layer depend on every sum
+	size := float64(len(l.Neurons))
+	var mean, normalized float64
+	for j, neuron := range l.Neurons {
+		mean += deltas[j] / size
+		normalized += deltas[j] * neuron.Normalized / size
+	}
+	for j, neuron := range l.Neurons {
+		deltas[j] -= mean + neuron.Normalized*normalized
+	}
+}
+
+// normalizeBatchDeltas is normalizeDeltas for normalization by the
+// statistics of the batch of replicas nets, with deltas by replica
+func normalizeBatchDeltas(nets []*deep.Neural, i int, deltas [][][]float64, gammas, betas []float64) {
+	size := float64(len(nets))
+	for j := range nets[0].Layers[i].Neurons {
+		var sum, normalized float64
+		for r, n := range nets {
+			sum += deltas[r][i][j]
+			normalized += deltas[r][i][j] * n.Layers[i].Neurons[j].Normalized
+		}
+		gammas[j] += normalized
+		betas[j] += sum
+		for r, n := range nets {
+			neuron := n.Layers[i].Neurons[j]
+			deltas[r][i][j] = neuron.NormScale() * (deltas[r][i][j] - sum/size - neuron.Normalized*normalized/size)
+		}
+	}
+}
@@ -2,48 +2,98 @@ package training
 
 import (
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"strings"
 	"text/tabwriter"
 	"time"
 
 	deep "github.com/patrikeh/go-deep"
 )
 
-// StatsPrinter prints training progress
+// StatsPrinter is the default Logger, which prints a table of the
+// progress of training on a validation set
 type StatsPrinter struct {
-	w *tabwriter.Writer
+	w        *tabwriter.Writer
+	loss     deep.Loss
+	schedule *schedule
+	// metrics are printed on the validation set
+	metrics []Metric
+	// accuracy is printed for ModeMultiClass networks
+	accuracy bool
 }
 
-// NewStatsPrinter creates a StatsPrinter
+// NewStatsPrinter creates a StatsPrinter to stdout
 func NewStatsPrinter() *StatsPrinter {
-	return &StatsPrinter{tabwriter.NewWriter(os.Stdout, 16, 0, 3, ' ', 0)}
+	return newStatsPrinter(nil)
+}
+
+// newStatsPrinter creates a StatsPrinter to w, stdout if nil
+func newStatsPrinter(w io.Writer) *StatsPrinter {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &StatsPrinter{w: tabwriter.NewWriter(w, 16, 0, 3, ' ', 0)}
 }
 
 // Init initializes printer
 func (p *StatsPrinter) Init(n *deep.Neural) {
 	fmt.Fprintf(p.w, "Epochs\tElapsed\tLoss (%s)\t", n.Config.Loss)
-	if n.Config.Mode == deep.ModeMultiClass {
-		fmt.Fprintf(p.w, "Accuracy\t\n---\t---\t---\t---\t\n")
-	} else {
-		fmt.Fprintf(p.w, "\n---\t---\t---\t\n")
+	columns := 3
+	p.accuracy = n.Config.Mode == deep.ModeMultiClass
+	if p.accuracy {
+		fmt.Fprintf(p.w, "Accuracy\t")
+		columns++
 	}
+	for _, m := range p.metrics {
+		fmt.Fprintf(p.w, "%s\t", metricName(m))
+		columns++
+	}
+	if p.schedule != nil {
+		fmt.Fprintf(p.w, "LR\t")
+		columns++
+	}
+	fmt.Fprintf(p.w, "\n%s\n", strings.Repeat("---\t", columns))
 }
 
 // PrintProgress prints the current state of training
 func (p *StatsPrinter) PrintProgress(n *deep.Neural, validation Examples, elapsed time.Duration, iteration int) {
-	fmt.Fprintf(p.w, "%d\t%s\t%.4f\t%s\n",
-		iteration,
-		elapsed.String(),
-		crossValidate(n, validation),
-		formatAccuracy(n, validation))
-	p.w.Flush()
+	stats := EpochStats{
+		Epoch:          iteration,
+		Elapsed:        elapsed,
+		ValidationLoss: validationLoss(n, p.loss, validation),
+	}
+	p.accuracy = n.Config.Mode == deep.ModeMultiClass
+	if p.accuracy {
+		stats.Accuracy = accuracy(n, validation)
+	}
+	for i, v := range evaluate(n, p.metrics, validation) {
+		stats.Metrics = append(stats.Metrics, MetricStats{Name: metricName(p.metrics[i]), Validation: v})
+	}
+	if p.schedule != nil {
+		stats.LR = p.schedule.solver.LR()
+	}
+	p.Epoch(stats)
 }
 
-func formatAccuracy(n *deep.Neural, validation Examples) string {
-	if n.Config.Mode == deep.ModeMultiClass {
-		return fmt.Sprintf("%.2f\t", accuracy(n, validation))
+// Epoch prints a row of stats, if they are of a validation set
+func (p *StatsPrinter) Epoch(stats EpochStats) {
+	if math.IsNaN(stats.ValidationLoss) {
+		return
+	}
+	fmt.Fprintf(p.w, "%d\t%s\t%.4f\t", stats.Epoch, stats.Elapsed.String(), stats.ValidationLoss)
+	if p.accuracy {
+		fmt.Fprintf(p.w, "%.2f\t", stats.Accuracy)
 	}
-	return ""
+	for _, m := range stats.Metrics {
+		fmt.Fprintf(p.w, "%.4f\t", m.Validation)
+	}
+	if p.schedule != nil {
+		fmt.Fprintf(p.w, "%.3g\t", stats.LR)
+	}
+	fmt.Fprintln(p.w)
+	p.w.Flush()
 }
 
 func accuracy(n *deep.Neural, validation Examples) float64 {
@@ -58,11 +108,36 @@ func accuracy(n *deep.Neural, validation Examples) float64 {
 }
 
 func crossValidate(n *deep.Neural, validation Examples) float64 {
+	return validationLoss(n, nil, validation)
+}
+
+// validationLoss is the loss of n on validation, using the loss given by
+// n's config if loss is nil
+func validationLoss(n *deep.Neural, loss deep.Loss, validation Examples) float64 {
+	if loss == nil {
+		loss = n.Loss()
+	}
 	predictions, responses := make([][]float64, len(validation)), make([][]float64, len(validation))
 	for i := 0; i < len(validation); i++ {
 		predictions[i] = n.Predict(validation[i].Input)
 		responses[i] = validation[i].Response
 	}
 
-	return deep.GetLoss(n.Config.Loss).F(predictions, responses)
+	if !validation.weighted() {
+		return loss.F(predictions, responses)
+	}
+
+	var sum, c, weights float64
+	for i, e := range validation {
+		w := e.weight(true)
+		if w == 0 {
+			continue
+		}
+		compensate(&sum, &c, w*loss.F(predictions[i:i+1], responses[i:i+1]))
+		weights += w
+	}
+	if math.IsInf(sum, 0) {
+		return sum / weights
+	}
+	return (sum + c) / weights
 }
@@ -0,0 +1,159 @@
+package training
+
+import (
+	deep "github.com/patrikeh/go-deep"
+)
+
+// WithBPTT trains recurrent networks on the examples as a sequence, in
+// their given order, by truncated backpropagation through time: the loss
+// of each step is backpropagated through up to window steps, the current
+// one included. The state is reset at the start of every epoch and at
+// examples that Reset. Only the OnlineTrainer trains over sequences;
+// otherwise every example is a sequence of its own.
+func WithBPTT(window int) Option {
+	return func(o *options) {
+		o.bptt = window
+	}
+}
+
+// record is what backpropagation through time needs of a past step
+type record struct {
+	// inputs of the synapses of each layer, alike for each neuron
+	inputs [][]float64
+	// derivatives of the output of each neuron
+	derivatives [][]float64
+	// slopes are the derivatives of the outputs of PReLU neurons by Alpha
+	slopes [][]float64
+}
+
+// history keeps the records of the last steps of a sequence
+type history struct {
+	// records is a ring of the last steps, the latest before next
+	records    []record
+	next, size int
+	// deltas of each layer at the step being backpropagated through and
+	// at the step after, and the gradients of its outputs
+	deltas, later, outGradients [][]float64
+}
+
+func newHistory(n *deep.Neural, window int) *history {
+	h := &history{
+		records:      make([]record, window-1),
+		deltas:       make([][]float64, len(n.Layers)),
+		later:        make([][]float64, len(n.Layers)),
+		outGradients: make([][]float64, len(n.Layers)),
+	}
+	for r := range h.records {
+		h.records[r] = record{
+			inputs:      make([][]float64, len(n.Layers)),
+			derivatives: make([][]float64, len(n.Layers)),
+			slopes:      make([][]float64, len(n.Layers)),
+		}
+		for i, l := range n.Layers {
+			h.records[r].inputs[i] = make([]float64, len(l.Neurons[0].In))
+			h.records[r].derivatives[i] = make([]float64, len(l.Neurons))
+			h.records[r].slopes[i] = make([]float64, len(l.Neurons))
+		}
+	}
+	for i, l := range n.Layers {
+		h.deltas[i] = make([]float64, len(l.Neurons))
+		h.later[i] = make([]float64, len(l.Neurons))
+		h.outGradients[i] = make([]float64, len(l.Neurons))
+	}
+	return h
+}
+
+// reset forgets the past steps, at the start of a sequence
+func (h *history) reset() {
+	h.next, h.size = 0, 0
+}
+
+// record keeps the last forward pass of n as the latest step
+func (h *history) record(n *deep.Neural) {
+	if len(h.records) == 0 {
+		return
+	}
+	r := h.records[h.next]
+	for i, l := range n.Layers {
+		for k, s := range l.Neurons[0].In {
+			r.inputs[i][k] = s.In
+		}
+		for j, neuron := range l.Neurons {
+			r.derivatives[i][j] = neuron.Derivative()
+			if l.A == deep.ActivationPReLU {
+				r.slopes[i][j] = neuron.Mask() * deep.PReLU{}.DfAlpha(neuron.Sum)
+			}
+		}
+	}
+	h.next = (h.next + 1) % len(h.records)
+	if h.size < len(h.records) {
+		h.size++
+	}
+}
+
+// backward backpropagates deltas, those of the current step, through the
+// recurrent layers of n into the past steps, adding the gradients of the
+// weights and slopes of each layer that is not frozen to gradients and
+// alphas
+func (h *history) backward(n *deep.Neural, deltas [][]float64, gradients [][][]float64, alphas []float64) {
+	for i := range deltas {
+		copy(h.later[i], deltas[i])
+	}
+	output := len(n.Layers) - 1
+	for step := 0; step < h.size; step++ {
+		r := h.records[(h.next-1-step+2*len(h.records))%len(h.records)]
+		for i := output - 1; i >= trainable(n); i-- {
+			l := n.Layers[i]
+			for m, neuron := range l.Neurons {
+				var sum float64
+				if i+1 < output {
+					for k, s := range neuron.Out {
+						sum += s.Weight * h.deltas[i+1][k]
+					}
+				}
+				h.outGradients[i][m] = sum
+			}
+			addSkipped(n, i, h.outGradients)
+			for m, sum := range h.outGradients[i] {
+				// the state is the output before the skipped outputs
+				for j, synapses := range l.Recurrent {
+					sum += synapses[m].Weight * h.later[i][j]
+				}
+				h.deltas[i][m] = r.derivatives[i][m] * sum
+				if l.A == deep.ActivationPReLU && !l.Frozen {
+					alphas[i] += sum * r.slopes[i][m]
+				}
+			}
+			if l.Frozen {
+				continue
+			}
+			for j, neuron := range l.Neurons {
+				for k, s := range neuron.In {
+					if !s.Pruned {
+						gradients[i][j][k] += h.deltas[i][j] * r.inputs[i][k]
+					}
+				}
+			}
+		}
+		h.deltas, h.later = h.later, h.deltas
+	}
+}
+
+// learnStep learns from e as the next step of a sequence, backpropagating
+// through the past steps
+func (t *OnlineTrainer) learnStep(n *deep.Neural, e Example, it int) {
+	if e.Reset {
+		n.ResetState()
+		t.history.reset()
+	}
+	n.Forward(e.Input)
+	if weight := e.weight(t.weighted); weight != 0 {
+		t.calculateDeltas(n, e.Response, weight)
+		t.accumulate(n)
+		t.history.backward(n, t.deltas, t.gradients, t.accumulatedAlphas)
+	}
+	t.history.record(n)
+	if t.steps == t.opts.accumulation() {
+		t.step(n, it)
+	}
+}
@@ -0,0 +1,175 @@
+package training
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BPTTGradient(t *testing.T) {
+	config := func() *deep.Config {
+		return &deep.Config{
+			Inputs:      2,
+			Layout:      []int{3, 3, 2},
+			Activation:  deep.ActivationTanh,
+			Activations: []deep.ActivationType{deep.ActivationNone, deep.ActivationPReLU, deep.ActivationNone},
+			Mode:        deep.ModeRegression,
+			Weight:      deep.NewNormal(1, 0),
+			Bias:        true,
+			Recurrent:   []bool{true, true, false},
+			Skips:       []deep.Skip{{From: 0, To: 1}},
+		}
+	}
+	sequence := Examples{
+		{Input: []float64{0.5, -1}, Response: []float64{0.2, -0.4}},
+		{Input: []float64{-0.3, 0.8}, Response: []float64{-0.1, 0.6}},
+		{Input: []float64{1, 0.2}, Response: []float64{0.7, 0.1}},
+		{Input: []float64{-0.6, -0.5}, Response: []float64{0, -0.8}},
+	}
+	gradients := func(window int) []float64 {
+		rand.Seed(0)
+		n := deep.NewNeural(config())
+		solver := &gradientSolver{}
+		trainer := NewTrainer(solver, 0, WithBPTT(window), WithAccumulationSteps(len(sequence)))
+		trainer.Train(n, sequence, nil, 1)
+		return solver.gradients
+	}
+
+	rand.Seed(0)
+	n := deep.NewNeural(config())
+	// the mean loss of the steps of the sequence
+	loss := func() float64 {
+		n.ResetState()
+		var sum float64
+		for _, e := range sequence {
+			for i, v := range n.Predict(e.Input) {
+				sum += 0.5 * math.Pow(v-e.Response[i], 2) / float64(len(sequence))
+			}
+		}
+		return sum
+	}
+	const h = 1e-6
+	var numerical []float64
+	for _, l := range n.Layers {
+		for _, neuron := range l.Neurons {
+			for _, s := range neuron.In {
+				w := s.Weight
+				s.Weight = w + h
+				plus := loss()
+				s.Weight = w - h
+				minus := loss()
+				s.Weight = w
+				numerical = append(numerical, (plus-minus)/(2*h))
+			}
+		}
+	}
+	alpha := n.Layers[1].Alpha
+	n.Layers[1].Alpha = alpha + h
+	plus := loss()
+	n.Layers[1].Alpha = alpha - h
+	minus := loss()
+	numerical = append(numerical, (plus-minus)/(2*h))
+
+	// a window over the whole sequence gives the exact gradient
+	exact := gradients(len(sequence))
+	assert.Len(t, exact, n.NumWeights()+1)
+	assert.InDeltaSlice(t, numerical, exact, 1e-6)
+
+	// shorter windows truncate it
+	truncated := gradients(2)
+	assert.Len(t, truncated, len(exact))
+	var diff float64
+	for i := range exact {
+		diff += math.Abs(exact[i] - truncated[i])
+	}
+	assert.True(t, diff > 1e-3, "%f", diff)
+}
+
+// parity returns a sequence of random bits, each labelled by the parity
+// of the last 3 bits
+func parity(steps int) Examples {
+	bits := make([]float64, steps)
+	examples := make(Examples, steps)
+	for i := range bits {
+		bits[i] = float64(rand.Intn(2))
+		var ones int
+		for j := i; j >= 0 && j > i-3; j-- {
+			ones += int(bits[j])
+		}
+		examples[i] = Example{Input: []float64{bits[i]}, Response: []float64{float64(ones % 2)}}
+	}
+	return examples
+}
+
+func Test_BPTTParity(t *testing.T) {
+	accuracy := func(opts ...Option) float64 {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     1,
+			Layout:     []int{8, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeBinary,
+			Weight:     deep.NewNormal(0.5, 0),
+			Bias:       true,
+			Recurrent:  []bool{true, false},
+		})
+		trainer := NewTrainer(NewAdam(0.01, 0.9, 0.999, 1e-8), 0, opts...)
+		trainer.Train(n, parity(2000), nil, 20)
+
+		n.ResetState()
+		test := parity(500)
+		var correct int
+		for _, e := range test {
+			if (n.Predict(e.Input)[0] > 0.5) == (e.Response[0] == 1) {
+				correct++
+			}
+		}
+		return float64(correct) / float64(len(test))
+	}
+
+	bptt := accuracy(WithBPTT(4))
+	assert.True(t, bptt > 0.98, "%f", bptt)
+	// gradients through the current step only are slower to train the
+	// state to hold the past inputs, and without a sequence it holds none
+	step := accuracy(WithBPTT(1))
+	assert.True(t, step < bptt-0.05, "%f", step)
+	none := accuracy()
+	assert.True(t, none < 0.6, "%f", none)
+}
+
+func Test_BPTTClipping(t *testing.T) {
+	// linear recurrent weights of unit scale make the gradient grow through
+	// time
+	gradients := func(opts ...Option) []float64 {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     1,
+			Layout:     []int{4, 1},
+			Activation: deep.ActivationLinear,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(1, 0),
+			Recurrent:  []bool{true, false},
+		})
+		sequence := make(Examples, 20)
+		for i := range sequence {
+			sequence[i] = Example{Input: []float64{1}, Response: []float64{0}}
+		}
+		solver := &gradientSolver{}
+		trainer := NewTrainer(solver, 0, append(opts, WithAccumulationSteps(len(sequence)))...)
+		trainer.Train(n, sequence, nil, 1)
+		return solver.gradients
+	}
+	shallow := gradients(WithBPTT(1))
+	through := gradients(WithBPTT(20))
+	assert.True(t, deep.Dot(through, through) > 10*deep.Dot(shallow, shallow))
+
+	// clipping rescales the gradient through time as a whole
+	clipped := gradients(WithBPTT(20), WithClipNorm(1))
+	assert.InDelta(t, 1, math.Sqrt(deep.Dot(clipped, clipped)), 1e-9)
+	for i, g := range clipped {
+		assert.InDelta(t, through[i]*clipped[0]/through[0], g, 1e-9)
+	}
+}
@@ -0,0 +1,137 @@
+package training
+
+import (
+	"math"
+
+	deep "github.com/patrikeh/go-deep"
+)
+
+// Safeguards protect continuous online training from pathological
+// examples by an exponential moving average of the losses of the examples
+// learned from. Each safeguard is off unless its threshold is positive,
+// but the update of an example whose loss is not finite is always skipped
+// and left out of the average.
+type Safeguards struct {
+	// Decay of the moving average, 0.99 by default
+	Decay float64
+	// SkipFactor skips the update of every example whose loss exceeds
+	// SkipFactor times the average, which it is then left out of
+	SkipFactor float64
+	// Patience multiplies the learning rate by Factor, 0.1 by default and
+	// down to Min, whenever the average has not improved on its best by
+	// more than MinDelta for Patience examples
+	Patience int
+	Factor   float64
+	MinDelta float64
+	Min      float64
+}
+
+// WithSafeguards safeguards the updates of the OnlineTrainer by s, which
+// sends an UpdateSkippedEvent for every skipped example and an
+// LRReducedEvent for every reduction to the events of WithEvents. Reducing
+// the learning rate requires an LRSolver, whose learning rate is reduced
+// on top of any schedule and restored after training. Recurrent training
+// by WithBPTT is not safeguarded.
+func WithSafeguards(s Safeguards) Option {
+	return func(o *options) {
+		o.safeguards = &s
+	}
+}
+
+// guard keeps the state of the safeguards over a training run
+type guard struct {
+	*Safeguards
+	solver LRSolver
+	base   float64
+	// average of the losses, NaN before the first example
+	average float64
+	best    float64
+	wait    int
+	scale   float64
+}
+
+// newGuard returns the guard of s for solver, or nil if s is nil, and
+// panics if the learning rate of solver is to be reduced but cannot be
+func newGuard(s *Safeguards, solver Solver) *guard {
+	if s == nil {
+		return nil
+	}
+	g := &guard{Safeguards: s, average: math.NaN(), best: math.Inf(1), scale: 1}
+	if s.Patience > 0 {
+		lr, ok := solver.(LRSolver)
+		if !ok {
+			panic("training: solver does not support learning rate reduction")
+		}
+		g.solver, g.base = lr, lr.LR()
+	}
+	return g
+}
+
+// admit records the loss of an example learned from after epoch and
+// reports whether to update by it, sending the events of the safeguards
+func (g *guard) admit(o options, loss float64, epoch int) bool {
+	if g == nil {
+		return true
+	}
+	if math.IsNaN(loss) || math.IsInf(loss, 0) {
+		o.emit(UpdateSkippedEvent{Epoch: epoch, Loss: loss, Average: g.average})
+		return false
+	}
+	if math.IsNaN(g.average) {
+		g.average = loss
+	} else {
+		if g.SkipFactor > 0 && loss > g.SkipFactor*g.average {
+			o.emit(UpdateSkippedEvent{Epoch: epoch, Loss: loss, Average: g.average})
+			return false
+		}
+		decay := fparam(g.Decay, 0.99)
+		g.average = decay*g.average + (1-decay)*loss
+	}
+	if g.Patience <= 0 {
+		return true
+	}
+	if g.average < g.best-g.MinDelta {
+		g.best, g.wait = g.average, 0
+		return true
+	}
+	if g.wait++; g.wait >= g.Patience {
+		g.scale *= fparam(g.Factor, 0.1)
+		g.wait = 0
+		o.emit(LRReducedEvent{Epoch: epoch, LR: g.lr(g.base)})
+	}
+	return true
+}
+
+// lr returns the learning rate lr reduced by the guard
+func (g *guard) lr(lr float64) float64 {
+	return math.Max(lr*g.scale, g.Min)
+}
+
+// apply reduces the learning rate of the solver for the next update, from
+// that of the schedule if scheduled and its base otherwise
+func (g *guard) apply(scheduled bool) {
+	if g == nil || g.solver == nil {
+		return
+	}
+	lr := g.base
+	if scheduled {
+		lr = g.solver.LR()
+	}
+	g.solver.SetLR(g.lr(lr))
+}
+
+// restore resets the learning rate of the solver to its base
+func (g *guard) restore() {
+	if g != nil && g.solver != nil {
+		g.solver.SetLR(g.base)
+	}
+}
+
+// exampleLoss returns the loss of the output of n on ideal, copied into
+// estimate
+func exampleLoss(n *deep.Neural, loss deep.Loss, ideal, estimate []float64) float64 {
+	for i, neuron := range n.Layers[len(n.Layers)-1].Neurons {
+		estimate[i] = neuron.Value
+	}
+	return loss.F([][]float64{estimate}, [][]float64{ideal})
+}
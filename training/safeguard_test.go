@@ -0,0 +1,154 @@
+package training
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+// lrRecorder records the learning rate of every update
+type lrRecorder struct {
+	*SGD
+	lrs []float64
+}
+
+func (r *lrRecorder) Update(value, gradient float64, iteration, idx int) float64 {
+	if idx == 0 {
+		r.lrs = append(r.lrs, r.LR())
+	}
+	return r.SGD.Update(value, gradient, iteration, idx)
+}
+
+func safeguarded() *deep.Neural {
+	rand.Seed(0)
+	return deep.NewNeural(&deep.Config{
+		Inputs:     1,
+		Layout:     []int{4, 1},
+		Activation: deep.ActivationTanh,
+		Mode:       deep.ModeRegression,
+		Weight:     deep.NewNormal(0.5, 0),
+		Bias:       true,
+	})
+}
+
+func Test_SafeguardsSkip(t *testing.T) {
+	var clean Examples
+	for x := 0.0; x < 1; x += 0.05 {
+		clean = append(clean, Example{Input: []float64{x}, Response: []float64{math.Sin(3 * x)}})
+	}
+	outlier := make(Examples, 0, len(clean)+1)
+	outlier = append(outlier, clean[:10]...)
+	outlier = append(outlier, Example{Input: []float64{0.5}, Response: []float64{100}})
+	outlier = append(outlier, clean[10:]...)
+
+	train := func(data Examples, opts ...Option) (*deep.Neural, []Event) {
+		events := make(chan Event, 100)
+		n := safeguarded()
+		NewTrainer(NewSGD(0.1, 0, 0, false), 0, append(opts, WithShuffle(false), WithEvents(events))...).Train(n, data, nil, 2)
+		close(events)
+		var skipped []Event
+		for e := range events {
+			if _, ok := e.(UpdateSkippedEvent); ok {
+				skipped = append(skipped, e)
+			}
+		}
+		return n, skipped
+	}
+	guard := WithSafeguards(Safeguards{Decay: 0.9, SkipFactor: 50})
+
+	unguarded, _ := train(clean)
+	guarded, skipped := train(clean, guard)
+	assert.Equal(t, unguarded.Weights(), guarded.Weights())
+	assert.Empty(t, skipped)
+
+	// the outlier leaves the weights as if it were absent
+	n, skipped := train(outlier, guard)
+	assert.Equal(t, guarded.Weights(), n.Weights())
+	if assert.Len(t, skipped, 2) {
+		e := skipped[0].(UpdateSkippedEvent)
+		assert.Equal(t, 1, e.Epoch)
+		assert.True(t, e.Loss > 50*e.Average, "%v", e)
+	}
+	n, _ = train(outlier)
+	assert.NotEqual(t, guarded.Weights(), n.Weights())
+}
+
+func Test_SafeguardsReduceLR(t *testing.T) {
+	data := make(Examples, 9)
+	for i := range data {
+		data[i] = Example{Input: []float64{0}, Response: []float64{0}}
+	}
+	// the average of 1, 2, 2, ... never improves on the first loss
+	script := []float64{1}
+	for len(script) < 2*len(data) {
+		script = append(script, 2)
+	}
+	var calls int
+	loss := scriptedLoss{script: script, calls: &calls}
+	solver := &lrRecorder{SGD: NewSGD(0.1, 0, 0, false)}
+	events := make(chan Event, 100)
+	NewTrainer(solver, 0, WithLoss(loss), WithShuffle(false), WithEvents(events),
+		WithSafeguards(Safeguards{Decay: 0.5, Patience: 3, Factor: 0.5})).Train(safeguarded(), data, nil, 1)
+	close(events)
+
+	assert.InDeltaSlice(t, []float64{0.1, 0.1, 0.1, 0.05, 0.05, 0.05, 0.025, 0.025, 0.025}, solver.lrs, 1e-12)
+	var reduced []float64
+	for e := range events {
+		if r, ok := e.(LRReducedEvent); ok {
+			reduced = append(reduced, r.LR)
+		}
+	}
+	assert.InDeltaSlice(t, []float64{0.05, 0.025}, reduced, 1e-12)
+	assert.Equal(t, 0.1, solver.LR())
+
+	assert.Panics(t, func() {
+		NewTrainer(solverFunc(nil), 0, WithSafeguards(Safeguards{Patience: 1})).Train(safeguarded(), data, nil, 1)
+	})
+}
+
+// nanLoss is the mean squared error, but NaN for an ideal of 42
+type nanLoss struct {
+	deep.MeanSquared
+}
+
+func (l nanLoss) F(estimate, ideal [][]float64) float64 {
+	if ideal[0][0] == 42 {
+		return math.NaN()
+	}
+	return l.MeanSquared.F(estimate, ideal)
+}
+
+func Test_SafeguardsNonFinite(t *testing.T) {
+	var clean Examples
+	for x := 0.0; x < 1; x += 0.05 {
+		clean = append(clean, Example{Input: []float64{x}, Response: []float64{math.Sin(3 * x)}})
+	}
+	// the first example of a loss that is not finite neither starts nor
+	// poisons the average, and the outlier after it is still skipped
+	poisoned := append(Examples{{Input: []float64{0.5}, Response: []float64{42}}}, clean[:10]...)
+	poisoned = append(poisoned, Example{Input: []float64{0.5}, Response: []float64{100}})
+	poisoned = append(poisoned, clean[10:]...)
+
+	train := func(data Examples) (*deep.Neural, int) {
+		events := make(chan Event, 100)
+		n := safeguarded()
+		NewTrainer(NewSGD(0.1, 0, 0, false), 0, WithLoss(nanLoss{}), WithShuffle(false), WithEvents(events),
+			WithSafeguards(Safeguards{Decay: 0.9, SkipFactor: 50, Patience: 1000})).Train(n, data, nil, 2)
+		close(events)
+		var skipped int
+		for e := range events {
+			if _, ok := e.(UpdateSkippedEvent); ok {
+				skipped++
+			}
+		}
+		return n, skipped
+	}
+	guarded, skipped := train(clean)
+	assert.Equal(t, 0, skipped)
+	n, skipped := train(poisoned)
+	assert.Equal(t, guarded.Weights(), n.Weights())
+	assert.Equal(t, 4, skipped)
+}
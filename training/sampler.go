@@ -0,0 +1,97 @@
+package training
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// Sampler draws the examples of every epoch from the training examples in
+// place of shuffling them, by r or the global source if r is nil
+type Sampler interface {
+	Sample(examples Examples, r *rand.Rand) Examples
+}
+
+// WithSampler draws the examples of every epoch by s, whose mini-batches
+// are then consecutive examples of the sample. The source of WithSeed is
+// passed to s, which must draw the same sample from the same source for
+// training to be resumed exactly. Recurrent training by WithBPTT does not
+// sample.
+func WithSampler(s Sampler) Option {
+	return func(o *options) {
+		o.sampler = s
+	}
+}
+
+// sample returns the examples of an epoch: a sample, or train after
+// shuffling it unless disabled. It reports whether the source was drawn from.
+func (o options) sample(train Examples) (Examples, bool) {
+	if o.source != nil && (o.sampler != nil || !o.noShuffle) {
+		o.source.samples = append(o.source.samples, o.source.draws)
+	}
+	if o.sampler != nil {
+		return o.sampler.Sample(train, o.rand), true
+	}
+	return train, o.shuffle(train)
+}
+
+// SampleBalanced samples as many examples as given, drawn from each class
+// in turn, by the argmax of the response or the label of a single binary
+// response, such that every mini-batch holds about as many of each. The
+// examples of each class are shuffled and drawn without replacement until
+// all have been drawn, so that minority classes are oversampled and
+// majority classes undersampled.
+type SampleBalanced struct{}
+
+// Sample returns a balanced sample of examples
+func (SampleBalanced) Sample(examples Examples, r *rand.Rand) Examples {
+	classes := examples.classes()
+	next := make([]int, len(classes))
+	sample := make(Examples, len(examples))
+	for i := range sample {
+		c := i % len(classes)
+		if next[c] == 0 {
+			class := make(Examples, len(classes[c]))
+			copy(class, classes[c])
+			class.ShuffleWith(r)
+			classes[c] = class
+		}
+		sample[i] = classes[c][next[c]]
+		next[c] = (next[c] + 1) % len(classes[c])
+	}
+	return sample
+}
+
+// SampleWeighted samples as many examples as given with replacement, each
+// with a probability proportional to its weight in Weights
+type SampleWeighted struct {
+	Weights []float64
+}
+
+// Sample returns a weighted sample of examples
+func (s SampleWeighted) Sample(examples Examples, r *rand.Rand) Examples {
+	if len(s.Weights) != len(examples) {
+		panic(fmt.Sprintf("training: %d sample weights for %d examples", len(s.Weights), len(examples)))
+	}
+	cumulative := make([]float64, len(s.Weights))
+	var total float64
+	for i, w := range s.Weights {
+		if w < 0 {
+			panic(fmt.Sprintf("training: negative sample weight %v", w))
+		}
+		total += w
+		cumulative[i] = total
+	}
+	draw := rand.Float64
+	if r != nil {
+		draw = r.Float64
+	}
+	sample := make(Examples, len(examples))
+	for i := range sample {
+		// the first example whose cumulative weight exceeds the draw
+		x := draw() * total
+		j := sort.Search(len(cumulative), func(j int) bool { return cumulative[j] > x })
+		sample[i] = examples[min(j, len(examples)-1)]
+	}
+	return sample
+}
@@ -0,0 +1,103 @@
+package training
+
+import (
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+// imbalanced returns 98% negatives around (0, 0) and 2% positives around
+// (1, 1) of a binary label
+func imbalanced(r *rand.Rand, size int) Examples {
+	e := make(Examples, size)
+	for i := range e {
+		label, center := 0.0, 0.0
+		if i%50 == 0 {
+			label, center = 1, 1
+		}
+		e[i] = Example{
+			Input:    []float64{center + 0.5*r.NormFloat64(), center + 0.5*r.NormFloat64()},
+			Response: []float64{label},
+		}
+	}
+	return e
+}
+
+func Test_SampleBalanced(t *testing.T) {
+	data := imbalanced(rand.New(rand.NewSource(0)), 1000)
+	sample := SampleBalanced{}.Sample(data, rand.New(rand.NewSource(1)))
+	assert.Len(t, sample, len(data))
+
+	for _, batch := range sample.SplitSize(20) {
+		var positives int
+		for _, e := range batch {
+			positives += e.class()
+		}
+		assert.InDelta(t, 10, positives, 1)
+	}
+	// every negative is drawn at most once, and every positive repeatedly
+	seen := map[*float64]int{}
+	for _, e := range sample {
+		seen[&e.Input[0]]++
+	}
+	for _, e := range data {
+		if e.class() == 0 {
+			assert.True(t, seen[&e.Input[0]] <= 1)
+		} else {
+			assert.True(t, seen[&e.Input[0]] >= 24)
+		}
+	}
+}
+
+func Test_SampleWeighted(t *testing.T) {
+	data := Examples{
+		{Input: []float64{0}, Response: []float64{0}},
+		{Input: []float64{1}, Response: []float64{0}},
+		{Input: []float64{2}, Response: []float64{0}},
+	}
+	r := rand.New(rand.NewSource(0))
+	counts := make([]int, 3)
+	for i := 0; i < 1000; i++ {
+		for _, e := range (SampleWeighted{Weights: []float64{1, 0, 3}}).Sample(data, r) {
+			counts[int(e.Input[0])]++
+		}
+	}
+	assert.Equal(t, 0, counts[1])
+	assert.InDelta(t, 0.25, float64(counts[0])/3000, 0.02)
+	assert.InDelta(t, 0.75, float64(counts[2])/3000, 0.02)
+
+	assert.Panics(t, func() { SampleWeighted{Weights: []float64{1}}.Sample(data, r) })
+	assert.Panics(t, func() { SampleWeighted{Weights: []float64{1, -1, 1}}.Sample(data, r) })
+}
+
+func Test_SamplerRecall(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	train, test := imbalanced(r, 2000), imbalanced(r, 5000)
+	recall := func(opts ...Option) float64 {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{4, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeBinary,
+			Weight:     deep.NewNormal(0.5, 0),
+			Bias:       true,
+		})
+		NewBatchTrainer(NewAdam(0.01, 0, 0, 0), 0, 20, 1, append(opts, WithSeed(1))...).Train(n, train, nil, 10)
+		var positives, found float64
+		for _, e := range test {
+			if e.class() == 1 {
+				positives++
+				if n.Predict(e.Input)[0] >= 0.5 {
+					found++
+				}
+			}
+		}
+		return found / positives
+	}
+
+	uniform, balanced := recall(), recall(WithSampler(SampleBalanced{}))
+	assert.True(t, balanced > uniform+0.3, "%v vs %v", balanced, uniform)
+}
@@ -0,0 +1,155 @@
+package training
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+
+	deep "github.com/patrikeh/go-deep"
+)
+
+// CheckpointSaver is a Callback that saves the network, marshalled by
+// Marshal, while training. The validation loss, or the training loss
+// without a validation set, decides which epochs improve.
+type CheckpointSaver struct {
+	// Path of the checkpoints, formatted with the epoch, e.g. "net-%03d.json"
+	Path string
+	// Create opens the writer of the checkpoint of an epoch instead of Path
+	Create func(epoch int) (io.WriteCloser, error)
+	// Every saves a checkpoint every Every epochs, zero for none
+	Every int
+	// OnImprove saves a checkpoint whenever the loss improves
+	OnImprove bool
+	// Keep is the number of recent checkpoints at Path kept, zero for all
+	Keep int
+	// Best is the path of a file that holds the network of the best epoch
+	Best string
+
+	bestLoss  float64
+	bestEpoch int
+	saved     []string
+	started   bool
+	events    chan<- Event
+}
+
+// WithCheckpointSaver adds s to the callbacks of training
+func WithCheckpointSaver(s *CheckpointSaver) Option {
+	return WithCallbacks(s)
+}
+
+// BestLoss returns the best loss of the last training run
+func (s *CheckpointSaver) BestLoss() float64 {
+	return s.bestLoss
+}
+
+// BestEpoch returns the epoch of the best loss of the last training run,
+// zero before any
+func (s *CheckpointSaver) BestEpoch() int {
+	return s.bestEpoch
+}
+
+// OnEpochEnd saves the checkpoints of epoch
+func (s *CheckpointSaver) OnEpochEnd(epoch int, trainLoss, valLoss float64, n *deep.Neural) error {
+	if !s.started {
+		s.bestLoss, s.bestEpoch, s.saved, s.started = math.Inf(1), 0, nil, true
+	}
+	loss := valLoss
+	if math.IsNaN(loss) {
+		loss = trainLoss
+	}
+	improved := loss < s.bestLoss
+	if improved {
+		s.bestLoss, s.bestEpoch = loss, epoch
+	}
+	save := s.Every > 0 && epoch%s.Every == 0 || s.OnImprove && improved
+	if !save && !(improved && s.Best != "") {
+		return nil
+	}
+
+	bytes, err := n.Marshal()
+	if err != nil {
+		return err
+	}
+	if improved && s.Best != "" {
+		if err := writeAtomic(s.Best, bytes); err != nil {
+			return err
+		}
+		emit(s.events, CheckpointEvent{Epoch: epoch, Path: s.Best, Best: true})
+	}
+	if !save {
+		return nil
+	}
+	if s.Create != nil {
+		w, err := s.Create(epoch)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(bytes); err != nil {
+			w.Close()
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		emit(s.events, CheckpointEvent{Epoch: epoch})
+		return nil
+	}
+	if s.Path == "" {
+		return nil
+	}
+	path := fmt.Sprintf(s.Path, epoch)
+	if err := writeAtomic(path, bytes); err != nil {
+		return err
+	}
+	emit(s.events, CheckpointEvent{Epoch: epoch, Path: path})
+	s.saved = append(s.saved, path)
+	if s.Keep > 0 && len(s.saved) > s.Keep {
+		old := s.saved[0]
+		s.saved = s.saved[1:]
+		if err := os.Remove(old); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// setEvents sends the CheckpointEvents of the training run to events
+func (s *CheckpointSaver) setEvents(events chan<- Event) {
+	s.events = events
+}
+
+// OnTrainEnd ends the training run, the next starts afresh
+func (s *CheckpointSaver) OnTrainEnd(epoch int, n *deep.Neural, err error) {
+	s.started = false
+}
+
+// writeAtomic writes bytes to a temporary file next to path and renames it
+// to path, so that path holds either its old or its new content
+func writeAtomic(path string, bytes []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(bytes); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package training
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+type closingBuffer struct {
+	*bytes.Buffer
+}
+
+func (closingBuffer) Close() error { return nil }
+
+func Test_CheckpointSaver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoints")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	rand.Seed(0)
+	data := Examples{
+		{Input: []float64{0, 0}, Response: []float64{0}},
+		{Input: []float64{0, 1}, Response: []float64{1}},
+		{Input: []float64{1, 0}, Response: []float64{1}},
+		{Input: []float64{1, 1}, Response: []float64{0}},
+	}
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     2,
+		Layout:     []int{4, 1},
+		Activation: deep.ActivationTanh,
+		Mode:       deep.ModeRegression,
+		Weight:     deep.NewNormal(1, 0),
+		Bias:       true,
+	})
+	saver := &CheckpointSaver{
+		Path:  filepath.Join(dir, "net-%02d.json"),
+		Every: 2,
+		Keep:  2,
+		Best:  filepath.Join(dir, "best.json"),
+	}
+	var losses []float64
+	NewTrainer(NewSGD(0.5, 0, 0, false), 0, WithCheckpointSaver(saver), WithCallbacks(CallbackFuncs{
+		EpochEnd: func(epoch int, trainLoss, valLoss float64, n *deep.Neural) error {
+			losses = append(losses, valLoss)
+			return nil
+		},
+	})).Train(n, data, data[:3], 10)
+
+	// only the two most recent periodic checkpoints are kept, without
+	// temporary files
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"best.json", "net-08.json", "net-10.json"}, names)
+
+	best := 0
+	for i, l := range losses {
+		if l < losses[best] {
+			best = i
+		}
+	}
+	assert.Equal(t, best+1, saver.BestEpoch())
+	assert.Equal(t, losses[best], saver.BestLoss())
+
+	b, err := ioutil.ReadFile(saver.Best)
+	assert.Nil(t, err)
+	restored, err := deep.Unmarshal(b)
+	assert.Nil(t, err)
+	assert.InDelta(t, losses[best], validationLoss(restored, nil, data[:3]), 1e-9)
+
+	b, err = ioutil.ReadFile(filepath.Join(dir, "net-10.json"))
+	assert.Nil(t, err)
+	last, err := deep.Unmarshal(b)
+	assert.Nil(t, err)
+	assert.Equal(t, n.Weights(), last.Weights())
+}
+
+func Test_CheckpointSaverCreate(t *testing.T) {
+	rand.Seed(0)
+	data := Examples{
+		{Input: []float64{0}, Response: []float64{0}},
+		{Input: []float64{1}, Response: []float64{1}},
+	}
+	n := deep.NewNeural(&deep.Config{
+		Inputs: 1,
+		Layout: []int{1},
+		Mode:   deep.ModeRegression,
+		Weight: deep.NewNormal(0.5, 0),
+	})
+	var improved []int
+	buffers := map[int]*bytes.Buffer{}
+	saver := &CheckpointSaver{
+		OnImprove: true,
+		Create: func(epoch int) (io.WriteCloser, error) {
+			buffers[epoch] = &bytes.Buffer{}
+			return closingBuffer{buffers[epoch]}, nil
+		},
+	}
+	best := math.Inf(1)
+	NewTrainer(NewSGD(0.1, 0, 0, false), 0, WithCheckpointSaver(saver), WithCallbacks(CallbackFuncs{
+		EpochEnd: func(epoch int, trainLoss, valLoss float64, n *deep.Neural) error {
+			if trainLoss < best {
+				best = trainLoss
+				improved = append(improved, epoch)
+			}
+			return nil
+		},
+	})).Train(n, data, nil, 5)
+
+	assert.Len(t, buffers, len(improved))
+	for _, epoch := range improved {
+		_, err := deep.Unmarshal(buffers[epoch].Bytes())
+		assert.Nil(t, err)
+	}
+}
@@ -0,0 +1,192 @@
+package training
+
+import (
+	"math"
+
+	deep "github.com/patrikeh/go-deep"
+)
+
+// Scheduler gives the learning rate of a solver over the course of
+// training, where epoch is the number of completed epochs, iteration the
+// number of completed updates and base the learning rate of the solver
+type Scheduler interface {
+	LR(epoch, iteration int, base float64) float64
+}
+
+// ValidationScheduler is a Scheduler that is told the loss on the
+// validation set after every epoch, if there is one
+type ValidationScheduler interface {
+	Scheduler
+	Observe(epoch int, loss float64)
+}
+
+// LRSolver is a Solver whose learning rate can be scheduled
+type LRSolver interface {
+	Solver
+	LR() float64
+	SetLR(lr float64)
+}
+
+// StepDecay multiplies the learning rate by Gamma every Step epochs
+type StepDecay struct {
+	Step  int
+	Gamma float64
+}
+
+// LR is base*Gamma^floor(epoch/Step)
+func (s StepDecay) LR(epoch, iteration int, base float64) float64 {
+	return base * math.Pow(s.Gamma, float64(epoch/iparam(s.Step, 1)))
+}
+
+// ExponentialDecay multiplies the learning rate by Gamma every epoch
+type ExponentialDecay struct {
+	Gamma float64
+}
+
+// LR is base*Gamma^epoch
+func (s ExponentialDecay) LR(epoch, iteration int, base float64) float64 {
+	return base * math.Pow(s.Gamma, float64(epoch))
+}
+
+// CosineAnnealing anneals the learning rate from base to Min over Epochs
+// epochs along a half cosine, and stays at Min thereafter
+type CosineAnnealing struct {
+	Epochs int
+	Min    float64
+}
+
+// LR is Min + (base-Min)(1+cos(π epoch/Epochs))/2
+func (s CosineAnnealing) LR(epoch, iteration int, base float64) float64 {
+	if epoch >= s.Epochs {
+		return s.Min
+	}
+	return s.Min + (base-s.Min)*(1+math.Cos(math.Pi*float64(epoch)/float64(s.Epochs)))/2
+}
+
+// Warmup increases the learning rate linearly over the first Iterations
+// updates, up to that of Next or the base learning rate if Next is nil
+type Warmup struct {
+	Iterations int
+	Next       Scheduler
+}
+
+// LR is the learning rate of Next scaled by (iteration+1)/Iterations
+func (s Warmup) LR(epoch, iteration int, base float64) float64 {
+	lr := base
+	if s.Next != nil {
+		lr = s.Next.LR(epoch, iteration, base)
+	}
+	if iteration < s.Iterations {
+		lr *= float64(iteration+1) / float64(s.Iterations)
+	}
+	return lr
+}
+
+// Observe passes the validation loss to Next
+func (s Warmup) Observe(epoch int, loss float64) {
+	if next, ok := s.Next.(ValidationScheduler); ok {
+		next.Observe(epoch, loss)
+	}
+}
+
+func (s Warmup) reset() {
+	if next, ok := s.Next.(resetter); ok {
+		next.reset()
+	}
+}
+
+// ReduceLROnPlateau multiplies the learning rate by Factor whenever the
+// validation loss has not improved on its best by more than MinDelta for
+// Patience epochs, down to Min
+type ReduceLROnPlateau struct {
+	Factor   float64
+	Patience int
+	MinDelta float64
+	Min      float64
+
+	best  float64
+	wait  int
+	scale float64
+}
+
+// LR is the base learning rate, reduced once per plateau
+func (s *ReduceLROnPlateau) LR(epoch, iteration int, base float64) float64 {
+	if s.scale == 0 {
+		s.reset()
+	}
+	return math.Max(base*s.scale, s.Min)
+}
+
+// Observe records the validation loss after epoch
+func (s *ReduceLROnPlateau) Observe(epoch int, loss float64) {
+	if s.scale == 0 {
+		s.reset()
+	}
+	if loss < s.best-s.MinDelta {
+		s.best, s.wait = loss, 0
+		return
+	}
+	s.wait++
+	if s.wait >= iparam(s.Patience, 1) {
+		s.scale *= fparam(s.Factor, 0.1)
+		s.wait = 0
+	}
+}
+
+func (s *ReduceLROnPlateau) reset() {
+	s.best, s.wait, s.scale = math.Inf(1), 0, 1
+}
+
+// resetter is implemented by schedulers with state, which is reset at the
+// start of training
+type resetter interface {
+	reset()
+}
+
+// schedule applies a Scheduler to a solver
+type schedule struct {
+	scheduler Scheduler
+	solver    LRSolver
+	base      float64
+}
+
+// newSchedule returns the schedule of scheduler for solver, or nil if
+// scheduler is nil, and panics if solver cannot be scheduled
+func newSchedule(scheduler Scheduler, solver Solver) *schedule {
+	if scheduler == nil {
+		return nil
+	}
+	s, ok := solver.(LRSolver)
+	if !ok {
+		panic("training: solver does not support learning rate schedules")
+	}
+	if r, ok := scheduler.(resetter); ok {
+		r.reset()
+	}
+	return &schedule{scheduler: scheduler, solver: s, base: s.LR()}
+}
+
+// apply sets the learning rate of the solver for the next update
+func (s *schedule) apply(epoch, iteration int) {
+	if s != nil {
+		s.solver.SetLR(s.scheduler.LR(epoch, iteration, s.base))
+	}
+}
+
+// observe passes the loss of n on validation after epoch to the scheduler,
+// if it is a ValidationScheduler
+func (s *schedule) observe(n *deep.Neural, loss deep.Loss, epoch int, validation Examples) {
+	if s == nil || len(validation) == 0 {
+		return
+	}
+	if v, ok := s.scheduler.(ValidationScheduler); ok {
+		v.Observe(epoch, validationLoss(n, loss, validation))
+	}
+}
+
+// restore resets the learning rate of the solver to its base
+func (s *schedule) restore() {
+	if s != nil {
+		s.solver.SetLR(s.base)
+	}
+}
@@ -0,0 +1,196 @@
+package training
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"text/tabwriter"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+func lrs(s Scheduler, epochs int, base float64) []float64 {
+	lrs := make([]float64, epochs)
+	for i := range lrs {
+		lrs[i] = s.LR(i, 0, base)
+	}
+	return lrs
+}
+
+func Test_StepDecay(t *testing.T) {
+	assert.InDeltaSlice(t,
+		[]float64{1, 1, 1, 0.5, 0.5, 0.5, 0.25, 0.25},
+		lrs(StepDecay{Step: 3, Gamma: 0.5}, 8, 1), 1e-12)
+}
+
+func Test_ExponentialDecay(t *testing.T) {
+	assert.InDeltaSlice(t,
+		[]float64{0.1, 0.09, 0.081, 0.0729},
+		lrs(ExponentialDecay{Gamma: 0.9}, 4, 0.1), 1e-12)
+}
+
+func Test_CosineAnnealing(t *testing.T) {
+	assert.InDeltaSlice(t,
+		[]float64{1, 0.5 + 0.5*math.Sqrt(0.5), 0.5, 0.5 - 0.5*math.Sqrt(0.5), 0, 0},
+		lrs(CosineAnnealing{Epochs: 4}, 6, 1), 1e-12)
+	assert.InDeltaSlice(t,
+		[]float64{1, 0.55, 0.1},
+		lrs(CosineAnnealing{Epochs: 2, Min: 0.1}, 3, 1), 1e-12)
+}
+
+type recordingScheduler struct {
+	epochs, iterations []int
+}
+
+func (s *recordingScheduler) LR(epoch, iteration int, base float64) float64 {
+	s.epochs = append(s.epochs, epoch)
+	s.iterations = append(s.iterations, iteration)
+	return base / float64(epoch+1)
+}
+
+func Test_Scheduling(t *testing.T) {
+	data := Examples{
+		{Input: []float64{0, 0}, Response: []float64{0}},
+		{Input: []float64{1, 0}, Response: []float64{1}},
+		{Input: []float64{0, 1}, Response: []float64{1}},
+		{Input: []float64{1, 1}, Response: []float64{0}},
+	}
+	n := deep.NewNeural(&deep.Config{Inputs: 2, Layout: []int{2, 1}, Mode: deep.ModeBinary})
+
+	s := &recordingScheduler{}
+	solver := NewSGD(0.1, 0, 0, false)
+	NewTrainer(solver, 0, WithScheduler(s)).Train(n, data, nil, 2)
+	assert.Equal(t, []int{0, 0, 0, 0, 1, 1, 1, 1}, s.epochs)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7}, s.iterations)
+	// the solver is left at its base learning rate
+	assert.Equal(t, 0.1, solver.LR())
+
+	s = &recordingScheduler{}
+	NewBatchTrainer(solver, 0, 2, 1, WithScheduler(s)).Train(n, data, nil, 2)
+	assert.Equal(t, []int{0, 0, 1, 1}, s.epochs)
+	assert.Equal(t, []int{0, 1, 2, 3}, s.iterations)
+
+	assert.Panics(t, func() {
+		NewTrainer(solverFunc(nil), 0, WithScheduler(s)).Train(n, data, nil, 1)
+	})
+}
+
+// solverFunc is a Solver without a learning rate
+type solverFunc func(gradient float64) float64
+
+func (f solverFunc) Init(size int) {}
+func (f solverFunc) Update(value, gradient float64, iteration, idx int) float64 {
+	return f(gradient)
+}
+
+func Test_ScheduledTraining(t *testing.T) {
+	data := Examples{
+		{Input: []float64{0, 0}, Response: []float64{0}},
+		{Input: []float64{1, 0}, Response: []float64{1}},
+		{Input: []float64{0, 1}, Response: []float64{1}},
+		{Input: []float64{1, 1}, Response: []float64{0}},
+	}
+	rand.Seed(0)
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     2,
+		Layout:     []int{4, 1},
+		Activation: deep.ActivationTanh,
+		Mode:       deep.ModeBinary,
+		Weight:     deep.NewNormal(1, 0),
+		Bias:       true,
+	})
+	trainer := NewTrainer(NewAdam(0.05, 0, 0, 0), 100, WithScheduler(CosineAnnealing{Epochs: 500, Min: 0.001}))
+	var out bytes.Buffer
+	trainer.printer.w = tabwriter.NewWriter(&out, 16, 0, 3, ' ', 0)
+	trainer.Train(n, data, data, 500)
+
+	for _, e := range data {
+		assert.Equal(t, e.Response[0], deep.Round(n.Predict(e.Input)[0]))
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 7)
+	assert.Contains(t, lines[0], "LR")
+	assert.Contains(t, lines[6], "0.001")
+}
+
+func Test_Warmup(t *testing.T) {
+	s := Warmup{Iterations: 4}
+	var warm []float64
+	for it := 0; it < 6; it++ {
+		warm = append(warm, s.LR(0, it, 0.1))
+	}
+	assert.InDeltaSlice(t, []float64{0.025, 0.05, 0.075, 0.1, 0.1, 0.1}, warm, 1e-12)
+
+	s = Warmup{Iterations: 2, Next: ExponentialDecay{Gamma: 0.5}}
+	assert.InDelta(t, 0.025, s.LR(1, 0, 0.1), 1e-12)
+	assert.InDelta(t, 0.05, s.LR(1, 2, 0.1), 1e-12)
+}
+
+func Test_ReduceLROnPlateau(t *testing.T) {
+	s := &ReduceLROnPlateau{Factor: 0.5, Patience: 2, MinDelta: 0.1, Min: 0.2}
+	var lrs []float64
+	for epoch, loss := range []float64{
+		1,    // first observation is always an improvement
+		0.9,  // exactly MinDelta is not enough
+		0.95, // second epoch without improvement: reduce
+		0.7,  // improves by more than MinDelta on the best of 1
+		0.7,  // tie
+		0.7,  // reduce
+		0.7,
+		0.7, // reduce, but not below Min
+		0.7,
+		0.7,
+	} {
+		s.Observe(epoch+1, loss)
+		lrs = append(lrs, s.LR(epoch+1, 0, 1))
+	}
+	assert.InDeltaSlice(t, []float64{1, 1, 0.5, 0.5, 0.5, 0.25, 0.25, 0.2, 0.2, 0.2}, lrs, 1e-12)
+
+	// state is reset at the start of training
+	newSchedule(s, NewSGD(1, 0, 0, false))
+	assert.Equal(t, 1.0, s.LR(0, 0, 1))
+	wrapped := Warmup{Next: s}
+	s.Observe(1, 1)
+	s.Observe(2, 1)
+	s.Observe(3, 1)
+	newSchedule(wrapped, NewSGD(1, 0, 0, false))
+	assert.Equal(t, 1.0, s.LR(0, 0, 1))
+}
+
+// frozenSolver records its learning rates without updating any weights
+type frozenSolver struct {
+	lr  float64
+	lrs []float64
+}
+
+func (o *frozenSolver) Init(size int)    {}
+func (o *frozenSolver) LR() float64      { return o.lr }
+func (o *frozenSolver) SetLR(lr float64) { o.lr = lr }
+func (o *frozenSolver) Update(value, gradient float64, iteration, idx int) float64 {
+	if idx == 0 {
+		o.lrs = append(o.lrs, o.lr)
+	}
+	return 0
+}
+
+func Test_ReduceLROnPlateauTraining(t *testing.T) {
+	data := Examples{
+		{Input: []float64{0, 0}, Response: []float64{0}},
+		{Input: []float64{1, 1}, Response: []float64{1}},
+	}
+	n := deep.NewNeural(&deep.Config{Inputs: 2, Layout: []int{2, 1}, Mode: deep.ModeBinary})
+
+	// the network doesn't learn, so validation loss stalls after the first
+	// epoch, and the rate drops every other epoch thereafter
+	for _, trainer := range []func(Solver, Scheduler) Trainer{
+		func(s Solver, sc Scheduler) Trainer { return NewTrainer(s, 0, WithScheduler(sc)) },
+		func(s Solver, sc Scheduler) Trainer { return NewBatchTrainer(s, 0, 1, 1, WithScheduler(sc)) },
+	} {
+		solver := &frozenSolver{lr: 1}
+		trainer(solver, &ReduceLROnPlateau{Factor: 0.5, Patience: 2}).Train(n, data, data, 6)
+		assert.Equal(t, []float64{1, 1, 1, 1, 1, 1, 0.5, 0.5, 0.5, 0.5, 0.25, 0.25}, solver.lrs)
+	}
+}
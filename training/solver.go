@@ -1,6 +1,12 @@
 package training
 
-import "math"
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	deep "github.com/patrikeh/go-deep"
+)
 
 // Solver implements an update rule for training a NN
 type Solver interface {
@@ -8,6 +14,67 @@ type Solver interface {
 	Update(value, gradient float64, iteration, idx int) float64
 }
 
+// BiasAwareSolver is a Solver that treats biases differently from other
+// weights, and is told which indices passed to Update are biases after Init
+type BiasAwareSolver interface {
+	Solver
+	SetBiases(biases []bool)
+}
+
+// StatefulSolver is a Solver whose state, such as moment estimates, can be
+// persisted between training runs, see Checkpoint. Unmarshal restores the
+// state into a solver initialized by Init for as many weights.
+type StatefulSolver interface {
+	Solver
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// initSolver initializes solver for the weights of n, in the order they are
+// updated by the trainers, followed by the slope of each layer, the scale
+// and shift of each normalized neuron and the kernels and biases of the
+// convolution
+func initSolver(solver Solver, n *deep.Neural) {
+	solver.Init(len(biases(n)))
+	if s, ok := solver.(BiasAwareSolver); ok {
+		s.SetBiases(biases(n))
+	}
+}
+
+// biases reports which of the indices of initSolver are biases, counting
+// layer slopes and normalizations as biases
+func biases(n *deep.Neural) []bool {
+	var biases []bool
+	for _, l := range n.Layers {
+		for _, neuron := range l.Neurons {
+			for _, s := range neuron.In {
+				biases = append(biases, s.IsBias)
+			}
+		}
+	}
+	for range n.Layers {
+		biases = append(biases, true)
+	}
+	for _, l := range n.Layers {
+		if l.Norm != nil {
+			for range l.Neurons {
+				biases = append(biases, true, true)
+			}
+		}
+	}
+	if n.Conv != nil {
+		for _, kernel := range n.Conv.Kernels {
+			for range kernel {
+				biases = append(biases, false)
+			}
+		}
+		for range n.Conv.Biases {
+			biases = append(biases, true)
+		}
+	}
+	return biases
+}
+
 // SGD is stochastic gradient descent with nesterov/momentum
 type SGD struct {
 	lr       float64
@@ -27,11 +94,41 @@ func NewSGD(lr, momentum, decay float64, nesterov bool) *SGD {
 	}
 }
 
-// Init initializes vectors using number of weights in network
+// LR returns the learning rate
+func (o *SGD) LR() float64 { return o.lr }
+
+// SetLR sets the learning rate
+func (o *SGD) SetLR(lr float64) { o.lr = lr }
+
+// Init initializes vectors using number of weights in network, resetting
+// the velocity of every weight
 func (o *SGD) Init(size int) {
 	o.moments = make([]float64, size)
 }
 
+type sgdState struct {
+	Moments []float64
+}
+
+// Marshal marshals the velocity of every weight
+func (o *SGD) Marshal() ([]byte, error) {
+	return json.Marshal(sgdState{Moments: o.moments})
+}
+
+// Unmarshal restores the velocities marshaled by Marshal, after Init for
+// as many weights
+func (o *SGD) Unmarshal(data []byte) error {
+	var state sgdState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	if err := checkState("velocities", len(state.Moments), len(o.moments)); err != nil {
+		return err
+	}
+	o.moments = state.Moments
+	return nil
+}
+
 // Update returns the update for a given weight
 func (o *SGD) Update(value, gradient float64, iteration, idx int) float64 {
 	lr := o.lr / (1 + o.decay*float64(iteration))
@@ -39,7 +136,8 @@ func (o *SGD) Update(value, gradient float64, iteration, idx int) float64 {
 	o.moments[idx] = o.momentum*o.moments[idx] - lr*gradient
 
 	if o.nesterov {
-		o.moments[idx] = o.momentum*o.moments[idx] - lr*gradient
+		// step along the velocity from the look-ahead position
+		return o.momentum*o.moments[idx] - lr*gradient
 	}
 
 	return o.moments[idx]
@@ -52,7 +150,12 @@ type Adam struct {
 	beta2   float64
 	epsilon float64
 
-	v, m []float64
+	// amsgrad normalizes by the maximum second moment, and nesterov applies
+	// nesterov momentum (Nadam)
+	amsgrad  bool
+	nesterov bool
+
+	v, m, vmax []float64
 }
 
 // NewAdam returns a new Adam solver
@@ -65,19 +168,233 @@ func NewAdam(lr, beta, beta2, epsilon float64) *Adam {
 	}
 }
 
+// NewAMSGrad returns a new Adam solver normalizing by the maximum of the
+// second moment estimates, such that steps do not grow as gradients shrink
+func NewAMSGrad(lr, beta, beta2, epsilon float64) *Adam {
+	o := NewAdam(lr, beta, beta2, epsilon)
+	o.amsgrad = true
+	return o
+}
+
+// NewNadam returns a new Adam solver with nesterov momentum
+func NewNadam(lr, beta, beta2, epsilon float64) *Adam {
+	o := NewAdam(lr, beta, beta2, epsilon)
+	o.nesterov = true
+	return o
+}
+
+// LR returns the learning rate
+func (o *Adam) LR() float64 { return o.lr }
+
+// SetLR sets the learning rate
+func (o *Adam) SetLR(lr float64) { o.lr = lr }
+
 // Init initializes vectors using number of weights in network
 func (o *Adam) Init(size int) {
 	o.v, o.m = make([]float64, size), make([]float64, size)
+	if o.amsgrad {
+		o.vmax = make([]float64, size)
+	}
+}
+
+type adamState struct {
+	M, V []float64
+	VMax []float64 `json:",omitempty"`
+}
+
+// Marshal marshals the moment estimates of every weight
+func (o *Adam) Marshal() ([]byte, error) {
+	return json.Marshal(adamState{M: o.m, V: o.v, VMax: o.vmax})
+}
+
+// Unmarshal restores the moment estimates marshaled by Marshal, after Init
+// for as many weights
+func (o *Adam) Unmarshal(data []byte) error {
+	var state adamState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	if len(state.M) != len(state.V) || (o.amsgrad && len(state.VMax) != len(state.V)) {
+		return fmt.Errorf("inconsistent adam state")
+	}
+	if err := checkState("moment estimates", len(state.M), len(o.m)); err != nil {
+		return err
+	}
+	o.m, o.v, o.vmax = state.M, state.V, state.VMax
+	return nil
 }
 
 // Update returns the update for a given weight
 func (o *Adam) Update(value, gradient float64, t, idx int) float64 {
-	lrt := o.lr * (math.Sqrt(1.0 - math.Pow(o.beta2, float64(t)))) /
-		(1.0 - math.Pow(o.beta, float64(t)))
 	o.m[idx] = o.beta*o.m[idx] + (1.0-o.beta)*gradient
 	o.v[idx] = o.beta2*o.v[idx] + (1.0-o.beta2)*math.Pow(gradient, 2.0)
 
-	return -lrt * (o.m[idx] / (math.Sqrt(o.v[idx]) + o.epsilon))
+	if o.nesterov {
+		m := o.beta*o.m[idx]/(1-math.Pow(o.beta, float64(t+1))) +
+			(1-o.beta)*gradient/(1-math.Pow(o.beta, float64(t)))
+		v := o.v[idx] / (1 - math.Pow(o.beta2, float64(t)))
+		return -o.lr * m / (math.Sqrt(v) + o.epsilon)
+	}
+
+	v := o.v[idx]
+	if o.amsgrad {
+		o.vmax[idx] = math.Max(o.vmax[idx], v)
+		v = o.vmax[idx]
+	}
+	lrt := o.lr * (math.Sqrt(1.0 - math.Pow(o.beta2, float64(t)))) /
+		(1.0 - math.Pow(o.beta, float64(t)))
+	return -lrt * (o.m[idx] / (math.Sqrt(v) + o.epsilon))
+}
+
+// AdamW is an Adam solver with weight decay decoupled from the gradient
+type AdamW struct {
+	*Adam
+	weightDecay float64
+
+	biases []bool
+}
+
+// NewAdamW returns a new AdamW solver, which by the trainers does not decay
+// biases
+func NewAdamW(lr, beta, beta2, epsilon, weightDecay float64) *AdamW {
+	return &AdamW{
+		Adam:        NewAdam(lr, beta, beta2, epsilon),
+		weightDecay: fparam(weightDecay, 0.01),
+	}
+}
+
+// SetBiases excludes biases from weight decay
+func (o *AdamW) SetBiases(biases []bool) {
+	o.biases = biases
+}
+
+// Update returns the update for a given weight
+func (o *AdamW) Update(value, gradient float64, t, idx int) float64 {
+	update := o.Adam.Update(value, gradient, t, idx)
+	if idx < len(o.biases) && o.biases[idx] {
+		return update
+	}
+	return update - o.lr*o.weightDecay*value
+}
+
+type cacheState struct {
+	Cache []float64
+}
+
+// RMSProp is an RMSProp solver
+type RMSProp struct {
+	lr      float64
+	decay   float64
+	epsilon float64
+
+	cache []float64
+}
+
+// NewRMSProp returns a new RMSProp solver
+func NewRMSProp(lr, decay, epsilon float64) *RMSProp {
+	return &RMSProp{
+		lr:      fparam(lr, 0.001),
+		decay:   fparam(decay, 0.9),
+		epsilon: fparam(epsilon, 1e-8),
+	}
+}
+
+// LR returns the learning rate
+func (o *RMSProp) LR() float64 { return o.lr }
+
+// SetLR sets the learning rate
+func (o *RMSProp) SetLR(lr float64) { o.lr = lr }
+
+// Init initializes vectors using number of weights in network
+func (o *RMSProp) Init(size int) {
+	o.cache = make([]float64, size)
+}
+
+// Marshal marshals the accumulated squared gradients of every weight
+func (o *RMSProp) Marshal() ([]byte, error) {
+	return json.Marshal(cacheState{Cache: o.cache})
+}
+
+// Unmarshal restores the accumulated squared gradients marshaled by
+// Marshal, after Init for as many weights
+func (o *RMSProp) Unmarshal(data []byte) error {
+	var state cacheState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	if err := checkState("squared gradients", len(state.Cache), len(o.cache)); err != nil {
+		return err
+	}
+	o.cache = state.Cache
+	return nil
+}
+
+// Update returns the update for a given weight
+func (o *RMSProp) Update(value, gradient float64, t, idx int) float64 {
+	o.cache[idx] = o.decay*o.cache[idx] + (1-o.decay)*gradient*gradient
+	return -o.lr * gradient / (math.Sqrt(o.cache[idx]) + o.epsilon)
+}
+
+// AdaGrad is an AdaGrad solver, whose steps shrink with the squared
+// gradients accumulated per weight
+type AdaGrad struct {
+	lr      float64
+	epsilon float64
+
+	cache []float64
+}
+
+// NewAdaGrad returns a new AdaGrad solver
+func NewAdaGrad(lr, epsilon float64) *AdaGrad {
+	return &AdaGrad{
+		lr:      fparam(lr, 0.01),
+		epsilon: fparam(epsilon, 1e-8),
+	}
+}
+
+// LR returns the learning rate
+func (o *AdaGrad) LR() float64 { return o.lr }
+
+// SetLR sets the learning rate
+func (o *AdaGrad) SetLR(lr float64) { o.lr = lr }
+
+// Init initializes vectors using number of weights in network
+func (o *AdaGrad) Init(size int) {
+	o.cache = make([]float64, size)
+}
+
+// Marshal marshals the accumulated squared gradients of every weight
+func (o *AdaGrad) Marshal() ([]byte, error) {
+	return json.Marshal(cacheState{Cache: o.cache})
+}
+
+// Unmarshal restores the accumulated squared gradients marshaled by
+// Marshal, after Init for as many weights
+func (o *AdaGrad) Unmarshal(data []byte) error {
+	var state cacheState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	if err := checkState("squared gradients", len(state.Cache), len(o.cache)); err != nil {
+		return err
+	}
+	o.cache = state.Cache
+	return nil
+}
+
+// Update returns the update for a given weight
+func (o *AdaGrad) Update(value, gradient float64, t, idx int) float64 {
+	o.cache[idx] += gradient * gradient
+	return -o.lr * gradient / (math.Sqrt(o.cache[idx]) + o.epsilon)
+}
+
+// checkState returns an error unless the restored state of a solver holds
+// as many values as the solver was initialized for
+func checkState(name string, restored, size int) error {
+	if restored != size {
+		return fmt.Errorf("state has %d %s, solver was initialized for %d weights", restored, name, size)
+	}
+	return nil
 }
 
 func fparam(val, fallback float64) float64 {
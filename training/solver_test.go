@@ -0,0 +1,235 @@
+package training
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+// bowl is the ill-conditioned quadratic f(w) = Σ a_i w_i²
+var bowl = []float64{1, 50}
+
+// minimize returns the number of iterations for solver to bring the bowl
+// below threshold, starting from w = 1
+func minimize(solver Solver, threshold float64, max int) int {
+	w := make([]float64, len(bowl))
+	for i := range w {
+		w[i] = 1
+	}
+	solver.Init(len(w))
+	for it := 1; it <= max; it++ {
+		var f float64
+		for i, a := range bowl {
+			w[i] += solver.Update(w[i], 2*a*w[i], it, i)
+			f += a * w[i] * w[i]
+		}
+		if f < threshold {
+			return it
+		}
+	}
+	return max
+}
+
+func Test_RMSProp(t *testing.T) {
+	o := NewRMSProp(0.01, 0.9, 1e-8)
+	o.Init(2)
+	// the first update of a zero gradient is zero, not NaN
+	assert.Equal(t, 0.0, o.Update(1, 0, 1, 0))
+	assert.InDelta(t, -0.01/math.Sqrt(0.1), o.Update(1, 1, 1, 1), 1e-9)
+
+	o.Init(3)
+	assert.Len(t, o.cache, 3)
+	assert.Equal(t, 0.0, o.cache[1])
+
+	rmsprop := minimize(NewRMSProp(0.01, 0.9, 1e-8), 1e-3, 10000)
+	sgd := minimize(NewSGD(0.01, 0, 0, false), 1e-3, 10000)
+	assert.True(t, rmsprop < sgd)
+}
+
+func Test_RMSPropTraining(t *testing.T) {
+	data := Examples{
+		{Input: []float64{0, 0}, Response: []float64{0}},
+		{Input: []float64{1, 0}, Response: []float64{1}},
+		{Input: []float64{0, 1}, Response: []float64{1}},
+		{Input: []float64{1, 1}, Response: []float64{0}},
+	}
+	for _, trainer := range []Trainer{
+		NewTrainer(NewRMSProp(0.01, 0, 0), 0),
+		NewBatchTrainer(NewRMSProp(0.01, 0, 0), 0, 4, 2),
+	} {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{4, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeBinary,
+			Weight:     deep.NewNormal(1, 0),
+			Bias:       true,
+		})
+		trainer.Train(n, data, nil, 1000)
+		for _, e := range data {
+			assert.Equal(t, e.Response[0], deep.Round(n.Predict(e.Input)[0]))
+		}
+	}
+}
+
+func Test_AdaGrad(t *testing.T) {
+	o := NewAdaGrad(0.1, 1e-8)
+	o.Init(2)
+
+	// steps of a constant gradient shrink monotonically
+	prev := math.Inf(1)
+	for it := 1; it <= 100; it++ {
+		step := math.Abs(o.Update(0, 1, it, 0))
+		assert.True(t, step < prev)
+		prev = step
+	}
+	assert.InDelta(t, 0.1/math.Sqrt(100), prev, 1e-9)
+
+	// long stretches of zero gradients leave the weight and cache unchanged
+	for it := 1; it <= 100; it++ {
+		assert.Equal(t, 0.0, o.Update(0, 0, it, 1))
+	}
+	assert.Equal(t, 0.0, o.cache[1])
+	assert.InDelta(t, -0.1, o.Update(0, 3, 1, 1), 1e-9)
+
+	assert.True(t, minimize(NewAdaGrad(0.5, 0), 1e-3, 10000) < 10000)
+}
+
+func Test_AdamVariants(t *testing.T) {
+	gradients := [][]float64{{1, -2}, {0.5, 0.1}}
+	for _, c := range []struct {
+		solver   *Adam
+		expected [][]float64
+	}{
+		{NewAdam(0.1, 0.9, 0.9, 1e-8), [][]float64{
+			{-0.09999999683772245, 0.0999999984188612},
+			{-0.09471141001595627, 0.06491103182422892},
+		}},
+		// the second moment of the second weight decreases, so its maximum
+		// shrinks the step
+		{NewAMSGrad(0.1, 0.9, 0.9, 1e-8), [][]float64{
+			{-0.09999999683772245, 0.0999999984188612},
+			{-0.09471141001595627, 0.06166548028433414},
+		}},
+		{NewNadam(0.1, 0.9, 0.9, 1e-8), [][]float64{
+			{-0.14736841957894742, 0.1473684203157895},
+			{-0.09358805536540692, 0.03714032591602849},
+		}},
+	} {
+		c.solver.Init(2)
+		for it, g := range gradients {
+			for i := range g {
+				assert.InDelta(t, c.expected[it][i], c.solver.Update(0, g[i], it+1, i), 1e-12)
+			}
+		}
+	}
+
+	for _, solver := range []Solver{NewAMSGrad(0.1, 0, 0, 0), NewNadam(0.1, 0, 0, 0)} {
+		assert.True(t, minimize(solver, 1e-3, 10000) < 10000)
+	}
+}
+
+func Test_AdamW(t *testing.T) {
+	o := NewAdamW(0.1, 0, 0, 0, 0.5)
+	o.Init(2)
+	o.SetBiases([]bool{false, true})
+
+	// without a gradient only the weight decays, by lr*wd*w
+	assert.InDelta(t, -0.1*0.5*2, o.Update(2, 0, 1, 0), 1e-12)
+	assert.Equal(t, 0.0, o.Update(2, 0, 1, 1))
+
+	rand.Seed(0)
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     2,
+		Layout:     []int{3, 2},
+		Activation: deep.ActivationTanh,
+		Mode:       deep.ModeBinary,
+		Bias:       true,
+	})
+	b := biases(n)
+	assert.Len(t, b, n.NumWeights()+len(n.Layers))
+	var idx, count int
+	for _, l := range n.Layers {
+		for _, neuron := range l.Neurons {
+			for _, s := range neuron.In {
+				assert.Equal(t, s.IsBias, b[idx])
+				if b[idx] {
+					count++
+				}
+				idx++
+			}
+		}
+	}
+	assert.Equal(t, 5, count)
+	for _, bias := range b[idx:] {
+		assert.True(t, bias)
+	}
+}
+
+func Test_AdamWTraining(t *testing.T) {
+	var data Examples
+	rand.Seed(0)
+	for i := 0; i < 100; i++ {
+		x, y := rand.Float64()*2-1, rand.Float64()*2-1
+		data = append(data, Example{Input: []float64{x, y}, Response: []float64{x + 0.5*y}})
+	}
+
+	norm := func(solver Solver) float64 {
+		rand.Seed(1)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{8, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(1, 0),
+			Bias:       true,
+		})
+		NewTrainer(solver, 0).Train(n, data, nil, 100)
+		assert.True(t, crossValidate(n, data) < 0.01)
+
+		var sum float64
+		for _, l := range n.Layers {
+			for _, neuron := range l.Neurons {
+				for _, s := range neuron.In {
+					if !s.IsBias {
+						sum += s.Weight * s.Weight
+					}
+				}
+			}
+		}
+		return math.Sqrt(sum)
+	}
+	assert.True(t, norm(NewAdamW(0.01, 0, 0, 0, 0.1)) < norm(NewAdam(0.01, 0, 0, 0)))
+}
+
+func Test_SGDMomentum(t *testing.T) {
+	// no momentum is plain gradient descent, with or without nesterov
+	for _, nesterov := range []bool{false, true} {
+		o := NewSGD(0.1, 0, 0.01, nesterov)
+		o.Init(1)
+		for it := 1; it <= 3; it++ {
+			assert.Equal(t, -0.1/(1+0.01*float64(it))*0.7, o.Update(0, 0.7, it, 0))
+		}
+	}
+
+	o := NewSGD(0.1, 0.9, 0, false)
+	o.Init(1)
+	assert.InDelta(t, -0.1, o.Update(0, 1, 1, 0), 1e-12)
+	assert.InDelta(t, -0.19, o.Update(0, 1, 2, 0), 1e-12)
+	o.Init(1)
+	assert.InDelta(t, -0.1, o.Update(0, 1, 1, 0), 1e-12)
+
+	// nesterov steps along the velocity from the look-ahead position
+	o = NewSGD(0.1, 0.9, 0, true)
+	o.Init(1)
+	assert.InDelta(t, -0.9*0.1-0.1, o.Update(0, 1, 1, 0), 1e-12)
+	assert.InDelta(t, -0.9*0.19-0.1, o.Update(0, 1, 2, 0), 1e-12)
+
+	plain := minimize(NewSGD(0.005, 0, 0, false), 1e-3, 10000)
+	assert.True(t, minimize(NewSGD(0.005, 0.9, 0, false), 1e-3, 10000) < plain)
+	assert.True(t, minimize(NewSGD(0.005, 0.9, 0, true), 1e-3, 10000) < plain)
+}
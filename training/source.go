@@ -0,0 +1,161 @@
+package training
+
+import (
+	"math/rand"
+)
+
+// ExampleSource supplies training examples one at a time, for data sets
+// that do not fit in memory as Examples. Next returns false once the
+// examples of an epoch are exhausted, and Reset starts the next epoch.
+type ExampleSource interface {
+	Next() (Example, bool)
+	Reset()
+}
+
+// SliceSource is an ExampleSource of the examples of a slice, in order
+type SliceSource struct {
+	Examples Examples
+	next     int
+}
+
+// NewSliceSource returns the source of examples
+func NewSliceSource(examples Examples) *SliceSource {
+	return &SliceSource{Examples: examples}
+}
+
+// Next returns the next example
+func (s *SliceSource) Next() (Example, bool) {
+	if s.next >= len(s.Examples) {
+		return Example{}, false
+	}
+	s.next++
+	return s.Examples[s.next-1], true
+}
+
+// Reset starts over from the first example
+func (s *SliceSource) Reset() {
+	s.next = 0
+}
+
+// WithShuffleBuffer shuffles the examples of an ExampleSource through a
+// buffer of size examples, by the source of WithSeed if any: each example
+// is drawn at random from the buffer, which is then refilled from the
+// source. Examples that are far apart in the source stay apart unless the
+// buffer is as large.
+func WithShuffleBuffer(size int) Option {
+	return func(o *options) {
+		o.shuffleBuffer = size
+	}
+}
+
+// shuffleBuffer shuffles the examples of a source locally
+type shuffleBuffer struct {
+	source ExampleSource
+	buffer Examples
+	size   int
+	intn   func(int) int
+}
+
+func (b *shuffleBuffer) Next() (Example, bool) {
+	for len(b.buffer) < b.size {
+		e, ok := b.source.Next()
+		if !ok {
+			break
+		}
+		b.buffer = append(b.buffer, e)
+	}
+	if len(b.buffer) == 0 {
+		return Example{}, false
+	}
+	i, last := b.intn(len(b.buffer)), len(b.buffer)-1
+	e := b.buffer[i]
+	b.buffer[i] = b.buffer[last]
+	b.buffer = b.buffer[:last]
+	return e, true
+}
+
+func (b *shuffleBuffer) Reset() {
+	b.source.Reset()
+	b.buffer = b.buffer[:0]
+}
+
+// stream is the training examples of a run: a copy of a slice, sampled or
+// shuffled before every epoch, or a source
+type stream struct {
+	train  Examples
+	source ExampleSource
+	// sample of the epoch and the position in it, of a slice
+	sample   Examples
+	position int
+	// batch is the buffer of the batches of a source
+	batch Examples
+}
+
+// sliceStream returns the stream of a copy of examples
+func sliceStream(examples Examples) *stream {
+	train := make(Examples, len(examples))
+	copy(train, examples)
+	return &stream{train: train, sample: train}
+}
+
+// sourceStream returns the stream of source, through the shuffle buffer of
+// o if any
+func (o options) sourceStream(source ExampleSource) *stream {
+	if o.shuffleBuffer > 1 {
+		intn := rand.Intn
+		if o.rand != nil {
+			intn = o.rand.Intn
+		}
+		source = &shuffleBuffer{source: source, size: o.shuffleBuffer, intn: intn}
+	}
+	return &stream{source: source}
+}
+
+// epoch starts an epoch, sampling or shuffling a slice by o if shuffle,
+// and reports whether it drew from the source of o
+func (s *stream) epoch(o options, shuffle bool) bool {
+	if s.source != nil {
+		s.source.Reset()
+		return false
+	}
+	s.position = 0
+	if !shuffle {
+		return false
+	}
+	sample, drawn := o.sample(s.train)
+	if drawn {
+		s.sample = sample
+	}
+	return drawn
+}
+
+// next returns the next example of the epoch
+func (s *stream) next() (Example, bool) {
+	if s.source != nil {
+		return s.source.Next()
+	}
+	if s.position >= len(s.sample) {
+		return Example{}, false
+	}
+	s.position++
+	return s.sample[s.position-1], true
+}
+
+// nextBatch returns the next size examples of the epoch, fewer at its end
+// and none after it, valid until the next call
+func (s *stream) nextBatch(size int) Examples {
+	if s.source == nil {
+		b := s.sample[s.position:min(s.position+size, len(s.sample))]
+		s.position += len(b)
+		return b
+	}
+	s.batch = s.batch[:0]
+	for len(s.batch) < size {
+		e, ok := s.source.Next()
+		if !ok {
+			break
+		}
+		s.batch = append(s.batch, e)
+	}
+	return s.batch
+}
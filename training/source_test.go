@@ -0,0 +1,119 @@
+package training
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+// generator is an ExampleSource of size examples of sin(3x) a epoch, drawn
+// at random
+type generator struct {
+	r          *rand.Rand
+	size, next int
+}
+
+func (g *generator) Next() (Example, bool) {
+	if g.next == g.size {
+		return Example{}, false
+	}
+	g.next++
+	x := g.r.Float64()
+	return Example{Input: []float64{x}, Response: []float64{math.Sin(3 * x)}}, true
+}
+
+func (g *generator) Reset() { g.next = 0 }
+
+func Test_SliceSource(t *testing.T) {
+	data := indexedExamples(5)
+	for i := range data {
+		data[i].Response = []float64{float64(i) / 5}
+	}
+	network := func() *deep.Neural {
+		rand.Seed(0)
+		return deep.NewNeural(&deep.Config{
+			Inputs:     1,
+			Layout:     []int{3, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(0.5, 0),
+			Bias:       true,
+		})
+	}
+
+	// a slice in order trains alike from a source
+	a, b := network(), network()
+	NewTrainer(NewSGD(0.1, 0, 0, false), 0, WithShuffle(false)).Train(a, data, nil, 3)
+	assert.NoError(t, NewTrainer(NewSGD(0.1, 0, 0, false), 0).TrainSource(context.Background(), b, NewSliceSource(data), nil, 3))
+	assert.Equal(t, a.Weights(), b.Weights())
+
+	a, b = network(), network()
+	NewBatchTrainer(NewSGD(0.1, 0, 0, false), 0, 2, 2, WithShuffle(false)).Train(a, data, nil, 3)
+	assert.NoError(t, NewBatchTrainer(NewSGD(0.1, 0, 0, false), 0, 2, 2).TrainSource(context.Background(), b, NewSliceSource(data), nil, 3))
+	assert.Equal(t, a.Weights(), b.Weights())
+}
+
+func Test_ShuffleBuffer(t *testing.T) {
+	data := indexedExamples(20)
+	source := newOptions([]Option{WithShuffleBuffer(5), WithSeed(1)}).sourceStream(NewSliceSource(data)).source
+
+	var epochs [2][]int
+	for i := range epochs {
+		source.Reset()
+		for e, ok := source.Next(); ok; e, ok = source.Next() {
+			epochs[i] = append(epochs[i], int(e.Input[0]))
+		}
+		assert.Len(t, epochs[i], 20)
+		seen := map[int]bool{}
+		for j, v := range epochs[i] {
+			seen[v] = true
+			// an example is drawn from the next five at most
+			assert.True(t, v < j+5, "%d at %d", v, j)
+		}
+		assert.Len(t, seen, 20)
+	}
+	assert.NotEqual(t, epochs[0], epochs[1])
+	assert.NotEqual(t, indices(data), epochs[0])
+}
+
+func Test_TrainSource(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	data := make(Examples, 2000)
+	for i := range data {
+		x := r.Float64()
+		data[i] = Example{Input: []float64{x}, Response: []float64{math.Sin(3 * x)}}
+	}
+	test := data[:200]
+	network := func() *deep.Neural {
+		rand.Seed(0)
+		return deep.NewNeural(&deep.Config{
+			Inputs:     1,
+			Layout:     []int{8, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(0.5, 0),
+			Bias:       true,
+		})
+	}
+
+	slice, streamed := network(), network()
+	NewBatchTrainer(NewAdam(0.01, 0, 0, 0), 0, 16, 2).Train(slice, data, nil, 20)
+	source := &generator{r: rand.New(rand.NewSource(1)), size: 2000}
+	var trainLosses []float64
+	assert.NoError(t, NewBatchTrainer(NewAdam(0.01, 0, 0, 0), 0, 16, 2, WithShuffleBuffer(64), WithCallbacks(CallbackFuncs{
+		EpochEnd: func(epoch int, trainLoss, valLoss float64, n *deep.Neural) error {
+			trainLosses = append(trainLosses, trainLoss)
+			return nil
+		},
+	})).TrainSource(context.Background(), streamed, source, nil, 20))
+
+	sliceLoss, streamedLoss := validationLoss(slice, nil, test), validationLoss(streamed, nil, test)
+	assert.True(t, sliceLoss < 0.01, "%v", sliceLoss)
+	assert.True(t, streamedLoss < 2*sliceLoss+0.002, "%v vs %v", streamedLoss, sliceLoss)
+	assert.Len(t, trainLosses, 20)
+	assert.True(t, math.IsNaN(trainLosses[0]))
+}
@@ -0,0 +1,202 @@
+package training
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// State is the progress of a trainer after a training run, beyond the
+// network and the solver, from which training can be resumed exactly by
+// WithState
+type State struct {
+	// Epoch is the number of completed epochs
+	Epoch int
+	// Updates is the number of completed updates, the iterations of
+	// schedules
+	Updates int
+	// Shuffles is the number of epochs whose examples were shuffled or
+	// sampled
+	Shuffles int
+	// Draws is the number of values drawn from the source of WithSeed, by
+	// shuffles, samples, augmenters and dropout, and Samples the number
+	// drawn before each of the shuffles. On resuming, the shuffles are
+	// repeated at their positions in the source, and the other values are
+	// skipped. States without draws repeat the shuffles one after another.
+	Draws   int64   `json:",omitempty"`
+	Samples []int64 `json:",omitempty"`
+	// Seed is the seed of WithSeed, if any, whose source WithBundle
+	// restores
+	Seed *int64 `json:",omitempty"`
+	// BestLoss is the best validation loss of early stopping at BestEpoch,
+	// zero before any, and Waited the number of epochs since
+	BestLoss  float64
+	BestEpoch int
+	Waited    int
+	// Scheduler is the state of a StatefulScheduler
+	Scheduler json.RawMessage `json:",omitempty"`
+}
+
+// StatefulScheduler is a Scheduler whose state can be persisted between
+// training runs, see State
+type StatefulScheduler interface {
+	Scheduler
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// WithState resumes training from s: epochs and updates are counted on
+// from s, and early stopping and the scheduler continue where they were.
+// The network and the solver are expected to be restored alike, e.g. by
+// WithCheckpoint. The weights of the best epoch before s are not kept, so
+// early stopping restores them only if a later epoch improves on it, and
+// the order of the examples is only restored for trainers WithSeed.
+func WithState(s State) Option {
+	return func(o *options) {
+		o.state = &s
+	}
+}
+
+// progress keeps the state of the last training run of a trainer
+type progress struct {
+	state State
+}
+
+// State returns the state of the last training run, to resume it later
+func (p *progress) State() State {
+	return p.state
+}
+
+// restoreState continues the run of the state of o, if any: it restores
+// early stopping and schedule, moves the source of WithSeed past the values
+// drawn before, and returns the number of updates and shuffles
+func (o options) restoreState(s *stopping, sched *schedule, train Examples) (updates, shuffles int) {
+	if o.state == nil {
+		return 0, 0
+	}
+	if o.state.BestEpoch > 0 {
+		s.bestLoss, s.bestEpoch, s.waited = o.state.BestLoss, o.state.BestEpoch, o.state.Waited
+	}
+	if sched != nil && o.state.Scheduler != nil {
+		scheduler, ok := sched.scheduler.(StatefulScheduler)
+		if !ok {
+			panic("training: scheduler does not support state")
+		}
+		if err := scheduler.Unmarshal(o.state.Scheduler); err != nil {
+			panic(fmt.Sprintf("training: invalid scheduler state: %s", err))
+		}
+	}
+	switch {
+	case o.source != nil && o.state.Draws > 0:
+		// the examples are shuffled in place from epoch to epoch
+		for _, draws := range o.state.Samples {
+			o.source.skip(draws)
+			o.sample(train)
+		}
+		o.source.skip(o.state.Draws)
+	case o.rand != nil:
+		// the examples are shuffled in place from epoch to epoch, and
+		// samples draw from the source alike
+		for i := 0; i < o.state.Shuffles; i++ {
+			o.sample(train)
+		}
+	}
+	return o.state.Updates, o.state.Shuffles
+}
+
+// record keeps the state of a training run after epoch
+func (p *progress) record(epoch, updates, shuffles int, o options, s *stopping, sched *schedule) {
+	p.state = State{Epoch: epoch, Updates: updates, Shuffles: shuffles, Seed: o.seed, Waited: s.waited}
+	if o.source != nil {
+		p.state.Draws = o.source.draws
+		p.state.Samples = append([]int64(nil), o.source.samples...)
+	}
+	if s.bestEpoch > 0 {
+		p.state.BestLoss, p.state.BestEpoch = s.bestLoss, s.bestEpoch
+	}
+	if sched != nil {
+		if scheduler, ok := sched.scheduler.(StatefulScheduler); ok {
+			p.state.Scheduler, _ = scheduler.Marshal()
+		}
+	}
+}
+
+// countingSource is a source that counts the values drawn from it, such
+// that a source of the same seed can be moved to the same position, and
+// the number drawn before each sample of the examples
+type countingSource struct {
+	src     rand.Source64
+	draws   int64
+	samples []int64
+}
+
+func newCountingSource(seed int64) *countingSource {
+	return &countingSource{src: rand.NewSource(seed).(rand.Source64)}
+}
+
+func (s *countingSource) Int63() int64 {
+	s.draws++
+	return s.src.Int63()
+}
+
+func (s *countingSource) Uint64() uint64 {
+	s.draws++
+	return s.src.Uint64()
+}
+
+func (s *countingSource) Seed(seed int64) {
+	s.src.Seed(seed)
+	s.draws, s.samples = 0, nil
+}
+
+// skip draws from s until draws values were drawn in all
+func (s *countingSource) skip(draws int64) {
+	for s.draws < draws {
+		s.Int63()
+	}
+}
+
+type plateauState struct {
+	// Best is nil before any loss
+	Best  *float64
+	Wait  int
+	Scale float64
+}
+
+// Marshal returns the state of s
+func (s *ReduceLROnPlateau) Marshal() ([]byte, error) {
+	if s.scale == 0 {
+		s.reset()
+	}
+	return json.Marshal(plateauState{Best: jsonFloat(s.best), Wait: s.wait, Scale: s.scale})
+}
+
+// Unmarshal restores the state marshaled by Marshal
+func (s *ReduceLROnPlateau) Unmarshal(data []byte) error {
+	var state plateauState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	s.best, s.wait, s.scale = math.Inf(1), state.Wait, state.Scale
+	if state.Best != nil {
+		s.best = *state.Best
+	}
+	return nil
+}
+
+// Marshal returns the state of Next, null if it has none
+func (s Warmup) Marshal() ([]byte, error) {
+	if next, ok := s.Next.(StatefulScheduler); ok {
+		return next.Marshal()
+	}
+	return []byte("null"), nil
+}
+
+// Unmarshal restores the state of Next, if it has one
+func (s Warmup) Unmarshal(data []byte) error {
+	if next, ok := s.Next.(StatefulScheduler); ok {
+		return next.Unmarshal(data)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package training
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ResumeState(t *testing.T) {
+	data := Examples{
+		{Input: []float64{0, 0}, Response: []float64{0}},
+		{Input: []float64{0, 1}, Response: []float64{1}},
+		{Input: []float64{1, 0}, Response: []float64{1}},
+		{Input: []float64{1, 1}, Response: []float64{0}},
+	}
+	network := func() *deep.Neural {
+		rand.Seed(0)
+		return deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{4, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeBinary,
+			Weight:     deep.NewNormal(1, 0),
+			Bias:       true,
+		})
+	}
+	type trainer interface {
+		Trainer
+		State() State
+	}
+	trainers := map[string]func(Solver, ...Option) trainer{
+		"online": func(s Solver, opts ...Option) trainer { return NewTrainer(s, 0, opts...) },
+		"batch":  func(s Solver, opts ...Option) trainer { return NewBatchTrainer(s, 0, 2, 1, opts...) },
+	}
+	options := func(opts ...Option) []Option {
+		return append([]Option{
+			WithSeed(7),
+			WithScheduler(Warmup{Iterations: 30, Next: &ReduceLROnPlateau{Factor: 0.5, Patience: 2}}),
+			WithEarlyStopping(EarlyStopping{Patience: 100}),
+		}, opts...)
+	}
+
+	for name, newTrainer := range trainers {
+		n := network()
+		uninterrupted := newTrainer(NewAdam(0.05, 0, 0, 0), options()...)
+		uninterrupted.Train(n, data, data, 20)
+
+		m, solver := network(), NewAdam(0.05, 0, 0, 0)
+		interrupted := newTrainer(solver, options()...)
+		interrupted.Train(m, data, data, 10)
+		c, err := NewCheckpoint(m, solver, 10)
+		assert.NoError(t, err)
+		state := interrupted.State()
+		c.Trainer = &state
+		var buf bytes.Buffer
+		assert.NoError(t, SaveCheckpoint(&buf, c))
+		c, err = LoadCheckpoint(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, state, *c.Trainer, name)
+
+		resumed := c.Neural()
+		resumer := newTrainer(NewAdam(0.05, 0, 0, 0), options(WithCheckpoint(c))...)
+		resumer.Train(resumed, data, data, 10)
+
+		assert.Equal(t, n.Weights(), resumed.Weights(), name)
+		assert.Equal(t, uninterrupted.State(), resumer.State(), name)
+		assert.Equal(t, 20, resumer.State().Epoch, name)
+		assert.NotNil(t, resumer.State().Scheduler, name)
+
+		// without the state of the trainer, the run diverges
+		c.Trainer = nil
+		restarted := c.Neural()
+		newTrainer(NewAdam(0.05, 0, 0, 0), options(WithCheckpoint(c))...).Train(restarted, data, data, 10)
+		assert.NotEqual(t, n.Weights(), restarted.Weights(), name)
+	}
+}
+
+func Test_PlateauState(t *testing.T) {
+	s := &ReduceLROnPlateau{Factor: 0.5, Patience: 1}
+	b, err := s.Marshal()
+	assert.NoError(t, err)
+
+	s.Observe(1, 1)
+	s.Observe(2, 2)
+	assert.Equal(t, 0.5, s.LR(2, 0, 1))
+
+	restored := &ReduceLROnPlateau{Factor: 0.5, Patience: 1}
+	assert.NoError(t, restored.Unmarshal(b))
+	assert.Equal(t, 1.0, restored.LR(0, 0, 1))
+	b, err = s.Marshal()
+	assert.NoError(t, err)
+	assert.NoError(t, restored.Unmarshal(b))
+	assert.Equal(t, 0.5, restored.LR(2, 0, 1))
+	restored.Observe(3, 1.5)
+	assert.Equal(t, 0.25, restored.LR(3, 0, 1))
+}
@@ -0,0 +1,99 @@
+package training
+
+import (
+	"fmt"
+
+	deep "github.com/patrikeh/go-deep"
+)
+
+// WithSWA enables stochastic weight averaging: from epoch start on, the
+// weights of the network after every epoch are averaged, see ApplyAverage
+func WithSWA(start int) Option {
+	return func(o *options) {
+		o.swa = start
+	}
+}
+
+// averaging keeps the running average of the weights of a training run
+type averaging struct {
+	averaged       int
+	averageWeights [][][]float64
+	averageAlphas  []float64
+	averageConv    *deep.Convolution
+}
+
+// resetAverage discards the average
+func (a *averaging) resetAverage() {
+	a.averaged, a.averageWeights, a.averageAlphas, a.averageConv = 0, nil, nil, nil
+}
+
+// average adds the weights of n after epoch to the average, if epoch is
+// not before start
+func (a *averaging) average(n *deep.Neural, start, epoch int) {
+	if start <= 0 || epoch < start {
+		return
+	}
+	a.averaged++
+	if a.averaged == 1 {
+		a.averageWeights, a.averageAlphas, a.averageConv = n.Weights(), n.Alphas(), n.Convolution()
+		return
+	}
+	c := float64(a.averaged)
+	for i, l := range n.Layers {
+		for j, neuron := range l.Neurons {
+			for k, s := range neuron.In {
+				a.averageWeights[i][j][k] += (s.Weight - a.averageWeights[i][j][k]) / c
+			}
+		}
+		a.averageAlphas[i] += (l.Alpha - a.averageAlphas[i]) / c
+	}
+	if n.Conv != nil {
+		for f, kernel := range n.Conv.Kernels {
+			for k, w := range kernel {
+				a.averageConv.Kernels[f][k] += (w - a.averageConv.Kernels[f][k]) / c
+			}
+		}
+		for f, b := range n.Conv.Biases {
+			a.averageConv.Biases[f] += (b - a.averageConv.Biases[f]) / c
+		}
+	}
+}
+
+// SWAWeights returns the averaged weights of the last training run, or nil
+// if no epoch was averaged
+func (a *averaging) SWAWeights() [][][]float64 {
+	return a.averageWeights
+}
+
+// ApplyAverage sets the weights of n, e.g. a clone of the trained network,
+// to the averaged weights of the last training run
+func (a *averaging) ApplyAverage(n *deep.Neural) error {
+	if a.averaged == 0 {
+		return fmt.Errorf("no averaged weights")
+	}
+	if !fits(n, a.averageWeights) {
+		return fmt.Errorf("averaged weights do not fit network")
+	}
+	n.ApplyWeights(a.averageWeights)
+	n.ApplyAlphas(a.averageAlphas)
+	n.ApplyConvolution(a.averageConv)
+	return nil
+}
+
+// fits reports whether weights are shaped like the weights of n
+func fits(n *deep.Neural, weights [][][]float64) bool {
+	if len(weights) != len(n.Layers) {
+		return false
+	}
+	for i, l := range n.Layers {
+		if len(weights[i]) != len(l.Neurons) {
+			return false
+		}
+		for j, neuron := range l.Neurons {
+			if len(weights[i][j]) != len(neuron.In) {
+				return false
+			}
+		}
+	}
+	return true
+}
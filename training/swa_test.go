@@ -0,0 +1,71 @@
+package training
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	deep "github.com/patrikeh/go-deep"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SWA(t *testing.T) {
+	rand.Seed(0)
+	sample := func(noise float64) Example {
+		x := rand.Float64()*4 - 2
+		return Example{Input: []float64{x}, Response: []float64{math.Sin(x) + noise*rand.NormFloat64()}}
+	}
+	var data, validation Examples
+	for i := 0; i < 200; i++ {
+		data = append(data, sample(0.5))
+		validation = append(validation, sample(0))
+	}
+	config := func() *deep.Config {
+		return &deep.Config{
+			Inputs:     1,
+			Layout:     []int{8, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(0.5, 0),
+			Bias:       true,
+		}
+	}
+
+	for _, trainer := range []interface {
+		Trainer
+		SWAWeights() [][][]float64
+		ApplyAverage(*deep.Neural) error
+	}{
+		NewTrainer(NewSGD(0.05, 0, 0, false), 0, WithSWA(20)),
+		NewBatchTrainer(NewSGD(0.5, 0, 0, false), 0, 4, 4, WithSWA(20)),
+	} {
+		rand.Seed(1)
+		n := deep.NewNeural(config())
+		assert.Error(t, trainer.ApplyAverage(n))
+
+		trainer.Train(n, data, nil, 40)
+		assert.NotNil(t, trainer.SWAWeights())
+
+		averaged := deep.FromDump(n.Dump())
+		assert.NoError(t, trainer.ApplyAverage(averaged))
+		assert.NotEqual(t, n.Weights(), averaged.Weights())
+		last, swa := validationLoss(n, nil, validation), validationLoss(averaged, nil, validation)
+		assert.True(t, swa <= last)
+
+		// the averaged network persists like any other
+		dump, err := averaged.Marshal()
+		assert.NoError(t, err)
+		restored, err := deep.Unmarshal(dump)
+		assert.NoError(t, err)
+		assert.Equal(t, averaged.Predict([]float64{0.5}), restored.Predict([]float64{0.5}))
+
+		c := config()
+		c.Layout = []int{4, 1}
+		assert.Error(t, trainer.ApplyAverage(deep.NewNeural(c)))
+	}
+
+	// without SWA there is no average
+	trainer := NewTrainer(NewSGD(0.05, 0, 0, false), 0)
+	trainer.Train(deep.NewNeural(config()), data, nil, 2)
+	assert.Nil(t, trainer.SWAWeights())
+}
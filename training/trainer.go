@@ -1,7 +1,10 @@
 package training
 
 import (
-	"time"
+	"context"
+	"io"
+	"math"
+	"math/rand"
 
 	deep "github.com/patrikeh/go-deep"
 )
@@ -11,96 +14,621 @@ type Trainer interface {
 	Train(n *deep.Neural, examples, validation Examples, iterations int)
 }
 
+// Option configures a trainer
+type Option func(*options)
+
+type options struct {
+	loss          deep.Loss
+	scheduler     Scheduler
+	clipNorm      float64
+	clipValue     float64
+	layerLR       map[int]float64
+	checkpoint    *Checkpoint
+	steps         int
+	swa           int
+	bptt          int
+	maxNorm       float64
+	stopping      *EarlyStopping
+	noShuffle     bool
+	rand          *rand.Rand
+	source        *countingSource
+	seed          *int64
+	callbacks     []Callback
+	metrics       []Metric
+	logger        Logger
+	silent        bool
+	output        io.Writer
+	state         *State
+	parallelism   int
+	budget        *TimeBudget
+	events        chan<- Event
+	sampler       Sampler
+	augmenter     Augmenter
+	shuffleBuffer int
+	safeguards    *Safeguards
+	history       *History
+	bundle        *Bundle
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithLoss trains using loss rather than the loss given by Config.Loss,
+// e.g. for parameterized losses such as deep.NewWeightedCrossEntropy
+func WithLoss(loss deep.Loss) Option {
+	return func(o *options) {
+		o.loss = loss
+	}
+}
+
+// WithScheduler schedules the learning rate of the solver, which must be an
+// LRSolver, before every update
+func WithScheduler(scheduler Scheduler) Option {
+	return func(o *options) {
+		o.scheduler = scheduler
+	}
+}
+
+// WithClipNorm rescales the gradient of all weights whenever its L2 norm
+// exceeds norm
+func WithClipNorm(norm float64) Option {
+	return func(o *options) {
+		o.clipNorm = norm
+	}
+}
+
+// WithClipValue clamps the gradient of each weight to [-value, value]
+func WithClipValue(value float64) Option {
+	return func(o *options) {
+		o.clipValue = value
+	}
+}
+
+// WithMaxNorm rescales the incoming weights of each neuron, biases
+// excluded, and the kernel of each filter to an L2 norm of norm after every
+// update that leaves them longer, e.g. in place of L2 with dropout
+func WithMaxNorm(norm float64) Option {
+	return func(o *options) {
+		o.maxNorm = norm
+	}
+}
+
+// WithShuffle sets whether the examples are shuffled before every epoch,
+// which they are by default
+func WithShuffle(shuffle bool) Option {
+	return func(o *options) {
+		o.noShuffle = !shuffle
+	}
+}
+
+// WithSeed shuffles the examples and drops out neurons by a source of the
+// trainer seeded by seed rather than by the global source, for reproducible
+// training along with Config.Seed. The BatchTrainer drops out each example
+// by a source seeded by a draw of it for the batch and the position of the
+// example in the batch, so dropout does not depend on its parallelism.
+func WithSeed(seed int64) Option {
+	return func(o *options) {
+		o.source = newCountingSource(seed)
+		o.rand = rand.New(o.source)
+		o.seed = &seed
+	}
+}
+
+// shuffle shuffles examples before an epoch, unless disabled, and reports
+// whether it did
+func (o options) shuffle(examples Examples) bool {
+	if !o.noShuffle {
+		examples.ShuffleWith(o.rand)
+	}
+	return !o.noShuffle
+}
+
+// WithLayerLR multiplies the updates of the weights into each layer by
+// its multiplier, e.g. 0 freezes a layer. Layers not given are unaffected.
+func WithLayerLR(multipliers map[int]float64) Option {
+	return func(o *options) {
+		o.layerLR = multipliers
+	}
+}
+
+// WithAccumulationSteps sums the gradients of steps examples, or mini-batches
+// for the BatchTrainer, into each update of the solver, which is passed
+// their average, over the total weight of the examples for the
+// BatchTrainer. Leftover gradients are applied at the end of each epoch.
+// Learning rate schedules count updates, not examples or mini-batches.
+func WithAccumulationSteps(steps int) Option {
+	return func(o *options) {
+		o.steps = steps
+	}
+}
+
+// accumulation returns the number of steps summed into each update
+func (o options) accumulation() int {
+	return iparam(o.steps, 1)
+}
+
+// lr returns the learning rate multiplier of layer i
+func (o options) lr(i int) float64 {
+	if m, ok := o.layerLR[i]; ok {
+		return m
+	}
+	return 1
+}
+
+// clipScale returns the scale of gradients with the given squared L2 norm
+func (o options) clipScale(squared float64) float64 {
+	if o.clipNorm > 0 && squared > o.clipNorm*o.clipNorm {
+		return o.clipNorm / math.Sqrt(squared)
+	}
+	return 1
+}
+
+// clip scales gradient and clamps it by value
+func (o options) clip(gradient, scale float64) float64 {
+	gradient *= scale
+	if o.clipValue > 0 {
+		gradient = math.Max(-o.clipValue, math.Min(gradient, o.clipValue))
+	}
+	return gradient
+}
+
+// constrain applies the max-norm constraint to the layers of n that are
+// not frozen
+func (o options) constrain(n *deep.Neural) {
+	if o.maxNorm <= 0 {
+		return
+	}
+	for _, l := range n.Layers {
+		if l.Frozen {
+			continue
+		}
+		for _, neuron := range l.Neurons {
+			var squared float64
+			for _, s := range neuron.In {
+				if !s.IsBias {
+					squared += s.Weight * s.Weight
+				}
+			}
+			if scale := o.maxNormScale(squared); scale != 1 {
+				for _, s := range neuron.In {
+					if !s.IsBias {
+						s.Weight *= scale
+					}
+				}
+			}
+		}
+	}
+	if n.Conv != nil && !n.Layers[0].Frozen {
+		for _, kernel := range n.Conv.Kernels {
+			if scale := o.maxNormScale(deep.Dot(kernel, kernel)); scale != 1 {
+				for k := range kernel {
+					kernel[k] *= scale
+				}
+			}
+		}
+	}
+}
+
+// maxNormScale returns the scale of weights with the given squared L2 norm
+// under the max-norm constraint
+func (o options) maxNormScale(squared float64) float64 {
+	if squared > o.maxNorm*o.maxNorm {
+		return o.maxNorm / math.Sqrt(squared)
+	}
+	return 1
+}
+
+// lossFor returns the loss of the trainer, or that of n, differentiated for
+// the output layer of n
+func (o options) lossFor(n *deep.Neural) deep.Loss {
+	loss := o.loss
+	if loss == nil {
+		loss = n.Loss()
+	}
+	return n.OutputLoss(loss)
+}
+
 // OnlineTrainer is a basic, online network trainer
 type OnlineTrainer struct {
 	*internal
+	averaging
+	stopping
+	progress
+	opts      options
 	solver    Solver
 	printer   *StatsPrinter
 	verbosity int
 }
 
 // NewTrainer creates a new trainer
-func NewTrainer(solver Solver, verbosity int) *OnlineTrainer {
+func NewTrainer(solver Solver, verbosity int, opts ...Option) *OnlineTrainer {
+	o := newOptions(opts)
 	return &OnlineTrainer{
+		opts:      o,
 		solver:    solver,
-		printer:   NewStatsPrinter(),
+		printer:   newStatsPrinter(o.output),
 		verbosity: verbosity,
 	}
 }
 
 type internal struct {
-	deltas [][]float64
+	loss       deep.Loss
+	weighted   bool
+	augmenter  Augmenter
+	schedule   *schedule
+	guard      *guard
+	updates    int
+	deltas     [][]float64
+	alphas     []float64
+	estimate   []float64
+	activation []float64
+	outputs    []float64
+	// ones is the activation gradient of a PReLU output layer, see outputAlpha
+	ones []float64
+	// gradients of the outputs of each layer
+	outGradients [][]float64
+
+	norms normGradients
+	conv  convGradients
+	// history of the sequence, under WithBPTT
+	history *history
+
+	// gradients accumulated over the steps of an update
+	steps             int
+	gradients         [][][]float64
+	accumulatedAlphas []float64
+	accumulatedNorms  normGradients
 }
 
-func newTraining(layers []*deep.Layer) *internal {
+func newTraining(layers []*deep.Layer, loss deep.Loss) *internal {
 	deltas := make([][]float64, len(layers))
+	outGradients := make([][]float64, len(layers))
+	gradients := make([][][]float64, len(layers))
 	for i, l := range layers {
 		deltas[i] = make([]float64, len(l.Neurons))
+		outGradients[i] = make([]float64, len(l.Neurons))
+		gradients[i] = make([][]float64, len(l.Neurons))
+		for j, n := range l.Neurons {
+			gradients[i][j] = make([]float64, len(n.In))
+		}
 	}
+	outputs := len(layers[len(layers)-1].Neurons)
 	return &internal{
-		deltas: deltas,
+		loss:              loss,
+		deltas:            deltas,
+		alphas:            make([]float64, len(layers)),
+		estimate:          make([]float64, outputs),
+		activation:        make([]float64, outputs),
+		outputs:           make([]float64, outputs),
+		ones:              ones(outputs),
+		outGradients:      outGradients,
+		norms:             newNormGradients(layers),
+		gradients:         gradients,
+		accumulatedAlphas: make([]float64, len(layers)),
+		accumulatedNorms:  newNormGradients(layers),
+	}
+}
+
+// ones returns n ones
+func ones(n int) []float64 {
+	ones := make([]float64, n)
+	for i := range ones {
+		ones[i] = 1
+	}
+	return ones
+}
+
+// outputAlpha is the gradient of loss with respect to the slope of a PReLU
+// output layer l, using outputs for the gradient with respect to each output
+// and ones, of a one for each output, for their activation gradients
+func outputAlpha(loss deep.Loss, l *deep.Layer, estimate, ideal, ones, outputs []float64) float64 {
+	deep.OutputDeltas(loss, estimate, ideal, ones, outputs)
+	var grad float64
+	for i, neuron := range l.Neurons {
+		grad += outputs[i] * deep.PReLU{}.DfAlpha(neuron.Sum)
+	}
+	return grad
+}
+
+// trainable returns the index of the first layer of n that is not frozen,
+// below which no gradients are needed
+func trainable(n *deep.Neural) int {
+	for i, l := range n.Layers {
+		if !l.Frozen {
+			return i
+		}
+	}
+	return len(n.Layers)
+}
+
+// layerWeights returns the number of weights into l, biases included
+func layerWeights(l *deep.Layer) int {
+	var weights int
+	for _, neuron := range l.Neurons {
+		weights += len(neuron.In)
+	}
+	return weights
+}
+
+// addSkipped adds to the gradients of the outputs of layer i of n those of
+// the layers they are skipped to
+func addSkipped(n *deep.Neural, i int, outGradients [][]float64) {
+	for _, s := range n.Config.Skips {
+		if s.From == i {
+			for j, g := range outGradients[s.To] {
+				outGradients[i][j] += g
+			}
+		}
 	}
 }
 
-// Train trains n
+// Train trains n, and panics if the loss or the input or response of an
+// example is invalid, see TrainContext
 func (t *OnlineTrainer) Train(n *deep.Neural, examples, validation Examples, iterations int) {
-	t.internal = newTraining(n.Layers)
+	if err := checkExamples(n, t.opts.lossFor(n), examples, validation); err != nil {
+		panic("training: " + err.Error())
+	}
+	t.train(context.Background(), n, sliceStream(examples), validation, iterations)
+}
 
-	train := make(Examples, len(examples))
-	copy(train, examples)
+// TrainContext trains n until ctx is done, checked before every example,
+// and returns the error of ctx or of the callback that stopped training.
+// Gradients accumulated towards an update are then discarded. An error
+// naming the first example or validation example of an invalid input, see
+// deep.Neural.CheckInput, or of a response not of the size of the ideals
+// of the loss, see deep.IdealSize, is returned before training, as is that
+// of a loss that cannot train n, see deep.ValidateLoss.
+func (t *OnlineTrainer) TrainContext(ctx context.Context, n *deep.Neural, examples, validation Examples, iterations int) error {
+	if err := checkExamples(n, t.opts.lossFor(n), examples, validation); err != nil {
+		return err
+	}
+	return t.train(ctx, n, sliceStream(examples), validation, iterations)
+}
 
-	t.printer.Init(n)
-	t.solver.Init(n.NumWeights())
+// TrainSource trains n like TrainContext on the examples of source, drawn
+// anew every epoch. They are not sampled, shuffled but by WithShuffleBuffer
+// or weighted, their loss is not evaluated, and resuming a run only
+// restores the order of examples of a slice.
+func (t *OnlineTrainer) TrainSource(ctx context.Context, n *deep.Neural, source ExampleSource, validation Examples, iterations int) error {
+	if err := checkLoss(n, t.opts.lossFor(n)); err != nil {
+		return err
+	}
+	return t.train(ctx, n, t.opts.sourceStream(source), validation, iterations)
+}
 
-	ts := time.Now()
-	for i := 1; i <= iterations; i++ {
-		examples.Shuffle()
-		for j := 0; j < len(examples); j++ {
-			t.learn(n, examples[j], i)
+func (t *OnlineTrainer) train(ctx context.Context, n *deep.Neural, train *stream, validation Examples, iterations int) error {
+	t.internal = newTraining(n.Layers, t.opts.lossFor(n))
+	t.augmenter = t.opts.augmentation()
+	t.conv = newConvGradients(n)
+	if t.opts.bptt > 0 {
+		window := t.opts.bptt
+		if !n.Recurrent() {
+			window = 1
+		}
+		t.history = newHistory(n, window)
+	}
+	defer n.SetTraining(n.Training())
+	n.SetTraining(true)
+	if t.opts.rand != nil {
+		defer n.SetRand(n.Rand())
+		n.SetRand(t.opts.rand)
+	}
+	t.resetAverage()
+	t.resetStopping()
+	t.weighted = train.train.weighted()
+	t.schedule = newSchedule(t.opts.scheduler, t.solver)
+	defer t.schedule.restore()
+	t.guard = newGuard(t.opts.safeguards, t.solver)
+	defer t.guard.restore()
+
+	t.printer.loss = t.loss
+	t.printer.schedule = t.schedule
+	t.printer.metrics = t.opts.metrics
+	start := t.opts.resume(t.solver, n)
+	callbacks := newCallbacks(t.opts, t.printer, t.verbosity, n, t.solver, t.loss, train.train, validation)
+	updates, shuffles := t.opts.restoreState(&t.stopping, t.schedule, train.train)
+	t.updates = updates
+
+	epoch := start
+	var err error
+	deadline := t.opts.deadline()
+	for i := start + 1; i <= start+iterations; i++ {
+		t.opts.emit(EpochStartEvent{Epoch: i})
+		if t.history != nil {
+			n.ResetState()
+			t.history.reset()
+		}
+		if train.epoch(t.opts, t.history == nil) {
+			shuffles++
+		}
+		passed := false
+		for e, ok := train.next(); ok; e, ok = train.next() {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			if passed = deadline.batch(); passed {
+				break
+			}
+			t.learn(n, e, i)
+		}
+		if err != nil {
+			break
 		}
-		if t.verbosity > 0 && i%t.verbosity == 0 && len(validation) > 0 {
-			t.printer.PrintProgress(n, validation, time.Since(ts), i)
+		if passed {
+			t.reason = StopMaxDuration
+			break
 		}
+		if t.steps > 0 {
+			t.step(n, i)
+		}
+		t.average(n, t.opts.swa, i)
+		t.schedule.observe(n, t.loss, i, validation)
+		epoch = i
+		if err = callbacks.epochEnd(n, i); err != nil {
+			break
+		}
+		if t.stop(n, t.opts.stopping, t.loss, i, validation) {
+			t.opts.emit(EarlyStopEvent{Epoch: i, BestEpoch: t.bestEpoch, BestLoss: t.bestLoss})
+			break
+		}
+		if deadline.passed() {
+			t.reason = StopMaxDuration
+			break
+		}
+	}
+	if err != nil {
+		t.reason = StopInterrupted
 	}
+	t.record(epoch, t.updates, shuffles, t.opts, &t.stopping, t.schedule)
+	t.restoreBest(n, t.opts.stopping)
+	callbacks.trainEnd(n, epoch, err)
+	return err
 }
 
 func (t *OnlineTrainer) learn(n *deep.Neural, e Example, it int) {
+	e = augment(t.augmenter, e)
+	if t.history != nil {
+		t.learnStep(n, e, it)
+		return
+	}
+	weight := e.weight(t.weighted)
+	if weight == 0 {
+		return
+	}
+	n.ResetState()
 	n.Forward(e.Input)
-	t.calculateDeltas(n, e.Response)
+	if t.guard != nil && !t.guard.admit(t.opts, exampleLoss(n, t.loss, e.Response, t.estimate), it) {
+		return
+	}
+	t.calculateDeltas(n, e.Response, weight)
+	t.accumulate(n)
+	if t.steps == t.opts.accumulation() {
+		t.step(n, it)
+	}
+}
+
+// accumulate adds the gradients of the last example
+func (t *OnlineTrainer) accumulate(n *deep.Neural) {
+	for i, l := range n.Layers {
+		if l.Frozen {
+			continue
+		}
+		for j, neuron := range l.Neurons {
+			for k, s := range neuron.In {
+				if !s.Pruned {
+					t.gradients[i][j][k] += t.deltas[i][j] * s.In
+				}
+			}
+		}
+		t.accumulatedAlphas[i] += t.alphas[i]
+	}
+	t.accumulatedNorms.add(t.norms)
+	t.conv.backward(n, t.deltas[0])
+	t.steps++
+}
+
+// step updates n by the average of the accumulated gradients
+func (t *OnlineTrainer) step(n *deep.Neural, it int) {
+	t.schedule.apply(it-1, t.updates)
+	t.guard.apply(t.schedule != nil)
 	t.update(n, it)
+	t.updates++
 }
 
-func (t *OnlineTrainer) calculateDeltas(n *deep.Neural, ideal []float64) {
+func (t *OnlineTrainer) calculateDeltas(n *deep.Neural, ideal []float64, weight float64) {
 	for i, neuron := range n.Layers[len(n.Layers)-1].Neurons {
-		t.deltas[len(n.Layers)-1][i] = deep.GetLoss(n.Config.Loss).Df(
-			neuron.Value,
-			ideal[i],
-			neuron.DActivate(neuron.Value))
+		t.estimate[i] = neuron.Value
+		t.activation[i] = neuron.Derivative()
+	}
+	deep.OutputDeltas(t.loss, t.estimate, ideal, t.activation, t.deltas[len(n.Layers)-1])
+	if weight != 1 {
+		for i := range t.deltas[len(n.Layers)-1] {
+			t.deltas[len(n.Layers)-1][i] *= weight
+		}
+	}
+	if last := n.Layers[len(n.Layers)-1]; last.A == deep.ActivationPReLU {
+		t.alphas[len(n.Layers)-1] = weight * outputAlpha(t.loss, last, t.estimate, ideal, t.ones, t.outputs)
 	}
 
-	for i := len(n.Layers) - 2; i >= 0; i-- {
+	for i := len(n.Layers) - 2; i >= trainable(n); i-- {
+		prelu := n.Layers[i].A == deep.ActivationPReLU
+		t.alphas[i] = 0
 		for j, neuron := range n.Layers[i].Neurons {
 			var sum float64
 			for k, s := range neuron.Out {
 				sum += s.Weight * t.deltas[i+1][k]
 			}
-			t.deltas[i][j] = neuron.DActivate(neuron.Value) * sum
+			t.outGradients[i][j] = sum
+		}
+		addSkipped(n, i, t.outGradients)
+		for j, neuron := range n.Layers[i].Neurons {
+			sum := t.outGradients[i][j]
+			t.deltas[i][j] = neuron.Derivative() * sum
+			if prelu {
+				t.alphas[i] += sum * neuron.Mask() * deep.PReLU{}.DfAlpha(neuron.Sum)
+			}
+		}
+		if n.Layers[i].Norm != nil {
+			normalizeDeltas(n.Layers[i], t.deltas[i], t.norms.gammas[i], t.norms.betas[i])
 		}
 	}
 }
 
 func (t *OnlineTrainer) update(n *deep.Neural, it int) {
+	steps := float64(t.steps)
+	scale := 1.0
+	if t.opts.clipNorm > 0 {
+		var squared float64
+		for i, l := range n.Layers {
+			for _, jG := range t.gradients[i] {
+				for _, g := range jG {
+					squared += (g / steps) * (g / steps)
+				}
+			}
+			if l.A == deep.ActivationPReLU && !l.Frozen {
+				squared += math.Pow(t.accumulatedAlphas[i]/steps, 2)
+			}
+		}
+		squared += t.accumulatedNorms.squared(n, steps)
+		squared += t.conv.squared(steps)
+		scale = t.opts.clipScale(squared)
+	}
+
 	var idx int
 	for i, l := range n.Layers {
+		if l.Frozen {
+			idx += layerWeights(l)
+			continue
+		}
 		for j := range l.Neurons {
 			for k := range l.Neurons[j].In {
+				if l.Neurons[j].In[k].Pruned {
+					idx++
+					continue
+				}
 				update := t.solver.Update(l.Neurons[j].In[k].Weight,
-					t.deltas[i][j]*l.Neurons[j].In[k].In,
+					t.opts.clip(t.gradients[i][j][k]/steps, scale)+n.Config.Regularization(l.Neurons[j].In[k]),
 					it,
 					idx)
-				l.Neurons[j].In[k].Weight += update
+				l.Neurons[j].In[k].Weight += t.opts.lr(i) * update
+				t.gradients[i][j][k] = 0
 				idx++
 			}
 		}
 	}
+	for i, l := range n.Layers {
+		if l.A == deep.ActivationPReLU && !l.Frozen {
+			l.Alpha += t.opts.lr(i) * t.solver.Update(l.Alpha, t.opts.clip(t.accumulatedAlphas[i]/steps, scale), it, idx+i)
+		}
+		t.accumulatedAlphas[i] = 0
+	}
+	idx = t.accumulatedNorms.apply(n, t.solver, t.opts, it, idx+len(n.Layers), steps, scale)
+	t.conv.apply(n, t.solver, t.opts, it, idx, steps, scale)
+	t.opts.constrain(n)
+	t.steps = 0
 }
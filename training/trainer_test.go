@@ -1,10 +1,15 @@
 package training
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
+	"runtime"
+	"sort"
 	"testing"
+	"time"
 
 	deep "github.com/patrikeh/go-deep"
 	"github.com/stretchr/testify/assert"
@@ -69,15 +74,490 @@ func Test_RegressionLinearOuts(t *testing.T) {
 	}
 }
 
+func Test_MeanAbsoluteRegression(t *testing.T) {
+	rand.Seed(0)
+
+	data := Examples{}
+	for i := 0.0; i < 1; i += 0.02 {
+		data = append(data, Example{Input: []float64{i}, Response: []float64{2*i + 1}})
+	}
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     1,
+		Layout:     []int{2, 1},
+		Activation: deep.ActivationLinear,
+		Mode:       deep.ModeRegression,
+		Loss:       deep.LossMeanAbsolute,
+		Weight:     deep.NewUniform(0.5, 0),
+		Bias:       true,
+	})
+
+	trainer := NewTrainer(NewAdam(0.01, 0, 0, 0), 0)
+	trainer.Train(n, data, nil, 500)
+
+	for _, x := range []float64{0.1, 0.3, 0.5, 0.9} {
+		assert.InDelta(t, 2*x+1, n.Predict([]float64{x})[0], 0.05)
+	}
+	assert.True(t, crossValidate(n, data) < 0.05)
+}
+
+func Test_FocalImbalanced(t *testing.T) {
+	// 99:1 imbalance where the minority class is labeled 0, such that
+	// the default alpha of 0.25 weighs it by 0.75
+	rand.Seed(0)
+	var data Examples
+	for i := 0; i < 990; i++ {
+		data = append(data, Example{Input: []float64{rand.NormFloat64(), rand.NormFloat64()}, Response: []float64{1}})
+	}
+	for i := 0; i < 10; i++ {
+		data = append(data, Example{Input: []float64{rand.NormFloat64() + 2, rand.NormFloat64() + 2}, Response: []float64{0}})
+	}
+
+	recall := func(loss deep.LossType) int {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{1},
+			Activation: deep.ActivationSigmoid,
+			Mode:       deep.ModeBinary,
+			Loss:       loss,
+			Weight:     deep.NewUniform(0.5, 0),
+			Bias:       true,
+		})
+		trainer := NewTrainer(NewSGD(0.01, 0, 0, false), 0)
+		trainer.Train(n, data, nil, 20)
+
+		var tp int
+		for _, e := range data {
+			if e.Response[0] == 0 && n.Predict(e.Input)[0] < 0.5 {
+				tp++
+			}
+		}
+		return tp
+	}
+
+	assert.True(t, recall(deep.LossFocal) > recall(deep.LossBinaryCrossEntropy))
+}
+
+func Test_WithLoss(t *testing.T) {
+	// identical inputs, so the prediction is the weighted class frequency
+	var data Examples
+	for i := 0; i < 10; i++ {
+		response := []float64{1, 0}
+		if i == 0 {
+			response = []float64{0, 1}
+		}
+		data = append(data, Example{Input: []float64{1}, Response: response})
+	}
+
+	predict := func(weights []float64) float64 {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     1,
+			Layout:     []int{2},
+			Activation: deep.ActivationSigmoid,
+			Mode:       deep.ModeMultiClass,
+			Weight:     deep.NewUniform(0.5, 0),
+			Bias:       true,
+		})
+		trainer := NewBatchTrainer(NewAdam(0.01, 0, 0, 0), 0, len(data), 1, WithLoss(deep.NewWeightedCrossEntropy(weights)))
+		trainer.Train(n, data, nil, 2000)
+		return n.Predict([]float64{1})[1]
+	}
+
+	assert.InDelta(t, 0.1, predict([]float64{1, 1}), 0.01)
+	assert.InDelta(t, 0.5, predict([]float64{1, 9}), 0.01)
+}
+
+func Test_QuantileRegression(t *testing.T) {
+	rand.Seed(0)
+
+	data := Examples{}
+	for i := 0; i < 500; i++ {
+		x := rand.Float64()
+		data = append(data, Example{Input: []float64{x}, Response: []float64{x + rand.Float64()}})
+	}
+
+	fit := func(tau float64) *deep.Neural {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     1,
+			Layout:     []int{2, 1},
+			Activation: deep.ActivationLinear,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewUniform(0.5, 0),
+			Bias:       true,
+		})
+		trainer := NewTrainer(NewAdam(0.001, 0, 0, 0), 0, WithLoss(deep.NewQuantile(tau)))
+		trainer.Train(n, data, nil, 200)
+		return n
+	}
+	low, high := fit(0.1), fit(0.9)
+
+	var below, above int
+	for _, e := range data {
+		lo, hi := low.Predict(e.Input)[0], high.Predict(e.Input)[0]
+		assert.True(t, hi > lo)
+		if e.Response[0] < lo {
+			below++
+		}
+		if e.Response[0] > hi {
+			above++
+		}
+	}
+	// roughly a tenth of the targets fall outside each bound
+	assert.InDelta(t, 50, below, 20)
+	assert.InDelta(t, 50, above, 20)
+}
+
+// underForecast is MSE with under-forecasts penalized by a factor of 4
+type underForecast struct{ deep.MeanSquared }
+
+func (l underForecast) Df(estimate, ideal, activation float64) float64 {
+	if estimate < ideal {
+		return 4 * l.MeanSquared.Df(estimate, ideal, activation)
+	}
+	return l.MeanSquared.Df(estimate, ideal, activation)
+}
+
+func Test_RegisteredLoss(t *testing.T) {
+	loss := deep.RegisterLoss("training-under-forecast", func() deep.Loss { return underForecast{} })
+
+	// targets 0 and 1 for the same input, MSE settles on the mean
+	data := Examples{
+		{Input: []float64{1}, Response: []float64{0}},
+		{Input: []float64{1}, Response: []float64{1}},
+	}
+	fit := func(loss deep.LossType) float64 {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     1,
+			Layout:     []int{1, 1},
+			Activation: deep.ActivationLinear,
+			Mode:       deep.ModeRegression,
+			Loss:       loss,
+			Weight:     deep.NewUniform(0.5, 0),
+			Bias:       true,
+		})
+		NewTrainer(NewSGD(0.01, 0, 0, false), 0).Train(n, data, nil, 2000)
+		return n.Predict([]float64{1})[0]
+	}
+
+	assert.InDelta(t, 0.5, fit(deep.LossMeanSquared), 0.05)
+	assert.InDelta(t, 0.8, fit(loss), 0.05)
+}
+
+func Test_ExampleWeights(t *testing.T) {
+	base := Examples{
+		{Input: []float64{0, 1}, Response: []float64{1}},
+		{Input: []float64{1, 0}, Response: []float64{0}},
+		{Input: []float64{1, 1}, Response: []float64{1}},
+	}
+	duplicated := append(Examples{base[0]}, base...)
+	weighted := Examples{
+		{Input: base[0].Input, Response: base[0].Response, Weight: 2},
+		{Input: base[1].Input, Response: base[1].Response, Weight: 1},
+		{Input: base[2].Input, Response: base[2].Response, Weight: 1},
+		// skipped
+		{Input: []float64{5, 5}, Response: []float64{0}, Weight: 0},
+	}
+
+	fit := func(data Examples, trainer Trainer) *deep.Neural {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{3, 1},
+			Activation: deep.ActivationSigmoid,
+			Mode:       deep.ModeBinary,
+			Weight:     deep.NewUniform(0.5, 0),
+			Bias:       true,
+		})
+		trainer.Train(n, data, nil, 50)
+		return n
+	}
+
+	a := fit(duplicated, NewBatchTrainer(NewSGD(0.5, 0, 0, false), 0, len(duplicated), 1))
+	b := fit(weighted, NewBatchTrainer(NewSGD(0.5, 0, 0, false), 0, len(weighted), 1))
+	for i, l := range a.Weights() {
+		for j, ws := range l {
+			for k, w := range ws {
+				assert.InDelta(t, w, b.Weights()[i][j][k], 1e-12)
+			}
+		}
+	}
+
+	assert.InDelta(t, crossValidate(a, duplicated), crossValidate(b, weighted), 1e-12)
+	assert.NotEqual(t, crossValidate(b, weighted), crossValidate(b, append(base, weighted[3])))
+
+	// a zero weight example does not take part in online training
+	c := fit(Examples{base[0]}, NewTrainer(NewSGD(0.5, 0, 0, false), 0))
+	d := fit(Examples{
+		{Input: base[0].Input, Response: base[0].Response, Weight: 1},
+		weighted[3],
+	}, NewTrainer(NewSGD(0.5, 0, 0, false), 0))
+	assert.Equal(t, c.Weights(), d.Weights())
+}
+
+func Test_HingeMargins(t *testing.T) {
+	rand.Seed(0)
+	var data Examples
+	for i := 0; i < 50; i++ {
+		data = append(data,
+			Example{Input: []float64{rand.Float64() + 1, rand.Float64()}, Response: []float64{1}},
+			Example{Input: []float64{-rand.Float64() - 1, rand.Float64()}, Response: []float64{-1}})
+	}
+
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     2,
+		Layout:     []int{1},
+		Activation: deep.ActivationLinear,
+		Loss:       deep.LossHinge,
+		Weight:     deep.NewUniform(0.5, 0),
+		Bias:       true,
+	})
+	trainer := NewTrainer(NewSGD(0.01, 0, 0, false), 0)
+	trainer.Train(n, data, nil, 200)
+
+	for _, e := range data {
+		assert.True(t, e.Response[0]*n.Predict(e.Input)[0] >= 1)
+	}
+	assert.Equal(t, 0.0, crossValidate(n, data))
+}
+
+func Test_PoissonRegression(t *testing.T) {
+	rand.Seed(0)
+
+	rate := func(x float64) float64 { return math.Exp(1 + x) }
+	// Knuth's algorithm for sampling a Poisson distributed count
+	poisson := func(lambda float64) float64 {
+		l, k, p := math.Exp(-lambda), 0.0, 1.0
+		for p > l {
+			k++
+			p *= rand.Float64()
+		}
+		return k - 1
+	}
+	var data Examples
+	for i := 0; i < 1000; i++ {
+		x := rand.Float64()
+		data = append(data, Example{Input: []float64{x}, Response: []float64{poisson(rate(x))}})
+	}
+
+	// a single exponential unit is Poisson regression with a log link
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     1,
+		Layout:     []int{1},
+		Activation: deep.ActivationExp,
+		Loss:       deep.LossPoisson,
+		Weight:     deep.NewUniform(0.5, 0),
+		Bias:       true,
+	})
+	trainer := NewTrainer(NewAdam(0.01, 0, 0, 0), 0)
+	trainer.Train(n, data, nil, 50)
+
+	for _, x := range []float64{0, 0.25, 0.5, 0.75, 1} {
+		est := n.Predict([]float64{x})[0]
+		assert.True(t, est > 0)
+		assert.InEpsilon(t, rate(x), est, 0.1)
+	}
+}
+
+func Test_MultiHead(t *testing.T) {
+	rand.Seed(0)
+
+	// one head classifies the quadrant of a point, the other regresses the
+	// sum of its coordinates
+	var data Examples
+	for i := 0; i < 400; i++ {
+		x, y := rand.Float64()*2-1, rand.Float64()*2-1
+		response := make([]float64, 5)
+		if x > 0 {
+			response[1] = 1
+		}
+		if y > 0 {
+			response[2] = 1
+		}
+		response[0] = response[1] + 2*response[2]
+		class := int(response[0])
+		for j := range response[:4] {
+			response[j] = 0
+		}
+		response[class] = 1
+		response[4] = x + y
+		data = append(data, Example{Input: []float64{x, y}, Response: response})
+	}
+
+	n := deep.NewNeural(&deep.Config{
+		Inputs: 2,
+		Layout: []int{16, 5},
+		Heads: []deep.Head{
+			{From: 0, To: 4, Mode: deep.ModeMultiClass},
+			{From: 4, To: 5, Mode: deep.ModeRegression, Weight: 2},
+		},
+		Activation: deep.ActivationTanh,
+		Weight:     deep.NewNormal(0.5, 0),
+		Bias:       true,
+	})
+	trainer := NewTrainer(NewAdam(0.01, 0, 0, 0), 0)
+	trainer.Train(n, data, nil, 100)
+
+	var correct int
+	var mse float64
+	for _, e := range data {
+		out := n.Predict(e.Input)
+		if deep.ArgMax(out[:4]) == deep.ArgMax(e.Response[:4]) {
+			correct++
+		}
+		mse += math.Pow(out[4]-e.Response[4], 2) / float64(len(data))
+	}
+	assert.True(t, float64(correct)/float64(len(data)) > 0.95)
+	assert.True(t, mse < 0.01)
+}
+
+func Test_PPOPolicy(t *testing.T) {
+	rand.Seed(0)
+
+	// a pole leaning by angle is balanced by pushing the cart the same way,
+	// action 0 pushes left and action 1 pushes right
+	reward := func(angle float64, action int) float64 {
+		if (angle < 0) == (action == 0) {
+			return 1
+		}
+		return 0
+	}
+	sample := func(probs []float64) int {
+		if rand.Float64() < probs[0] {
+			return 0
+		}
+		return 1
+	}
+
+	actor := deep.NewNeural(&deep.Config{
+		Inputs:     1,
+		Layout:     []int{4, 2},
+		Activation: deep.ActivationTanh,
+		Mode:       deep.ModeMultiClass,
+		Weight:     deep.NewUniform(0.5, 0),
+		Bias:       true,
+	})
+	trainer := NewTrainer(NewSGD(0.1, 0, 0, false), 0, WithLoss(deep.PPOClip{Epsilon: 0.2}))
+
+	for iteration := 0; iteration < 30; iteration++ {
+		var rollout Examples
+		var baseline float64
+		actions, rewards := make([]int, 100), make([]float64, 100)
+		for i := range actions {
+			angle := rand.Float64()*2 - 1
+			probs := actor.Predict([]float64{angle})
+			actions[i] = sample(probs)
+			rewards[i] = reward(angle, actions[i])
+			baseline += rewards[i] / 100
+			rollout = append(rollout, Example{Input: []float64{angle}, Response: probs})
+		}
+		for i := range rollout {
+			rollout[i].Response = deep.PPOTarget(actions[i], rewards[i]-baseline, rollout[i].Response)
+		}
+		// several epochs on the same rollout is what the clipping is for
+		trainer.Train(actor, rollout, nil, 4)
+	}
+
+	for _, angle := range []float64{-0.8, -0.4, 0.4, 0.8} {
+		probs := actor.Predict([]float64{angle})
+		best := 1
+		if angle < 0 {
+			best = 0
+		}
+		assert.True(t, probs[best] > 0.9)
+	}
+}
+
+func Test_ActorCritic(t *testing.T) {
+	rand.Seed(0)
+
+	// a bandit of two states, where action 0 pays in state 0 and action 1
+	// in state 1
+	states := [][]float64{{1, 0}, {0, 1}}
+	ac := deep.NewActorCritic(&deep.Config{
+		Inputs:     2,
+		Layout:     []int{8},
+		Activation: deep.ActivationTanh,
+		Weight:     deep.NewUniform(0.5, 0),
+		Bias:       true,
+	}, 2, 1)
+	// the policy gradient of rare actions is clipped
+	trainer := NewTrainer(NewSGD(0.05, 0, 0, false), 0, WithClipNorm(1))
+
+	for i := 0; i < 300; i++ {
+		var batch Examples
+		for j := 0; j < 10; j++ {
+			state := rand.Intn(2)
+			policy, values := ac.Predict(states[state])
+			action := 1
+			if rand.Float64() < policy[0] {
+				action = 0
+			}
+			var reward float64
+			if action == state {
+				reward = 1
+			}
+			batch = append(batch, Example{Input: states[state], Response: ac.Target(action, reward-values[0])})
+		}
+		trainer.Train(ac.Neural, batch, nil, 1)
+	}
+
+	for state, input := range states {
+		policy, values := ac.Predict(input)
+		assert.True(t, policy[state] > 0.9, "%v", policy)
+		// the critic values the expected reward of the policy
+		assert.InDelta(t, policy[state], values[0], 0.1)
+	}
+}
+
+func Test_ActorEntropyBonus(t *testing.T) {
+	// a bandit where action 0 pays slightly more than action 1
+	train := func(loss deep.ActorPolicyGradient) float64 {
+		rand.Seed(0)
+		actor := deep.NewNeural(&deep.Config{
+			Inputs:     1,
+			Layout:     []int{2},
+			Activation: deep.ActivationLinear,
+			Mode:       deep.ModeMultiClass,
+			Weight:     deep.NewUniform(0.5, 0),
+			Bias:       true,
+		})
+		trainer := NewTrainer(NewSGD(0.05, 0, 0, false), 0, WithLoss(loss))
+		for i := 0; i < 200; i++ {
+			var batch Examples
+			for j := 0; j < 10; j++ {
+				probs := actor.Predict([]float64{1})
+				action, reward := 0, 1.0
+				if rand.Float64() > probs[0] {
+					action, reward = 1, 0.8
+				}
+				ideal := make([]float64, 2)
+				ideal[action] = reward - 0.9
+				batch = append(batch, Example{Input: []float64{1}, Response: ideal})
+			}
+			trainer.Train(actor, batch, nil, 1)
+		}
+		probs := actor.Predict([]float64{1})
+		return -probs[0]*math.Log(probs[0]) - probs[1]*math.Log(probs[1])
+	}
+
+	collapsed := train(deep.ActorPolicyGradient{})
+	regularized := train(deep.ActorPolicyGradient{EntropyCoeff: 0.5})
+	assert.True(t, collapsed < 0.1)
+	assert.True(t, regularized > 0.3)
+}
+
 func Test_Training(t *testing.T) {
 	rand.Seed(0)
 
 	data := Examples{
-		Example{[]float64{0}, []float64{0}},
-		Example{[]float64{0}, []float64{0}},
-		Example{[]float64{0}, []float64{0}},
-		Example{[]float64{5}, []float64{1}},
-		Example{[]float64{5}, []float64{1}},
+		Example{Input: []float64{0}, Response: []float64{0}},
+		Example{Input: []float64{0}, Response: []float64{0}},
+		Example{Input: []float64{0}, Response: []float64{0}},
+		Example{Input: []float64{5}, Response: []float64{1}},
+		Example{Input: []float64{5}, Response: []float64{1}},
 	}
 
 	n := deep.NewNeural(&deep.Config{
@@ -98,16 +578,16 @@ func Test_Training(t *testing.T) {
 }
 
 var data = []Example{
-	{[]float64{2.7810836, 2.550537003}, []float64{0}},
-	{[]float64{1.465489372, 2.362125076}, []float64{0}},
-	{[]float64{3.396561688, 4.400293529}, []float64{0}},
-	{[]float64{1.38807019, 1.850220317}, []float64{0}},
-	{[]float64{3.06407232, 3.005305973}, []float64{0}},
-	{[]float64{7.627531214, 2.759262235}, []float64{1}},
-	{[]float64{5.332441248, 2.088626775}, []float64{1}},
-	{[]float64{6.922596716, 1.77106367}, []float64{1}},
-	{[]float64{8.675418651, -0.242068655}, []float64{1}},
-	{[]float64{7.673756466, 3.508563011}, []float64{1}},
+	{Input: []float64{2.7810836, 2.550537003}, Response: []float64{0}},
+	{Input: []float64{1.465489372, 2.362125076}, Response: []float64{0}},
+	{Input: []float64{3.396561688, 4.400293529}, Response: []float64{0}},
+	{Input: []float64{1.38807019, 1.850220317}, Response: []float64{0}},
+	{Input: []float64{3.06407232, 3.005305973}, Response: []float64{0}},
+	{Input: []float64{7.627531214, 2.759262235}, Response: []float64{1}},
+	{Input: []float64{5.332441248, 2.088626775}, Response: []float64{1}},
+	{Input: []float64{6.922596716, 1.77106367}, Response: []float64{1}},
+	{Input: []float64{8.675418651, -0.242068655}, Response: []float64{1}},
+	{Input: []float64{7.673756466, 3.508563011}, Response: []float64{1}},
 }
 
 func Test_Prediction(t *testing.T) {
@@ -150,16 +630,16 @@ func Test_CrossVal(t *testing.T) {
 
 func Test_MultiClass(t *testing.T) {
 	var data = []Example{
-		{[]float64{2.7810836, 2.550537003}, []float64{1, 0}},
-		{[]float64{1.465489372, 2.362125076}, []float64{1, 0}},
-		{[]float64{3.396561688, 4.400293529}, []float64{1, 0}},
-		{[]float64{1.38807019, 1.850220317}, []float64{1, 0}},
-		{[]float64{3.06407232, 3.005305973}, []float64{1, 0}},
-		{[]float64{7.627531214, 2.759262235}, []float64{0, 1}},
-		{[]float64{5.332441248, 2.088626775}, []float64{0, 1}},
-		{[]float64{6.922596716, 1.77106367}, []float64{0, 1}},
-		{[]float64{8.675418651, -0.242068655}, []float64{0, 1}},
-		{[]float64{7.673756466, 3.508563011}, []float64{0, 1}},
+		{Input: []float64{2.7810836, 2.550537003}, Response: []float64{1, 0}},
+		{Input: []float64{1.465489372, 2.362125076}, Response: []float64{1, 0}},
+		{Input: []float64{3.396561688, 4.400293529}, Response: []float64{1, 0}},
+		{Input: []float64{1.38807019, 1.850220317}, Response: []float64{1, 0}},
+		{Input: []float64{3.06407232, 3.005305973}, Response: []float64{1, 0}},
+		{Input: []float64{7.627531214, 2.759262235}, Response: []float64{0, 1}},
+		{Input: []float64{5.332441248, 2.088626775}, Response: []float64{0, 1}},
+		{Input: []float64{6.922596716, 1.77106367}, Response: []float64{0, 1}},
+		{Input: []float64{8.675418651, -0.242068655}, Response: []float64{0, 1}},
+		{Input: []float64{7.673756466, 3.508563011}, Response: []float64{0, 1}},
 	}
 
 	n := deep.NewNeural(&deep.Config{
@@ -199,10 +679,10 @@ func Test_or(t *testing.T) {
 		Bias:       true,
 	})
 	permutations := Examples{
-		{[]float64{0, 0}, []float64{0}},
-		{[]float64{1, 0}, []float64{1}},
-		{[]float64{0, 1}, []float64{1}},
-		{[]float64{1, 1}, []float64{1}},
+		{Input: []float64{0, 0}, Response: []float64{0}},
+		{Input: []float64{1, 0}, Response: []float64{1}},
+		{Input: []float64{0, 1}, Response: []float64{1}},
+		{Input: []float64{1, 1}, Response: []float64{1}},
 	}
 
 	trainer := NewTrainer(NewSGD(0.5, 0, 0, false), 10)
@@ -225,10 +705,10 @@ func Test_xor(t *testing.T) {
 		Bias:       true,
 	})
 	permutations := Examples{
-		{[]float64{0, 0}, []float64{0}},
-		{[]float64{1, 0}, []float64{1}},
-		{[]float64{0, 1}, []float64{1}},
-		{[]float64{1, 1}, []float64{0}},
+		{Input: []float64{0, 0}, Response: []float64{0}},
+		{Input: []float64{1, 0}, Response: []float64{1}},
+		{Input: []float64{0, 1}, Response: []float64{1}},
+		{Input: []float64{1, 1}, Response: []float64{0}},
 	}
 
 	trainer := NewTrainer(NewSGD(1.0, 0.1, 1e-6, false), 50)
@@ -239,6 +719,897 @@ func Test_xor(t *testing.T) {
 	}
 }
 
+func Test_xorELU(t *testing.T) {
+	rand.Seed(0)
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     2,
+		Layout:     []int{4, 1},
+		Activation: deep.ActivationELU,
+		Mode:       deep.ModeBinary,
+		Weight:     deep.NewNormal(1, 0),
+		Bias:       true,
+	})
+	permutations := Examples{
+		{Input: []float64{0, 0}, Response: []float64{0}},
+		{Input: []float64{1, 0}, Response: []float64{1}},
+		{Input: []float64{0, 1}, Response: []float64{1}},
+		{Input: []float64{1, 1}, Response: []float64{0}},
+	}
+
+	trainer := NewTrainer(NewAdam(0.05, 0, 0, 0), 0)
+	trainer.Train(n, permutations, permutations, 500)
+
+	for _, perm := range permutations {
+		assert.Equal(t, perm.Response[0], deep.Round(n.Predict(perm.Input)[0]))
+	}
+}
+
+func Test_SwishRegression(t *testing.T) {
+	rand.Seed(0)
+
+	var data Examples
+	for i := 0; i < 200; i++ {
+		x := rand.Float64()*4 - 2
+		data = append(data, Example{Input: []float64{x}, Response: []float64{math.Sin(2 * x)}})
+	}
+
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     1,
+		Layout:     []int{16, 1},
+		Activation: deep.ActivationSwish,
+		Mode:       deep.ModeRegression,
+		Weight:     deep.NewNormal(1, 0),
+		Bias:       true,
+	})
+	trainer := NewTrainer(NewAdam(0.01, 0, 0, 0), 0)
+	trainer.Train(n, data, nil, 300)
+
+	assert.True(t, crossValidate(n, data) < 0.01)
+}
+
+func Test_PositiveRegression(t *testing.T) {
+	rand.Seed(0)
+
+	// the spread of a noisy target, which grows with x
+	var data Examples
+	for i := 0; i < 200; i++ {
+		x := rand.Float64()*2 - 1
+		data = append(data, Example{Input: []float64{x}, Response: []float64{0.1 + x*x}})
+	}
+
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     1,
+		Layout:     []int{8, 1},
+		Activation: deep.ActivationTanh,
+		Mode:       deep.ModePositiveRegression,
+		Weight:     deep.NewNormal(1, 0),
+		Bias:       true,
+	})
+	assert.Equal(t, deep.LossMeanSquared, n.Config.Loss)
+	trainer := NewTrainer(NewAdam(0.01, 0, 0, 0), 0)
+	trainer.Train(n, data, nil, 200)
+
+	for _, x := range []float64{-3, -0.5, 0, 0.5, 3} {
+		assert.True(t, n.Predict([]float64{x})[0] > 0)
+	}
+	assert.True(t, crossValidate(n, data) < 0.005)
+}
+
+func Test_PReLUGradient(t *testing.T) {
+	rand.Seed(0)
+
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     2,
+		Layout:     []int{4, 3},
+		Activation: deep.ActivationPReLU,
+		Loss:       deep.LossMeanSquared,
+		Weight:     deep.NewNormal(1, 0),
+		Bias:       true,
+	})
+	input, ideal := []float64{0.7, -1.2}, []float64{0.5, -0.3, 1}
+	loss := func() float64 {
+		var sum float64
+		for i, v := range n.Predict(input) {
+			sum += 0.5 * math.Pow(v-ideal[i], 2)
+		}
+		return sum
+	}
+
+	trainer := NewTrainer(NewSGD(0.1, 0, 0, false), 0)
+	trainer.internal = newTraining(n.Layers, n.Loss())
+	n.Forward(input)
+	trainer.calculateDeltas(n, ideal, 1)
+
+	const h = 1e-6
+	for i, l := range n.Layers {
+		alpha := l.Alpha
+		l.Alpha = alpha + h
+		plus := loss()
+		l.Alpha = alpha - h
+		minus := loss()
+		l.Alpha = alpha
+		assert.InDelta(t, (plus-minus)/(2*h), trainer.alphas[i], 1e-6)
+	}
+}
+
+func Test_PReLUTraining(t *testing.T) {
+	// negative inputs carry as much signal as positive ones
+	var data Examples
+	for i := 0; i < 100; i++ {
+		x := float64(i)/50 - 1
+		data = append(data, Example{Input: []float64{x}, Response: []float64{math.Abs(x)}})
+	}
+
+	for _, trainer := range []Trainer{
+		NewTrainer(NewAdam(0.01, 0, 0, 0), 0),
+		NewBatchTrainer(NewAdam(0.01, 0, 0, 0), 0, 10, 2),
+	} {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     1,
+			Layout:     []int{4, 1},
+			Activation: deep.ActivationPReLU,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(1, 0),
+			Bias:       true,
+		})
+		trainer.Train(n, data, nil, 200)
+
+		assert.True(t, math.Abs(n.Layers[0].Alpha-0.25) > 0.5)
+		assert.True(t, crossValidate(n, data) < 0.01)
+	}
+}
+
+func Test_RegisteredActivation(t *testing.T) {
+	sin := deep.RegisterActivation("sin", math.Sin, math.Cos)
+
+	var data Examples
+	for i := 0; i < 100; i++ {
+		x := float64(i)/10 - 5
+		data = append(data, Example{Input: []float64{x}, Response: []float64{math.Sin(x)}})
+	}
+
+	fit := func(act deep.ActivationType) float64 {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     1,
+			Layout:     []int{4, 1},
+			Activation: act,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(1, 0),
+			Bias:       true,
+		})
+		NewTrainer(NewAdam(0.01, 0, 0, 0), 0).Train(n, data, nil, 50)
+		return crossValidate(n, data)
+	}
+	assert.True(t, fit(sin) < fit(deep.ActivationTanh))
+}
+
 func printResult(ideal, actual []float64) {
 	fmt.Printf("want: %+v have: %+v\n", ideal, actual)
 }
+
+// gradientSolver records the gradients passed to it without updating
+type gradientSolver struct {
+	gradients []float64
+}
+
+func (o *gradientSolver) Init(size int) { o.gradients = nil }
+func (o *gradientSolver) Update(value, gradient float64, iteration, idx int) float64 {
+	o.gradients = append(o.gradients, gradient)
+	return 0
+}
+
+func Test_GradientClipping(t *testing.T) {
+	// an ideal far off the estimate gives a huge gradient
+	data := Examples{
+		{Input: []float64{1, -2}, Response: []float64{1e6}},
+		{Input: []float64{-1, 3}, Response: []float64{-1e6}},
+	}
+	trainers := func(opts ...Option) []Trainer {
+		return []Trainer{
+			NewTrainer(&gradientSolver{}, 0, opts...),
+			NewBatchTrainer(&gradientSolver{}, 0, 2, 2, opts...),
+		}
+	}
+	gradients := func(trainer Trainer, examples Examples) []float64 {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{3, 1},
+			Activation: deep.ActivationPReLU,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(1, 0),
+			Bias:       true,
+		})
+		trainer.Train(n, append(Examples{}, examples...), nil, 1)
+		switch trainer := trainer.(type) {
+		case *OnlineTrainer:
+			return trainer.solver.(*gradientSolver).gradients
+		case *BatchTrainer:
+			return trainer.solver.(*gradientSolver).gradients
+		}
+		return nil
+	}
+
+	for i, trainer := range trainers(WithClipNorm(5)) {
+		unclipped := gradients(trainers()[i], data[:1])
+		clipped := gradients(trainer, data[:1])
+		assert.True(t, deep.Dot(unclipped, unclipped) > 25)
+		assert.InDelta(t, 5, math.Sqrt(deep.Dot(clipped, clipped)), 1e-9)
+		// the direction is unchanged
+		for j := range clipped {
+			assert.InDelta(t, unclipped[j]*clipped[0]/unclipped[0], clipped[j], 1e-9)
+		}
+	}
+
+	for _, trainer := range trainers(WithClipValue(0.5)) {
+		for _, g := range gradients(trainer, data) {
+			assert.True(t, math.Abs(g) <= 0.5)
+		}
+	}
+
+	// zero-configured clipping is a no-op, as are thresholds not exceeded
+	for i, trainer := range trainers(WithClipNorm(0), WithClipValue(0)) {
+		assert.Equal(t, gradients(trainers()[i], data), gradients(trainer, data))
+	}
+	for i, trainer := range trainers(WithClipNorm(1e12), WithClipValue(1e12)) {
+		assert.Equal(t, gradients(trainers()[i], data), gradients(trainer, data))
+	}
+}
+
+func Test_L1Regularization(t *testing.T) {
+	// the response depends on the first two inputs, the others are noise
+	// that only fits the noise of the response
+	rand.Seed(0)
+	var data Examples
+	for i := 0; i < 50; i++ {
+		x := []float64{rand.NormFloat64(), rand.NormFloat64(), rand.NormFloat64(), rand.NormFloat64()}
+		data = append(data, Example{Input: x, Response: []float64{x[0] - x[1] + 0.3*rand.NormFloat64()}})
+	}
+	noise := func(l1, l2 float64) float64 {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs: 4,
+			Layout: []int{1},
+			Mode:   deep.ModeRegression,
+			Weight: deep.NewNormal(0.5, 0),
+			L1:     l1,
+			L2:     l2,
+		})
+		NewTrainer(NewSGD(0.01, 0, 0, false), 0).Train(n, append(Examples{}, data...), nil, 300)
+		w := n.Weights()[0][0]
+		assert.InDelta(t, 1, w[0], 0.3)
+		assert.InDelta(t, -1, w[1], 0.3)
+		return math.Max(math.Abs(w[2]), math.Abs(w[3]))
+	}
+
+	l1, l2, elastic := noise(0.1, 0), noise(0, 0.1), noise(0.1, 0.1)
+	assert.True(t, l1 < 0.005)
+	assert.True(t, elastic < 0.005)
+	assert.True(t, l2 > 0.02)
+}
+
+func Test_MaxNorm(t *testing.T) {
+	// correlated inputs of a far off target drive the weights far out
+	rand.Seed(0)
+	var data Examples
+	for i := 0; i < 50; i++ {
+		x := rand.NormFloat64()
+		data = append(data, Example{Input: []float64{x, x, x + 0.01*rand.NormFloat64()}, Response: []float64{100 * x, -100 * x}})
+	}
+	// norms returns the largest norm of the incoming weights of a neuron,
+	// biases excluded, after each epoch
+	norms := func(trainer Trainer) []float64 {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     3,
+			Layout:     []int{4, 2},
+			Activation: deep.ActivationLinear,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(0.5, 0),
+			Bias:       true,
+		})
+		var max []float64
+		for i := 0; i < 20; i++ {
+			trainer.Train(n, data, nil, 1)
+			var epoch float64
+			for _, l := range n.Layers {
+				for _, neuron := range l.Neurons {
+					var squared float64
+					for _, s := range neuron.In {
+						if !s.IsBias {
+							squared += s.Weight * s.Weight
+						}
+					}
+					epoch = math.Max(epoch, math.Sqrt(squared))
+				}
+			}
+			max = append(max, epoch)
+		}
+		return max
+	}
+
+	for _, trainer := range []func(...Option) Trainer{
+		func(opts ...Option) Trainer { return NewTrainer(NewSGD(0.0001, 0.9, 0, false), 0, opts...) },
+		func(opts ...Option) Trainer { return NewBatchTrainer(NewSGD(0.001, 0.9, 0, false), 0, 10, 2, opts...) },
+	} {
+		unconstrained := norms(trainer())
+		assert.True(t, unconstrained[len(unconstrained)-1] > 5, "%v", unconstrained)
+		for _, norm := range norms(trainer(WithMaxNorm(2))) {
+			assert.True(t, norm <= 2+1e-12, "%f", norm)
+		}
+	}
+}
+
+func Test_LayerLR(t *testing.T) {
+	data := Examples{
+		{Input: []float64{0, 0}, Response: []float64{0}},
+		{Input: []float64{0, 1}, Response: []float64{1}},
+		{Input: []float64{1, 0}, Response: []float64{1}},
+		{Input: []float64{1, 1}, Response: []float64{0}},
+	}
+	network := func() *deep.Neural {
+		rand.Seed(0)
+		return deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{3, 3, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeBinary,
+			Weight:     deep.NewNormal(1, 0),
+			Bias:       true,
+		})
+	}
+	trainers := func(opts ...Option) []Trainer {
+		return []Trainer{
+			NewTrainer(NewAdam(0.01, 0, 0, 0), 0, opts...),
+			NewBatchTrainer(NewAdam(0.01, 0, 0, 0), 0, 2, 2, opts...),
+		}
+	}
+
+	for _, trainer := range trainers(WithLayerLR(map[int]float64{0: 0})) {
+		n := network()
+		before := n.Weights()
+		trainer.Train(n, append(Examples{}, data...), nil, 10)
+		after := n.Weights()
+		assert.Equal(t, before[0], after[0])
+		assert.NotEqual(t, before[1], after[1])
+		assert.NotEqual(t, before[2], after[2])
+	}
+
+	// a multiplier scales the steps of the solver
+	for i, trainer := range trainers(WithLayerLR(map[int]float64{2: 0.5})) {
+		n, reference := network(), network()
+		before := n.Weights()
+		trainer.Train(n, append(Examples{}, data[:1]...), nil, 1)
+		trainers()[i].Train(reference, append(Examples{}, data[:1]...), nil, 1)
+		assert.Equal(t, reference.Weights()[:2], n.Weights()[:2])
+		for j, w := range n.Weights()[2][0] {
+			assert.InDelta(t, (reference.Weights()[2][0][j]-before[2][0][j])/2, w-before[2][0][j], 1e-12)
+		}
+	}
+}
+
+func Test_AccumulationSteps(t *testing.T) {
+	rand.Seed(0)
+	var data Examples
+	for i := 0; i < 256; i++ {
+		x := []float64{rand.NormFloat64(), rand.NormFloat64()}
+		data = append(data, Example{Input: x, Response: []float64{math.Sin(x[0]) * x[1]}})
+	}
+	network := func() *deep.Neural {
+		rand.Seed(1)
+		return deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{4, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(1, 0),
+			Bias:       true,
+		})
+	}
+	equal := func(expected, actual *deep.Neural) {
+		for i, l := range expected.Weights() {
+			for j, w := range l {
+				assert.InDeltaSlice(t, w, actual.Weights()[i][j], 1e-12)
+			}
+		}
+	}
+
+	full, accumulated := network(), network()
+	NewBatchTrainer(NewAdam(0.01, 0, 0, 0), 0, 256, 1).Train(full, data, nil, 3)
+	NewBatchTrainer(NewAdam(0.01, 0, 0, 0), 0, 32, 1, WithAccumulationSteps(8)).Train(accumulated, data, nil, 3)
+	assert.NotEqual(t, network().Weights(), full.Weights())
+	equal(full, accumulated)
+
+	// the online trainer averages the gradients of single examples
+	online := network()
+	NewTrainer(NewAdam(0.01, 0, 0, 0), 0, WithAccumulationSteps(256)).Train(online, data, nil, 3)
+	equal(full, online)
+
+	// weighted examples alike, the batch trainer averaging over the weights
+	// and the online trainer over the examples of an update, here as many
+	for i := range data {
+		data[i].Weight = 0.5 + float64(i%2)
+	}
+	full, online = network(), network()
+	NewBatchTrainer(NewAdam(0.01, 0, 0, 0), 0, 64, 1, WithShuffle(false)).Train(full, data, nil, 3)
+	NewTrainer(NewAdam(0.01, 0, 0, 0), 0, WithAccumulationSteps(64), WithShuffle(false)).Train(online, data, nil, 3)
+	equal(full, online)
+
+	// leftover steps are applied at the end of each epoch, and schedules
+	// count updates
+	s := &recordingScheduler{}
+	n := network()
+	NewBatchTrainer(NewSGD(0.01, 0, 0, false), 0, 32, 1, WithAccumulationSteps(3), WithScheduler(s)).Train(n, data, nil, 2)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, s.iterations)
+	assert.Equal(t, []int{0, 0, 0, 1, 1, 1}, s.epochs)
+
+	s = &recordingScheduler{}
+	NewTrainer(NewSGD(0.01, 0, 0, false), 0, WithAccumulationSteps(100), WithScheduler(s)).Train(n, data, nil, 1)
+	assert.Equal(t, []int{0, 1, 2}, s.iterations)
+}
+
+func Test_DropoutGradient(t *testing.T) {
+	rand.Seed(0)
+
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     2,
+		Layout:     []int{6, 4, 3},
+		Activation: deep.ActivationPReLU,
+		Loss:       deep.LossMeanSquared,
+		Weight:     deep.NewNormal(1, 0),
+		Bias:       true,
+		Dropout:    []float64{0.5, 0.3, 0},
+	})
+	n.SetTraining(true)
+	input, ideal := []float64{0.7, -1.2}, []float64{0.5, -0.3, 1}
+	// the same seed draws the same dropout mask
+	forward := func() {
+		rand.Seed(1)
+		n.Forward(input)
+	}
+	loss := func() float64 {
+		forward()
+		var sum float64
+		for i, neuron := range n.Layers[len(n.Layers)-1].Neurons {
+			sum += 0.5 * math.Pow(neuron.Value-ideal[i], 2)
+		}
+		return sum
+	}
+
+	trainer := NewTrainer(NewSGD(0.1, 0, 0, false), 0)
+	trainer.internal = newTraining(n.Layers, n.Loss())
+	forward()
+	trainer.calculateDeltas(n, ideal, 1)
+	var dropped int
+	for _, neuron := range append(n.Layers[0].Neurons, n.Layers[1].Neurons...) {
+		if neuron.Mask() == 0 {
+			dropped++
+		}
+	}
+	assert.True(t, dropped > 0)
+
+	const h = 1e-6
+	for i, l := range n.Layers {
+		for j, neuron := range l.Neurons {
+			for _, s := range neuron.In {
+				analytic := trainer.deltas[i][j] * s.In
+				w := s.Weight
+				s.Weight = w + h
+				plus := loss()
+				s.Weight = w - h
+				minus := loss()
+				s.Weight = w
+				assert.InDelta(t, (plus-minus)/(2*h), analytic, 1e-6)
+			}
+		}
+		alpha := l.Alpha
+		l.Alpha = alpha + h
+		plus := loss()
+		l.Alpha = alpha - h
+		minus := loss()
+		l.Alpha = alpha
+		assert.InDelta(t, (plus-minus)/(2*h), trainer.alphas[i], 1e-6)
+	}
+}
+
+func Test_DropoutRegularization(t *testing.T) {
+	rand.Seed(0)
+	sample := func(noise float64) Example {
+		x := []float64{rand.Float64()*2 - 1, rand.Float64()*2 - 1}
+		return Example{Input: x, Response: []float64{x[0]*x[1] + noise*rand.NormFloat64()}}
+	}
+	var data, validation Examples
+	for i := 0; i < 30; i++ {
+		data = append(data, sample(0.3))
+	}
+	for i := 0; i < 200; i++ {
+		validation = append(validation, sample(0))
+	}
+
+	loss := func(p float64) float64 {
+		rand.Seed(1)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{64, 64, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(0.5, 0),
+			Bias:       true,
+			Dropout:    []float64{p, p, 0},
+		})
+		NewBatchTrainer(NewAdam(0.005, 0, 0, 0), 0, 10, 1).Train(n, data, nil, 500)
+		assert.False(t, n.Training())
+		return validationLoss(n, nil, validation)
+	}
+	assert.True(t, loss(0.3) < loss(0))
+}
+
+func Test_LayerNormGradient(t *testing.T) {
+	rand.Seed(0)
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     3,
+		Layout:     []int{5, 4, 2},
+		Activation: deep.ActivationPReLU,
+		Loss:       deep.LossMeanSquared,
+		Weight:     deep.NewNormal(1, 0),
+		Bias:       true,
+		LayerNorm:  []bool{true, true, false},
+	})
+	for _, l := range n.Layers[:2] {
+		for j := range l.Neurons {
+			l.Norm.Gamma[j] = 1 + rand.NormFloat64()/2
+			l.Norm.Beta[j] = rand.NormFloat64() / 2
+		}
+	}
+	input, ideal := []float64{0.7, -1.2, 0.4}, []float64{0.5, -0.3}
+	loss := func() float64 {
+		var sum float64
+		for i, v := range n.Predict(input) {
+			sum += 0.5 * math.Pow(v-ideal[i], 2)
+		}
+		return sum
+	}
+	derivative := func(p *float64) float64 {
+		const h = 1e-6
+		v := *p
+		*p = v + h
+		plus := loss()
+		*p = v - h
+		minus := loss()
+		*p = v
+		return (plus - minus) / (2 * h)
+	}
+
+	trainer := NewTrainer(NewSGD(0.1, 0, 0, false), 0)
+	trainer.internal = newTraining(n.Layers, n.Loss())
+	n.Forward(input)
+	trainer.calculateDeltas(n, ideal, 1)
+
+	for i, l := range n.Layers {
+		for j, neuron := range l.Neurons {
+			for _, s := range neuron.In {
+				assert.InDelta(t, derivative(&s.Weight), trainer.deltas[i][j]*s.In, 1e-6)
+			}
+			if l.Norm != nil {
+				assert.InDelta(t, derivative(&l.Norm.Gamma[j]), trainer.norms.gammas[i][j], 1e-6)
+				assert.InDelta(t, derivative(&l.Norm.Beta[j]), trainer.norms.betas[i][j], 1e-6)
+			}
+		}
+		assert.InDelta(t, derivative(&l.Alpha), trainer.alphas[i], 1e-6)
+	}
+}
+
+func Test_SkipGradient(t *testing.T) {
+	rand.Seed(0)
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     2,
+		Layout:     []int{3, 3, 3, 2},
+		Activation: deep.ActivationTanh,
+		Loss:       deep.LossMeanSquared,
+		Weight:     deep.NewNormal(1, 0),
+		Bias:       true,
+		Skips:      []deep.Skip{{From: 0, To: 1}, {From: 0, To: 2}, {From: 1, To: 2}},
+	})
+	input, ideal := []float64{0.7, -1.2}, []float64{0.5, -0.3}
+	loss := func() float64 {
+		var sum float64
+		for i, v := range n.Predict(input) {
+			sum += 0.5 * math.Pow(v-ideal[i], 2)
+		}
+		return sum
+	}
+
+	trainer := NewTrainer(NewSGD(0.1, 0, 0, false), 0)
+	trainer.internal = newTraining(n.Layers, n.Loss())
+	n.Forward(input)
+	trainer.calculateDeltas(n, ideal, 1)
+
+	const h = 1e-6
+	for i, l := range n.Layers {
+		for j, neuron := range l.Neurons {
+			for _, s := range neuron.In {
+				w := s.Weight
+				s.Weight = w + h
+				plus := loss()
+				s.Weight = w - h
+				minus := loss()
+				s.Weight = w
+				assert.InDelta(t, (plus-minus)/(2*h), trainer.deltas[i][j]*s.In, 1e-6)
+			}
+		}
+	}
+}
+
+func Test_FreezeLayer(t *testing.T) {
+	for _, trainer := range []Trainer{
+		NewTrainer(NewAdam(0.01, 0.9, 0.999, 1e-8), 0),
+		NewBatchTrainer(NewAdam(0.01, 0.9, 0.999, 1e-8), 0, 4, 2),
+	} {
+		rand.Seed(0)
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{4, 4, 1},
+			Activation: deep.ActivationPReLU,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.NewNormal(1, 0),
+			Bias:       true,
+			L2:         0.01,
+			LayerNorm:  []bool{false, true, false},
+		})
+		n.FreezeLayer(0)
+		n.FreezeLayer(1)
+		weights, alphas, norms := n.Weights(), n.Alphas(), n.Norms()
+
+		trainer.Train(n, Examples{
+			{Input: []float64{0, 1}, Response: []float64{1}},
+			{Input: []float64{1, 0}, Response: []float64{-1}},
+			{Input: []float64{1, 1}, Response: []float64{0.5}},
+		}, nil, 20)
+
+		trained := n.Weights()
+		assert.Equal(t, weights[:2], trained[:2])
+		assert.NotEqual(t, weights[2], trained[2])
+		assert.Equal(t, alphas[:2], n.Alphas()[:2])
+		assert.Equal(t, norms, n.Norms())
+
+		n.UnfreezeLayer(1)
+		trainer.Train(n, Examples{{Input: []float64{0, 1}, Response: []float64{1}}}, nil, 5)
+		assert.Equal(t, weights[0], n.Weights()[0])
+		assert.NotEqual(t, weights[1], n.Weights()[1])
+	}
+}
+
+func Test_PruneFineTuning(t *testing.T) {
+	// epsilon is the tolerated drop in validation accuracy
+	const epsilon = 0.03
+	rand.Seed(0)
+	sample := func() Example {
+		x, y := rand.Float64()*2-1, rand.Float64()*2-1
+		if x*x+y*y < 0.5 {
+			return Example{Input: []float64{x, y}, Response: []float64{1, 0}}
+		}
+		return Example{Input: []float64{x, y}, Response: []float64{0, 1}}
+	}
+	var train, validation Examples
+	for i := 0; i < 500; i++ {
+		train = append(train, sample())
+		validation = append(validation, sample())
+	}
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     2,
+		Layout:     []int{32, 32, 2},
+		Activation: deep.ActivationReLU,
+		Mode:       deep.ModeMultiClass,
+		Weight:     deep.WeightHe,
+		Bias:       true,
+	})
+	trainer := NewBatchTrainer(NewAdam(0.01, 0.9, 0.999, 1e-8), 0, 32, 2)
+	trainer.Train(n, train, nil, 100)
+	trained := accuracy(n, validation)
+
+	var magnitudes []float64
+	for _, l := range n.Layers {
+		for _, neuron := range l.Neurons {
+			for _, s := range neuron.In {
+				if !s.IsBias {
+					magnitudes = append(magnitudes, math.Abs(s.Weight))
+				}
+			}
+		}
+	}
+	sort.Float64s(magnitudes)
+	report := n.Prune(magnitudes[len(magnitudes)*4/5])
+	assert.InDelta(t, 0.8, report.Fraction(), 0.01)
+
+	trainer.Train(n, train, nil, 10)
+	assert.True(t, accuracy(n, validation) > trained-epsilon, "%f, %f", accuracy(n, validation), trained)
+	assert.Equal(t, report, n.Prune(0))
+	for _, l := range n.Layers {
+		for _, neuron := range l.Neurons {
+			for _, s := range neuron.In {
+				if s.Pruned {
+					assert.Equal(t, 0.0, s.Weight)
+				}
+			}
+		}
+	}
+}
+
+func Test_ConvGradient(t *testing.T) {
+	rand.Seed(0)
+	n := deep.NewNeural(&deep.Config{
+		Inputs:     7,
+		Layout:     []int{3, 2},
+		Activation: deep.ActivationTanh,
+		Loss:       deep.LossMeanSquared,
+		Weight:     deep.NewNormal(1, 0),
+		Bias:       true,
+		Conv:       &deep.Conv1D{Kernel: 3, Stride: 2, Filters: 2, Activation: deep.ActivationGELU},
+	})
+	input, ideal := []float64{0.1, -0.5, 0.8, 0.3, -1, 0.6, 0.2}, []float64{0.5, -0.3}
+	derivative := func(p *float64) float64 {
+		loss := func() float64 {
+			var sum float64
+			for i, v := range n.Predict(input) {
+				sum += 0.5 * math.Pow(v-ideal[i], 2)
+			}
+			return sum
+		}
+		const h = 1e-6
+		v := *p
+		*p = v + h
+		plus := loss()
+		*p = v - h
+		minus := loss()
+		*p = v
+		return (plus - minus) / (2 * h)
+	}
+
+	trainer := NewTrainer(NewSGD(0.1, 0, 0, false), 0)
+	trainer.internal = newTraining(n.Layers, n.Loss())
+	trainer.conv = newConvGradients(n)
+	n.Forward(input)
+	trainer.calculateDeltas(n, ideal, 1)
+	trainer.accumulate(n)
+
+	for f, kernel := range n.Conv.Kernels {
+		for k := range kernel {
+			assert.InDelta(t, derivative(&kernel[k]), trainer.conv.kernels[f][k], 1e-6)
+		}
+		assert.InDelta(t, derivative(&n.Conv.Biases[f]), trainer.conv.biases[f], 1e-6)
+	}
+}
+
+func Test_TrainContext(t *testing.T) {
+	data, network := parallelData()
+	type contextTrainer interface {
+		TrainContext(ctx context.Context, n *deep.Neural, examples, validation Examples, iterations int) error
+	}
+	trainers := map[string]func(...Option) contextTrainer{
+		"online": func(opts ...Option) contextTrainer { return NewTrainer(NewSGD(0.01, 0, 0, false), 0, opts...) },
+		"batch": func(opts ...Option) contextTrainer {
+			return NewBatchTrainer(NewSGD(0.01, 0, 0, false), 0, 8, 4, opts...)
+		},
+	}
+	for name, trainer := range trainers {
+		// cancelled after the second epoch, before the first example or
+		// batch of the third
+		ctx, cancel := context.WithCancel(context.Background())
+		var epochs []int
+		var ended error
+		n := network()
+		err := trainer(WithCallbacks(CallbackFuncs{
+			EpochEnd: func(epoch int, trainLoss, valLoss float64, n *deep.Neural) error {
+				epochs = append(epochs, epoch)
+				if epoch == 2 {
+					cancel()
+				}
+				return nil
+			},
+			TrainEnd: func(epoch int, n *deep.Neural, err error) { ended = err },
+		})).TrainContext(ctx, n, data, nil, 10)
+		assert.Equal(t, context.Canceled, err, name)
+		assert.Equal(t, context.Canceled, ended, name)
+		assert.Equal(t, []int{1, 2}, epochs, name)
+
+		// cancelled while training
+		goroutines := runtime.NumGoroutine()
+		ctx, cancel = context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		begun := time.Now()
+		n = network()
+		err = trainer().TrainContext(ctx, n, data, nil, 1e6)
+		assert.Equal(t, context.Canceled, err, name)
+		assert.True(t, time.Since(begun) < 2*time.Second, name)
+		assert.Equal(t, goroutines, runtime.NumGoroutine(), name)
+		for _, e := range data[:4] {
+			out := n.Predict(e.Input)
+			assert.Len(t, out, 1)
+			assert.False(t, math.IsNaN(out[0]), name)
+		}
+	}
+}
+
+func Test_InvalidExamples(t *testing.T) {
+	data, network := parallelData()
+	type contextTrainer interface {
+		Train(n *deep.Neural, examples, validation Examples, iterations int)
+		TrainContext(ctx context.Context, n *deep.Neural, examples, validation Examples, iterations int) error
+	}
+	for name, trainer := range map[string]contextTrainer{
+		"online": NewTrainer(NewSGD(0.01, 0, 0, false), 0),
+		"batch":  NewBatchTrainer(NewSGD(0.01, 0, 0, false), 0, 8, 4),
+	} {
+		n := network()
+		before := n.Weights()
+		good := data[3]
+		data[3] = Example{Input: good.Input[:1], Response: good.Response}
+		err := trainer.TrainContext(context.Background(), n, data, nil, 1)
+		assert.EqualError(t, err, fmt.Sprintf("example 3: input of 1 values, expected %d", len(good.Input)), name)
+		var size deep.ErrInputSize
+		assert.True(t, errors.As(err, &size), name)
+		assert.Panics(t, func() { trainer.Train(n, data, nil, 1) }, name)
+		data[3] = good
+
+		validation := Examples{good, {Input: []float64{good.Input[0], math.NaN()}, Response: good.Response}}
+		err = trainer.TrainContext(context.Background(), n, data, validation, 1)
+		assert.EqualError(t, err, "validation example 1: input 1 is not finite", name)
+		var nonFinite deep.ErrNonFiniteInput
+		assert.True(t, errors.As(err, &nonFinite), name)
+		assert.Equal(t, 1, nonFinite.Index, name)
+
+		good = data[5]
+		data[5] = Example{Input: good.Input, Response: []float64{}}
+		err = trainer.TrainContext(context.Background(), n, data, nil, 1)
+		assert.EqualError(t, err, "example 5: response of 0 values, expected 1", name)
+		assert.Panics(t, func() { trainer.Train(n, data, nil, 1) }, name)
+		data[5] = good
+		assert.Equal(t, before, n.Weights(), name)
+	}
+
+	// a loss that cannot train the network
+	for name, trainer := range map[string]contextTrainer{
+		"online": NewTrainer(NewSGD(0.01, 0, 0, false), 0, WithLoss(deep.NewWeightedCrossEntropy([]float64{1, 2}))),
+		"batch":  NewBatchTrainer(NewSGD(0.01, 0, 0, false), 0, 8, 4, WithLoss(deep.NewWeightedCrossEntropy([]float64{1, 2}))),
+	} {
+		n := network()
+		err := trainer.TrainContext(context.Background(), n, data, nil, 1)
+		assert.EqualError(t, err, "invalid loss: weighted cross entropy has 2 weights, network has 1 outputs", name)
+		assert.Panics(t, func() { trainer.Train(n, data, nil, 1) }, name)
+	}
+}
+
+func Test_Seed(t *testing.T) {
+	data := Examples{}
+	for i := 0.0; i < 1; i += 0.05 {
+		data = append(data, Example{Input: []float64{i, 1 - i}, Response: []float64{math.Sin(3 * i)}})
+	}
+	run := func(seed int64, batch bool) [][][]float64 {
+		// the global source must not matter
+		rand.Seed(time.Now().UnixNano())
+		n := deep.NewNeural(&deep.Config{
+			Inputs:     2,
+			Layout:     []int{8, 8, 1},
+			Activation: deep.ActivationTanh,
+			Mode:       deep.ModeRegression,
+			Weight:     deep.WeightXavier,
+			Dropout:    []float64{0.2, 0.2, 0},
+			Bias:       true,
+			Seed:       seed,
+		})
+		if batch {
+			NewBatchTrainer(NewAdam(0.01, 0, 0, 0), 0, 4, 3, WithSeed(seed)).Train(n, data, nil, 5)
+		} else {
+			NewTrainer(NewSGD(0.1, 0.5, 0, false), 0, WithSeed(seed)).Train(n, data, nil, 5)
+		}
+		return n.Weights()
+	}
+
+	for _, batch := range []bool{false, true} {
+		weights := run(1, batch)
+		assert.Equal(t, weights, run(1, batch), "batch %v", batch)
+		assert.NotEqual(t, weights, run(2, batch), "batch %v", batch)
+	}
+}
@@ -105,13 +105,43 @@ func Sum(xx []float64) (sum float64) {
 	return
 }
 
-// Softmax is the softmax function
+// compensated is a sum by Neumaier's variant of Kahan summation, whose
+// rounding error does not grow with the number of terms
+type compensated struct {
+	sum, c float64
+}
+
+func (s *compensated) add(v float64) {
+	t := s.sum + v
+	if math.Abs(s.sum) >= math.Abs(v) {
+		s.c += (s.sum - t) + v
+	} else {
+		s.c += (v - t) + s.sum
+	}
+	s.sum = t
+}
+
+// value returns the sum, or the infinity it overflowed to
+func (s compensated) value() float64 {
+	if math.IsInf(s.sum, 0) {
+		return s.sum
+	}
+	return s.sum + s.c
+}
+
+// Softmax is the softmax function, computed relative to the maximum so as
+// not to overflow. Infinite maxima share all of the probability.
 func Softmax(xx []float64) []float64 {
 	out := make([]float64, len(xx))
 	var sum float64
 	max := Max(xx)
 	for i, x := range xx {
-		out[i] = math.Exp(x - max)
+		if x == max {
+			// also where x - max is Inf - Inf
+			out[i] = 1
+		} else {
+			out[i] = math.Exp(x - max)
+		}
 		sum += out[i]
 	}
 	for i := range out {
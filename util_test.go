@@ -1,6 +1,7 @@
 package deep
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,6 +17,15 @@ func Test_softmax(t *testing.T) {
 	}
 }
 
+func Test_softmaxExtreme(t *testing.T) {
+	// infinite maxima share the probability rather than turn it into NaN
+	assert.Equal(t, []float64{0.5, 0, 0.5}, Softmax([]float64{math.Inf(1), 0, math.Inf(1)}))
+	assert.Equal(t, []float64{0.5, 0.5}, Softmax([]float64{math.Inf(-1), math.Inf(-1)}))
+
+	s := Softmax([]float64{1e308, -1e308, 1e308 - 1e292})
+	assert.InDelta(t, 1, Sum(s), 1e-12)
+}
+
 func Test_Standardize(t *testing.T) {
 
 	s := []float64{10.0, 5.0, 0.0}
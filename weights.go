@@ -1,27 +1,152 @@
 package deep
 
-import "math/rand"
+import (
+	"math"
+	"math/rand"
+)
+
+// An Initializer gives the initial weights of each layer
+type Initializer interface {
+	// Layer returns the initializer of the weights into a layer of
+	// fanOut neurons with fanIn inputs each
+	Layer(fanIn, fanOut int) WeightInitializer
+}
 
 // A WeightInitializer returns a (random) weight
 type WeightInitializer func() float64
 
-// NewUniform returns a uniform weight generator
-func NewUniform(stdDev, mean float64) WeightInitializer {
-	return func() float64 { return Uniform(stdDev, mean) }
+// Layer returns w for every layer
+func (w WeightInitializer) Layer(fanIn, fanOut int) WeightInitializer { return w }
+
+// A RandInitializer is an Initializer whose weights can be drawn from a
+// given source of randomness, as by Config.Seed
+type RandInitializer interface {
+	Initializer
+	// LayerFrom is Layer, drawing from r
+	LayerFrom(r *rand.Rand, fanIn, fanOut int) WeightInitializer
+}
+
+// A FanInitializer scales the initial weights of a layer by its fan-in and
+// fan-out, and initializes biases to zero
+type FanInitializer func(fanIn, fanOut int) WeightInitializer
+
+// Layer returns f(fanIn, fanOut)
+func (f FanInitializer) Layer(fanIn, fanOut int) WeightInitializer { return f(fanIn, fanOut) }
+
+// A Distribution draws a weight from r
+type Distribution func(r *rand.Rand) float64
+
+// Layer returns d drawing from the global source
+func (d Distribution) Layer(fanIn, fanOut int) WeightInitializer { return d.From(global) }
+
+// LayerFrom returns d drawing from r
+func (d Distribution) LayerFrom(r *rand.Rand, fanIn, fanOut int) WeightInitializer { return d.From(r) }
+
+// From returns the initializer of weights drawn from r
+func (d Distribution) From(r *rand.Rand) WeightInitializer {
+	return func() float64 { return d(r) }
+}
+
+// A FanDistribution is a FanInitializer of the distribution of the weights
+// of a layer
+type FanDistribution func(fanIn, fanOut int) Distribution
+
+// Layer returns f(fanIn, fanOut) drawing from the global source
+func (f FanDistribution) Layer(fanIn, fanOut int) WeightInitializer {
+	return f.LayerFrom(global, fanIn, fanOut)
+}
+
+// LayerFrom returns f(fanIn, fanOut) drawing from r
+func (f FanDistribution) LayerFrom(r *rand.Rand, fanIn, fanOut int) WeightInitializer {
+	return f(fanIn, fanOut).From(r)
+}
+
+// WeightLeCun samples weights from N(0, 1/fanIn), as required by
+// self-normalizing networks using ActivationSELU
+var WeightLeCun FanDistribution = func(fanIn, fanOut int) Distribution {
+	return NewNormal(math.Sqrt(1/float64(fanIn)), 0)
+}
+
+// WeightXavier samples weights from N(0, 2/(fanIn+fanOut)), the Glorot
+// initialization for sigmoid and tanh layers
+var WeightXavier FanDistribution = func(fanIn, fanOut int) Distribution {
+	return NewNormal(math.Sqrt(2/float64(fanIn+fanOut)), 0)
+}
+
+// WeightHe samples weights from N(0, 2/fanIn), which keeps the variance of
+// the sums of ReLU layers
+var WeightHe FanDistribution = func(fanIn, fanOut int) Distribution {
+	return NewNormal(math.Sqrt(2/float64(fanIn)), 0)
+}
+
+// seeded is a RandInitializer drawing from its own source
+type seeded struct {
+	RandInitializer
+	rand *rand.Rand
+}
+
+// Layer returns the initializer of a layer drawing from the source of s
+func (s seeded) Layer(fanIn, fanOut int) WeightInitializer {
+	return s.LayerFrom(s.rand, fanIn, fanOut)
+}
+
+// unset reports whether w is nil, or a nil function of one of the
+// initializer types
+func unset(w Initializer) bool {
+	switch w := w.(type) {
+	case nil:
+		return true
+	case WeightInitializer:
+		return w == nil
+	case FanInitializer:
+		return w == nil
+	case Distribution:
+		return w == nil
+	case FanDistribution:
+		return w == nil
+	}
+	return false
+}
+
+// biasInitializer returns the initializer of the biases of layers
+func biasInitializer(w Initializer) WeightInitializer {
+	switch w := w.(type) {
+	case WeightInitializer:
+		return w
+	case Distribution:
+		return w.From(global)
+	case seeded:
+		if d, ok := w.RandInitializer.(Distribution); ok {
+			return d.From(w.rand)
+		}
+	}
+	return func() float64 { return 0 }
+}
+
+// global draws from the global source of math/rand
+var global = rand.New(globalSource{})
+
+type globalSource struct{}
+
+func (globalSource) Int63() int64    { return rand.Int63() }
+func (globalSource) Seed(seed int64) { rand.Seed(seed) }
+
+// NewUniform returns a uniform weight distribution
+func NewUniform(stdDev, mean float64) Distribution {
+	return func(r *rand.Rand) float64 { return (r.Float64()-0.5)*stdDev + mean }
 }
 
 // Uniform samples a value from u(mean-stdDev/2,mean+stdDev/2)
 func Uniform(stdDev, mean float64) float64 {
-	return (rand.Float64()-0.5)*stdDev + mean
-
+	return NewUniform(stdDev, mean)(global)
 }
 
-// NewNormal returns a normal weight generator
-func NewNormal(stdDev, mean float64) WeightInitializer {
-	return func() float64 { return Normal(stdDev, mean) }
+// NewNormal returns a normal weight distribution
+func NewNormal(stdDev, mean float64) Distribution {
+	return func(r *rand.Rand) float64 { return r.NormFloat64()*stdDev + mean }
 }
 
 // Normal samples a value from N(μ, σ)
 func Normal(stdDev, mean float64) float64 {
-	return rand.NormFloat64()*stdDev + mean
+	return NewNormal(stdDev, mean)(global)
 }
@@ -0,0 +1,114 @@
+package deep
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WeightXavier(t *testing.T) {
+	rand.Seed(0)
+	n := NewNeural(&Config{
+		Inputs: 50,
+		Layout: []int{150, 10},
+		Weight: WeightXavier,
+		Bias:   true,
+	})
+
+	var weights []float64
+	for _, neuron := range n.Layers[0].Neurons {
+		for _, s := range neuron.In {
+			if !s.IsBias {
+				weights = append(weights, s.Weight)
+			}
+		}
+	}
+	assert.InDelta(t, math.Sqrt(2.0/200), StandardDeviation(weights), 0.005)
+	for _, biases := range n.Biases {
+		for _, b := range biases {
+			assert.Equal(t, 0.0, b.Weight)
+		}
+	}
+}
+
+func Test_WeightHe(t *testing.T) {
+	deviations := func(weight Initializer) []float64 {
+		rand.Seed(0)
+		n := NewNeural(&Config{
+			Inputs:     32,
+			Layout:     []int{32, 32, 32, 32, 32, 32},
+			Activation: ActivationReLU,
+			Mode:       ModeRegression,
+			Weight:     weight,
+		})
+		values := make([][]float64, len(n.Layers))
+		input := make([]float64, 32)
+		for i := 0; i < 200; i++ {
+			for j := range input {
+				input[j] = rand.NormFloat64()
+			}
+			n.Forward(input)
+			for l, layer := range n.Layers {
+				for _, neuron := range layer.Neurons {
+					values[l] = append(values[l], neuron.Value)
+				}
+			}
+		}
+		deviations := make([]float64, len(values))
+		for l, v := range values {
+			deviations[l] = StandardDeviation(v)
+		}
+		return deviations
+	}
+
+	// the output layer is linear
+	for _, d := range deviations(WeightHe)[:5] {
+		assert.True(t, d > 0.5 && d < 2, "%v", d)
+	}
+	// but collapse under a fixed scale
+	assert.True(t, deviations(NewUniform(0.5, 0))[4] < 0.1)
+}
+
+func Test_Seed(t *testing.T) {
+	network := func(seed int64, weight Initializer) *Neural {
+		return NewNeural(&Config{
+			Inputs:     3,
+			Layout:     []int{4, 2},
+			Activation: ActivationTanh,
+			Mode:       ModeMultiClass,
+			Weight:     weight,
+			Bias:       true,
+			Seed:       seed,
+		})
+	}
+
+	for _, weight := range []Initializer{NewNormal(1, 0), NewUniform(1, 0), WeightXavier} {
+		rand.Seed(1)
+		a := network(7, weight).Weights()
+		rand.Seed(2)
+		assert.Equal(t, a, network(7, weight).Weights(), "%T", weight)
+		assert.NotEqual(t, a, network(8, weight).Weights(), "%T", weight)
+	}
+
+	// the global source is drawn from as before
+	rand.Seed(0)
+	normal, uniform := Normal(2, 1), Uniform(2, 1)
+	rand.Seed(0)
+	assert.Equal(t, rand.NormFloat64()*2+1, normal)
+	assert.Equal(t, (rand.Float64()-0.5)*2+1, uniform)
+
+	custom := WeightInitializer(func() float64 { return rand.Float64() })
+	assert.Panics(t, func() { network(1, custom) })
+	assert.NotPanics(t, func() { network(0, custom) })
+}
+
+func Test_UnsetWeight(t *testing.T) {
+	for _, weight := range []Initializer{nil, WeightInitializer(nil), Distribution(nil), FanDistribution(nil), FanInitializer(nil)} {
+		rand.Seed(0)
+		n := NewNeural(&Config{Inputs: 2, Layout: []int{3, 1}, Weight: weight, Bias: true})
+		rand.Seed(0)
+		assert.Equal(t, NewNeural(&Config{Inputs: 2, Layout: []int{3, 1}, Bias: true}).Weights(), n.Weights(), "%T", weight)
+	}
+}